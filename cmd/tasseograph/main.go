@@ -3,14 +3,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/signalnine/tasseograph/internal/agent"
 	"github.com/signalnine/tasseograph/internal/collector"
 	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/fakellm"
+	"github.com/signalnine/tasseograph/internal/protocol"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +26,34 @@ var (
 	agentConfigPath     string
 	collectorConfigPath string
 	sendSummaryNow      bool
+	fakeLLMListen       string
+	fakeLLMRules        string
+	evalCorpus          string
+	evalOut             string
+	evalOpts            collector.EvalOptions
+	labelIssue          int
+	labelVerdict        string
+	labelSeverity       string
+	labelNote           string
+	labelAuthor         string
+	labelLimit          int
+	labelOut            string
+	silence             protocol.Silence
+	silenceStart        string
+	silenceEnd          string
+	silenceFor          time.Duration
+	migrateDryRun       bool
+	migrateTo           int
+	search              collector.SearchQuery
+	searchSince         string
+	searchUntil         string
+	exportSince         string
+	exportUntil         string
+	exportFormat        string
+	exportOut           string
+	importDB            string
+	backupTo            string
+	restoreFrom         string
 )
 
 var rootCmd = &cobra.Command{
@@ -56,7 +92,7 @@ var collectorCmd = &cobra.Command{
 		// configured window, then exit. Lets operators validate SMTP
 		// without waiting for the next scheduled tick.
 		if sendSummaryNow {
-			db, err := collector.NewDB(cfg.DBPath)
+			db, err := collector.OpenStore(cfg)
 			if err != nil {
 				return fmt.Errorf("open db: %w", err)
 			}
@@ -81,13 +117,595 @@ var collectorCmd = &cobra.Command{
 	},
 }
 
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the collector database schema",
+	Long: `Migrate the collector database schema to the latest version, or to
+--to N. The collector migrates on startup; this lets operators check what a
+new release will change (--dry-run) or step through it before deploying.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadCollectorConfig(collectorConfigPath)
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		from, ran, err := collector.MigrateStore(cfg, migrateTo, migrateDryRun)
+		for _, m := range ran {
+			verb := "applied"
+			if migrateDryRun {
+				verb = "would apply"
+			}
+			fmt.Printf("%s %3d  %s\n", verb, m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		to := from
+		if len(ran) > 0 {
+			to = ran[len(ran)-1].Version
+		}
+		switch {
+		case len(ran) == 0:
+			fmt.Printf("schema version %d, nothing to do\n", from)
+		case migrateDryRun:
+			fmt.Printf("schema version %d, would migrate to %d\n", from, to)
+		default:
+			fmt.Printf("schema version %d, migrated to %d\n", from, to)
+		}
+		return nil
+	},
+}
+
+var compactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Move stored dmesg text into compressed blobs",
+	Long: `Move the dmesg text of results stored before compressed blobs into
+them, drop blobs no result uses, and (on SQLite) vacuum the database so the
+file shrinks. New results are stored compressed already; this is a one-off
+for an upgraded database. On SQLite, stop the collector first: VACUUM needs
+the database to itself.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		stats, err := db.Compact()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("compacted %d results: %d bytes of dmesg text into %d bytes of new blobs\n", stats.Rows, stats.TextBytes, stats.BlobBytes)
+		fmt.Printf("database size %d -> %d bytes\n", stats.SizeBefore, stats.SizeAfter)
+		return nil
+	},
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the SQLite database while the collector runs",
+	Long: `Copy the SQLite database to --to with SQLite's online backup API: a
+consistent snapshot, taken while the collector keeps running. If --to is a
+directory the backup is named for the time, as scheduled backups are.
+Back up PostgreSQL with pg_dump.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadSQLiteConfig()
+		if err != nil {
+			return err
+		}
+		to := backupTo
+		if fi, err := os.Stat(to); err == nil && fi.IsDir() {
+			to = collector.BackupName(to)
+		}
+		if err := collector.BackupDB(cfg.DBPath, to); err != nil {
+			return err
+		}
+		fmt.Printf("backed up %s to %s\n", cfg.DBPath, to)
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Replace the SQLite database with a backup",
+	Long: `Replace the SQLite database with the backup --from, once the backup
+passes PRAGMA integrity_check and has a schema version this release can
+migrate; the collector migrates it on startup. The database it replaces is
+kept beside it with a .pre-restore suffix. Stop the collector first:
+restore refuses while the database is open.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadSQLiteConfig()
+		if err != nil {
+			return err
+		}
+		version, err := collector.RestoreDB(cfg.DBPath, restoreFrom)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("restored %s from %s (schema version %d)\n", cfg.DBPath, restoreFrom, version)
+		return nil
+	},
+}
+
+// loadSQLiteConfig loads the collector config, for the commands that work
+// on the SQLite file itself.
+func loadSQLiteConfig() (*config.CollectorConfig, error) {
+	cfg, err := config.LoadCollectorConfig(collectorConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	if cfg.DBDriver != "sqlite" {
+		return nil, errors.New("backup and restore are for SQLite; use pg_dump and pg_restore for PostgreSQL")
+	}
+	return cfg, nil
+}
+
+var fakeLLMCmd = &cobra.Command{
+	Use:   "fake-llm",
+	Short: "Run a scripted OpenAI/Anthropic-compatible LLM for testing",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var rules *fakellm.Rules
+		if fakeLLMRules != "" {
+			var err error
+			rules, err = fakellm.LoadRules(fakeLLMRules)
+			if err != nil {
+				return fmt.Errorf("load rules: %w", err)
+			}
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		return fakellm.Run(ctx, fakeLLMListen, rules)
+	},
+}
+
+var evalCmd = &cobra.Command{
+	Use:   "eval",
+	Short: "Score the configured LLM chain against a labeled corpus",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadCollectorConfig(collectorConfigPath)
+		if err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+		cases, err := collector.LoadCorpus(evalCorpus)
+		if err != nil {
+			return fmt.Errorf("load corpus: %w", err)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		report := collector.RunEval(ctx, collector.NewLLMClientFromConfig(cfg), cases, evalOpts)
+		report.WriteText(os.Stdout)
+		if evalOut != "" {
+			buf, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(evalOut, append(buf, '\n'), 0644); err != nil {
+				return fmt.Errorf("write report: %w", err)
+			}
+		}
+		return nil
+	},
+}
+
+// openCollectorDB opens the database of the collector configured at
+// collectorConfigPath.
+func openCollectorDB() (*config.CollectorConfig, collector.Store, error) {
+	cfg, err := config.LoadCollectorConfig(collectorConfigPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load config: %w", err)
+	}
+	db, err := collector.OpenStore(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open db: %w", err)
+	}
+	return cfg, db, nil
+}
+
+var labelCmd = &cobra.Command{
+	Use:   "label",
+	Short: "Record operator feedback on analysis results",
+}
+
+var labelAddCmd = &cobra.Command{
+	Use:   "add RESULT_ID",
+	Short: "Label a result, or one of its issues",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("result id: %w", err)
+		}
+		cfg, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		l := &protocol.Label{
+			ResultID: id,
+			Verdict:  labelVerdict,
+			Severity: labelSeverity,
+			Note:     labelNote,
+			Author:   labelAuthor,
+		}
+		if labelIssue >= 0 {
+			l.Issue = &labelIssue
+		}
+		if err := db.AddLabel(l); err != nil {
+			return err
+		}
+		// A running collector picks the label up within a minute; rebuild
+		// the rules now so they're right for the next result either way.
+		if err := db.RebuildSuppressions(cfg.SuppressAfter); err != nil {
+			return fmt.Errorf("rebuild suppressions: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "label %d: result %d (%s) marked %s\n", l.ID, l.ResultID, l.Hostname, l.Verdict)
+		return nil
+	},
+}
+
+var labelListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recent labels",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		labels, err := db.QueryLabels(labelLimit)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tRESULT\tHOST\tVERDICT\tISSUE\tNOTE")
+		for _, l := range labels {
+			verdict := l.Verdict
+			if l.Severity != "" {
+				verdict += " -> " + l.Severity
+			}
+			issue := "(whole result)"
+			if l.Issue != nil && len(l.Issues) == 1 {
+				issue = l.Issues[0].Summary
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n", l.ID, l.ResultID, l.Hostname, verdict, issue, l.Note)
+		}
+		return tw.Flush()
+	},
+}
+
+var labelSuppressionsCmd = &cobra.Command{
+	Use:   "suppressions",
+	Short: "List the suppression rules built from false-positive labels",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		rules, err := db.Suppressions()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "LABELS\tSINCE\tEXAMPLE\tSIGNATURE")
+		for _, r := range rules {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", r.FalsePositives, r.CreatedAt.Format("2006-01-02"), r.Example, r.Signature)
+		}
+		return tw.Flush()
+	},
+}
+
+var labelExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export labelled results as an eval corpus",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		out := os.Stdout
+		if labelOut != "" {
+			f, err := os.Create(labelOut)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		n, err := db.ExportCorpus(out)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported %d cases\n", n)
+		return nil
+	},
+}
+
+var silenceCmd = &cobra.Command{
+	Use:   "silence",
+	Short: "Mute expected errors during maintenance",
+}
+
+var silenceAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a silence",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if silenceStart != "" {
+			if silence.StartsAt, err = time.Parse(time.RFC3339, silenceStart); err != nil {
+				return fmt.Errorf("--start: %w", err)
+			}
+		}
+		switch {
+		case silenceEnd != "" && silenceFor != 0:
+			return fmt.Errorf("--end and --for are mutually exclusive")
+		case silenceEnd != "":
+			if silence.EndsAt, err = time.Parse(time.RFC3339, silenceEnd); err != nil {
+				return fmt.Errorf("--end: %w", err)
+			}
+		case silenceFor > 0:
+			start := silence.StartsAt
+			if start.IsZero() {
+				start = time.Now()
+			}
+			silence.EndsAt = start.Add(silenceFor)
+		default:
+			return fmt.Errorf("one of --end or --for is required")
+		}
+
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err := db.AddSilence(&silence); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "silence %d: until %s\n", silence.ID, silence.EndsAt.Local().Format(time.RFC3339))
+		return nil
+	},
+}
+
+var silenceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List current and scheduled silences",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		now := time.Now()
+		silences, err := db.QuerySilences(now, now.AddDate(100, 0, 0))
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tHOST\tCATEGORY\tSUMMARY\tSTARTS\tENDS\tREASON")
+		for _, s := range silences {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Hostname, s.Category, s.Summary,
+				s.StartsAt.Local().Format("2006-01-02 15:04"), s.EndsAt.Local().Format("2006-01-02 15:04"), s.Reason)
+		}
+		return tw.Flush()
+	},
+}
+
+var silenceExpireCmd = &cobra.Command{
+	Use:   "expire ID",
+	Short: "End a silence now",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("silence id: %w", err)
+		}
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		ok, err := db.ExpireSilence(id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("no active silence %d", id)
+		}
+		return nil
+	},
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search QUERY...",
+	Short: "Find results whose dmesg lines or issues contain the given words",
+	Long: `Find results whose dmesg lines or issues contain every word of QUERY.
+Quote a phrase to match it as written, e.g. tasseograph search '"AER: Uncorrected"'.
+Matches are shown between ** in each result's snippet, newest result first.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		search.Query = strings.Join(args, " ")
+		if searchSince != "" {
+			if search.Since, err = time.Parse(time.RFC3339, searchSince); err != nil {
+				return fmt.Errorf("--since: %w", err)
+			}
+		}
+		if searchUntil != "" {
+			if search.Until, err = time.Parse(time.RFC3339, searchUntil); err != nil {
+				return fmt.Errorf("--until: %w", err)
+			}
+		}
+
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		hits, err := db.Search(search)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "RESULT\tTIME\tHOST\tSTATUS\tSNIPPET")
+		for _, h := range hits {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", h.ResultID, h.Timestamp.Local().Format("2006-01-02 15:04"), h.Hostname, h.Status, h.Snippet)
+		}
+		return tw.Flush()
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export results as JSON Lines, CSV or Parquet",
+	Long: `Export the results whose time is in [--since, --until) in the order they
+were stored. JSON Lines has one result per line, as the API returns it, and
+can be loaded back with import. CSV and Parquet have one column per field,
+with issues, verdicts and suppressed issues as JSON.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var since, until time.Time
+		var err error
+		if exportSince != "" {
+			if since, err = time.Parse(time.RFC3339, exportSince); err != nil {
+				return fmt.Errorf("--since: %w", err)
+			}
+		}
+		if exportUntil != "" {
+			if until, err = time.Parse(time.RFC3339, exportUntil); err != nil {
+				return fmt.Errorf("--until: %w", err)
+			}
+		}
+
+		out := os.Stdout
+		if exportOut != "" {
+			f, err := os.Create(exportOut)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		w, err := collector.NewResultWriter(out, exportFormat)
+		if err != nil {
+			return err
+		}
+		_, db, err := openCollectorDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		n, err := db.ExportResults(since, until, w)
+		if err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported %d results\n", n)
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import ARCHIVE...",
+	Short: "Load archived results into a scratch database",
+	Long: `Load results from archive files, or directories of them, written by
+the collector's archive_dir or by export --format jsonl, into the SQLite
+database --db, creating it if need be. Results keep their ids; one already
+in the database is skipped. Point a copy of the collector config's db_path
+at the database to search it, or query it with sqlite3.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := collector.NewDB(importDB)
+		if err != nil {
+			return fmt.Errorf("open db: %w", err)
+		}
+		defer db.Close()
+		stats, err := db.ImportArchive(args)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("imported %d results from %d files, skipped %d repeats\n", stats.Results, stats.Files, stats.Repeated)
+		return nil
+	},
+}
+
 func init() {
 	agentCmd.Flags().StringVarP(&agentConfigPath, "config", "c", "/etc/tasseograph/agent.yaml", "path to config file")
-	collectorCmd.Flags().StringVarP(&collectorConfigPath, "config", "c", "/etc/tasseograph/collector.yaml", "path to config file")
+	collectorCmd.PersistentFlags().StringVarP(&collectorConfigPath, "config", "c", "/etc/tasseograph/collector.yaml", "path to config file")
 	collectorCmd.Flags().BoolVar(&sendSummaryNow, "send-summary-now", false, "build and email one digest covering summary_interval, then exit")
 
 	rootCmd.AddCommand(agentCmd)
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "list the migrations that would run, change nothing")
+	migrateCmd.Flags().IntVar(&migrateTo, "to", 0, "migrate to this schema version (default: the latest)")
+	backupCmd.Flags().StringVar(&backupTo, "to", "", "backup file, or directory to put it in")
+	backupCmd.MarkFlagRequired("to")
+	restoreCmd.Flags().StringVar(&restoreFrom, "from", "", "backup file to restore")
+	restoreCmd.MarkFlagRequired("from")
+	collectorCmd.AddCommand(migrateCmd, compactCmd, backupCmd, restoreCmd)
 	rootCmd.AddCommand(collectorCmd)
+
+	fakeLLMCmd.Flags().StringVar(&fakeLLMListen, "listen", ":8080", "listen address")
+	fakeLLMCmd.Flags().StringVar(&fakeLLMRules, "rules", "", "rules file (default: answer everything with status ok)")
+	rootCmd.AddCommand(fakeLLMCmd)
+
+	evalCmd.Flags().StringVarP(&collectorConfigPath, "config", "c", "/etc/tasseograph/collector.yaml", "collector config whose llm_endpoints are evaluated")
+	evalCmd.Flags().StringVar(&evalCorpus, "corpus", "eval/corpus.jsonl", "labeled corpus (JSON Lines)")
+	evalCmd.Flags().StringVar(&evalOut, "out", "", "also write the report as JSON to this file")
+	evalCmd.Flags().IntVar(&evalOpts.Concurrency, "concurrency", 4, "cases analyzed at once")
+	evalCmd.Flags().Float64Var(&evalOpts.PricePerMInput, "price-in", 0, "USD per million prompt tokens, for the cost estimate")
+	evalCmd.Flags().Float64Var(&evalOpts.PricePerMOutput, "price-out", 0, "USD per million completion tokens, for the cost estimate")
+	rootCmd.AddCommand(evalCmd)
+
+	labelCmd.PersistentFlags().StringVarP(&collectorConfigPath, "config", "c", "/etc/tasseograph/collector.yaml", "path to collector config file")
+	labelAddCmd.Flags().StringVar(&labelVerdict, "verdict", "", "true_positive, false_positive or wrong_severity")
+	labelAddCmd.Flags().IntVar(&labelIssue, "issue", -1, "index of the issue to label; -1 labels the whole result")
+	labelAddCmd.Flags().StringVar(&labelSeverity, "severity", "", "the right status (ok, warning or critical), with --verdict wrong_severity")
+	labelAddCmd.Flags().StringVar(&labelNote, "note", "", "free-text note")
+	labelAddCmd.Flags().StringVar(&labelAuthor, "author", os.Getenv("USER"), "who is labelling")
+	labelAddCmd.MarkFlagRequired("verdict")
+	labelListCmd.Flags().IntVar(&labelLimit, "limit", 20, "number of labels to show")
+	labelExportCmd.Flags().StringVar(&labelOut, "out", "", "write the corpus to this file (default: stdout)")
+	labelCmd.AddCommand(labelAddCmd, labelListCmd, labelSuppressionsCmd, labelExportCmd)
+	rootCmd.AddCommand(labelCmd)
+
+	silenceCmd.PersistentFlags().StringVarP(&collectorConfigPath, "config", "c", "/etc/tasseograph/collector.yaml", "path to collector config file")
+	silenceAddCmd.Flags().StringVar(&silence.Hostname, "host", "", "hostname glob, e.g. 'db-*'")
+	silenceAddCmd.Flags().StringVar(&silence.Category, "category", "", "issue category: memory, storage, network, thermal, driver or other")
+	silenceAddCmd.Flags().StringVar(&silence.Summary, "summary", "", "regexp matched against issue summaries")
+	silenceAddCmd.Flags().StringVar(&silenceStart, "start", "", "start time, RFC3339 (default: now)")
+	silenceAddCmd.Flags().StringVar(&silenceEnd, "end", "", "end time, RFC3339")
+	silenceAddCmd.Flags().DurationVar(&silenceFor, "for", 0, "how long from the start, e.g. 4h")
+	silenceAddCmd.Flags().StringVar(&silence.Reason, "reason", "", "why, e.g. 'DIMM swap, CHG-1234'")
+	silenceAddCmd.Flags().StringVar(&silence.Author, "author", os.Getenv("USER"), "who is adding it")
+	silenceAddCmd.MarkFlagRequired("reason")
+	silenceCmd.AddCommand(silenceAddCmd, silenceListCmd, silenceExpireCmd)
+	rootCmd.AddCommand(silenceCmd)
+
+	searchCmd.Flags().StringVarP(&collectorConfigPath, "config", "c", "/etc/tasseograph/collector.yaml", "path to collector config file")
+	searchCmd.Flags().StringVar(&search.Hostname, "host", "", "only results from this host")
+	searchCmd.Flags().StringVar(&searchSince, "since", "", "only results from this time on, RFC3339")
+	searchCmd.Flags().StringVar(&searchUntil, "until", "", "only results before this time, RFC3339")
+	searchCmd.Flags().IntVar(&search.Limit, "limit", 50, "maximum results to show")
+	rootCmd.AddCommand(searchCmd)
+
+	exportCmd.Flags().StringVarP(&collectorConfigPath, "config", "c", "/etc/tasseograph/collector.yaml", "path to collector config file")
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "only results from this time on, RFC3339")
+	exportCmd.Flags().StringVar(&exportUntil, "until", "", "only results before this time, RFC3339")
+	exportCmd.Flags().StringVar(&exportFormat, "format", collector.FormatJSONL, "jsonl, csv or parquet")
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "write the export to this file (default: stdout)")
+	rootCmd.AddCommand(exportCmd)
+
+	importCmd.Flags().StringVar(&importDB, "db", "", "SQLite database to load the results into")
+	importCmd.MarkFlagRequired("db")
+	rootCmd.AddCommand(importCmd)
 }
 
 func main() {
@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,12 +18,20 @@ import (
 	"github.com/signalnine/tasseograph/internal/protocol"
 )
 
-// Agent collects dmesg and sends to collector
+// Agent collects kernel and hardware logs and sends them to the collector
 type Agent struct {
-	cfg    *config.AgentConfig
-	client *http.Client
+	cfg     *config.AgentConfig
+	client  *http.Client
+	sources []Source
+
+	// lastSmart is when a SMART snapshot was last delivered. Kept in memory
+	// only: a restart just means one early snapshot.
+	lastSmart time.Time
 }
 
+// hardwareSource tags the delta carrying sysfs metrics and SMART snapshots.
+const hardwareSource = "hardware"
+
 // New creates a new agent
 func New(cfg *config.AgentConfig) *Agent {
 	transport := &http.Transport{}
@@ -30,19 +39,36 @@ func New(cfg *config.AgentConfig) *Agent {
 		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 
+	var sources []Source
+	for _, sc := range cfg.Sources {
+		sources = append(sources, NewSource(sc))
+	}
+	if len(sources) == 0 {
+		sources = defaultSources()
+	}
+	if cfg.RasdaemonDB != "" {
+		log.Printf("rasdaemon_db is deprecated: list it under sources as {type: rasdaemon, path: %s}", cfg.RasdaemonDB)
+		sources = append(sources, &rasdaemonSource{name: config.LegacyRasdaemonSource, path: cfg.RasdaemonDB})
+	}
+
 	return &Agent{
 		cfg: cfg,
 		client: &http.Client{
 			Timeout:   30 * time.Second,
 			Transport: transport,
 		},
+		sources: sources,
 	}
 }
 
 // Run starts the agent loop
 func (a *Agent) Run(ctx context.Context) error {
-	log.Printf("Agent starting: hostname=%s collector=%s interval=%s",
-		a.cfg.Hostname, a.cfg.CollectorURL, a.cfg.PollInterval)
+	names := make([]string, len(a.sources))
+	for i, src := range a.sources {
+		names[i] = src.Name()
+	}
+	log.Printf("Agent starting: hostname=%s collector=%s interval=%s sources=%s",
+		a.cfg.Hostname, a.cfg.CollectorURL, a.cfg.PollInterval, strings.Join(names, ","))
 
 	ticker := time.NewTicker(a.cfg.PollInterval)
 	defer ticker.Stop()
@@ -65,51 +91,104 @@ func (a *Agent) Run(ctx context.Context) error {
 	}
 }
 
+// collect polls every source, sending each one's new records as its own
+// delta, then sends hardware data. A failing source is reported but doesn't
+// hold back the others.
 func (a *Agent) collect(ctx context.Context) error {
-	// Read last timestamp
-	lastSeen, err := ReadLastTimestamp(a.cfg.StateFile)
+	cursors, err := ReadCursors(a.cfg.StateFile)
 	if err != nil {
 		return fmt.Errorf("read state: %w", err)
 	}
 
-	// Get dmesg
-	lines, err := GetDmesg()
-	if err != nil {
-		return fmt.Errorf("get dmesg: %w", err)
+	var errs []error
+	for _, src := range a.sources {
+		if err := a.collectSource(ctx, src, cursors); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+		}
 	}
-
-	// Filter to new lines
-	newLines, latestTs := FilterNewLines(lines, lastSeen)
-	if len(newLines) == 0 {
-		log.Printf("No new dmesg lines since %v", lastSeen)
-		return nil
+	if err := a.collectHardware(ctx); err != nil {
+		errs = append(errs, err)
 	}
+	return errors.Join(errs...)
+}
 
-	// Cap lines to prevent LLM cost explosion
-	origCount := len(newLines)
-	newLines, truncated := CapLines(newLines)
-	if truncated {
-		log.Printf("WARNING: Truncated to %d lines (was %d, dropped %d oldest)", MaxLines, origCount, origCount-MaxLines)
+// collectSource sends one source's new records and advances its cursor once
+// the collector has them. The level filter runs after the read so the cursor
+// still moves past records we chose not to send.
+func (a *Agent) collectSource(ctx context.Context, src Source, cursors map[string]string) error {
+	name := src.Name()
+	cursor := cursors[name]
+	records, next, err := src.Read(cursor)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
 	}
+	records = FilterMinLevel(records, a.cfg.MinLevelValue)
+
+	if len(records) > 0 {
+		// Cap lines to prevent LLM cost explosion
+		origCount := len(records)
+		var truncated bool
+		records, truncated = CapLines(records)
+		if truncated {
+			log.Printf("WARNING: %s: Truncated to %d lines (was %d, dropped %d oldest)", name, MaxLines, origCount, origCount-MaxLines)
+		}
 
-	log.Printf("Sending %d new dmesg lines", len(newLines))
+		log.Printf("Sending %d new lines from %s", len(records), name)
+		delta := protocol.DmesgDelta{
+			Hostname:  a.cfg.Hostname,
+			Timestamp: time.Now(),
+			Source:    name,
+			Records:   records,
+		}
+		if err := a.send(ctx, delta); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+	} else {
+		log.Printf("No new lines from %s at or above %s", name, protocol.LevelName(a.cfg.MinLevelValue))
+	}
 
-	// Send to collector
-	delta := protocol.DmesgDelta{
-		Hostname:  a.cfg.Hostname,
-		Timestamp: time.Now(),
-		Lines:     newLines,
+	if next == cursor {
+		return nil
 	}
+	cursors[name] = next
+	if err := WriteCursors(a.cfg.StateFile, cursors); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
 
-	if err := a.send(ctx, delta); err != nil {
-		return fmt.Errorf("send: %w", err)
+// collectHardware sends sysfs counters and, when due, SMART snapshots.
+// Counters ride along on every poll, quiet or not: the collector needs
+// consecutive samples to see a rate. SMART logs change slowly and reading
+// them wakes the drives, so they go out on their own, longer schedule.
+func (a *Agent) collectHardware(ctx context.Context) error {
+	var metrics []protocol.Metric
+	if a.cfg.HardwareMetrics {
+		metrics = CollectHardwareMetrics(sysfsRoot)
 	}
 
-	// Update state
-	if err := WriteLastTimestamp(a.cfg.StateFile, latestTs); err != nil {
-		return fmt.Errorf("write state: %w", err)
+	var smart []protocol.SmartSnapshot
+	smartDue := a.cfg.SmartInterval > 0 && time.Since(a.lastSmart) >= a.cfg.SmartInterval
+	if smartDue {
+		smart = CollectSmart(sysfsRoot)
 	}
 
+	if len(metrics) > 0 || len(smart) > 0 {
+		log.Printf("Sending %d hardware metrics, %d SMART snapshots", len(metrics), len(smart))
+		delta := protocol.DmesgDelta{
+			Hostname:  a.cfg.Hostname,
+			Timestamp: time.Now(),
+			Source:    hardwareSource,
+			Metrics:   metrics,
+			Smart:     smart,
+		}
+		if err := a.send(ctx, delta); err != nil {
+			return fmt.Errorf("%s: send: %w", hardwareSource, err)
+		}
+	}
+	if smartDue {
+		a.lastSmart = time.Now()
+	}
 	return nil
 }
 
@@ -6,8 +6,12 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
 )
 
 var timestampRe = regexp.MustCompile(`^\[([A-Za-z]{3} [A-Za-z]{3} [ \d]\d \d{2}:\d{2}:\d{2} \d{4})\]`)
@@ -25,21 +29,16 @@ func ParseDmesgTimestamp(line string) (time.Time, error) {
 	return time.ParseInLocation("Mon Jan _2 15:04:05 2006", matches[1], time.Local)
 }
 
-// FilterNewLines returns lines newer than lastSeen and the latest timestamp
-func FilterNewLines(lines []string, lastSeen time.Time) ([]string, time.Time) {
-	var filtered []string
+// FilterNewRecords returns records newer than lastSeen and the latest timestamp
+func FilterNewRecords(records []protocol.Record, lastSeen time.Time) ([]protocol.Record, time.Time) {
+	var filtered []protocol.Record
 	var latest time.Time
 
-	for _, line := range lines {
-		ts, err := ParseDmesgTimestamp(line)
-		if err != nil {
-			continue // skip lines without parseable timestamps
-		}
-
-		if ts.After(lastSeen) {
-			filtered = append(filtered, line)
-			if ts.After(latest) {
-				latest = ts
+	for _, r := range records {
+		if r.Timestamp.After(lastSeen) {
+			filtered = append(filtered, r)
+			if r.Timestamp.After(latest) {
+				latest = r.Timestamp
 			}
 		}
 	}
@@ -47,21 +46,288 @@ func FilterNewLines(lines []string, lastSeen time.Time) ([]string, time.Time) {
 	return filtered, latest
 }
 
+// FilterMinLevel drops records less severe than minLevel. Syslog levels count
+// down toward severity, so "less severe" means numerically greater.
+func FilterMinLevel(records []protocol.Record, minLevel int) []protocol.Record {
+	var kept []protocol.Record
+	for _, r := range records {
+		if r.Level <= minLevel {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
 // MaxLines caps how many lines we send to the LLM to control costs
 const MaxLines = 500
 
-// GetDmesg runs dmesg -T and returns the output lines
-// Uses LC_ALL=C for consistent timestamp format across locales
-func GetDmesg() ([]string, error) {
-	cmd := exec.Command("dmesg", "-T")
+// kmsgPath is the kernel's structured log device.
+var kmsgPath = "/dev/kmsg"
+
+// bootIDPath identifies the current boot; /dev/kmsg sequence numbers restart
+// at zero on every boot.
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// kmsgSource reads the kernel ring buffer from /dev/kmsg with priority,
+// facility and the SUBSYSTEM/DEVICE tags intact. Its cursor is
+// "<boot_id>:<seq>": the kernel's record sequence number is exact where
+// second-resolution timestamps collide, but only within one boot.
+type kmsgSource struct {
+	name string
+	path string
+}
+
+func (s *kmsgSource) Name() string { return s.name }
+
+func (s *kmsgSource) Read(cursor string) ([]protocol.Record, string, error) {
+	data, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return nil, cursor, err
+	}
+	entries, err := readKmsg(s.path)
+	if err != nil {
+		return nil, cursor, err
+	}
+	records, next := filterKmsg(entries, cursor, strings.TrimSpace(string(data)))
+	return records, next, nil
+}
+
+// kmsgEntry is a parsed /dev/kmsg record and its sequence number.
+type kmsgEntry struct {
+	protocol.Record
+	seq uint64
+}
+
+// filterKmsg keeps the entries after cursor. A cursor from another boot
+// means the host rebooted and everything buffered is new. A bare timestamp
+// is a state file from before per-source cursors and filters by time, once.
+func filterKmsg(entries []kmsgEntry, cursor, bootID string) ([]protocol.Record, string) {
+	if len(entries) == 0 {
+		return nil, cursor
+	}
+
+	var afterSeq uint64
+	sameBoot := false
+	var since time.Time
+	if id, seq, ok := strings.Cut(cursor, ":"); ok && id == bootID {
+		if n, err := strconv.ParseUint(seq, 10, 64); err == nil {
+			afterSeq, sameBoot = n, true
+		}
+	} else if ts, err := time.Parse(timestampFormat, cursor); err == nil {
+		since = ts
+	}
+
+	var records []protocol.Record
+	for _, e := range entries {
+		if sameBoot && e.seq <= afterSeq {
+			continue
+		}
+		if !sameBoot && !e.Timestamp.After(since) {
+			continue
+		}
+		records = append(records, e.Record)
+	}
+	return records, bootID + ":" + strconv.FormatUint(entries[len(entries)-1].seq, 10)
+}
+
+// dmesgSource runs `dmesg -T -x`, which decodes the same priority into a
+// text prefix. For kernels or containers where /dev/kmsg can't be opened.
+// Its cursor is the newest record timestamp.
+type dmesgSource struct {
+	name string
+}
+
+func (s *dmesgSource) Name() string { return s.name }
+
+func (s *dmesgSource) Read(cursor string) ([]protocol.Record, string, error) {
+	records, err := getDmesgDecoded()
+	if err != nil {
+		return nil, cursor, err
+	}
+	// An empty or corrupt cursor parses as the zero time: a fresh start.
+	lastSeen, _ := time.Parse(timestampFormat, cursor)
+	newRecords, latest := FilterNewRecords(records, lastSeen)
+	if len(newRecords) == 0 {
+		return nil, cursor, nil
+	}
+	return newRecords, latest.Format(timestampFormat), nil
+}
+
+// readKmsg drains every record currently buffered in /dev/kmsg. The device
+// is opened non-blocking and read with raw syscalls: an *os.File would park
+// on the runtime poller instead of returning EAGAIN at the end of the buffer.
+func readKmsg(path string) ([]kmsgEntry, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	boot, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []kmsgEntry
+	// Each read(2) returns exactly one record; the kernel caps them well
+	// under 8 KiB.
+	buf := make([]byte, 8192)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN || (err == nil && n == 0) {
+			break
+		}
+		if err == syscall.EPIPE {
+			// The ring buffer wrapped past our read position; the kernel
+			// has already advanced us to the oldest surviving record.
+			continue
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r, seq, ok := parseKmsgRecord(string(buf[:n]), boot); ok {
+			entries = append(entries, kmsgEntry{Record: r, seq: seq})
+		}
+	}
+	return entries, nil
+}
+
+// parseKmsgRecord decodes one /dev/kmsg record (see
+// Documentation/ABI/testing/dev-kmsg):
+//
+//	6,339,5140900,-;NET: Registered protocol family 10
+//	 SUBSYSTEM=net
+//	 DEVICE=n1
+//
+// The header carries the combined syslog priority, the record's sequence
+// number and a microsecond offset from boot, which we anchor to wall-clock
+// time via boot.
+func parseKmsgRecord(raw string, boot time.Time) (protocol.Record, uint64, bool) {
+	header, rest, ok := strings.Cut(raw, ";")
+	if !ok {
+		return protocol.Record{}, 0, false
+	}
+	fields := strings.Split(header, ",")
+	if len(fields) < 3 {
+		return protocol.Record{}, 0, false
+	}
+	pri, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return protocol.Record{}, 0, false
+	}
+	seq, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return protocol.Record{}, 0, false
+	}
+	usec, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return protocol.Record{}, 0, false
+	}
+
+	lines := strings.Split(strings.TrimRight(rest, "\n"), "\n")
+	r := protocol.Record{
+		Timestamp: boot.Add(time.Duration(usec) * time.Microsecond),
+		Level:     pri & 7,
+		Facility:  pri >> 3,
+		Message:   lines[0],
+	}
+	for _, l := range lines[1:] {
+		k, v, ok := strings.Cut(strings.TrimPrefix(l, " "), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "SUBSYSTEM":
+			r.Subsystem = v
+		case "DEVICE":
+			r.Device = v
+		}
+	}
+	return r, seq, true
+}
+
+// uptimePath is read to anchor /dev/kmsg's boot-relative timestamps.
+var uptimePath = "/proc/uptime"
+
+// bootTime estimates when the kernel booted. It's rounded to the second so
+// successive polls agree on the same anchor; otherwise ms-level jitter in
+// /proc/uptime would shift every record and defeat the last-seen cursor.
+// Like `dmesg -T`, the result drifts if the host has been suspended.
+func bootTime() (time.Time, error) {
+	data, err := os.ReadFile(uptimePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return time.Time{}, errors.New("empty " + uptimePath)
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	up := time.Duration(secs * float64(time.Second))
+	return time.Now().Add(-up).Round(time.Second), nil
+}
+
+// getDmesgDecoded runs dmesg -T -x and parses the decoded facility/level
+// prefix. Uses LC_ALL=C for consistent timestamp format across locales
+func getDmesgDecoded() ([]protocol.Record, error) {
+	cmd := exec.Command("dmesg", "-T", "-x")
 	cmd.Env = cLocaleEnv()
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, errors.New("dmesg command failed (check permissions or CAP_SYSLOG): " + err.Error())
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	return lines, nil
+	var records []protocol.Record
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if r, ok := parseDecodedLine(line); ok {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// parseDecodedLine parses one line of `dmesg -T -x` output:
+//
+//	kern  :err   : [Mon Feb  3 12:25:01 2026] EXT4-fs error (device sda1): ...
+//
+// Lines without a parseable prefix or timestamp are skipped, matching how
+// the plain `dmesg -T` reader treated them.
+func parseDecodedLine(line string) (protocol.Record, bool) {
+	fac, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return protocol.Record{}, false
+	}
+	lvl, rest, ok := strings.Cut(rest, ":")
+	if !ok {
+		return protocol.Record{}, false
+	}
+	facility, err := protocol.ParseFacility(fac)
+	if err != nil {
+		return protocol.Record{}, false
+	}
+	level, err := protocol.ParseLevel(lvl)
+	if err != nil {
+		return protocol.Record{}, false
+	}
+
+	rest = strings.TrimPrefix(rest, " ")
+	ts, err := ParseDmesgTimestamp(rest)
+	if err != nil {
+		return protocol.Record{}, false
+	}
+	msg := rest[strings.IndexByte(rest, ']')+1:]
+	return protocol.Record{
+		Timestamp: ts,
+		Level:     level,
+		Facility:  facility,
+		Message:   strings.TrimPrefix(msg, " "),
+	}, true
 }
 
 // cLocaleEnv returns the parent environment with any inherited locale
@@ -83,7 +349,7 @@ func cLocaleEnv() []string {
 
 // CapLines returns at most MaxLines from the end of the slice (most recent)
 // Returns true if lines were truncated
-func CapLines(lines []string) ([]string, bool) {
+func CapLines[T any](lines []T) ([]T, bool) {
 	if len(lines) <= MaxLines {
 		return lines, false
 	}
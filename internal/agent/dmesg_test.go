@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
 )
 
 func TestParseDmesgTimestamp(t *testing.T) {
@@ -46,28 +48,150 @@ func TestParseDmesgTimestampUsesLocalZone(t *testing.T) {
 	}
 }
 
-func TestFilterNewLines(t *testing.T) {
-	lines := []string{
-		"[Mon Feb  3 12:00:00 2026] old message",
-		"[Mon Feb  3 12:05:00 2026] newer message",
-		"[Mon Feb  3 12:10:00 2026] newest message",
+func TestFilterNewRecords(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, _ := time.ParseInLocation("Mon Jan _2 15:04:05 2006", s, time.Local)
+		return ts
+	}
+	records := []protocol.Record{
+		{Timestamp: at("Mon Feb  3 12:00:00 2026"), Message: "old message"},
+		{Timestamp: at("Mon Feb  3 12:05:00 2026"), Message: "newer message"},
+		{Timestamp: at("Mon Feb  3 12:10:00 2026"), Message: "newest message"},
 	}
 
-	// Parse the middle timestamp as "last seen"
-	lastSeen, _ := time.ParseInLocation("Mon Jan _2 15:04:05 2006", "Mon Feb  3 12:05:00 2026", time.Local)
-
-	filtered, latestTs := FilterNewLines(lines, lastSeen)
+	// The middle timestamp is "last seen"
+	filtered, latestTs := FilterNewRecords(records, at("Mon Feb  3 12:05:00 2026"))
 
 	if len(filtered) != 1 {
-		t.Errorf("FilterNewLines returned %d lines, want 1", len(filtered))
+		t.Errorf("FilterNewRecords returned %d records, want 1", len(filtered))
+	}
+	if len(filtered) > 0 && filtered[0].Message != "newest message" {
+		t.Errorf("FilterNewRecords returned wrong record: %q", filtered[0].Message)
+	}
+	if want := at("Mon Feb  3 12:10:00 2026"); !latestTs.Equal(want) {
+		t.Errorf("latestTs = %v, want %v", latestTs, want)
+	}
+}
+
+func TestFilterMinLevel(t *testing.T) {
+	records := []protocol.Record{
+		{Level: protocol.LevelEmerg, Message: "emerg"},
+		{Level: protocol.LevelWarning, Message: "warning"},
+		{Level: protocol.LevelInfo, Message: "info"},
+		{Level: protocol.LevelDebug, Message: "debug"},
+	}
+
+	kept := FilterMinLevel(records, protocol.LevelWarning)
+	if len(kept) != 2 || kept[0].Message != "emerg" || kept[1].Message != "warning" {
+		t.Errorf("FilterMinLevel(warning) = %+v, want emerg+warning", kept)
 	}
-	if len(filtered) > 0 && filtered[0] != "[Mon Feb  3 12:10:00 2026] newest message" {
-		t.Errorf("FilterNewLines returned wrong line: %q", filtered[0])
+	if kept := FilterMinLevel(records, protocol.LevelDebug); len(kept) != len(records) {
+		t.Errorf("FilterMinLevel(debug) kept %d, want all %d", len(kept), len(records))
 	}
+}
+
+func TestParseKmsgRecord(t *testing.T) {
+	boot := time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)
+	raw := "3,1204,5140900,-;pcieport 0000:00:1c.0: AER: Corrected error received\n SUBSYSTEM=pci\n DEVICE=+pci:0000:00:1c.0\n"
 
-	expectedLatest, _ := time.ParseInLocation("Mon Jan _2 15:04:05 2006", "Mon Feb  3 12:10:00 2026", time.Local)
-	if !latestTs.Equal(expectedLatest) {
-		t.Errorf("latestTs = %v, want %v", latestTs, expectedLatest)
+	r, seq, ok := parseKmsgRecord(raw, boot)
+	if !ok {
+		t.Fatal("parseKmsgRecord rejected a well-formed record")
+	}
+	if r.Level != protocol.LevelErr {
+		t.Errorf("Level = %d, want %d (err)", r.Level, protocol.LevelErr)
+	}
+	if seq != 1204 {
+		t.Errorf("seq = %d, want 1204", seq)
+	}
+	if r.Facility != 0 {
+		t.Errorf("Facility = %d, want 0 (kern)", r.Facility)
+	}
+	if want := boot.Add(5140900 * time.Microsecond); !r.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", r.Timestamp, want)
+	}
+	if r.Subsystem != "pci" || r.Device != "+pci:0000:00:1c.0" {
+		t.Errorf("tags = %q/%q, want pci/+pci:0000:00:1c.0", r.Subsystem, r.Device)
+	}
+	if r.Message != "pcieport 0000:00:1c.0: AER: Corrected error received" {
+		t.Errorf("Message = %q", r.Message)
+	}
+
+	// Userspace writes to /dev/kmsg carry a non-kern facility.
+	r, _, ok = parseKmsgRecord("30,1205,5200000,-;systemd[1]: Started foo.service\n", boot)
+	if !ok || r.Facility != 3 || r.Level != protocol.LevelInfo {
+		t.Errorf("daemon.info record = %+v ok=%v, want facility 3 level 6", r, ok)
+	}
+
+	for _, bad := range []string{"", "no header", "x,1,2,-;msg", "6,1;msg"} {
+		if _, _, ok := parseKmsgRecord(bad, boot); ok {
+			t.Errorf("parseKmsgRecord(%q) accepted malformed record", bad)
+		}
+	}
+}
+
+func TestFilterKmsg(t *testing.T) {
+	base := time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)
+	entries := []kmsgEntry{
+		{Record: protocol.Record{Timestamp: base, Message: "a"}, seq: 10},
+		{Record: protocol.Record{Timestamp: base.Add(time.Second), Message: "b"}, seq: 11},
+		{Record: protocol.Record{Timestamp: base.Add(time.Second), Message: "c"}, seq: 12},
+	}
+
+	// Fresh start: everything, cursor at the last sequence number.
+	got, next := filterKmsg(entries, "", "boot-a")
+	if len(got) != 3 || next != "boot-a:12" {
+		t.Errorf("fresh = %d records, cursor %q; want 3, boot-a:12", len(got), next)
+	}
+
+	// Same boot: only records after the sequence number, even though b and
+	// c share a timestamp.
+	got, next = filterKmsg(entries, "boot-a:11", "boot-a")
+	if len(got) != 1 || got[0].Message != "c" || next != "boot-a:12" {
+		t.Errorf("same boot = %+v, cursor %q; want just c", got, next)
+	}
+
+	// A cursor from a previous boot: sequence numbers restarted, so all new.
+	if got, _ := filterKmsg(entries, "boot-z:500", "boot-a"); len(got) != 3 {
+		t.Errorf("after reboot got %d records, want 3", len(got))
+	}
+
+	// A legacy timestamp cursor filters by time.
+	if got, _ := filterKmsg(entries, base.Format(timestampFormat), "boot-a"); len(got) != 2 {
+		t.Errorf("legacy cursor got %d records, want 2", len(got))
+	}
+
+	// Nothing buffered: the cursor holds.
+	if _, next := filterKmsg(nil, "boot-a:12", "boot-a"); next != "boot-a:12" {
+		t.Errorf("empty read moved cursor to %q", next)
+	}
+}
+
+func TestParseDecodedLine(t *testing.T) {
+	r, ok := parseDecodedLine("kern  :err   : [Mon Feb  3 12:25:01 2026] EXT4-fs error (device sda1): bad block")
+	if !ok {
+		t.Fatal("parseDecodedLine rejected a well-formed line")
+	}
+	if r.Level != protocol.LevelErr || r.Facility != 0 {
+		t.Errorf("level/facility = %d/%d, want err/kern", r.Level, r.Facility)
+	}
+	if r.Message != "EXT4-fs error (device sda1): bad block" {
+		t.Errorf("Message = %q", r.Message)
+	}
+	want, _ := time.ParseInLocation("Mon Jan _2 15:04:05 2006", "Mon Feb  3 12:25:01 2026", time.Local)
+	if !r.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", r.Timestamp, want)
+	}
+
+	for _, bad := range []string{
+		"",
+		"[Mon Feb  3 12:25:01 2026] plain dmesg -T line",
+		"kern  :bogus : [Mon Feb  3 12:25:01 2026] unknown level",
+		"kern  :info  : no timestamp",
+	} {
+		if _, ok := parseDecodedLine(bad); ok {
+			t.Errorf("parseDecodedLine(%q) accepted malformed line", bad)
+		}
 	}
 }
 
@@ -0,0 +1,311 @@
+// internal/agent/filesource.go
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+const (
+	// fileFirstReadBytes bounds how far back a file source starts the first
+	// time it sees a file, so enabling one on a host with a year of kern.log
+	// sends recent history rather than reading the whole file.
+	fileFirstReadBytes = 256 << 10
+	// fileMaxReadBytes caps one poll's read; the rest is picked up next poll.
+	fileMaxReadBytes = 4 << 20
+)
+
+// Syslog facilities file sources assign to lines that don't carry one.
+const (
+	facilityKern   = 0
+	facilityUser   = 1
+	facilityDaemon = 3
+)
+
+// fileCursor is a file source's position: which file (by inode, so a
+// rotated-away file is recognised) and how far into it we've consumed.
+type fileCursor struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// fileSource tails a text log such as /var/log/kern.log or a BMC SEL dump.
+// Only complete lines are consumed; a line still being written is left for
+// the next poll.
+type fileSource struct {
+	name   string
+	path   string
+	format string // syslog, sel or raw
+	level  int    // for lines whose format doesn't carry a level
+}
+
+func (s *fileSource) Name() string { return s.name }
+
+func (s *fileSource) Read(cursor string) ([]protocol.Record, string, error) {
+	fi, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		// Not created yet, or mid-rotation; try again next poll.
+		return nil, cursor, nil
+	}
+	if err != nil {
+		return nil, cursor, err
+	}
+	inode := fileInode(fi)
+
+	var c fileCursor
+	if cursor != "" {
+		json.Unmarshal([]byte(cursor), &c)
+	}
+
+	var lines []string
+	skipPartial := false
+	switch {
+	case c.Inode == 0:
+		// First sight (or a corrupt cursor).
+		c = fileCursor{Inode: inode, Offset: max(0, fi.Size()-fileFirstReadBytes)}
+		skipPartial = c.Offset > 0
+	case c.Inode != inode:
+		// Rotated: the file we were reading was renamed away. Finish it if
+		// logrotate left it uncompressed at path.1, then start the new one
+		// from the top.
+		if old, err := os.Stat(s.path + ".1"); err == nil && fileInode(old) == c.Inode {
+			tail, _, err := readLinesFrom(s.path+".1", c.Offset, false)
+			if err != nil {
+				return nil, cursor, err
+			}
+			lines = append(lines, tail...)
+		}
+		c = fileCursor{Inode: inode}
+	case fi.Size() < c.Offset:
+		// Truncated in place (copytruncate): everything is new.
+		c.Offset = 0
+	}
+
+	more, offset, err := readLinesFrom(s.path, c.Offset, skipPartial)
+	if err != nil {
+		return nil, cursor, err
+	}
+	lines = append(lines, more...)
+	c.Offset = offset
+
+	now := time.Now()
+	var records []protocol.Record
+	for _, line := range lines {
+		if r, ok := parseFileLine(s.format, line, s.level, now); ok {
+			records = append(records, r)
+		}
+	}
+	next, err := json.Marshal(c)
+	if err != nil {
+		return nil, cursor, err
+	}
+	return records, string(next), nil
+}
+
+// readLinesFrom returns the complete lines after offset and the offset just
+// past the last one. With skipPartial, offset is a guess that may fall
+// mid-line, so everything up to the first line break is dropped -- unless
+// the byte before offset is that line break, in which case offset starts a
+// whole line.
+//
+// A line with no break in a whole read's worth of bytes would otherwise be
+// re-read every poll: it is cut to fileMaxLineBytes, marked, and skipped to
+// its end.
+func readLinesFrom(path string, offset int64, skipPartial bool) ([]string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	start := offset
+	if skipPartial && offset > 0 {
+		start = offset - 1
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, fileMaxReadBytes))
+	if err != nil {
+		return nil, offset, err
+	}
+
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		if len(data) < fileMaxReadBytes {
+			// The line is still being written.
+			return nil, offset, nil
+		}
+		next, err := skipLine(f, start+int64(len(data)))
+		if err != nil || skipPartial {
+			// A partial line's head is as good as lost.
+			return nil, next, err
+		}
+		return []string{truncateLine(string(data))}, next, nil
+	}
+	data = data[:end+1]
+	next := start + int64(len(data))
+	if skipPartial {
+		_, data, _ = bytes.Cut(data, []byte("\n"))
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil, next, nil
+	}
+	return strings.Split(text, "\n"), next, nil
+}
+
+// fileMaxLineBytes is how much of an overlong line a file source keeps.
+const fileMaxLineBytes = 64 << 10
+
+// truncateLine cuts line to fileMaxLineBytes, on a UTF-8 boundary, and
+// marks it as cut.
+func truncateLine(line string) string {
+	cut := fileMaxLineBytes
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + " [truncated]"
+}
+
+// skipLine reads on from pos, which f is at, to the end of the line, and
+// returns the offset after it; or the end of the file, if the line isn't
+// finished yet.
+func skipLine(f *os.File, pos int64) (int64, error) {
+	r := bufio.NewReader(f)
+	for {
+		chunk, err := r.ReadSlice('\n')
+		pos += int64(len(chunk))
+		switch err {
+		case nil, io.EOF:
+			return pos, nil
+		case bufio.ErrBufferFull:
+		default:
+			return pos, err
+		}
+	}
+}
+
+// parseFileLine turns one line into a Record according to the source's
+// format. Blank lines are skipped; a line whose timestamp can't be parsed
+// is kept and stamped with the read time rather than dropped.
+func parseFileLine(format, line string, level int, now time.Time) (protocol.Record, bool) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return protocol.Record{}, false
+	}
+	switch format {
+	case "syslog":
+		return parseSyslogFileLine(line, level, now), true
+	case "sel":
+		return parseSELLine(line, level, now), true
+	default:
+		return protocol.Record{Timestamp: now, Level: level, Facility: facilityUser, Message: line}, true
+	}
+}
+
+// parseSyslogFileLine parses a line as written by rsyslog/syslog-ng, in
+// either the traditional or the high-precision timestamp format:
+//
+//	Feb  3 12:25:01 host kernel: [ 5140.900000] EXT4-fs error ...
+//	2026-02-03T12:25:01.123456+00:00 host kernel: EXT4-fs error ...
+//
+// The default templates don't record priority, so the level is the
+// source's configured one. Lines tagged "kernel:" are kern facility with
+// the tag and printk timestamp stripped, matching what kmsg sends.
+func parseSyslogFileLine(line string, level int, now time.Time) protocol.Record {
+	r := protocol.Record{Timestamp: now, Level: level, Facility: facilityUser, Message: line}
+
+	var rest string
+	if first, after, ok := strings.Cut(line, " "); ok {
+		if ts, err := time.Parse(time.RFC3339Nano, first); err == nil {
+			r.Timestamp, rest = ts, after
+		}
+	}
+	if rest == "" && len(line) > 16 {
+		if ts, err := time.ParseInLocation(time.Stamp, line[:15], time.Local); err == nil {
+			// The traditional format has no year. Assume this year unless
+			// that puts the line in the future (read across New Year).
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			r.Timestamp, rest = ts, line[16:]
+		}
+	}
+	if rest == "" {
+		return r
+	}
+
+	// Drop the hostname field; the delta already carries it.
+	if _, msg, ok := strings.Cut(rest, " "); ok {
+		rest = msg
+	}
+	if msg, ok := strings.CutPrefix(rest, "kernel: "); ok {
+		r.Facility = facilityKern
+		if strings.HasPrefix(msg, "[") {
+			if i := strings.IndexByte(msg, ']'); i > 0 {
+				msg = strings.TrimPrefix(msg[i+1:], " ")
+			}
+		}
+		rest = msg
+	}
+	r.Message = rest
+	return r
+}
+
+// parseSELLine parses one line of `ipmitool sel elist`:
+//
+//	1f | 02/03/2026 | 12:25:01 | Memory #0x01 | Correctable ECC | Asserted
+//
+// The SEL has no syslog level, so one is inferred from the event text;
+// anything unrecognised gets the source's configured level.
+func parseSELLine(line string, level int, now time.Time) protocol.Record {
+	fields := strings.Split(line, "|")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 5 {
+		return protocol.Record{Timestamp: now, Level: level, Facility: facilityDaemon, Subsystem: "ipmi:sel", Message: line}
+	}
+
+	ts, err := time.ParseInLocation("01/02/2006 15:04:05", fields[1]+" "+fields[2], time.Local)
+	if err != nil {
+		// "Pre-Init" entries are logged before the BMC's clock is set.
+		ts = now
+	}
+	event := strings.Join(fields[4:], " | ")
+	return protocol.Record{
+		Timestamp: ts,
+		Level:     selLevel(event, level),
+		Facility:  facilityDaemon,
+		Subsystem: "ipmi:sel",
+		Device:    fields[3],
+		Message:   "SEL " + fields[3] + ": " + event,
+	}
+}
+
+// selLevel maps SEL event text onto a syslog level.
+func selLevel(event string, fallback int) int {
+	e := strings.ToLower(event)
+	switch {
+	case strings.Contains(e, "deasserted"):
+		return protocol.LevelNotice
+	case strings.Contains(e, "uncorrectable"), strings.Contains(e, "non-recoverable"),
+		strings.Contains(e, "fatal"), strings.Contains(e, "fail"):
+		return protocol.LevelCrit
+	case strings.Contains(e, "non-critical"), strings.Contains(e, "correctable"),
+		strings.Contains(e, "predictive"), strings.Contains(e, "degraded"):
+		return protocol.LevelWarning
+	case strings.Contains(e, "critical"):
+		return protocol.LevelCrit
+	}
+	return fallback
+}
@@ -0,0 +1,13 @@
+// internal/agent/filesource_other.go
+//go:build !unix
+
+package agent
+
+import "os"
+
+// fileInode has no inode to go on here, so every file looks like the
+// same one: a rotation reads as the file being truncated, and is caught
+// by its shrinking. Not 0, which marks a fresh cursor.
+func fileInode(fi os.FileInfo) uint64 {
+	return 1
+}
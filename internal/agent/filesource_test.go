@@ -0,0 +1,246 @@
+// internal/agent/filesource_test.go
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func appendFile(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func messages(records []protocol.Record) []string {
+	out := make([]string, len(records))
+	for i, r := range records {
+		out[i] = r.Message
+	}
+	return out
+}
+
+func TestFileSourceTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kern.log")
+	src := &fileSource{name: "file:" + path, path: path, format: "raw", level: protocol.LevelNotice}
+
+	// Not there yet: no records, cursor untouched.
+	records, cursor, err := src.Read("")
+	if err != nil || len(records) != 0 || cursor != "" {
+		t.Fatalf("missing file = %v, %q, %v", records, cursor, err)
+	}
+
+	appendFile(t, path, "one\ntwo\npart")
+	records, cursor, err = src.Read(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(records); len(got) != 2 || got[0] != "one" || got[1] != "two" {
+		t.Errorf("first read = %q, want one, two (partial line held back)", got)
+	}
+
+	appendFile(t, path, "ial\nthree\n")
+	records, cursor, err = src.Read(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(records); len(got) != 2 || got[0] != "partial" || got[1] != "three" {
+		t.Errorf("second read = %q, want partial, three", got)
+	}
+
+	// Nothing new.
+	records, next, err := src.Read(cursor)
+	if err != nil || len(records) != 0 || next != cursor {
+		t.Errorf("idle read = %v, cursor moved %v", records, next != cursor)
+	}
+}
+
+func TestFileSourceRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kern.log")
+	src := &fileSource{name: "file:" + path, path: path, format: "raw", level: protocol.LevelNotice}
+
+	appendFile(t, path, "old-1\n")
+	_, cursor, err := src.Read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A line lands just before logrotate renames the file away.
+	appendFile(t, path, "old-2\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "new-1\n")
+
+	records, cursor, err := src.Read(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(records); len(got) != 2 || got[0] != "old-2" || got[1] != "new-1" {
+		t.Errorf("after rotation = %q, want old-2, new-1", got)
+	}
+
+	// copytruncate: same inode, shorter file.
+	if err := os.WriteFile(path, []byte("t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, _, err = src.Read(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(records); len(got) != 1 || got[0] != "t" {
+		t.Errorf("after truncation = %q, want t", got)
+	}
+}
+
+func TestFileSourceFirstReadSkipsOldHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kern.log")
+	line := make([]byte, 1023)
+	for i := range line {
+		line[i] = 'x'
+	}
+	for i := 0; i < 2*fileFirstReadBytes/1024; i++ {
+		appendFile(t, path, string(line)+"\n")
+	}
+	appendFile(t, path, "recent\n")
+
+	src := &fileSource{name: "f", path: path, format: "raw"}
+	records, _, err := src.Read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(records); n == 0 || n > fileFirstReadBytes/1024+1 {
+		t.Errorf("first read returned %d lines, want about %d", n, fileFirstReadBytes/1024)
+	}
+	if records[len(records)-1].Message != "recent" {
+		t.Errorf("last line = %q, want recent", records[len(records)-1].Message)
+	}
+	for _, r := range records {
+		if r.Message != "recent" && len(r.Message) != 1023 {
+			t.Errorf("partial line leaked into first read: %d bytes", len(r.Message))
+		}
+	}
+}
+
+// TestFileSourceFirstReadOnLineBoundary checks a first read whose start
+// falls exactly on a line boundary keeps that line.
+func TestFileSourceFirstReadOnLineBoundary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kern.log")
+	line := strings.Repeat("x", 1023) + "\n"
+	for i := 0; i < fileFirstReadBytes/1024+10; i++ {
+		appendFile(t, path, line)
+	}
+
+	src := &fileSource{name: "f", path: path, format: "raw"}
+	records, _, err := src.Read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(records); n != fileFirstReadBytes/1024 {
+		t.Errorf("first read returned %d lines, want %d", n, fileFirstReadBytes/1024)
+	}
+}
+
+// TestFileSourceOverlongLine checks a line longer than a whole read is cut
+// and passed, not re-read every poll.
+func TestFileSourceOverlongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kern.log")
+	src := &fileSource{name: "f", path: path, format: "raw"}
+	appendFile(t, path, "before\n")
+	_, cursor, err := src.Read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two-byte runes, offset by one, so the cut falls inside one.
+	appendFile(t, path, "x"+strings.Repeat("é", fileMaxReadBytes)+"\nafter\n")
+	records, cursor, err := src.Read(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("read %d records, want the cut line", len(records))
+	}
+	msg := records[0].Message
+	if !strings.HasSuffix(msg, " [truncated]") || len(msg) > fileMaxLineBytes+len(" [truncated]") || !utf8.ValidString(msg) {
+		t.Errorf("cut line: %d bytes, valid UTF-8 %v, ends %q", len(msg), utf8.ValidString(msg), msg[len(msg)-20:])
+	}
+
+	records, _, err = src.Read(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messages(records); len(got) != 1 || got[0] != "after" {
+		t.Errorf("next read = %d lines, want just after", len(got))
+	}
+}
+
+func TestParseSyslogFileLine(t *testing.T) {
+	now := time.Date(2026, 2, 3, 13, 0, 0, 0, time.Local)
+
+	r := parseSyslogFileLine("Feb  3 12:25:01 web01 kernel: [ 5140.900000] EXT4-fs error (device sda1): bad block", protocol.LevelNotice, now)
+	if r.Facility != 0 || r.Message != "EXT4-fs error (device sda1): bad block" {
+		t.Errorf("kernel line = facility %d msg %q", r.Facility, r.Message)
+	}
+	if want := time.Date(2026, 2, 3, 12, 25, 1, 0, time.Local); !r.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", r.Timestamp, want)
+	}
+	if r.Level != protocol.LevelNotice {
+		t.Errorf("Level = %d, want configured notice", r.Level)
+	}
+
+	r = parseSyslogFileLine("2026-02-03T12:25:01.5+00:00 web01 sshd[812]: Accepted publickey", protocol.LevelInfo, now)
+	if r.Facility != 1 || r.Message != "sshd[812]: Accepted publickey" || r.Timestamp.UTC().Hour() != 12 {
+		t.Errorf("high-precision line = %+v", r)
+	}
+
+	// A December line read in January belongs to last year.
+	jan := time.Date(2027, 1, 1, 0, 5, 0, 0, time.Local)
+	r = parseSyslogFileLine("Dec 31 23:59:59 web01 kernel: late", protocol.LevelInfo, jan)
+	if r.Timestamp.Year() != 2026 {
+		t.Errorf("year rollover: got %v", r.Timestamp)
+	}
+
+	// Unparseable: kept whole, stamped with the read time.
+	r = parseSyslogFileLine("garbage without timestamp", protocol.LevelInfo, now)
+	if r.Message != "garbage without timestamp" || !r.Timestamp.Equal(now) {
+		t.Errorf("unparseable line = %+v", r)
+	}
+}
+
+func TestParseSELLine(t *testing.T) {
+	now := time.Now()
+	r := parseSELLine("  1f | 02/03/2026 | 12:25:01 | Memory #0x01 | Correctable ECC logging limit reached | Asserted", protocol.LevelNotice, now)
+	if r.Level != protocol.LevelWarning || r.Subsystem != "ipmi:sel" || r.Device != "Memory #0x01" {
+		t.Errorf("correctable ECC = %+v", r)
+	}
+	if r.Timestamp.Format("2006-01-02 15:04:05") != "2026-02-03 12:25:01" {
+		t.Errorf("Timestamp = %v", r.Timestamp)
+	}
+
+	cases := map[string]int{
+		"   2 | 02/03/2026 | 12:26:00 | Memory #0x02 | Uncorrectable ECC | Asserted":           protocol.LevelCrit,
+		"   3 | 02/03/2026 | 12:27:00 | Power Supply #0x51 | Failure detected | Asserted":      protocol.LevelCrit,
+		"   4 | 02/03/2026 | 12:28:00 | Temp #0x30 | Upper Non-critical going high | Asserted": protocol.LevelWarning,
+		"   5 | 02/03/2026 | 12:29:00 | Temp #0x30 | Upper Critical going high | Asserted":     protocol.LevelCrit,
+		"   6 | 02/03/2026 | 12:30:00 | Power Supply #0x51 | Failure detected | Deasserted":    protocol.LevelNotice,
+		"   7 | Pre-Init  | 0000000005 | System Event #0x83 | Timestamp Clock Sync | Asserted": protocol.LevelInfo,
+	}
+	for line, want := range cases {
+		if got := parseSELLine(line, protocol.LevelInfo, now); got.Level != want {
+			t.Errorf("%q: level %d, want %d", line, got.Level, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// internal/agent/filesource_unix.go
+//go:build unix
+
+package agent
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode number, which survives a rename and so tells
+// rotation apart from a file that merely grew.
+func fileInode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,170 @@
+// internal/agent/hwmetrics.go
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// sysfsRoot is the sysfs mount the agent samples. CollectHardwareMetrics
+// takes the root as an argument so tests can hand it a fixture tree.
+const sysfsRoot = "/sys"
+
+// CollectHardwareMetrics samples error counters and temperatures that the
+// kernel exposes in sysfs but rarely logs: EDAC corrected/uncorrected counts
+// per DIMM, PCIe AER totals per device, and hwmon/NVMe temperatures. Missing
+// subsystems are skipped silently -- most hosts only have some of them.
+func CollectHardwareMetrics(root string) []protocol.Metric {
+	var metrics []protocol.Metric
+	metrics = append(metrics, edacMetrics(root)...)
+	metrics = append(metrics, aerMetrics(root)...)
+	metrics = append(metrics, nvmeMetrics(root)...)
+	metrics = append(metrics, hwmonMetrics(root)...)
+	return metrics
+}
+
+// edacMetrics reads per-DIMM CE/UE counts under
+// /sys/devices/system/edac/mc/mc*/dimm*/. Older drivers only populate the
+// csrow* layout, which we read the same way.
+func edacMetrics(root string) []protocol.Metric {
+	var metrics []protocol.Metric
+	mcs, _ := filepath.Glob(filepath.Join(root, "devices/system/edac/mc/mc[0-9]*"))
+	for _, mc := range mcs {
+		mcName := filepath.Base(mc)
+		dimms, _ := filepath.Glob(filepath.Join(mc, "dimm[0-9]*"))
+		prefix := "dimm_"
+		if len(dimms) == 0 {
+			dimms, _ = filepath.Glob(filepath.Join(mc, "csrow[0-9]*"))
+			prefix = ""
+		}
+		for _, dimm := range dimms {
+			labels := map[string]string{"mc": mcName, "dimm": filepath.Base(dimm)}
+			if l := readSysfsString(filepath.Join(dimm, prefix+"label")); l != "" {
+				labels["label"] = l
+			}
+			if v, ok := readSysfsFloat(filepath.Join(dimm, prefix+"ce_count")); ok {
+				metrics = append(metrics, protocol.Metric{Name: "edac_ce_count", Kind: protocol.MetricCounter, Labels: labels, Value: v})
+			}
+			if v, ok := readSysfsFloat(filepath.Join(dimm, prefix+"ue_count")); ok {
+				metrics = append(metrics, protocol.Metric{Name: "edac_ue_count", Kind: protocol.MetricCounter, Labels: labels, Value: v})
+			}
+		}
+	}
+	return metrics
+}
+
+// aerFiles maps each PCIe AER sysfs file to the TOTAL_* line it ends with.
+var aerFiles = []struct{ file, total, metric string }{
+	{"aer_dev_correctable", "TOTAL_ERR_COR", "pcie_aer_correctable_count"},
+	{"aer_dev_nonfatal", "TOTAL_ERR_NONFATAL", "pcie_aer_nonfatal_count"},
+	{"aer_dev_fatal", "TOTAL_ERR_FATAL", "pcie_aer_fatal_count"},
+}
+
+// aerMetrics reads the AER totals under /sys/bus/pci/devices/*/aer_dev_*.
+// Each file is a list of "<ErrName> <count>" lines; we only ship the
+// TOTAL_* line to keep the payload small.
+func aerMetrics(root string) []protocol.Metric {
+	var metrics []protocol.Metric
+	devs, _ := filepath.Glob(filepath.Join(root, "bus/pci/devices/*"))
+	for _, dev := range devs {
+		for _, f := range aerFiles {
+			data, err := os.ReadFile(filepath.Join(dev, f.file))
+			if err != nil {
+				continue
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) != 2 || fields[0] != f.total {
+					continue
+				}
+				v, err := strconv.ParseFloat(fields[1], 64)
+				if err != nil {
+					continue
+				}
+				metrics = append(metrics, protocol.Metric{
+					Name:   f.metric,
+					Kind:   protocol.MetricCounter,
+					Labels: map[string]string{"device": filepath.Base(dev)},
+					Value:  v,
+				})
+			}
+		}
+	}
+	return metrics
+}
+
+// nvmeMetrics reports each controller's composite temperature, labeled with
+// model and serial so a swapped drive starts a fresh series.
+func nvmeMetrics(root string) []protocol.Metric {
+	var metrics []protocol.Metric
+	ctrls, _ := filepath.Glob(filepath.Join(root, "class/nvme/nvme[0-9]*"))
+	for _, ctrl := range ctrls {
+		labels := map[string]string{"ctrl": filepath.Base(ctrl)}
+		if s := readSysfsString(filepath.Join(ctrl, "serial")); s != "" {
+			labels["serial"] = s
+		}
+		if m := readSysfsString(filepath.Join(ctrl, "model")); m != "" {
+			labels["model"] = m
+		}
+		temps, _ := filepath.Glob(filepath.Join(ctrl, "hwmon*/temp1_input"))
+		for _, t := range temps {
+			if v, ok := readSysfsFloat(t); ok {
+				metrics = append(metrics, protocol.Metric{Name: "nvme_temperature_celsius", Kind: protocol.MetricGauge, Labels: labels, Value: v / 1000})
+			}
+		}
+	}
+	return metrics
+}
+
+// hwmonMetrics reports every temp*_input under /sys/class/hwmon, labeled by
+// chip name and the sensor's own label when the driver provides one.
+func hwmonMetrics(root string) []protocol.Metric {
+	var metrics []protocol.Metric
+	chips, _ := filepath.Glob(filepath.Join(root, "class/hwmon/hwmon[0-9]*"))
+	for _, chip := range chips {
+		name := readSysfsString(filepath.Join(chip, "name"))
+		inputs, _ := filepath.Glob(filepath.Join(chip, "temp[0-9]*_input"))
+		sort.Strings(inputs)
+		for _, in := range inputs {
+			v, ok := readSysfsFloat(in)
+			if !ok {
+				continue
+			}
+			sensor := strings.TrimSuffix(filepath.Base(in), "_input")
+			labels := map[string]string{"chip": filepath.Base(chip), "sensor": sensor}
+			if name != "" {
+				labels["name"] = name
+			}
+			if l := readSysfsString(filepath.Join(chip, sensor+"_label")); l != "" {
+				labels["label"] = l
+			}
+			metrics = append(metrics, protocol.Metric{Name: "hwmon_temperature_celsius", Kind: protocol.MetricGauge, Labels: labels, Value: v / 1000})
+		}
+	}
+	return metrics
+}
+
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysfsFloat(path string) (float64, bool) {
+	s := readSysfsString(path)
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
@@ -0,0 +1,78 @@
+// internal/agent/hwmetrics_test.go
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// writeSysfs lays out a fake sysfs tree under root from path->content pairs.
+func writeSysfs(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for p, content := range files {
+		full := filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectHardwareMetrics(t *testing.T) {
+	root := t.TempDir()
+	writeSysfs(t, root, map[string]string{
+		"devices/system/edac/mc/mc0/dimm0/dimm_label":      "CPU_SrcID#0_MC#0_Chan#0_DIMM#0\n",
+		"devices/system/edac/mc/mc0/dimm0/dimm_ce_count":   "17\n",
+		"devices/system/edac/mc/mc0/dimm0/dimm_ue_count":   "0\n",
+		"bus/pci/devices/0000:00:1c.0/aer_dev_correctable": "RxErr 3\nBadTLP 1\nTOTAL_ERR_COR 4\n",
+		"bus/pci/devices/0000:00:1c.0/aer_dev_fatal":       "Undefined 0\nTOTAL_ERR_FATAL 0\n",
+		"class/nvme/nvme0/serial":                          "S4EWNX0R123456  \n",
+		"class/nvme/nvme0/model":                           "Samsung SSD 980 PRO\n",
+		"class/nvme/nvme0/hwmon2/temp1_input":              "41850\n",
+		"class/hwmon/hwmon0/name":                          "coretemp\n",
+		"class/hwmon/hwmon0/temp1_input":                   "55000\n",
+		"class/hwmon/hwmon0/temp1_label":                   "Package id 0\n",
+	})
+
+	got := map[string]protocol.Metric{}
+	for _, m := range CollectHardwareMetrics(root) {
+		got[m.SeriesKey()] = m
+	}
+
+	want := map[string]float64{
+		`edac_ce_count{dimm="dimm0",label="CPU_SrcID#0_MC#0_Chan#0_DIMM#0",mc="mc0"}`:                  17,
+		`edac_ue_count{dimm="dimm0",label="CPU_SrcID#0_MC#0_Chan#0_DIMM#0",mc="mc0"}`:                  0,
+		`pcie_aer_correctable_count{device="0000:00:1c.0"}`:                                            4,
+		`pcie_aer_fatal_count{device="0000:00:1c.0"}`:                                                  0,
+		`nvme_temperature_celsius{ctrl="nvme0",model="Samsung SSD 980 PRO",serial="S4EWNX0R123456"}`:   41.85,
+		`hwmon_temperature_celsius{chip="hwmon0",label="Package id 0",name="coretemp",sensor="temp1"}`: 55,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d metrics, want %d: %v", len(got), len(want), got)
+	}
+	for key, v := range want {
+		m, ok := got[key]
+		if !ok {
+			t.Errorf("missing series %s", key)
+			continue
+		}
+		if m.Value != v {
+			t.Errorf("%s = %v, want %v", key, m.Value, v)
+		}
+	}
+	if m := got[`pcie_aer_correctable_count{device="0000:00:1c.0"}`]; m.Kind != protocol.MetricCounter {
+		t.Errorf("AER kind = %q, want counter", m.Kind)
+	}
+}
+
+func TestCollectHardwareMetricsEmptyTree(t *testing.T) {
+	// VMs and containers have none of these subsystems; that's not an error.
+	if got := CollectHardwareMetrics(t.TempDir()); len(got) != 0 {
+		t.Errorf("got %d metrics from empty sysfs, want 0", len(got))
+	}
+}
@@ -0,0 +1,202 @@
+// internal/agent/journal.go
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// journalMaxFieldBytes rejects binary fields whose length prefix is
+// implausible, so a corrupt stream fails fast instead of allocating
+// gigabytes.
+const journalMaxFieldBytes = 16 << 20
+
+// journalFirstReadEntries is how many of the newest entries a fresh
+// cursor starts from, so enabling a journal source sends recent history
+// rather than the whole journal, as the kernel sources send only what the
+// ring buffer still holds.
+const journalFirstReadEntries = 1000
+
+// journalSource reads systemd's journal export format
+// (https://systemd.io/JOURNAL_EXPORT_FORMATS/), either from a file or from
+// a command such as `journalctl -k -o export`. Its cursor is the journal's
+// own __CURSOR of the last entry read. A command gets --after-cursor once
+// a cursor is known, and --lines before; a file is re-read and skipped
+// forward to it.
+type journalSource struct {
+	name    string
+	path    string
+	command []string
+}
+
+func (s *journalSource) Name() string { return s.name }
+
+func (s *journalSource) Read(cursor string) ([]protocol.Record, string, error) {
+	var entries []map[string]string
+	if s.path != "" {
+		f, err := os.Open(s.path)
+		if os.IsNotExist(err) {
+			return nil, cursor, nil
+		}
+		if err != nil {
+			return nil, cursor, err
+		}
+		defer f.Close()
+		// Keep what follows the cursor entry. Until it turns up -- and if
+		// it never does, because the cursor is fresh or the file was
+		// replaced -- only the newest entries are kept.
+		found := false
+		err = scanJournalExport(f, func(e map[string]string) {
+			if cursor != "" && e["__CURSOR"] == cursor {
+				entries, found = nil, true
+				return
+			}
+			entries = append(entries, e)
+			if !found && len(entries) >= 2*journalFirstReadEntries {
+				entries = append(entries[:0], entries[len(entries)-journalFirstReadEntries:]...)
+			}
+		})
+		if err != nil {
+			return nil, cursor, fmt.Errorf("%s: %w", s.path, err)
+		}
+		if !found && len(entries) > journalFirstReadEntries {
+			entries = entries[len(entries)-journalFirstReadEntries:]
+		}
+	} else {
+		args := append([]string(nil), s.command[1:]...)
+		if cursor != "" {
+			args = append(args, "--after-cursor="+cursor)
+		} else {
+			args = append(args, "--lines="+strconv.Itoa(journalFirstReadEntries))
+		}
+		cmd := exec.Command(s.command[0], args...)
+		cmd.Env = cLocaleEnv()
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, cursor, fmt.Errorf("%s: %w", s.command[0], err)
+		}
+		if entries, err = parseJournalExport(strings.NewReader(string(out))); err != nil {
+			return nil, cursor, fmt.Errorf("%s: %w", s.command[0], err)
+		}
+	}
+
+	next := cursor
+	var records []protocol.Record
+	for _, e := range entries {
+		if c := e["__CURSOR"]; c != "" {
+			next = c
+		}
+		if r, ok := journalRecord(e); ok {
+			records = append(records, r)
+		}
+	}
+	return records, next, nil
+}
+
+// parseJournalExport splits an export stream into entries of field name to
+// value. Entries are separated by a blank line; each field is either
+// "NAME=value\n" or, for values containing newlines or binary data, "NAME\n"
+// followed by a little-endian uint64 length, the raw value and "\n".
+func parseJournalExport(r io.Reader) ([]map[string]string, error) {
+	var entries []map[string]string
+	err := scanJournalExport(r, func(e map[string]string) {
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// scanJournalExport is parseJournalExport passing each entry to fn as it is
+// read, rather than holding the stream in memory.
+func scanJournalExport(r io.Reader, fn func(map[string]string)) error {
+	br := bufio.NewReader(r)
+	cur := map[string]string{}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		eof := err == io.EOF
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if len(cur) > 0 {
+				fn(cur)
+				cur = map[string]string{}
+			}
+		case strings.Contains(line, "="):
+			k, v, _ := strings.Cut(line, "=")
+			cur[k] = v
+		case !eof:
+			var size uint64
+			if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+				return fmt.Errorf("field %s: %w", line, err)
+			}
+			if size > journalMaxFieldBytes {
+				return fmt.Errorf("field %s: length %d too large", line, size)
+			}
+			data := make([]byte, size+1) // value plus trailing newline
+			if _, err := io.ReadFull(br, data); err != nil {
+				return fmt.Errorf("field %s: %w", line, err)
+			}
+			cur[line] = string(data[:size])
+		default:
+			return errors.New("truncated entry at end of stream")
+		}
+
+		if eof {
+			break
+		}
+	}
+	if len(cur) > 0 {
+		fn(cur)
+	}
+	return nil
+}
+
+// journalRecord converts one export entry. Entries without a MESSAGE (pure
+// metadata) are skipped. Facility defaults from the transport: the journal
+// omits SYSLOG_FACILITY for kernel messages.
+func journalRecord(e map[string]string) (protocol.Record, bool) {
+	msg, ok := e["MESSAGE"]
+	if !ok {
+		return protocol.Record{}, false
+	}
+
+	r := protocol.Record{
+		Level:     protocol.LevelInfo,
+		Facility:  facilityUser,
+		Subsystem: e["_KERNEL_SUBSYSTEM"],
+		Device:    e["_KERNEL_DEVICE"],
+		Timestamp: time.Now(),
+	}
+	if usec, err := strconv.ParseInt(e["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		r.Timestamp = time.UnixMicro(usec)
+	}
+	if p, err := strconv.Atoi(e["PRIORITY"]); err == nil && p >= 0 && p <= protocol.LevelDebug {
+		r.Level = p
+	}
+	if f, err := strconv.Atoi(e["SYSLOG_FACILITY"]); err == nil {
+		r.Facility = f
+	} else if e["_TRANSPORT"] == "kernel" {
+		r.Facility = facilityKern
+	}
+	if id := e["SYSLOG_IDENTIFIER"]; id != "" && r.Facility != facilityKern {
+		msg = id + ": " + msg
+	}
+	r.Message = msg
+	return r, true
+}
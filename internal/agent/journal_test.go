@@ -0,0 +1,136 @@
+// internal/agent/journal_test.go
+package agent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// journalExport builds an export stream with one kernel entry, one entry
+// whose MESSAGE uses the binary-safe encoding, and one userspace entry.
+func journalExport() []byte {
+	var b bytes.Buffer
+	b.WriteString("__CURSOR=s=abc;i=1\n__REALTIME_TIMESTAMP=1770121501000000\nPRIORITY=3\n_TRANSPORT=kernel\nSYSLOG_IDENTIFIER=kernel\n_KERNEL_SUBSYSTEM=pci\n_KERNEL_DEVICE=+pci:0000:3b:00.0\nMESSAGE=AER: Uncorrected (Fatal) error received\n\n")
+
+	msg := "multi\nline"
+	b.WriteString("__CURSOR=s=abc;i=2\n__REALTIME_TIMESTAMP=1770121502000000\nPRIORITY=4\n_TRANSPORT=kernel\nMESSAGE\n")
+	binary.Write(&b, binary.LittleEndian, uint64(len(msg)))
+	b.WriteString(msg + "\n\n")
+
+	b.WriteString("__CURSOR=s=abc;i=3\n__REALTIME_TIMESTAMP=1770121503000000\nPRIORITY=6\nSYSLOG_FACILITY=3\nSYSLOG_IDENTIFIER=smartd\nMESSAGE=Device: /dev/sda, SMART Usage Attribute: 194 changed\n")
+	return b.Bytes()
+}
+
+func TestParseJournalExport(t *testing.T) {
+	entries, err := parseJournalExport(bytes.NewReader(journalExport()))
+	if err != nil {
+		t.Fatalf("parseJournalExport: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if entries[1]["MESSAGE"] != "multi\nline" {
+		t.Errorf("binary MESSAGE = %q", entries[1]["MESSAGE"])
+	}
+
+	r, ok := journalRecord(entries[0])
+	if !ok || r.Level != protocol.LevelErr || r.Facility != 0 || r.Subsystem != "pci" || r.Device != "+pci:0000:3b:00.0" {
+		t.Errorf("kernel entry = %+v", r)
+	}
+	if r.Timestamp.UTC().Format("2006-01-02 15:04:05") != "2026-02-03 12:25:01" {
+		t.Errorf("Timestamp = %v", r.Timestamp.UTC())
+	}
+	if r.Message != "AER: Uncorrected (Fatal) error received" {
+		t.Errorf("kernel message should not carry the identifier: %q", r.Message)
+	}
+
+	r, _ = journalRecord(entries[2])
+	if r.Facility != 3 || r.Message != "smartd: Device: /dev/sda, SMART Usage Attribute: 194 changed" {
+		t.Errorf("daemon entry = %+v", r)
+	}
+
+	if _, err := parseJournalExport(bytes.NewReader([]byte("MESSAGE\n\xff\xff\xff\xff\xff\xff\xff\xff"))); err == nil {
+		t.Error("expected error for an oversized binary field")
+	}
+}
+
+func TestJournalSourceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kernel.export")
+	src := &journalSource{name: "journal:" + path, path: path}
+
+	if records, cursor, err := src.Read(""); err != nil || len(records) != 0 || cursor != "" {
+		t.Fatalf("missing file = %v, %q, %v", records, cursor, err)
+	}
+
+	if err := os.WriteFile(path, journalExport(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, cursor, err := src.Read("s=abc;i=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || cursor != "s=abc;i=3" {
+		t.Errorf("after cursor i=1 = %d records, cursor %q; want 2, s=abc;i=3", len(records), cursor)
+	}
+
+	records, next, err := src.Read(cursor)
+	if err != nil || len(records) != 0 || next != cursor {
+		t.Errorf("at end = %d records, cursor %q, err %v", len(records), next, err)
+	}
+}
+
+func TestJournalSourceCommand(t *testing.T) {
+	// The command sees --after-cursor once a cursor exists; echo it back so
+	// we can check it was passed.
+	src := &journalSource{name: "journal:sh", command: []string{"sh", "-c", `printf 'MESSAGE=args %s\n__CURSOR=c2\n' "$0"`}}
+	records, cursor, err := src.Read("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Message != "args --after-cursor=c1" || cursor != "c2" {
+		t.Errorf("command read = %+v, cursor %q", records, cursor)
+	}
+}
+
+// TestJournalSourceFreshCursor checks a fresh cursor starts from the
+// newest entries, not the whole journal.
+func TestJournalSourceFreshCursor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kernel.export")
+	var b bytes.Buffer
+	for i := 1; i <= 2*journalFirstReadEntries+500; i++ {
+		fmt.Fprintf(&b, "__CURSOR=i=%d\nMESSAGE=entry %d\n\n", i, i)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := &journalSource{name: "journal:" + path, path: path}
+	records, cursor, err := src.Read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := 2*journalFirstReadEntries + 500
+	if len(records) != journalFirstReadEntries || records[0].Message != fmt.Sprintf("entry %d", last-journalFirstReadEntries+1) || cursor != fmt.Sprintf("i=%d", last) {
+		t.Errorf("fresh read = %d records from %q, cursor %q", len(records), records[0].Message, cursor)
+	}
+
+	// With a cursor, everything after it comes, however much.
+	records, _, err = src.Read("i=10")
+	if err != nil || len(records) != last-10 {
+		t.Errorf("read after i=10 = %d records, %v; want %d", len(records), err, last-10)
+	}
+
+	cmd := &journalSource{name: "journal:sh", command: []string{"sh", "-c", `printf 'MESSAGE=args %s\n__CURSOR=c1\n' "$0"`}}
+	records, _, err = cmd.Read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Message != fmt.Sprintf("args --lines=%d", journalFirstReadEntries) {
+		t.Errorf("fresh command read = %+v", records)
+	}
+}
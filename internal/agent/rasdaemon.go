@@ -0,0 +1,210 @@
+// internal/agent/rasdaemon.go
+package agent
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+	_ "modernc.org/sqlite"
+)
+
+// rasBatchLimit caps rows read per table per poll. The agent's MaxLines cap
+// trims further; this just keeps a first run against years of history from
+// loading the whole table.
+const rasBatchLimit = 1000
+
+// rasTables are the rasdaemon tables we tail, each with the formatter that
+// turns one row into a Record. Tables that a given rasdaemon build doesn't
+// create (it's compiled per-feature) are skipped.
+var rasTables = []struct {
+	name   string
+	format func(row map[string]string) protocol.Record
+}{
+	{"mc_event", formatMCEvent},
+	{"aer_event", formatAEREvent},
+	{"mce_record", formatMCERecord},
+}
+
+// ReadRasdaemon returns rasdaemon events with a row ID above the per-table
+// cursor, plus the advanced cursor. rasdaemon keeps writing while we read,
+// so the database is opened read-only with a busy timeout rather than
+// copied. A missing database is not an error: rasdaemon may not be
+// installed or may not have logged anything yet.
+func ReadRasdaemon(path string, cursor map[string]int64) ([]protocol.Record, map[string]int64, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, cursor, nil
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer db.Close()
+
+	next := make(map[string]int64, len(cursor))
+	for k, v := range cursor {
+		next[k] = v
+	}
+
+	var records []protocol.Record
+	for _, t := range rasTables {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, t.name).Scan(&n); err != nil {
+			return nil, cursor, fmt.Errorf("%s: %w", t.name, err)
+		}
+		if n == 0 {
+			continue
+		}
+		rows, lastID, err := readRasRows(db, t.name, next[t.name])
+		if err != nil {
+			return nil, cursor, fmt.Errorf("%s: %w", t.name, err)
+		}
+		for _, row := range rows {
+			records = append(records, t.format(row))
+		}
+		next[t.name] = lastID
+	}
+	return records, next, nil
+}
+
+// readRasRows selects every column so we cope with the schema drift between
+// rasdaemon releases (mce_record in particular has grown columns over time).
+// Values come back as strings keyed by column name.
+func readRasRows(db *sql.DB, table string, afterID int64) ([]map[string]string, int64, error) {
+	rows, err := db.Query(`SELECT * FROM `+table+` WHERE id > ? ORDER BY id LIMIT ?`, afterID, rasBatchLimit)
+	if err != nil {
+		return nil, afterID, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, afterID, err
+	}
+	lastID := afterID
+	var out []map[string]string
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, afterID, err
+		}
+		row := make(map[string]string, len(cols))
+		for i, c := range cols {
+			row[c] = vals[i].String
+		}
+		var id int64
+		fmt.Sscan(row["id"], &id)
+		if id > lastID {
+			lastID = id
+		}
+		out = append(out, row)
+	}
+	return out, lastID, rows.Err()
+}
+
+// parseRasTimestamp reads rasdaemon's "2026-02-03 12:25:01 +0000" format.
+// rasdaemon derives it from the kernel trace clock, so an unparseable value
+// falls back to now rather than dropping the event.
+func parseRasTimestamp(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05"} {
+		if ts, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return ts
+		}
+	}
+	return time.Now()
+}
+
+// rasLevel maps rasdaemon's err_type strings onto syslog levels: corrected
+// errors are warnings, anything uncorrected or fatal is critical.
+func rasLevel(errType string) int {
+	t := strings.ToLower(errType)
+	switch {
+	case strings.Contains(t, "uncorrected"), strings.Contains(t, "fatal"):
+		return protocol.LevelCrit
+	case strings.Contains(t, "corrected"), strings.Contains(t, "deferred"):
+		return protocol.LevelWarning
+	default:
+		return protocol.LevelNotice
+	}
+}
+
+// formatMCEvent renders an EDAC memory controller event with its decoded
+// DIMM location. label is the silkscreen name from the DIMM labels database
+// when the operator has configured one; the layer triple always identifies
+// the slot.
+func formatMCEvent(row map[string]string) protocol.Record {
+	loc := fmt.Sprintf("mc%s layers %s:%s:%s", row["mc"], row["top_layer"], row["middle_layer"], row["lower_layer"])
+	device := loc
+	if l := row["label"]; l != "" && l != "unknown memory" {
+		device = l
+	}
+	msg := fmt.Sprintf("EDAC %s error count=%s on %s (%s)", row["err_type"], row["err_count"], device, loc)
+	if row["err_msg"] != "" {
+		msg += ": " + row["err_msg"]
+	}
+	if a := row["address"]; a != "" && a != "0" {
+		msg += " address=" + a
+	}
+	if s := row["syndrome"]; s != "" && s != "0" {
+		msg += " syndrome=" + s
+	}
+	if row["driver_detail"] != "" {
+		msg += " " + row["driver_detail"]
+	}
+	return protocol.Record{
+		Timestamp: parseRasTimestamp(row["timestamp"]),
+		Level:     rasLevel(row["err_type"]),
+		Subsystem: "ras:mc",
+		Device:    device,
+		Message:   msg,
+	}
+}
+
+// formatAEREvent renders a decoded PCIe Advanced Error Reporting event.
+func formatAEREvent(row map[string]string) protocol.Record {
+	return protocol.Record{
+		Timestamp: parseRasTimestamp(row["timestamp"]),
+		Level:     rasLevel(row["err_type"]),
+		Subsystem: "ras:aer",
+		Device:    row["dev_name"],
+		Message:   fmt.Sprintf("PCIe AER %s error on %s: %s", row["err_type"], row["dev_name"], row["err_msg"]),
+	}
+}
+
+// formatMCERecord renders an x86 machine check with rasdaemon's decoded
+// bank name and status messages instead of the raw MCi_STATUS hex.
+func formatMCERecord(row map[string]string) protocol.Record {
+	device := "cpu" + row["cpu"]
+	if loc := row["mc_location"]; loc != "" {
+		device = loc
+	}
+	parts := []string{fmt.Sprintf("MCE cpu=%s bank=%s", row["cpu"], row["bank"])}
+	for _, k := range []string{"bank_name", "error_msg", "mcistatus_msg", "mc_location", "user_action"} {
+		if v := strings.TrimSpace(row[k]); v != "" {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	if a := row["addr"]; a != "" && a != "0" {
+		parts = append(parts, "addr="+a)
+	}
+	// A machine check that rasdaemon couldn't classify is still a hardware
+	// error, so it never drops below warning.
+	level := rasLevel(row["mcistatus_msg"] + " " + row["error_msg"])
+	if level > protocol.LevelWarning {
+		level = protocol.LevelWarning
+	}
+	return protocol.Record{
+		Timestamp: parseRasTimestamp(row["timestamp"]),
+		Level:     level,
+		Subsystem: "ras:mce",
+		Device:    device,
+		Message:   strings.Join(parts, " "),
+	}
+}
@@ -0,0 +1,116 @@
+// internal/agent/rasdaemon_test.go
+package agent
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// seedRasdaemon creates a database with the subset of rasdaemon's schema we
+// read. mce_record is deliberately absent, as on a non-x86 build.
+func seedRasdaemon(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE mc_event (id INTEGER PRIMARY KEY, timestamp TEXT, err_count INTEGER,
+		err_type TEXT, err_msg TEXT, label TEXT, mc INTEGER, top_layer INTEGER,
+		middle_layer INTEGER, lower_layer INTEGER, address INTEGER, grain INTEGER,
+		syndrome INTEGER, driver_detail TEXT);
+	CREATE TABLE aer_event (id INTEGER PRIMARY KEY, timestamp TEXT, dev_name TEXT,
+		err_type TEXT, err_msg TEXT);
+	INSERT INTO mc_event VALUES (1, '2026-02-03 12:25:01 +0000', 1, 'Corrected',
+		'memory read error', 'CPU_SrcID#0_Ha#0_Chan#1_DIMM#0', 0, 0, 1, 0, 305419896, 64, 0, '');
+	INSERT INTO aer_event VALUES (1, '2026-02-03 12:26:00 +0000', '0000:3b:00.0',
+		'Uncorrected (Fatal)', 'Surprise Down Error');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestReadRasdaemon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ras-mc_event.db")
+	seed := seedRasdaemon(t, path)
+	defer seed.Close()
+
+	records, cursor, err := ReadRasdaemon(path, map[string]int64{})
+	if err != nil {
+		t.Fatalf("ReadRasdaemon: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(records), records)
+	}
+
+	mc := records[0]
+	if mc.Level != protocol.LevelWarning || mc.Subsystem != "ras:mc" {
+		t.Errorf("mc_event level/subsystem = %d/%q, want warning/ras:mc", mc.Level, mc.Subsystem)
+	}
+	if mc.Device != "CPU_SrcID#0_Ha#0_Chan#1_DIMM#0" || !strings.Contains(mc.Message, "mc0 layers 0:1:0") {
+		t.Errorf("mc_event location not decoded: device=%q msg=%q", mc.Device, mc.Message)
+	}
+	if mc.Timestamp.UTC().Format("15:04:05") != "12:25:01" {
+		t.Errorf("mc_event timestamp = %v", mc.Timestamp)
+	}
+
+	aer := records[1]
+	if aer.Level != protocol.LevelCrit || aer.Device != "0000:3b:00.0" {
+		t.Errorf("aer_event level/device = %d/%q, want crit/0000:3b:00.0", aer.Level, aer.Device)
+	}
+
+	if cursor["mc_event"] != 1 || cursor["aer_event"] != 1 {
+		t.Errorf("cursor = %v, want mc_event=1 aer_event=1", cursor)
+	}
+
+	// Nothing new: the cursor holds and no records come back.
+	records, cursor, err = ReadRasdaemon(path, cursor)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("second read = %d records, err %v; want none", len(records), err)
+	}
+
+	// A new row is picked up on its own.
+	if _, err := seed.Exec(`INSERT INTO mc_event (id, timestamp, err_count, err_type, label, mc, top_layer, middle_layer, lower_layer)
+		VALUES (2, '2026-02-03 13:00:00 +0000', 4, 'Uncorrected', '', 1, 2, 0, -1)`); err != nil {
+		t.Fatal(err)
+	}
+	records, cursor, err = ReadRasdaemon(path, cursor)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("third read = %d records, err %v; want 1", len(records), err)
+	}
+	if records[0].Level != protocol.LevelCrit || records[0].Device != "mc1 layers 2:0:-1" {
+		t.Errorf("unlabeled mc_event = %+v", records[0])
+	}
+	if cursor["mc_event"] != 2 {
+		t.Errorf("cursor[mc_event] = %d, want 2", cursor["mc_event"])
+	}
+}
+
+func TestReadRasdaemonMissingDB(t *testing.T) {
+	records, cursor, err := ReadRasdaemon(filepath.Join(t.TempDir(), "absent.db"), map[string]int64{"mc_event": 7})
+	if err != nil || len(records) != 0 || cursor["mc_event"] != 7 {
+		t.Errorf("missing DB = %v, %v, %v; want no records, cursor untouched, nil error", records, cursor, err)
+	}
+}
+
+func TestRasdaemonSourceCursor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ras-mc_event.db")
+	seed := seedRasdaemon(t, path)
+	defer seed.Close()
+
+	src := &rasdaemonSource{name: "rasdaemon:" + path, path: path}
+	records, cursor, err := src.Read("")
+	if err != nil || len(records) != 2 {
+		t.Fatalf("first read = %d records, err %v; want 2", len(records), err)
+	}
+	records, next, err := src.Read(cursor)
+	if err != nil || len(records) != 0 || next != cursor {
+		t.Errorf("second read = %d records, cursor moved %v, err %v", len(records), next != cursor, err)
+	}
+}
@@ -0,0 +1,201 @@
+// internal/agent/smart.go
+package agent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// errSmartUnsupported is returned by the ioctl layer on platforms without
+// NVMe admin passthrough or SG_IO.
+var errSmartUnsupported = errors.New("SMART collection is only supported on Linux")
+
+// smartLogSize is the size of both the NVMe SMART/Health log page and the
+// ATA SMART READ DATA / READ THRESHOLDS / IDENTIFY responses.
+const smartLogSize = 512
+
+var nvmeCtrlRe = regexp.MustCompile(`^nvme[0-9]+$`)
+
+// CollectSmart reads a health snapshot from every NVMe controller and SATA
+// disk it can find. A drive that can't be read (permissions, a USB bridge
+// that swallows ATA passthrough) is logged and skipped rather than failing
+// the whole poll.
+func CollectSmart(root string) []protocol.SmartSnapshot {
+	var snaps []protocol.SmartSnapshot
+
+	ctrls, _ := filepath.Glob(filepath.Join(root, "class/nvme/nvme[0-9]*"))
+	for _, ctrl := range ctrls {
+		name := filepath.Base(ctrl)
+		if !nvmeCtrlRe.MatchString(name) {
+			continue
+		}
+		dev := "/dev/" + name
+		page, err := nvmeSmartLog(dev)
+		if err != nil {
+			log.Printf("SMART %s: %v", dev, err)
+			continue
+		}
+		snap := parseNVMeSmartLog(page)
+		snap.Device = dev
+		snap.Serial = readSysfsString(filepath.Join(ctrl, "serial"))
+		snap.Model = readSysfsString(filepath.Join(ctrl, "model"))
+		snaps = append(snaps, snap)
+	}
+
+	disks, _ := filepath.Glob(filepath.Join(root, "block/sd*"))
+	for _, disk := range disks {
+		// libata reports every SATA disk's SCSI vendor as "ATA"; SAS and
+		// USB mass storage devices don't speak ATA SMART.
+		if readSysfsString(filepath.Join(disk, "device/vendor")) != "ATA" {
+			continue
+		}
+		dev := "/dev/" + filepath.Base(disk)
+		snap, err := readATASmart(dev)
+		if err != nil {
+			log.Printf("SMART %s: %v", dev, err)
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+
+	return snaps
+}
+
+// readATASmart issues IDENTIFY, SMART READ DATA and SMART READ THRESHOLDS
+// and joins them into one snapshot.
+func readATASmart(dev string) (protocol.SmartSnapshot, error) {
+	ident, err := ataCommand(dev, ataCmdIdentify, 0)
+	if err != nil {
+		return protocol.SmartSnapshot{}, fmt.Errorf("identify: %w", err)
+	}
+	data, err := ataCommand(dev, ataCmdSmart, ataSmartReadData)
+	if err != nil {
+		return protocol.SmartSnapshot{}, fmt.Errorf("read data: %w", err)
+	}
+	thresh, err := ataCommand(dev, ataCmdSmart, ataSmartReadThresholds)
+	if err != nil {
+		return protocol.SmartSnapshot{}, fmt.Errorf("read thresholds: %w", err)
+	}
+	serial, model := parseATAIdentify(ident)
+	return protocol.SmartSnapshot{
+		Device:     dev,
+		Protocol:   protocol.SmartATA,
+		Serial:     serial,
+		Model:      model,
+		Attributes: parseATASmart(data, thresh),
+	}, nil
+}
+
+// ATA command and SMART feature register values (ACS-3).
+const (
+	ataCmdIdentify         = 0xEC
+	ataCmdSmart            = 0xB0
+	ataSmartReadData       = 0xD0
+	ataSmartReadThresholds = 0xD1
+)
+
+// parseNVMeSmartLog decodes the fields we report from a SMART / Health
+// Information log page. Multi-byte counters are 128-bit little-endian; the
+// high half is zero for any drive that will exist in our lifetime.
+func parseNVMeSmartLog(page []byte) protocol.SmartSnapshot {
+	snap := protocol.SmartSnapshot{Protocol: protocol.SmartNVMe}
+	if len(page) < smartLogSize {
+		return snap
+	}
+	snap.CriticalWarning = int(page[0])
+	if kelvin := int(binary.LittleEndian.Uint16(page[1:3])); kelvin > 0 {
+		snap.TemperatureCelsius = kelvin - 273
+	}
+	snap.AvailableSpare = int(page[3])
+	snap.AvailableSpareThreshold = int(page[4])
+	snap.PercentageUsed = int(page[5])
+	snap.PowerOnHours = binary.LittleEndian.Uint64(page[128:136])
+	snap.UnsafeShutdowns = binary.LittleEndian.Uint64(page[144:152])
+	snap.MediaErrors = binary.LittleEndian.Uint64(page[160:168])
+	return snap
+}
+
+// ataAttrNames are the attributes whose meaning is consistent enough across
+// vendors to be worth naming in the prompt.
+var ataAttrNames = map[int]string{
+	1:   "Raw_Read_Error_Rate",
+	5:   "Reallocated_Sector_Ct",
+	9:   "Power_On_Hours",
+	10:  "Spin_Retry_Count",
+	177: "Wear_Leveling_Count",
+	184: "End-to-End_Error",
+	187: "Reported_Uncorrect",
+	188: "Command_Timeout",
+	194: "Temperature_Celsius",
+	196: "Reallocated_Event_Count",
+	197: "Current_Pending_Sector",
+	198: "Offline_Uncorrectable",
+	199: "UDMA_CRC_Error_Count",
+	231: "SSD_Life_Left",
+	233: "Media_Wearout_Indicator",
+}
+
+// parseATASmart walks the 30 twelve-byte attribute slots of SMART READ DATA
+// and looks up each attribute's threshold in the matching READ THRESHOLDS
+// slot. Empty slots (ID 0) are skipped.
+func parseATASmart(data, thresh []byte) []protocol.SmartAttribute {
+	if len(data) < smartLogSize {
+		return nil
+	}
+	thresholds := map[int]int{}
+	if len(thresh) >= smartLogSize {
+		for i := 0; i < 30; i++ {
+			e := thresh[2+i*12 : 2+(i+1)*12]
+			if e[0] != 0 {
+				thresholds[int(e[0])] = int(e[1])
+			}
+		}
+	}
+
+	var attrs []protocol.SmartAttribute
+	for i := 0; i < 30; i++ {
+		e := data[2+i*12 : 2+(i+1)*12]
+		id := int(e[0])
+		if id == 0 {
+			continue
+		}
+		var raw uint64
+		for b := 5; b >= 0; b-- {
+			raw = raw<<8 | uint64(e[5+b])
+		}
+		attrs = append(attrs, protocol.SmartAttribute{
+			ID:        id,
+			Name:      ataAttrNames[id],
+			Value:     int(e[3]),
+			Worst:     int(e[4]),
+			Threshold: thresholds[id],
+			Raw:       raw,
+		})
+	}
+	return attrs
+}
+
+// parseATAIdentify extracts serial (words 10-19) and model (words 27-46)
+// from IDENTIFY DEVICE data. ATA strings are stored with the two bytes of
+// each word swapped.
+func parseATAIdentify(ident []byte) (serial, model string) {
+	if len(ident) < smartLogSize {
+		return "", ""
+	}
+	return ataString(ident[20:40]), ataString(ident[54:94])
+}
+
+func ataString(b []byte) string {
+	out := make([]byte, len(b))
+	for i := 0; i+1 < len(b); i += 2 {
+		out[i], out[i+1] = b[i+1], b[i]
+	}
+	return strings.TrimSpace(string(out))
+}
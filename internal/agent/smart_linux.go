@@ -0,0 +1,146 @@
+// internal/agent/smart_linux.go
+package agent
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// nvmeAdminCmd mirrors struct nvme_admin_cmd from <linux/nvme_ioctl.h>.
+type nvmeAdminCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+const (
+	// _IOWR('N', 0x41, struct nvme_admin_cmd)
+	nvmeIoctlAdminCmd = 0xC0484E41
+	nvmeAdminGetLog   = 0x02
+	nvmeLogSmart      = 0x02
+	nvmeNSIDAll       = 0xFFFFFFFF
+)
+
+// nvmeSmartLog fetches the controller-wide SMART / Health Information log
+// page with a Get Log Page admin command.
+func nvmeSmartLog(dev string) ([]byte, error) {
+	fd, err := syscall.Open(dev, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	buf := make([]byte, smartLogSize)
+	cmd := nvmeAdminCmd{
+		opcode:    nvmeAdminGetLog,
+		nsid:      nvmeNSIDAll,
+		addr:      uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		dataLen:   smartLogSize,
+		cdw10:     uint32(smartLogSize/4-1)<<16 | nvmeLogSmart, // NUMDL (0-based dwords) | LID
+		timeoutMs: 5000,
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), nvmeIoctlAdminCmd, uintptr(unsafe.Pointer(&cmd)))
+	runtime.KeepAlive(buf)
+	if errno != 0 {
+		return nil, fmt.Errorf("NVME_IOCTL_ADMIN_CMD: %w", errno)
+	}
+	return buf, nil
+}
+
+// sgIOHdr mirrors struct sg_io_hdr from <scsi/sg.h>.
+type sgIOHdr struct {
+	interfaceID    int32
+	dxferDirection int32
+	cmdLen         uint8
+	mxSbLen        uint8
+	iovecCount     uint16
+	dxferLen       uint32
+	dxferp         uintptr
+	cmdp           uintptr
+	sbp            uintptr
+	timeout        uint32
+	flags          uint32
+	packID         int32
+	usrPtr         uintptr
+	status         uint8
+	maskedStatus   uint8
+	msgStatus      uint8
+	sbLenWr        uint8
+	hostStatus     uint16
+	driverStatus   uint16
+	resid          int32
+	duration       uint32
+	info           uint32
+}
+
+const (
+	sgIO            = 0x2285
+	sgDxferFromDev  = -3
+	sgInfoOKMask    = 0x1
+	ataPassThrough  = 0x85 // ATA PASS-THROUGH (16)
+	ataProtoPIOIn   = 4 << 1
+	ataTDirBlocks   = 0x0E // T_DIR=in, BYT_BLOK=1, T_LENGTH=sector count
+	ataSmartLBAMid  = 0x4F
+	ataSmartLBAHigh = 0xC2
+)
+
+// ataCommand sends a single-sector PIO-in ATA command through SG_IO using
+// ATA PASS-THROUGH (16), which libata translates for SATA disks.
+func ataCommand(dev string, command, feature byte) ([]byte, error) {
+	fd, err := syscall.Open(dev, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	cdb := [16]byte{ataPassThrough, ataProtoPIOIn, ataTDirBlocks}
+	cdb[4] = feature
+	cdb[6] = 1 // sector count
+	if command == ataCmdSmart {
+		cdb[10] = ataSmartLBAMid
+		cdb[12] = ataSmartLBAHigh
+	}
+	cdb[14] = command
+
+	buf := make([]byte, smartLogSize)
+	sense := make([]byte, 32)
+	hdr := sgIOHdr{
+		interfaceID:    'S',
+		dxferDirection: sgDxferFromDev,
+		cmdLen:         uint8(len(cdb)),
+		mxSbLen:        uint8(len(sense)),
+		dxferLen:       smartLogSize,
+		dxferp:         uintptr(unsafe.Pointer(&buf[0])),
+		cmdp:           uintptr(unsafe.Pointer(&cdb[0])),
+		sbp:            uintptr(unsafe.Pointer(&sense[0])),
+		timeout:        5000,
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), sgIO, uintptr(unsafe.Pointer(&hdr)))
+	runtime.KeepAlive(buf)
+	runtime.KeepAlive(&cdb)
+	runtime.KeepAlive(sense)
+	if errno != 0 {
+		return nil, fmt.Errorf("SG_IO: %w", errno)
+	}
+	if hdr.info&sgInfoOKMask != 0 {
+		return nil, fmt.Errorf("SG_IO: command failed (status=%#x host=%#x driver=%#x)", hdr.status, hdr.hostStatus, hdr.driverStatus)
+	}
+	return buf, nil
+}
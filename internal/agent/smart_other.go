@@ -0,0 +1,12 @@
+// internal/agent/smart_other.go
+//go:build !linux
+
+package agent
+
+func nvmeSmartLog(dev string) ([]byte, error) {
+	return nil, errSmartUnsupported
+}
+
+func ataCommand(dev string, command, feature byte) ([]byte, error) {
+	return nil, errSmartUnsupported
+}
@@ -0,0 +1,83 @@
+// internal/agent/smart_test.go
+package agent
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseNVMeSmartLog(t *testing.T) {
+	page := make([]byte, smartLogSize)
+	page[0] = 0x04                                   // reliability degraded
+	binary.LittleEndian.PutUint16(page[1:3], 273+45) // 45C in Kelvin
+	page[3] = 7                                      // available spare
+	page[4] = 10                                     // spare threshold
+	page[5] = 93                                     // percentage used
+	binary.LittleEndian.PutUint64(page[128:136], 26280)
+	binary.LittleEndian.PutUint64(page[144:152], 12)
+	binary.LittleEndian.PutUint64(page[160:168], 3)
+
+	s := parseNVMeSmartLog(page)
+	if s.Protocol != "nvme" {
+		t.Errorf("Protocol = %q, want nvme", s.Protocol)
+	}
+	if s.CriticalWarning != 0x04 || s.TemperatureCelsius != 45 {
+		t.Errorf("warning/temp = %#x/%d, want 0x4/45", s.CriticalWarning, s.TemperatureCelsius)
+	}
+	if s.AvailableSpare != 7 || s.AvailableSpareThreshold != 10 || s.PercentageUsed != 93 {
+		t.Errorf("spare/threshold/used = %d/%d/%d, want 7/10/93", s.AvailableSpare, s.AvailableSpareThreshold, s.PercentageUsed)
+	}
+	if s.PowerOnHours != 26280 || s.UnsafeShutdowns != 12 || s.MediaErrors != 3 {
+		t.Errorf("hours/shutdowns/media = %d/%d/%d, want 26280/12/3", s.PowerOnHours, s.UnsafeShutdowns, s.MediaErrors)
+	}
+
+	// A short read must not panic.
+	if s := parseNVMeSmartLog(page[:10]); s.MediaErrors != 0 {
+		t.Errorf("short page decoded MediaErrors = %d", s.MediaErrors)
+	}
+}
+
+func TestParseATASmart(t *testing.T) {
+	data := make([]byte, smartLogSize)
+	thresh := make([]byte, smartLogSize)
+
+	// Slot 0: Reallocated_Sector_Ct, value 100, worst 100, raw 8.
+	copy(data[2:], []byte{5, 0x33, 0x00, 100, 100, 8, 0, 0, 0, 0, 0, 0})
+	copy(thresh[2:], []byte{5, 36})
+	// Slot 1: Current_Pending_Sector with a multi-byte raw (0x010203 = 66051).
+	copy(data[14:], []byte{197, 0x32, 0x00, 1, 1, 0x03, 0x02, 0x01, 0, 0, 0, 0})
+	copy(thresh[14:], []byte{197, 0})
+
+	attrs := parseATASmart(data, thresh)
+	if len(attrs) != 2 {
+		t.Fatalf("got %d attributes, want 2", len(attrs))
+	}
+	if a := attrs[0]; a.ID != 5 || a.Name != "Reallocated_Sector_Ct" || a.Value != 100 || a.Threshold != 36 || a.Raw != 8 {
+		t.Errorf("attr 5 = %+v", a)
+	}
+	if a := attrs[1]; a.ID != 197 || a.Raw != 66051 || a.Threshold != 0 {
+		t.Errorf("attr 197 = %+v", a)
+	}
+}
+
+func TestParseATAIdentify(t *testing.T) {
+	ident := make([]byte, smartLogSize)
+	// ATA strings are byte-swapped per 16-bit word and space padded.
+	swap := func(s string, n int) []byte {
+		b := []byte(s)
+		for len(b) < n {
+			b = append(b, ' ')
+		}
+		for i := 0; i+1 < len(b); i += 2 {
+			b[i], b[i+1] = b[i+1], b[i]
+		}
+		return b
+	}
+	copy(ident[20:40], swap("WD-WCC4N1234567", 20))
+	copy(ident[54:94], swap("WDC WD40EFRX-68N32N0", 40))
+
+	serial, model := parseATAIdentify(ident)
+	if serial != "WD-WCC4N1234567" || model != "WDC WD40EFRX-68N32N0" {
+		t.Errorf("serial/model = %q/%q", serial, model)
+	}
+}
@@ -0,0 +1,80 @@
+// internal/agent/source.go
+package agent
+
+import (
+	"encoding/json"
+	"log"
+	"syscall"
+
+	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Source is one place the agent reads log records from.
+//
+// Read returns the records that follow cursor, plus the cursor to persist
+// once those records have been delivered. Cursors are opaque strings owned
+// by the source; an empty or unrecognised cursor means "start fresh". A
+// source with nothing new returns the cursor it was given.
+type Source interface {
+	Name() string
+	Read(cursor string) ([]protocol.Record, string, error)
+}
+
+// NewSource builds the source described by an already-validated config entry.
+func NewSource(sc config.SourceConfig) Source {
+	switch sc.Type {
+	case "kmsg":
+		return &kmsgSource{name: sc.Name, path: kmsgPath}
+	case "dmesg":
+		return &dmesgSource{name: sc.Name}
+	case "file":
+		return &fileSource{name: sc.Name, path: sc.Path, format: sc.Format, level: sc.LevelValue}
+	case "journal":
+		return &journalSource{name: sc.Name, path: sc.Path, command: sc.Command}
+	case "rasdaemon":
+		return &rasdaemonSource{name: sc.Name, path: sc.Path}
+	}
+	// LoadAgentConfig rejects unknown types, so this is a programming error.
+	panic("unknown source type " + sc.Type)
+}
+
+// defaultSources is what an agent with no sources list reads: the kernel
+// ring buffer. /dev/kmsg is preferred because it carries the SUBSYSTEM and
+// DEVICE tags; older kernels and restricted containers fall back to dmesg.
+func defaultSources() []Source {
+	fd, err := syscall.Open(kmsgPath, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		log.Printf("Cannot open %s (%v), reading the kernel log via dmesg", kmsgPath, err)
+		return []Source{&dmesgSource{name: "dmesg"}}
+	}
+	syscall.Close(fd)
+	return []Source{&kmsgSource{name: "kmsg", path: kmsgPath}}
+}
+
+// rasdaemonSource tails rasdaemon's event database. Its cursor is the
+// per-table row ID map, JSON-encoded.
+type rasdaemonSource struct {
+	name string
+	path string
+}
+
+func (s *rasdaemonSource) Name() string { return s.name }
+
+func (s *rasdaemonSource) Read(cursor string) ([]protocol.Record, string, error) {
+	prev := map[string]int64{}
+	if cursor != "" {
+		// A corrupt cursor restarts from the first row, like a corrupt
+		// state file.
+		json.Unmarshal([]byte(cursor), &prev)
+	}
+	records, next, err := ReadRasdaemon(s.path, prev)
+	if err != nil || len(records) == 0 {
+		return nil, cursor, err
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return nil, cursor, err
+	}
+	return records, string(data), nil
+}
@@ -2,50 +2,100 @@
 package agent
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/signalnine/tasseograph/internal/config"
 )
 
 const timestampFormat = time.RFC3339Nano
 
-// ReadLastTimestamp reads the last processed timestamp from file.
-// Returns zero time if file doesn't exist or is corrupt.
-func ReadLastTimestamp(path string) (time.Time, error) {
+// legacyCursorSources are the sources that inherit a pre-Source state file.
+// That file held one bare timestamp for the kernel ring buffer, which both
+// kernel sources accept as a starting cursor.
+var legacyCursorSources = []string{"kmsg", "dmesg"}
+
+// legacyRasdaemonSuffix names the file beside the state file that held the
+// rasdaemon row cursor before per-source cursors. Its JSON is the cursor
+// the rasdaemon source keeps, so it is carried over as is.
+const legacyRasdaemonSuffix = ".rasdaemon"
+
+// ReadCursors reads the per-source cursor map from the state file. Each
+// value is opaque to everything but the source that produced it.
+// Returns an empty map if the file doesn't exist or is corrupt.
+func ReadCursors(path string) (map[string]string, error) {
+	cursors, err := readCursors(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := cursors[config.LegacyRasdaemonSource]; !ok {
+		data, err := os.ReadFile(path + legacyRasdaemonSuffix)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(data) > 0 {
+			cursors[config.LegacyRasdaemonSource] = strings.TrimSpace(string(data))
+		}
+	}
+	return cursors, nil
+}
+
+func readCursors(path string) (map[string]string, error) {
+	cursors := map[string]string{}
 	data, err := os.ReadFile(path)
 	if os.IsNotExist(err) {
-		return time.Time{}, nil
+		return cursors, nil
 	}
 	if err != nil {
-		return time.Time{}, err
+		return nil, err
 	}
 
-	ts, err := time.Parse(timestampFormat, strings.TrimSpace(string(data)))
-	if err != nil {
-		// Corrupt file - return zero time for fresh start
-		return time.Time{}, nil
+	if err := json.Unmarshal(data, &cursors); err == nil {
+		return cursors, nil
 	}
 
-	return ts, nil
+	// State files written before per-source cursors hold a bare timestamp.
+	// Carry it over so an upgrade doesn't resend the whole ring buffer.
+	cursors = map[string]string{}
+	if ts, err := time.Parse(timestampFormat, strings.TrimSpace(string(data))); err == nil {
+		for _, name := range legacyCursorSources {
+			cursors[name] = ts.Format(timestampFormat)
+		}
+	}
+	// Otherwise corrupt - empty map for a fresh start
+	return cursors, nil
 }
 
-// WriteLastTimestamp writes the timestamp to the state file atomically.
+// WriteCursors writes the cursor map to the state file atomically.
 // Writes to <path>.tmp then renames into place; POSIX rename(2) guarantees
 // the destination is either the old content or the new content, never partial.
-func WriteLastTimestamp(path string, ts time.Time) error {
+func WriteCursors(path string, cursors map[string]string) error {
+	data, err := json.Marshal(cursors)
+	if err != nil {
+		return err
+	}
+
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
 	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, []byte(ts.Format(timestampFormat)), 0644); err != nil {
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
 		return err
 	}
 	if err := os.Rename(tmp, path); err != nil {
 		os.Remove(tmp)
 		return err
 	}
+	// The legacy rasdaemon cursor has moved into the map.
+	if _, ok := cursors[config.LegacyRasdaemonSource]; ok {
+		if err := os.Remove(path + legacyRasdaemonSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	return nil
 }
@@ -5,35 +5,35 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
-	"time"
 )
 
 func TestStateReadWrite(t *testing.T) {
 	dir := t.TempDir()
 	statePath := filepath.Join(dir, "last_timestamp")
 
-	// Initially should return zero time
-	ts, err := ReadLastTimestamp(statePath)
+	// Initially should return an empty map
+	cursors, err := ReadCursors(statePath)
 	if err != nil {
-		t.Fatalf("ReadLastTimestamp (missing file) error: %v", err)
+		t.Fatalf("ReadCursors (missing file) error: %v", err)
 	}
-	if !ts.IsZero() {
-		t.Errorf("expected zero time for missing file, got %v", ts)
+	if len(cursors) != 0 {
+		t.Errorf("expected no cursors for missing file, got %v", cursors)
 	}
 
-	// Write a timestamp
-	now := time.Date(2026, 2, 3, 12, 30, 0, 0, time.UTC)
-	if err := WriteLastTimestamp(statePath, now); err != nil {
-		t.Fatalf("WriteLastTimestamp error: %v", err)
+	want := map[string]string{"kmsg": "boot:1204", "file:/var/log/kern.log": `{"inode":7,"offset":42}`}
+	if err := WriteCursors(statePath, want); err != nil {
+		t.Fatalf("WriteCursors error: %v", err)
 	}
 
 	// Read it back
-	ts, err = ReadLastTimestamp(statePath)
+	cursors, err = ReadCursors(statePath)
 	if err != nil {
-		t.Fatalf("ReadLastTimestamp error: %v", err)
+		t.Fatalf("ReadCursors error: %v", err)
 	}
-	if !ts.Equal(now) {
-		t.Errorf("ReadLastTimestamp = %v, want %v", ts, now)
+	for k, v := range want {
+		if cursors[k] != v {
+			t.Errorf("cursor %q = %q, want %q", k, cursors[k], v)
+		}
 	}
 }
 
@@ -44,17 +44,59 @@ func TestStateCorruptFile(t *testing.T) {
 	// Write garbage
 	os.WriteFile(statePath, []byte("not a timestamp"), 0644)
 
-	// Should return zero time (fresh start)
-	ts, err := ReadLastTimestamp(statePath)
+	// Should return an empty map (fresh start)
+	cursors, err := ReadCursors(statePath)
 	if err != nil {
-		t.Fatalf("ReadLastTimestamp (corrupt) error: %v", err)
+		t.Fatalf("ReadCursors (corrupt) error: %v", err)
 	}
-	if !ts.IsZero() {
-		t.Errorf("expected zero time for corrupt file, got %v", ts)
+	if len(cursors) != 0 {
+		t.Errorf("expected no cursors for corrupt file, got %v", cursors)
 	}
 }
 
-// TestWriteIsAtomicViaRename verifies WriteLastTimestamp writes to a temp file
+// TestStateLegacyTimestamp verifies a state file from before per-source
+// cursors, holding one bare timestamp, seeds the kernel sources.
+func TestStateLegacyTimestamp(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "last_timestamp")
+	os.WriteFile(statePath, []byte("2026-02-03T12:30:00Z"), 0644)
+
+	cursors, err := ReadCursors(statePath)
+	if err != nil {
+		t.Fatalf("ReadCursors: %v", err)
+	}
+	for _, name := range []string{"kmsg", "dmesg"} {
+		if cursors[name] != "2026-02-03T12:30:00Z" {
+			t.Errorf("cursor %q = %q, want the legacy timestamp", name, cursors[name])
+		}
+	}
+}
+
+// TestStateLegacyRasdaemonCursor verifies the rasdaemon row cursor kept
+// beside the state file before per-source cursors moves into the map.
+func TestStateLegacyRasdaemonCursor(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "last_timestamp")
+	os.WriteFile(statePath, []byte(`{"kmsg":"boot:1204"}`), 0644)
+	os.WriteFile(statePath+".rasdaemon", []byte(`{"mc_event":42}`+"\n"), 0644)
+
+	cursors, err := ReadCursors(statePath)
+	if err != nil {
+		t.Fatalf("ReadCursors: %v", err)
+	}
+	if cursors["rasdaemon"] != `{"mc_event":42}` || cursors["kmsg"] != "boot:1204" {
+		t.Fatalf("cursors = %v, want the legacy rasdaemon cursor carried over", cursors)
+	}
+	if err := WriteCursors(statePath, cursors); err != nil {
+		t.Fatalf("WriteCursors: %v", err)
+	}
+	if _, err := os.Stat(statePath + ".rasdaemon"); !os.IsNotExist(err) {
+		t.Errorf("legacy cursor file left behind: %v", err)
+	}
+	if cursors, _ := ReadCursors(statePath); cursors["rasdaemon"] != `{"mc_event":42}` {
+		t.Errorf("cursor after migration = %q", cursors["rasdaemon"])
+	}
+}
+
+// TestWriteIsAtomicViaRename verifies WriteCursors writes to a temp file
 // and renames it into place. A pre-existing .tmp file with garbage must not
 // remain after a successful write.
 func TestWriteIsAtomicViaRename(t *testing.T) {
@@ -67,21 +109,20 @@ func TestWriteIsAtomicViaRename(t *testing.T) {
 		t.Fatalf("seeding stale tmp: %v", err)
 	}
 
-	now := time.Date(2026, 4, 27, 9, 0, 0, 0, time.UTC)
-	if err := WriteLastTimestamp(statePath, now); err != nil {
-		t.Fatalf("WriteLastTimestamp: %v", err)
+	if err := WriteCursors(statePath, map[string]string{"dmesg": "2026-04-27T09:00:00Z"}); err != nil {
+		t.Fatalf("WriteCursors: %v", err)
 	}
 
 	if _, err := os.Stat(tmpPath); !os.IsNotExist(err) {
 		t.Errorf("stale .tmp must be gone after atomic rename, stat err = %v", err)
 	}
 
-	got, err := ReadLastTimestamp(statePath)
+	got, err := ReadCursors(statePath)
 	if err != nil {
-		t.Fatalf("ReadLastTimestamp: %v", err)
+		t.Fatalf("ReadCursors: %v", err)
 	}
-	if !got.Equal(now) {
-		t.Errorf("ReadLastTimestamp = %v, want %v", got, now)
+	if got["dmesg"] != "2026-04-27T09:00:00Z" {
+		t.Errorf("ReadCursors = %v", got)
 	}
 }
 
@@ -92,8 +133,7 @@ func TestWriteFailurePreservesOriginal(t *testing.T) {
 	statePath := filepath.Join(dir, "last_timestamp")
 	tmpPath := statePath + ".tmp"
 
-	t1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
-	if err := WriteLastTimestamp(statePath, t1); err != nil {
+	if err := WriteCursors(statePath, map[string]string{"kmsg": "boot:1"}); err != nil {
 		t.Fatalf("seed write: %v", err)
 	}
 
@@ -102,16 +142,15 @@ func TestWriteFailurePreservesOriginal(t *testing.T) {
 		t.Fatalf("mkdir tmp squat: %v", err)
 	}
 
-	t2 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
-	if err := WriteLastTimestamp(statePath, t2); err == nil {
-		t.Fatalf("WriteLastTimestamp should fail when .tmp path is unwritable")
+	if err := WriteCursors(statePath, map[string]string{"kmsg": "boot:2"}); err == nil {
+		t.Fatalf("WriteCursors should fail when .tmp path is unwritable")
 	}
 
-	got, err := ReadLastTimestamp(statePath)
+	got, err := ReadCursors(statePath)
 	if err != nil {
-		t.Fatalf("ReadLastTimestamp: %v", err)
+		t.Fatalf("ReadCursors: %v", err)
 	}
-	if !got.Equal(t1) {
-		t.Errorf("original state corrupted: got %v, want %v", got, t1)
+	if got["kmsg"] != "boot:1" {
+		t.Errorf("original state corrupted: got %v", got)
 	}
 }
@@ -0,0 +1,167 @@
+// internal/collector/archive.go
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Archiver keeps the results a prune is about to delete, or drop the dmesg
+// text of, in gzipped JSON Lines files under Dir: one file per day of the
+// results' timestamps, e.g. Dir/2026/05/2026-05-12.jsonl.gz. Each batch is
+// appended as a gzip member of its own and synced before the prune goes
+// ahead, so a crash loses nothing but may archive a result twice.
+type Archiver struct {
+	Dir string
+}
+
+// Write archives results.
+func (a *Archiver) Write(results []protocol.StoredResult) error {
+	byDay := map[string][]*protocol.StoredResult{}
+	var days []string
+	for i := range results {
+		day := results[i].Timestamp.UTC().Format("2006-01-02")
+		if byDay[day] == nil {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], &results[i])
+	}
+	for _, day := range days {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		enc := json.NewEncoder(zw)
+		for _, r := range byDay[day] {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		if err := a.appendFile(day, buf.Bytes()); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a *Archiver) appendFile(day string, data []byte) error {
+	path := filepath.Join(a.Dir, day[:4], day[5:7], day+".jsonl.gz")
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// archiveResults hands the results matching cond to archive, when there is
+// one, and returns how many.
+func (d *sqlStore) archiveResults(archive *Archiver, cond string, args ...interface{}) (int64, error) {
+	if archive == nil {
+		return 0, nil
+	}
+	var n int64
+	err := d.eachResult(cond, args, func(batch []protocol.StoredResult) error {
+		n += int64(len(batch))
+		return archive.Write(batch)
+	})
+	return n, err
+}
+
+// ImportStats reports an ImportArchive run.
+type ImportStats struct {
+	Files    int
+	Results  int64 // results imported
+	Repeated int64 // copies of results already imported, skipped
+}
+
+// ImportArchive loads the results in the archive files at paths, or in the
+// .jsonl and .jsonl.gz files under them if they are directories, keeping
+// their ids and created_at. Files are read in name order, so the first
+// copy of a result archived twice -- once when its dmesg was dropped, with
+// the text, then again when it was deleted -- is the one kept.
+func (d *DB) ImportArchive(paths []string) (ImportStats, error) {
+	var stats ImportStats
+	var files []string
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(path string, e os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if e.IsDir() {
+				return nil
+			}
+			if path == p || strings.HasSuffix(path, ".jsonl") || strings.HasSuffix(path, ".jsonl.gz") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	sort.Strings(files)
+	for _, path := range files {
+		if err := d.importFile(path, &stats); err != nil {
+			return stats, fmt.Errorf("%s: %w", path, err)
+		}
+		stats.Files++
+	}
+	return stats, nil
+}
+
+func (d *DB) importFile(path string, stats *ImportStats) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	dec := json.NewDecoder(r)
+	for {
+		var res protocol.StoredResult
+		if err := dec.Decode(&res); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		added, err := d.insertResult(&res, true)
+		if err != nil {
+			return fmt.Errorf("result %d: %w", res.ID, err)
+		}
+		if added {
+			stats.Results++
+		} else {
+			stats.Repeated++
+		}
+	}
+}
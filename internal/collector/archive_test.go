@@ -0,0 +1,86 @@
+// internal/collector/archive_test.go
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// TestArchiveAndImport prunes with an archive, in two steps as retention
+// rules would, and loads the archive into a scratch database.
+func TestArchiveAndImport(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(filepath.Join(dir, "live.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := time.Date(2026, 5, 12, 23, 30, 0, 0, time.UTC)
+	var want []protocol.StoredResult
+	for i, status := range []string{"ok", "critical", "ok"} {
+		r := protocol.StoredResult{Timestamp: ts.Add(time.Duration(i) * time.Hour), Hostname: "web-1", Status: status, RawDmesg: "nvme0: I/O timeout",
+			Issues: []protocol.Issue{{Summary: "NVMe timeout", Evidence: "nvme0: I/O timeout"}}}
+		if err := db.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, r)
+	}
+	if _, err := db.exec(`UPDATE results SET created_at = ?`, "2026-05-13 01:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		want[i].CreatedAt = time.Date(2026, 5, 13, 1, 0, 0, 0, time.UTC)
+	}
+
+	archive := &Archiver{Dir: filepath.Join(dir, "archive")}
+	stats, err := db.Prune(0, []config.RetentionRule{{Status: "ok", Days: 7, Action: config.RetentionDropDmesg}}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Archived != 2 || stats.Dropped != 2 {
+		t.Errorf("dropping dmesg: %+v, want 2 archived and dropped", stats)
+	}
+	stats, err = db.Prune(7, nil, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Archived != 3 || stats.Deleted != 3 {
+		t.Errorf("deleting: %+v, want 3 archived and deleted", stats)
+	}
+	for _, day := range []string{"2026/05/2026-05-12.jsonl.gz", "2026/05/2026-05-13.jsonl.gz"} {
+		if _, err := os.Stat(filepath.Join(archive.Dir, day)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	scratch, err := NewDB(filepath.Join(dir, "scratch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scratch.Close()
+	imported, err := scratch.ImportArchive([]string{archive.Dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != (ImportStats{Files: 2, Results: 3, Repeated: 2}) {
+		t.Errorf("ImportArchive = %+v", imported)
+	}
+	for _, w := range want {
+		got, err := scratch.QueryResult(w.ID)
+		if err != nil || got == nil {
+			t.Fatalf("result %d: %v, %v", w.ID, got, err)
+		}
+		if !reflect.DeepEqual(*got, w) {
+			t.Errorf("result %d:\ngot  %+v\nwant %+v", w.ID, *got, w)
+		}
+	}
+	if hits, _ := scratch.Search(SearchQuery{Query: "I/O timeout"}); len(hits) != 3 {
+		t.Errorf("search after import found %d results, want 3", len(hits))
+	}
+}
@@ -0,0 +1,251 @@
+// internal/collector/backup.go
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// A SQLite database in WAL mode is its file plus the -wal file beside it,
+// which a copy of the file alone may miss or catch half-written. Backups
+// go through SQLite's online backup API instead, which copies a consistent
+// snapshot while the collector keeps writing.
+
+// backupPrefix names scheduled backups: tasseograph-20260512T100000Z.db.
+const backupPrefix = "tasseograph-"
+
+// BackupDB copies the SQLite database at path to dst. The copy is written
+// beside dst and renamed into place, so dst is never a partial backup.
+func BackupDB(path, dst string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return backupConn(conn, dst)
+}
+
+func backupConn(conn *sql.Conn, dst string) error {
+	tmp := dst + ".tmp"
+	os.Remove(tmp)
+	err := conn.Raw(func(c interface{}) error {
+		bc, ok := c.(interface {
+			NewBackup(string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return fmt.Errorf("sqlite driver connection %T has no backup API", c)
+		}
+		b, err := bc.NewBackup(tmp)
+		if err != nil {
+			return err
+		}
+		// One step, so the copy is of one snapshot: the WAL lets the
+		// collector write meanwhile.
+		_, err = b.Step(-1)
+		if ferr := b.Finish(); err == nil {
+			err = ferr
+		}
+		return err
+	})
+	if err == nil {
+		err = syncFile(tmp)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// BackupName returns the path of a new backup in dir.
+func BackupName(dir string) string {
+	return filepath.Join(dir, backupPrefix+time.Now().UTC().Format("20060102T150405Z")+".db")
+}
+
+// rotateBackups deletes all but the newest keep backups in dir.
+func rotateBackups(dir string, keep int) error {
+	names, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*.db"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := os.Remove(names[0]); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// startBackups kicks off a background goroutine that backs the SQLite
+// database up into BackupDir every BackupInterval, keeping the newest
+// BackupKeep, until ctx is canceled. BackupInterval == 0 disables it.
+func startBackups(ctx context.Context, cfg *config.CollectorConfig) {
+	if cfg.BackupInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.BackupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := os.MkdirAll(cfg.BackupDir, 0750); err != nil {
+					log.Printf("Backup error: %v", err)
+					continue
+				}
+				name := BackupName(cfg.BackupDir)
+				if err := BackupDB(cfg.DBPath, name); err != nil {
+					log.Printf("Backup error: %v", err)
+					continue
+				}
+				log.Printf("Backup written to %s", name)
+				if err := rotateBackups(cfg.BackupDir, cfg.BackupKeep); err != nil {
+					log.Printf("Backup rotation error: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// ErrDBInUse is returned by RestoreDB when something, such as a running
+// collector, has the database open.
+var ErrDBInUse = errors.New("the database is in use: stop the collector first")
+
+// RestoreDB replaces the SQLite database at path with the backup at from,
+// and returns the backup's schema version. The backup is copied beside
+// path and checked there -- PRAGMA integrity_check, and a schema version
+// this release can migrate -- before it is renamed over path. The database
+// it replaces is kept as path + ".pre-restore".
+func RestoreDB(path, from string) (int, error) {
+	tmp := path + ".restore"
+	if err := BackupDB(from, tmp); err != nil {
+		return 0, fmt.Errorf("copy backup: %w", err)
+	}
+	defer os.Remove(tmp)
+	version, err := checkBackup(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if err := keepPreRestore(path); err != nil {
+			return 0, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	// The old database's WAL would be replayed into the new one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// checkBackup returns the schema version of the database at path, once it
+// has passed an integrity check.
+func checkBackup(path string) (int, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return 0, fmt.Errorf("integrity check: %w", err)
+	}
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if len(problems) > 0 {
+		return 0, fmt.Errorf("backup fails its integrity check: %s", strings.Join(problems, "; "))
+	}
+
+	version, err := schemaVersion(db)
+	switch {
+	case err != nil:
+		return 0, err
+	case version == 0:
+		return 0, errors.New("backup is not a tasseograph database: it has no schema version")
+	case version > latestSchemaVersion():
+		return 0, fmt.Errorf("backup is at schema version %d, newer than this release's %d", version, latestSchemaVersion())
+	}
+	return version, nil
+}
+
+// keepPreRestore copies the database at path to path + ".pre-restore",
+// through a connection holding it exclusively, so it fails with
+// ErrDBInUse if anything else has it open.
+func keepPreRestore(path string) error {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(0)")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(context.Background(), `PRAGMA locking_mode = EXCLUSIVE`); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(context.Background(), `BEGIN EXCLUSIVE; COMMIT`); err != nil {
+		var se *sqlite.Error
+		if errors.As(err, &se) && se.Code()&0xff == sqlite3.SQLITE_BUSY {
+			return ErrDBInUse
+		}
+		return err
+	}
+	return backupConn(conn, path+".pre-restore")
+}
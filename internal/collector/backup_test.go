@@ -0,0 +1,151 @@
+// internal/collector/backup_test.go
+package collector
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func countResults(t *testing.T, path string) int {
+	t.Helper()
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.queryRow(`SELECT COUNT(*) FROM results`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// TestBackupAndRestore backs a database up while it is written to, then
+// restores the backup over it.
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert := func() {
+		r := protocol.StoredResult{Timestamp: time.Now().UTC(), Hostname: "h", Status: "ok", RawDmesg: "eth0: link up"}
+		if err := db.InsertResult(&r); err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		insert()
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			insert()
+		}
+	}()
+	backup := filepath.Join(dir, "backup.db")
+	if err := BackupDB(path, backup); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	backedUp := countResults(t, backup)
+	if backedUp < 100 {
+		t.Errorf("backup has %d results, want at least 100", backedUp)
+	}
+
+	if _, err := RestoreDB(path, backup); !errors.Is(err, ErrDBInUse) {
+		t.Errorf("restore with the database open = %v, want ErrDBInUse", err)
+	}
+	db.Close()
+	version, err := RestoreDB(path, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != latestSchemaVersion() {
+		t.Errorf("restored schema version %d, want %d", version, latestSchemaVersion())
+	}
+	if n := countResults(t, path); n != backedUp {
+		t.Errorf("restored database has %d results, want %d", n, backedUp)
+	}
+	if n := countResults(t, path+".pre-restore"); n != 200 {
+		t.Errorf("pre-restore copy has %d results, want 200", n)
+	}
+	for _, leftover := range []string{path + ".restore", backup + ".tmp"} {
+		if _, err := os.Stat(leftover); err == nil {
+			t.Errorf("%s left behind", leftover)
+		}
+	}
+}
+
+func TestRestoreRejectsBadBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte(strings.Repeat("not a database ", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty.db")
+	raw, err := sql.Open("sqlite", empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Exec(`CREATE TABLE t (x)`)
+	raw.Close()
+	newer := filepath.Join(dir, "newer.db")
+	if err := BackupDB(path, newer); err != nil {
+		t.Fatal(err)
+	}
+	raw, err = sql.Open("sqlite", newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from the future')`, latestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	for name, from := range map[string]string{"garbage": garbage, "not tasseograph": empty, "newer schema": newer, "missing": filepath.Join(dir, "none.db")} {
+		if _, err := RestoreDB(path, from); err == nil {
+			t.Errorf("%s: restored", name)
+		}
+	}
+	if _, err := os.Stat(path + ".pre-restore"); err == nil {
+		t.Error("a rejected restore replaced the database")
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"tasseograph-20260510T000000Z.db", "tasseograph-20260511T000000Z.db", "tasseograph-20260512T000000Z.db", "other.db"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rotateBackups(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept := err == nil; kept != (i != 0) {
+			t.Errorf("%s kept = %v", name, kept)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// internal/collector/batch.go
+package collector
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Batcher pools small deltas from several hosts over a short window and
+// analyzes them in one LLM call, then stores a row per host as if each had
+// been analyzed alone. A quiet fleet sends many deltas of a few lines each,
+// and paying the system prompt once per batch instead of once per host is
+// most of the cost.
+type Batcher struct {
+	db        Store
+	llm       *LLMClient
+	window    time.Duration
+	maxHosts  int
+	maxTokens int
+
+	mu      sync.Mutex
+	pending []*batchItem
+	tokens  int
+	gen     int // bumped on every take so a stale timer can't flush a newer batch
+	timer   *time.Timer
+}
+
+type batchItem struct {
+	hostname string
+	source   string
+	ts       time.Time
+	lines    []string
+	done     chan batchOutcome
+}
+
+type batchOutcome struct {
+	stored *protocol.StoredResult
+	meta   AnalysisMeta
+	err    error
+}
+
+// errBatchPending is returned when the caller stops waiting for its batch.
+// The batch still stores the row, so it is not a failure: the caller must
+// not ask the sender to resend.
+var errBatchPending = errors.New("batch analysis still running")
+
+// batchSectionTokens covers the delimiter lines around each host's section.
+const batchSectionTokens = 16
+
+// NewBatcher creates a batcher that flushes a batch once it has been open
+// for window, holds maxHosts hosts, or would exceed maxTokens of prompt.
+// maxTokens is lowered to what the smallest endpoint can take.
+func NewBatcher(db Store, llm *LLMClient, window time.Duration, maxHosts, maxTokens int) *Batcher {
+	if llm != nil && len(llm.endpoints) > 0 {
+		maxTokens = min(maxTokens, llm.batchBudget())
+	}
+	return &Batcher{
+		db:        db,
+		llm:       llm,
+		window:    window,
+		maxHosts:  maxHosts,
+		maxTokens: maxTokens,
+	}
+}
+
+// Analyze has analyzeAndStore's contract but waits for the host's batch to
+// be analyzed. A delta too big to share a prompt is analyzed on its own
+// straight away.
+func (b *Batcher) Analyze(ctx context.Context, hostname, source string, ts time.Time, lines []string) (*protocol.StoredResult, AnalysisMeta, error) {
+	tokens := estimateTokens(lines) + batchSectionTokens
+	if b.llm == nil || tokens > b.maxTokens {
+		return analyzeAndStore(ctx, b.db, b.llm, hostname, source, ts, lines)
+	}
+
+	item := &batchItem{
+		hostname: hostname,
+		source:   source,
+		ts:       ts,
+		lines:    lines,
+		done:     make(chan batchOutcome, 1),
+	}
+
+	b.mu.Lock()
+	// Sections are keyed by hostname, so a second delta from a host already
+	// waiting starts the next batch rather than sharing this one.
+	if len(b.pending) > 0 && (b.tokens+tokens > b.maxTokens || b.hasHost(hostname)) {
+		go b.run(b.take())
+	}
+	b.pending = append(b.pending, item)
+	b.tokens += tokens
+	if len(b.pending) >= b.maxHosts {
+		go b.run(b.take())
+	} else if len(b.pending) == 1 {
+		gen := b.gen
+		b.timer = time.AfterFunc(b.window, func() { b.flushGen(gen) })
+	}
+	b.mu.Unlock()
+
+	select {
+	case out := <-item.done:
+		return out.stored, out.meta, out.err
+	case <-ctx.Done():
+		// The batch still runs and stores the row; only the caller's wait
+		// is abandoned.
+		return nil, AnalysisMeta{}, errBatchPending
+	}
+}
+
+func (b *Batcher) hasHost(hostname string) bool {
+	for _, it := range b.pending {
+		if it.hostname == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// take empties the pending batch and returns it. Callers hold mu.
+func (b *Batcher) take() []*batchItem {
+	items := b.pending
+	b.pending = nil
+	b.tokens = 0
+	b.gen++
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return items
+}
+
+func (b *Batcher) flushGen(gen int) {
+	b.mu.Lock()
+	if gen != b.gen || len(b.pending) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	items := b.take()
+	b.mu.Unlock()
+	b.run(items)
+}
+
+// run analyzes one batch and delivers each host's outcome. The LLM call
+// isn't tied to any one caller's request, so it runs on its own context;
+// the client's timeout still bounds it.
+func (b *Batcher) run(items []*batchItem) {
+	ctx := context.Background()
+	if len(items) == 1 {
+		it := items[0]
+		stored, meta, err := analyzeAndStore(ctx, b.db, b.llm, it.hostname, it.source, it.ts, it.lines)
+		it.done <- batchOutcome{stored, meta, err}
+		return
+	}
+
+	hosts := make([]HostLines, len(items))
+	for i, it := range items {
+		hosts[i] = HostLines{Hostname: it.hostname, Lines: it.lines}
+	}
+	results, meta, llmErr := b.llm.AnalyzeBatch(ctx, hosts)
+	log.Printf("LLM batch: %d hosts in one call (%dms)", len(items), meta.LatencyMs)
+	shares := splitMeta(meta, items)
+
+	for i, it := range items {
+		result := results[it.hostname]
+		if llmErr == nil && result == nil {
+			// The model dropped this host from its answer. Give it a call
+			// of its own rather than store a row with no verdict.
+			log.Printf("LLM batch omitted %s, analyzing alone", it.hostname)
+			stored, meta, err := analyzeAndStore(ctx, b.db, b.llm, it.hostname, it.source, it.ts, it.lines)
+			it.done <- batchOutcome{stored, meta, err}
+			continue
+		}
+		hostMeta := shares[i]
+		if llmErr == nil {
+			result, hostMeta = b.llm.reconsider(ctx, it.lines, result, hostMeta)
+		}
+		stored, err := storeResult(b.db, it.hostname, it.source, it.ts, it.lines, result, hostMeta, llmErr)
+		it.done <- batchOutcome{stored, hostMeta, err}
+	}
+}
+
+// splitMeta shares one batch call's latency and tokens among its hosts in
+// proportion to their lines, so the rows add up to the call once rather
+// than once per host. The last host takes the rounding remainder.
+func splitMeta(meta AnalysisMeta, items []*batchItem) []AnalysisMeta {
+	weights := make([]int, len(items))
+	total := 0
+	for i, it := range items {
+		weights[i] = estimateTokens(it.lines)
+		total += weights[i]
+	}
+	shares := make([]AnalysisMeta, len(items))
+	left := meta
+	for i := range items {
+		share := meta
+		if i < len(items)-1 {
+			share.LatencyMs = portion(meta.LatencyMs, weights[i], total)
+			share.PromptTokens = int(portion(int64(meta.PromptTokens), weights[i], total))
+			share.CompletionTokens = int(portion(int64(meta.CompletionTokens), weights[i], total))
+			left.LatencyMs -= share.LatencyMs
+			left.PromptTokens -= share.PromptTokens
+			left.CompletionTokens -= share.CompletionTokens
+		} else {
+			share.LatencyMs = left.LatencyMs
+			share.PromptTokens = left.PromptTokens
+			share.CompletionTokens = left.CompletionTokens
+		}
+		shares[i] = share
+	}
+	return shares
+}
+
+// portion is weight's share of n.
+func portion(n int64, weight, total int) int64 {
+	if total == 0 {
+		return 0
+	}
+	return n * int64(weight) / int64(total)
+}
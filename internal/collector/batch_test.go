@@ -0,0 +1,186 @@
+// internal/collector/batch_test.go
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var batchHostRE = regexp.MustCompile(`(?m)^=== host: (\S+) ===$`)
+
+// batchMockLLM answers batch prompts with a warning for every host except
+// those in omit, and single-host prompts with "ok". It counts both.
+func batchMockLLM(t *testing.T, omit string) (*httptest.Server, *int32, *int32) {
+	t.Helper()
+	var batches, singles int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		user := req.Messages[len(req.Messages)-1].Content
+
+		content := `{"status": "ok", "issues": []}`
+		if hosts := batchHostRE.FindAllStringSubmatch(user, -1); hosts != nil {
+			atomic.AddInt32(&batches, 1)
+			var entries []string
+			for _, m := range hosts {
+				if m[1] != omit {
+					entries = append(entries, fmt.Sprintf(`{"hostname": %q, "status": "warning", "issues": [{"summary": "seen", "evidence": %q}]}`, m[1], m[1]))
+				}
+			}
+			content = `{"hosts": [` + strings.Join(entries, ",") + `]}`
+		} else {
+			atomic.AddInt32(&singles, 1)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &batches, &singles
+}
+
+func TestBatcherFansOutPerHost(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	mock, batches, singles := batchMockLLM(t, "web03")
+	llm := NewLLMClient([]Endpoint{{URL: mock.URL, Model: "test", APIKey: "key"}}, 0)
+	b := NewBatcher(db, llm, 100*time.Millisecond, 10, 8000)
+
+	var wg sync.WaitGroup
+	for _, host := range []string{"web01", "web02", "web03"} {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if _, _, err := b.Analyze(context.Background(), host, "kmsg", time.Now(), []string{host + ": NETDEV WATCHDOG"}); err != nil {
+				t.Errorf("%s: %v", host, err)
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	// One shared call; web03 was left out of the answer and re-run alone.
+	if *batches != 1 || *singles != 1 {
+		t.Errorf("calls = %d batch, %d single; want 1, 1", *batches, *singles)
+	}
+	for host, want := range map[string]string{"web01": "warning", "web02": "warning", "web03": "ok"} {
+		results, _ := db.QueryByHostname(host, 10)
+		if len(results) != 1 || results[0].Status != want {
+			t.Fatalf("%s rows = %+v, want one %s", host, results, want)
+		}
+		if want == "warning" && results[0].Issues[0].Evidence != host {
+			t.Errorf("%s got another host's issue: %+v", host, results[0].Issues)
+		}
+		if results[0].RawDmesg != host+": NETDEV WATCHDOG" {
+			t.Errorf("%s raw_dmesg = %q", host, results[0].RawDmesg)
+		}
+	}
+}
+
+func TestBatcherLimits(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	mock, batches, singles := batchMockLLM(t, "")
+	llm := NewLLMClient([]Endpoint{{URL: mock.URL, Model: "test", APIKey: "key"}}, 0)
+
+	// Reaching max hosts flushes without waiting out the window.
+	b := NewBatcher(db, llm, time.Hour, 2, 8000)
+	var wg sync.WaitGroup
+	for _, host := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			b.Analyze(context.Background(), host, "kmsg", time.Now(), []string{"line"})
+		}(host)
+	}
+	wg.Wait()
+	if *batches != 1 {
+		t.Errorf("max hosts: batches = %d, want 1", *batches)
+	}
+
+	// A delta over the token budget skips batching.
+	b = NewBatcher(db, llm, time.Hour, 10, 10)
+	big := []string{strings.Repeat("x", 100)}
+	if _, _, err := b.Analyze(context.Background(), "big", "kmsg", time.Now(), big); err != nil {
+		t.Fatal(err)
+	}
+	if *singles != 1 {
+		t.Errorf("oversized: singles = %d, want 1", *singles)
+	}
+
+	// Two that don't fit together go out separately.
+	b = NewBatcher(db, llm, 50*time.Millisecond, 10, 60)
+	for _, host := range []string{"c", "d"} {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			b.Analyze(context.Background(), host, "kmsg", time.Now(), []string{strings.Repeat("y", 80)})
+		}(host)
+	}
+	wg.Wait()
+	if *batches != 1 || *singles != 3 {
+		t.Errorf("token budget: calls = %d batch, %d single; want 1, 3", *batches, *singles)
+	}
+}
+
+func TestSplitMeta(t *testing.T) {
+	items := []*batchItem{
+		{lines: []string{"a"}},
+		{lines: []string{"b", "c", "d"}},
+	}
+	meta := AnalysisMeta{LatencyMs: 1001, PromptTokens: 400, CompletionTokens: 101, Model: "test"}
+	shares := splitMeta(meta, items)
+
+	var sum AnalysisMeta
+	for _, s := range shares {
+		sum.add(s)
+		if s.Model != "test" {
+			t.Errorf("share lost the model: %+v", s)
+		}
+	}
+	if sum.LatencyMs != meta.LatencyMs || sum.PromptTokens != meta.PromptTokens || sum.CompletionTokens != meta.CompletionTokens {
+		t.Errorf("shares sum to %+v, want the call's %+v", sum, meta)
+	}
+	if shares[0].PromptTokens != 100 || shares[1].PromptTokens != 300 {
+		t.Errorf("prompt tokens = %d, %d; want 100, 300", shares[0].PromptTokens, shares[1].PromptTokens)
+	}
+}
+
+func TestBatcherAbandonedWait(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	mock, _, _ := batchMockLLM(t, "")
+	llm := NewLLMClient([]Endpoint{{URL: mock.URL, Model: "test", APIKey: "key"}}, 0)
+	b := NewBatcher(db, llm, 50*time.Millisecond, 10, 8000)
+
+	// The caller gives up before the window closes: that's not a failure,
+	// since the batch still stores the row.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := b.Analyze(ctx, "web01", "kmsg", time.Now(), []string{"NETDEV WATCHDOG"}); err != errBatchPending {
+		t.Fatalf("err = %v, want errBatchPending", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if results, _ := db.QueryByHostname("web01", 10); len(results) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("row never stored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
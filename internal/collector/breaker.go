@@ -0,0 +1,174 @@
+// internal/collector/breaker.go
+package collector
+
+import (
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Circuit breaker and retry pacing defaults. A breaker opens after
+// threshold consecutive availability failures and stays open for the
+// cooldown before letting a single probe through.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+
+	// retryBaseDelay doubles per attempt up to retryMaxDelay; the actual
+	// sleep is a uniformly random fraction of that ("full jitter") so
+	// collectors retrying the same outage don't synchronise.
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+
+	// maxRetryAfter is the longest Retry-After we'll sleep through. A
+	// longer one opens the breaker for that long instead, and the request
+	// falls through to the next endpoint.
+	maxRetryAfter = 30 * time.Second
+)
+
+// errCircuitOpen is wrapped in a ClassCircuitOpen error instead of calling
+// an endpoint whose breaker is open; the chain always moves on.
+var errCircuitOpen = errors.New("circuit open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker tracks one endpoint's health. Only availability failures count;
+// an endpoint that answers, even with something unparseable, is up.
+type breaker struct {
+	name      string // for logs, e.g. "endpoint 1 (gpt-4o-mini)"
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int       // consecutive
+	until    time.Time // when an open breaker allows a probe
+	probing  bool      // a half-open probe is in flight
+
+	// Counters for /metrics.
+	trips   uint64
+	skipped uint64
+	retries uint64
+}
+
+func newBreaker(name string, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may go to the endpoint now. Once an open
+// breaker's cooldown has passed, exactly one caller gets through as the
+// half-open probe; everyone else is skipped until it reports back.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Before(b.until) {
+			b.skipped++
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		log.Printf("LLM %s: circuit half-open, probing", b.name)
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			b.skipped++
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// success closes the breaker.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		log.Printf("LLM %s: circuit closed", b.name)
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// failure records an availability failure. retryAfter is the server's
+// Retry-After, if it sent one: a failed probe, the threshold being reached,
+// or a Retry-After too long to wait out all open the breaker, for at least
+// that long.
+func (b *breaker) failure(now time.Time, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state != breakerHalfOpen && b.failures < b.threshold && retryAfter <= maxRetryAfter {
+		return
+	}
+	wait := max(b.cooldown, retryAfter)
+	if b.state != breakerOpen {
+		b.trips++
+		log.Printf("LLM %s: circuit open for %s after %d consecutive failures", b.name, wait, b.failures)
+	}
+	b.state = breakerOpen
+	b.until = now.Add(wait)
+}
+
+func (b *breaker) countRetry() {
+	b.mu.Lock()
+	b.retries++
+	b.mu.Unlock()
+}
+
+// snapshot returns the breaker's state and counters under its lock.
+func (b *breaker) snapshot() (state breakerState, trips, skipped, retries uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.trips, b.skipped, b.retries
+}
+
+// parseRetryAfter reads a Retry-After header in either of its forms,
+// delay-seconds or an HTTP date. Zero when absent or unparseable.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryDelay is how long to wait before retry attempt+1: the server's
+// Retry-After when it gave one, otherwise jittered exponential backoff.
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	ceiling := min(retryBaseDelay<<min(attempt, 16), retryMaxDelay)
+	return rand.N(ceiling) + 1
+}
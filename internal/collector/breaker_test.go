@@ -0,0 +1,155 @@
+// internal/collector/breaker_test.go
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndProbes(t *testing.T) {
+	b := newBreaker("endpoint 1 (m)", 2, time.Minute)
+	now := time.Now()
+
+	b.failure(now, 0)
+	if !b.allow(now) {
+		t.Fatal("opened below threshold")
+	}
+	b.failure(now, 0)
+	if b.allow(now.Add(30 * time.Second)) {
+		t.Fatal("allowed during cooldown")
+	}
+
+	// After the cooldown one probe goes through; a concurrent caller doesn't.
+	later := now.Add(time.Minute)
+	if !b.allow(later) {
+		t.Fatal("no probe after cooldown")
+	}
+	if b.allow(later) {
+		t.Fatal("second caller allowed while probing")
+	}
+
+	// A failed probe reopens at once.
+	b.failure(later, 0)
+	if b.allow(later.Add(time.Second)) {
+		t.Fatal("allowed after failed probe")
+	}
+
+	// A successful probe closes it.
+	if !b.allow(later.Add(time.Minute)) {
+		t.Fatal("no second probe")
+	}
+	b.success()
+	if !b.allow(later.Add(time.Minute)) {
+		t.Fatal("closed breaker refused")
+	}
+
+	state, trips, skipped, _ := b.snapshot()
+	if state != breakerClosed || trips != 2 || skipped != 3 {
+		t.Errorf("snapshot = %v/%d trips/%d skipped, want closed/2/3", state, trips, skipped)
+	}
+
+	// A Retry-After too long to sleep through opens it for that long.
+	b.failure(now, 5*time.Minute)
+	if b.allow(now.Add(4 * time.Minute)) {
+		t.Error("long Retry-After didn't hold the breaker open")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)
+	for in, want := range map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-1":                            0,
+		"Tue, 03 Feb 2026 12:01:00 GMT": time.Minute,
+		"Tue, 03 Feb 2026 11:00:00 GMT": 0,
+		"soon":                          0,
+	} {
+		if got := parseRetryAfter(in, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", in, got, want)
+		}
+	}
+
+	for attempt := 0; attempt < 8; attempt++ {
+		if d := retryDelay(attempt, 0); d <= 0 || d > retryMaxDelay {
+			t.Errorf("retryDelay(%d) = %v", attempt, d)
+		}
+	}
+}
+
+func TestLLMClientCircuitSkipsDeadPrimary(t *testing.T) {
+	var primaryHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": `{"status": "ok", "issues": []}`}}},
+		})
+	}))
+	defer fallback.Close()
+
+	client := NewLLMClient([]Endpoint{
+		{URL: primary.URL, Model: "primary", APIKey: "k"},
+		{URL: fallback.URL, Model: "fallback", APIKey: "k"},
+	}, 0)
+	client.configureBreakers(2, time.Hour)
+
+	for i := 0; i < 4; i++ {
+		if _, _, err := client.Analyze(context.Background(), []string{"line"}); err != nil {
+			t.Fatalf("Analyze %d: %v", i, err)
+		}
+	}
+	if primaryHits != 2 {
+		t.Errorf("primary hits = %d, want 2 before the breaker opened", primaryHits)
+	}
+
+	rec := httptest.NewRecorder()
+	metricsHandler(client)(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`tasseograph_llm_breaker_state{endpoint="1",model="primary"} 1`,
+		`tasseograph_llm_breaker_state{endpoint="2",model="fallback"} 0`,
+		`tasseograph_llm_breaker_trips_total{endpoint="1",model="primary"} 1`,
+		`tasseograph_llm_breaker_skipped_total{endpoint="1",model="primary"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestLLMClientHonorsRetryAfter(t *testing.T) {
+	var attempts int32
+	var first time.Time
+	var waited time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		waited = time.Since(first)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": `{"status": "ok", "issues": []}`}}},
+		})
+	}))
+	defer server.Close()
+
+	client := NewLLMClient([]Endpoint{{URL: server.URL, Model: "m", APIKey: "k"}}, 1)
+	if _, _, err := client.Analyze(context.Background(), []string{"line"}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || waited < time.Second {
+		t.Errorf("attempts = %d, waited %v; want a retry after the 1s Retry-After", attempts, waited)
+	}
+}
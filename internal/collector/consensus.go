@@ -0,0 +1,159 @@
+// internal/collector/consensus.go
+package collector
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Consensus strategies: how the stored status is chosen from the verdicts.
+const (
+	// ConsensusMajority takes the status most models gave. A tie goes to
+	// the more severe status, so a lone dissenter can't hide a fault.
+	ConsensusMajority = "majority"
+	// ConsensusConfidence takes the status of the most confident model. A
+	// tie goes to the primary.
+	ConsensusConfidence = "confidence"
+)
+
+// configureConsensus turns on consensus checks: a warning or critical
+// verdict is put to the next voters endpoints in the chain (skipping the one
+// that answered) and the stored status is chosen by strategy. voters == 0
+// turns it off.
+func (c *LLMClient) configureConsensus(voters int, strategy string) {
+	c.voters = voters
+	c.strategy = strategy
+}
+
+// reconsider runs a consensus check on a warning or critical result: the
+// same lines go to the voting endpoints concurrently, and the result is
+// replaced by the agreed status with the issues of the models that gave
+// it. meta gains the verdicts, primary first, the slowest voter's latency
+// and every voter's tokens. A voter that fails is recorded but doesn't
+// vote; if all fail, the primary's result stands.
+func (c *LLMClient) reconsider(ctx context.Context, lines []string, result *protocol.AnalysisResult, meta AnalysisMeta) (*protocol.AnalysisResult, AnalysisMeta) {
+	if c.voters == 0 || result == nil || result.Status == "ok" {
+		return result, meta
+	}
+
+	var voters []int
+	for i := range c.endpoints {
+		if i != meta.endpoint && len(voters) < c.voters {
+			voters = append(voters, i)
+		}
+	}
+	if len(voters) == 0 {
+		return result, meta
+	}
+
+	// Index 0 is the primary; voters follow in chain order.
+	results := make([]*protocol.AnalysisResult, len(voters)+1)
+	verdicts := make([]protocol.Verdict, len(voters)+1)
+	results[0] = result
+	verdicts[0] = verdictOf(c.endpoints[meta.endpoint], meta, result, nil)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var spent AnalysisMeta // voters' tokens, and the slowest one's latency
+	for n, i := range voters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, m, err := c.analyzeOn(ctx, i, c.endpoints[i], lines)
+			if err != nil {
+				log.Printf("LLM consensus: endpoint %d (%s) failed: %v", i+1, c.endpoints[i].Model, err)
+			}
+			results[n+1] = r
+			verdicts[n+1] = verdictOf(c.endpoints[i], m, r, err)
+			mu.Lock()
+			spent.LatencyMs = max(spent.LatencyMs, m.LatencyMs)
+			spent.PromptTokens += m.PromptTokens
+			spent.CompletionTokens += m.CompletionTokens
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	meta.add(spent)
+	meta.Verdicts = verdicts
+
+	agreed := decideConsensus(c.strategy, verdicts)
+	if agreed != result.Status {
+		log.Printf("LLM consensus: %s overturned to %s (%s)", result.Status, agreed, c.strategy)
+	}
+	var agreeing []protocol.AnalysisResult
+	for _, r := range results {
+		if r != nil && r.Status == agreed {
+			agreeing = append(agreeing, *r)
+		}
+	}
+	out := mergeResults(agreeing)
+	if agreed == "ok" {
+		out.Issues = []protocol.Issue{}
+	}
+	return out, meta
+}
+
+func verdictOf(ep Endpoint, meta AnalysisMeta, r *protocol.AnalysisResult, err error) protocol.Verdict {
+	v := protocol.Verdict{Model: meta.Model}
+	if v.Model == "" {
+		v.Model = ep.Model
+	}
+	if err != nil {
+		v.Error = string(ErrorClassOf(err))
+		if v.Error == "" {
+			v.Error = "error"
+		}
+		return v
+	}
+	v.Status, v.Confidence = r.Status, r.Confidence
+	return v
+}
+
+// decideConsensus picks the agreed status from verdicts, primary first.
+// Failed verdicts don't vote; the primary never fails.
+func decideConsensus(strategy string, verdicts []protocol.Verdict) string {
+	if strategy == ConsensusConfidence {
+		best := verdicts[0]
+		for _, v := range verdicts[1:] {
+			if v.Status != "" && v.Confidence > best.Confidence {
+				best = v
+			}
+		}
+		return best.Status
+	}
+
+	votes := map[string]int{}
+	for _, v := range verdicts {
+		if v.Status != "" {
+			votes[v.Status]++
+		}
+	}
+	agreed := verdicts[0].Status
+	for status, n := range votes {
+		if n > votes[agreed] || (n == votes[agreed] && statusRank[status] > statusRank[agreed]) {
+			agreed = status
+		}
+	}
+	return agreed
+}
+
+// disagree reports whether the models that answered gave different
+// statuses.
+func disagree(verdicts []protocol.Verdict) bool {
+	first := ""
+	for _, v := range verdicts {
+		if v.Status == "" {
+			continue
+		}
+		if first == "" {
+			first = v.Status
+		} else if v.Status != first {
+			return true
+		}
+	}
+	return false
+}
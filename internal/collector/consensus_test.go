@@ -0,0 +1,127 @@
+// internal/collector/consensus_test.go
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestDecideConsensus(t *testing.T) {
+	v := func(status string, confidence float64) protocol.Verdict {
+		return protocol.Verdict{Model: "m", Status: status, Confidence: confidence}
+	}
+	failed := protocol.Verdict{Model: "m", Error: "transport"}
+	tests := []struct {
+		name     string
+		strategy string
+		verdicts []protocol.Verdict
+		want     string
+	}{
+		{"majority overturns", ConsensusMajority, []protocol.Verdict{v("critical", 0.9), v("ok", 0.5), v("ok", 0.5)}, "ok"},
+		{"majority agrees", ConsensusMajority, []protocol.Verdict{v("warning", 0), v("warning", 0), v("ok", 0)}, "warning"},
+		{"tie goes to the more severe", ConsensusMajority, []protocol.Verdict{v("critical", 0), v("ok", 0)}, "critical"},
+		{"failed voters don't vote", ConsensusMajority, []protocol.Verdict{v("warning", 0), failed, failed}, "warning"},
+		{"most confident wins", ConsensusConfidence, []protocol.Verdict{v("critical", 0.4), v("ok", 0.9), v("warning", 0.6)}, "ok"},
+		{"confidence tie goes to primary", ConsensusConfidence, []protocol.Verdict{v("critical", 0), v("ok", 0)}, "critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideConsensus(tt.strategy, tt.verdicts); got != tt.want {
+				t.Errorf("decideConsensus = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// verdictServer answers every analysis with status and one issue named
+// after the model.
+func verdictServer(t *testing.T, model, status string) *httptest.Server {
+	t.Helper()
+	issues := "[]"
+	if status != "ok" {
+		issues = fmt.Sprintf(`[{\"summary\":\"%s saw a fault\",\"evidence\":\"x\"}]`, model)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"model":%q,"choices":[{"message":{"content":"{\"status\":\"%s\",\"issues\":%s}"}}]}`, model, status, issues)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLLMClientConsensus(t *testing.T) {
+	primary := verdictServer(t, "cheap", "critical")
+	endpoints := []Endpoint{
+		{URL: primary.URL, Model: "cheap", APIKey: "k"},
+		{URL: verdictServer(t, "big", "ok").URL, Model: "big", APIKey: "k"},
+		{URL: verdictServer(t, "other", "ok").URL, Model: "other", APIKey: "k"},
+	}
+
+	client := NewLLMClient(endpoints, 0)
+	client.configureConsensus(2, ConsensusMajority)
+	result, meta, err := client.Analyze(context.Background(), []string{"firmware chatter"})
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if result.Status != "ok" || len(result.Issues) != 0 {
+		t.Errorf("result = %+v, want ok with no issues (outvoted 2 to 1)", result)
+	}
+	if len(meta.Verdicts) != 3 || meta.Verdicts[0].Model != "cheap" || meta.Verdicts[0].Status != "critical" {
+		t.Errorf("verdicts = %+v, want primary's critical first then two voters", meta.Verdicts)
+	}
+
+	// An ok verdict isn't second-guessed.
+	quiet := NewLLMClient([]Endpoint{endpoints[1], endpoints[0]}, 0)
+	quiet.configureConsensus(1, ConsensusMajority)
+	_, meta, err = quiet.Analyze(context.Background(), []string{"line"})
+	if err != nil || meta.Verdicts != nil {
+		t.Errorf("ok verdict: verdicts = %+v err = %v, want no consensus check", meta.Verdicts, err)
+	}
+}
+
+func TestBuildSummary_ReportsDisagreements(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Date(2026, 5, 12, 22, 0, 0, 0, time.UTC)
+	since := now.Add(-24 * time.Hour)
+	for i, verdicts := range [][]protocol.Verdict{
+		{{Model: "cheap", Status: "critical"}, {Model: "big", Status: "ok"}},
+		{{Model: "cheap", Status: "warning"}, {Model: "big", Status: "warning"}},
+	} {
+		err := db.InsertResult(&protocol.StoredResult{
+			Timestamp: since.Add(time.Duration(i+1) * time.Hour),
+			Hostname:  fmt.Sprintf("host%d", i+1),
+			Status:    verdicts[1].Status,
+			Issues:    []protocol.Issue{},
+			Verdicts:  verdicts,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, body, err := BuildSummary(db, since, now, 0.5)
+	if err != nil {
+		t.Fatalf("BuildSummary: %v", err)
+	}
+	if !strings.Contains(body, "Model disagreements: 1 of 2 consensus checks") {
+		t.Errorf("body should count disagreements\n%s", body)
+	}
+	if !strings.Contains(body, "host1 -> ok  (cheap: critical, big: ok)") {
+		t.Errorf("body should list host1's verdicts\n%s", body)
+	}
+	if strings.Contains(body, "host2 ->") {
+		t.Errorf("host2's models agreed and shouldn't be listed\n%s", body)
+	}
+}
@@ -4,6 +4,7 @@ package collector
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -12,69 +13,46 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// DB wraps SQLite connection
+// DB is the SQLite Store, for a single collector.
 type DB struct {
-	db *sql.DB
+	sqlStore
 }
 
-// NewDB opens or creates the SQLite database
+// NewDB opens or creates the SQLite database and migrates its schema to
+// the latest version.
 func NewDB(path string) (*DB, error) {
 	db, err := sql.Open("sqlite", path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Enable WAL mode for better concurrent access
-	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+	// Let prunes hand freed pages back (see vacuumIncremental). This only
+	// takes on a new database, and must come before WAL mode does.
+	if _, err := db.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
 		db.Close()
 		return nil, err
 	}
 
-	// Create schema
-	schema := `
-	CREATE TABLE IF NOT EXISTS results (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp TEXT NOT NULL,
-		hostname TEXT NOT NULL,
-		status TEXT NOT NULL,
-		issues TEXT,
-		raw_dmesg TEXT,
-		api_latency_ms INTEGER,
-		provider TEXT,
-		model TEXT,
-		created_at TEXT DEFAULT (datetime('now'))
-	);
-	CREATE INDEX IF NOT EXISTS idx_results_hostname ON results(hostname);
-	CREATE INDEX IF NOT EXISTS idx_results_status ON results(status);
-	CREATE INDEX IF NOT EXISTS idx_results_timestamp ON results(timestamp);
-	`
-
-	if _, err := db.Exec(schema); err != nil {
+	// Enable WAL mode for better concurrent access
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		db.Close()
 		return nil, err
 	}
 
-	// Migration for installations whose results table predates the
-	// provider/model columns. SQLite has no idempotent ADD COLUMN, so
-	// gate each one on pragma_table_info.
-	if err := addColumnIfMissing(db, "results", "provider", "TEXT"); err != nil {
-		db.Close()
-		return nil, err
-	}
-	if err := addColumnIfMissing(db, "results", "model", "TEXT"); err != nil {
+	if _, _, err := migrate(db, latestSchemaVersion(), false); err != nil {
 		db.Close()
 		return nil, err
 	}
 
-	return &DB{db: db}, nil
+	return &DB{sqlStore{db: db}}, nil
 }
 
 // addColumnIfMissing is a portable "ALTER TABLE ... ADD COLUMN IF NOT EXISTS"
 // for SQLite (which lacks that syntax). Safe to call against a freshly-built
 // schema, where it's a no-op.
-func addColumnIfMissing(db *sql.DB, table, col, colType string) error {
+func addColumnIfMissing(tx *sql.Tx, table, col, colType string) error {
 	var n int
-	err := db.QueryRow(
+	err := tx.QueryRow(
 		`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
 		table, col,
 	).Scan(&n)
@@ -84,54 +62,102 @@ func addColumnIfMissing(db *sql.DB, table, col, colType string) error {
 	if n > 0 {
 		return nil
 	}
-	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col, colType))
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col, colType))
 	return err
 }
 
-// Close closes the database connection
-func (d *DB) Close() error {
-	return d.db.Close()
+// InsertResult stores an analysis result
+func (d *sqlStore) InsertResult(r *protocol.StoredResult) error {
+	_, err := d.insertResult(r, false)
+	return err
 }
 
-// InsertResult stores an analysis result
-func (d *DB) InsertResult(r *protocol.StoredResult) error {
+// insertResult stores r, with its own id and created_at when restoring it
+// from an archive. A restored result whose id is taken is skipped, and
+// insertResult returns false.
+func (d *sqlStore) insertResult(r *protocol.StoredResult, restore bool) (bool, error) {
 	issuesJSON, err := json.Marshal(r.Issues)
 	if err != nil {
-		return err
+		return false, err
+	}
+	// NULL unless a consensus check ran, so the digest can find them.
+	var verdictsJSON sql.NullString
+	if len(r.Verdicts) > 0 {
+		buf, err := json.Marshal(r.Verdicts)
+		if err != nil {
+			return false, err
+		}
+		verdictsJSON = sql.NullString{String: string(buf), Valid: true}
+	}
+	var suppressedJSON sql.NullString
+	if len(r.Suppressed) > 0 {
+		buf, err := json.Marshal(r.Suppressed)
+		if err != nil {
+			return false, err
+		}
+		suppressedJSON = sql.NullString{String: string(buf), Valid: true}
 	}
 
-	_, err = d.db.Exec(`
-		INSERT INTO results (timestamp, hostname, status, issues, raw_dmesg, api_latency_ms, provider, model)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, r.Timestamp.Format(time.RFC3339), r.Hostname, r.Status, string(issuesJSON), r.RawDmesg, r.APILatencyMs, r.Provider, r.Model)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
 
-	return err
+	// raw_dmesg stays NULL: the text goes into blobs (see dmesg.go).
+	// PostgreSQL's search vector is filled in here, SQLite's index below.
+	query := `INSERT INTO results (timestamp, hostname, status, issues, api_latency_ms, provider, model, source, error_class, verdicts, suppressed, silenced`
+	values := `?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?`
+	args := []interface{}{r.Timestamp.Format(time.RFC3339), r.Hostname, r.Status, string(issuesJSON), r.APILatencyMs, r.Provider, r.Model, r.Source, r.ErrorClass, verdictsJSON, suppressedJSON, r.Silenced}
+	if d.postgres {
+		query += `, search`
+		values += `, to_tsvector('simple', ?)`
+		args = append(args, r.RawDmesg+"\n"+issueText(r.Issues))
+	}
+	conflict := ``
+	if restore {
+		query += `, id, created_at`
+		values += `, ?, ?`
+		args = append(args, r.ID, r.CreatedAt.UTC().Format("2006-01-02 15:04:05"))
+		conflict = ` ON CONFLICT(id) DO NOTHING`
+	}
+	err = tx.QueryRow(d.rebind(query+`) VALUES (`+values+`)`+conflict+` RETURNING id`), args...).Scan(&r.ID)
+	if restore && errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := d.storeDmesg(tx, r.ID, r.RawDmesg); err != nil {
+		return false, err
+	}
+	if !d.postgres {
+		if _, err := tx.Exec(`INSERT INTO results_fts (rowid, dmesg, issues) VALUES (?, ?, ?)`, r.ID, r.RawDmesg, issueText(r.Issues)); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
 }
 
 // PruneOlderThan deletes rows whose created_at is older than the given number
-// of days. Returns the number of rows removed. days <= 0 is a no-op so callers
-// can pass an unconfigured RetentionDays without a guard.
-func (d *DB) PruneOlderThan(days int) (int64, error) {
+// of days, from results and the hardware metrics and SMART history. Returns the
+// number of rows removed. days <= 0 is a no-op so callers can pass an
+// unconfigured RetentionDays without a guard. See Prune for retention rules.
+func (d *sqlStore) PruneOlderThan(days int) (int64, error) {
 	if days <= 0 {
 		return 0, nil
 	}
-	res, err := d.db.Exec(
-		`DELETE FROM results WHERE created_at < datetime('now', ?)`,
-		fmt.Sprintf("-%d days", days),
-	)
-	if err != nil {
-		return 0, err
-	}
-	return res.RowsAffected()
+	stats, err := d.Prune(days, nil, nil)
+	return stats.Deleted, err
 }
 
 // resultColumns is the SELECT list shared by every query that hydrates a
 // StoredResult. Keep in sync with scanResults's Scan call.
-const resultColumns = `id, timestamp, hostname, status, issues, raw_dmesg, api_latency_ms, provider, model, created_at`
+const resultColumns = `id, timestamp, hostname, status, issues, raw_dmesg, api_latency_ms, provider, model, source, error_class, verdicts, suppressed, silenced, created_at`
 
 // QueryByHostname returns recent results for a host
-func (d *DB) QueryByHostname(hostname string, limit int) ([]protocol.StoredResult, error) {
-	rows, err := d.db.Query(`
+func (d *sqlStore) QueryByHostname(hostname string, limit int) ([]protocol.StoredResult, error) {
+	rows, err := d.query(`
 		SELECT `+resultColumns+`
 		FROM results
 		WHERE hostname = ?
@@ -143,12 +169,28 @@ func (d *DB) QueryByHostname(hostname string, limit int) ([]protocol.StoredResul
 	}
 	defer rows.Close()
 
-	return scanResults(rows)
+	return d.scanResults(rows)
+}
+
+// QueryResult returns the result with the given id, or nil if there is
+// none.
+func (d *sqlStore) QueryResult(id int64) (*protocol.StoredResult, error) {
+	rows, err := d.query(`SELECT `+resultColumns+` FROM results WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := d.scanResults(rows)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	return &results[0], nil
 }
 
 // QueryNonOK returns recent non-ok results
-func (d *DB) QueryNonOK(limit int) ([]protocol.StoredResult, error) {
-	rows, err := d.db.Query(`
+func (d *sqlStore) QueryNonOK(limit int) ([]protocol.StoredResult, error) {
+	rows, err := d.query(`
 		SELECT `+resultColumns+`
 		FROM results
 		WHERE status != 'ok'
@@ -160,12 +202,12 @@ func (d *DB) QueryNonOK(limit int) ([]protocol.StoredResult, error) {
 	}
 	defer rows.Close()
 
-	return scanResults(rows)
+	return d.scanResults(rows)
 }
 
 // StatusCounts returns count of results by status
-func (d *DB) StatusCounts() (map[string]int, error) {
-	rows, err := d.db.Query(`
+func (d *sqlStore) StatusCounts() (map[string]int, error) {
+	rows, err := d.query(`
 		SELECT status, COUNT(*) FROM results GROUP BY status
 	`)
 	if err != nil {
@@ -185,8 +227,11 @@ func (d *DB) StatusCounts() (map[string]int, error) {
 	return counts, rows.Err()
 }
 
-func scanResults(rows *sql.Rows) ([]protocol.StoredResult, error) {
+// scanResults reads rows selected with resultColumns, loading the dmesg
+// text of those whose raw_dmesg is NULL from blobs.
+func (d *sqlStore) scanResults(rows *sql.Rows) ([]protocol.StoredResult, error) {
 	var results []protocol.StoredResult
+	var inBlobs []int
 	for rows.Next() {
 		var r protocol.StoredResult
 		var tsStr, createdStr string
@@ -195,8 +240,12 @@ func scanResults(rows *sql.Rows) ([]protocol.StoredResult, error) {
 		var latency sql.NullInt64
 		var provider sql.NullString
 		var model sql.NullString
+		var source sql.NullString
+		var errorClass sql.NullString
+		var verdicts sql.NullString
+		var suppressed sql.NullString
 
-		err := rows.Scan(&r.ID, &tsStr, &r.Hostname, &r.Status, &issuesJSON, &rawDmesg, &latency, &provider, &model, &createdStr)
+		err := rows.Scan(&r.ID, &tsStr, &r.Hostname, &r.Status, &issuesJSON, &rawDmesg, &latency, &provider, &model, &source, &errorClass, &verdicts, &suppressed, &r.Silenced, &createdStr)
 		if err != nil {
 			return nil, err
 		}
@@ -206,6 +255,22 @@ func scanResults(rows *sql.Rows) ([]protocol.StoredResult, error) {
 		if model.Valid {
 			r.Model = model.String
 		}
+		if source.Valid {
+			r.Source = source.String
+		}
+		if errorClass.Valid {
+			r.ErrorClass = errorClass.String
+		}
+		if verdicts.Valid {
+			if err := json.Unmarshal([]byte(verdicts.String), &r.Verdicts); err != nil {
+				log.Printf("scanResults: failed to unmarshal verdicts column for row id=%d: %v", r.ID, err)
+			}
+		}
+		if suppressed.Valid {
+			if err := json.Unmarshal([]byte(suppressed.String), &r.Suppressed); err != nil {
+				log.Printf("scanResults: failed to unmarshal suppressed column for row id=%d: %v", r.ID, err)
+			}
+		}
 
 		r.Timestamp, _ = time.Parse(time.RFC3339, tsStr)
 		r.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdStr)
@@ -216,6 +281,8 @@ func scanResults(rows *sql.Rows) ([]protocol.StoredResult, error) {
 		}
 		if rawDmesg.Valid {
 			r.RawDmesg = rawDmesg.String
+		} else {
+			inBlobs = append(inBlobs, len(results))
 		}
 		if latency.Valid {
 			r.APILatencyMs = latency.Int64
@@ -223,5 +290,11 @@ func scanResults(rows *sql.Rows) ([]protocol.StoredResult, error) {
 
 		results = append(results, r)
 	}
-	return results, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := d.hydrateDmesg(results, inBlobs); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
@@ -173,6 +173,10 @@ func TestNewDBMigratesProviderModelColumns(t *testing.T) {
 		if _, err := db.db.Exec(`ALTER TABLE results DROP COLUMN model`); err != nil {
 			t.Fatalf("simulate-old: drop model: %v", err)
 		}
+		// Installations that old predate schema versioning too.
+		if _, err := db.db.Exec(`DROP TABLE schema_migrations`); err != nil {
+			t.Fatalf("simulate-old: drop schema_migrations: %v", err)
+		}
 		db.Close()
 	}
 
@@ -0,0 +1,206 @@
+// internal/collector/digest.go
+package collector
+
+import (
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// The HTML digest carries what renderBody does, laid out for a mail
+// client: the headline in the severity's color, criticals with their
+// evidence folded into <details>, and per-host tables. Mail clients run no
+// scripts, so rather than one sortable table there are two sorted ones:
+// every host busiest first, and the hosts with criticals, most first.
+// Styles are inline, since many clients drop <style>.
+
+// severityColors colors the digest's headline.
+var severityColors = map[string]string{
+	"CRITICAL": "#c62828",
+	"WARN":     "#ef6c00",
+	"OK":       "#2e7d32",
+}
+
+// digestView is what digestTemplate renders.
+type digestView struct {
+	*SummaryWindow
+	Severity  string
+	Headline  string
+	Color     string
+	ErrorRate float64
+	Statuses  []IssueCount // Summary is the status
+	Errors    []digestErrorClass
+	Criticals []digestResult
+	Disagree  []digestResult
+	More      int // disagreements left out
+	Silences  []digestSilence
+	Hosts     []digestHost // busiest first
+	Critical  []digestHost // hosts with criticals, most first
+}
+
+type digestErrorClass struct {
+	Label string
+	Count int
+	Hint  string
+}
+
+// digestResult is a result and its link, if there is one.
+type digestResult struct {
+	protocol.StoredResult
+	Link  string
+	Votes string
+}
+
+type digestSilence struct {
+	protocol.Silence
+	Match string
+}
+
+type digestHost struct {
+	HostnameStat
+	Criticals int
+}
+
+func renderHTML(w *SummaryWindow, severity, headline string, errorRate float64, resultURL string) (string, error) {
+	link := func(id int64) string {
+		if resultURL == "" {
+			return ""
+		}
+		return strings.ReplaceAll(resultURL, "{id}", strconv.FormatInt(id, 10))
+	}
+	v := digestView{
+		SummaryWindow: w,
+		Severity:      severity,
+		Headline:      headline,
+		Color:         severityColors[severity],
+		ErrorRate:     errorRate,
+	}
+	for _, st := range byCount(w.StatusCounts) {
+		v.Statuses = append(v.Statuses, IssueCount{st, w.StatusCounts[st]})
+	}
+	for _, class := range byCount(w.ErrorClasses) {
+		label, hint := errorClassLabel(class)
+		v.Errors = append(v.Errors, digestErrorClass{label, w.ErrorClasses[class], hint})
+	}
+	perHost := map[string]int{}
+	for _, r := range w.Criticals {
+		v.Criticals = append(v.Criticals, digestResult{StoredResult: r, Link: link(r.ID)})
+		perHost[r.Hostname]++
+	}
+	for i, r := range w.Disagreements {
+		if i == maxDigestDisagreements {
+			v.More = len(w.Disagreements) - i
+			break
+		}
+		v.Disagree = append(v.Disagree, digestResult{StoredResult: r, Link: link(r.ID), Votes: votes(r)})
+	}
+	for _, s := range w.Silences {
+		v.Silences = append(v.Silences, digestSilence{s, silenceMatch(s)})
+	}
+	for _, h := range w.Hostnames {
+		v.Hosts = append(v.Hosts, digestHost{h, perHost[h.Hostname]})
+		if perHost[h.Hostname] > 0 {
+			v.Critical = append(v.Critical, digestHost{h, perHost[h.Hostname]})
+		}
+	}
+	// Stable, so hosts with as many criticals stay busiest first.
+	sort.SliceStable(v.Critical, func(i, j int) bool { return v.Critical[i].Criticals > v.Critical[j].Criticals })
+
+	var sb strings.Builder
+	if err := digestTemplate.Execute(&sb, v); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04") },
+	"pct":  func(f float64) string { return strconv.FormatFloat(f*100, 'f', 1, 64) + "%" },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>[{{.Severity}}] tasseograph -- {{.Headline}}</title>
+</head>
+<body style="font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #212121;">
+<h2 style="margin: 0 0 4px; color: {{.Color}};">[{{.Severity}}] {{.Headline}}</h2>
+<p style="margin: 0 0 16px; color: #616161;">{{time .Since}} to {{time .Until}} UTC, {{.Total}} rows</p>
+{{- if eq .Total 0}}
+<p>No data ingested in this window. Either no agents are reporting, or the collector is rejecting their POSTs. Check <code>systemctl status tasseograph-collector tasseograph-agent</code> on each host.</p>
+{{- end}}
+{{- with .Statuses}}
+<p>{{range $i, $s := .}}{{if $i}} &middot; {{end}}{{$s.Summary}} <b>{{$s.Count}}</b>{{end}}</p>
+{{- end}}
+{{- if gt .ErrorRate 0.0}}
+<h3>LLM error rate: {{pct .ErrorRate}}</h3>
+{{- if ge .ErrorRate 0.5}}
+<p>Check <code>journalctl -u tasseograph-collector</code> -- the LLM endpoint is likely broken.</p>
+{{- end}}
+<table cellpadding="4" style="border-collapse: collapse;">
+{{- range .Errors}}
+<tr><td>{{.Label}}</td><td align="right">{{.Count}}</td><td>{{.Hint}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if gt .LatencyAvgMs 0}}
+<p>LLM latency: avg {{.LatencyAvgMs}}ms, max {{.LatencyMaxMs}}ms</p>
+{{- end}}
+{{- with .Criticals}}
+<h3 style="color: #c62828;">Critical events</h3>
+{{- range .}}
+<p style="margin: 12px 0 4px;"><b>{{.Hostname}}</b> {{time .Timestamp}} &middot; {{if .Link}}<a href="{{.Link}}">result {{.ID}}</a>{{else}}result {{.ID}}{{end}}</p>
+{{- range .Issues}}
+<details style="margin-left: 16px;"><summary>{{.Summary}}</summary><pre style="white-space: pre-wrap; background: #f5f5f5; padding: 8px;">{{.Evidence}}</pre></details>
+{{- end}}
+{{- end}}
+{{- end}}
+{{- if or .Silences .Silenced}}
+<h3>Silenced: {{index .Silenced "critical"}} critical, {{index .Silenced "warning"}} warning</h3>
+<ul>
+{{- range .Silences}}
+<li>#{{.ID}} {{.Match}}, {{time .StartsAt}} to {{time .EndsAt}}: {{.Reason}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- with .Disagree}}
+<h3>Model disagreements: {{len $.Disagreements}} of {{$.ConsensusChecks}} consensus checks</h3>
+<table cellpadding="4" style="border-collapse: collapse;">
+{{- range .}}
+<tr><td>{{time .Timestamp}}</td><td>{{.Hostname}}</td><td>{{.Status}}</td><td>{{.Votes}}</td><td>{{if .Link}}<a href="{{.Link}}">result {{.ID}}</a>{{else}}result {{.ID}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- if $.More}}
+<p>... and {{$.More}} more</p>
+{{- end}}
+{{- end}}
+{{- with .TopIssues}}
+<h3>Top issue summaries (warning + critical)</h3>
+<table cellpadding="4" style="border-collapse: collapse;">
+{{- range .}}
+<tr><td align="right">{{.Count}}</td><td>{{.Summary}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- with .Critical}}
+<h3>Hosts with critical events</h3>
+{{template "hosts" .}}
+{{- end}}
+{{- with .Hosts}}
+<h3>Per-host activity, busiest first</h3>
+{{template "hosts" .}}
+{{- end}}
+</body>
+</html>
+{{- define "hosts"}}
+<table cellpadding="4" style="border-collapse: collapse;">
+<tr style="background: #eeeeee;"><th align="left">Host</th><th align="right">Rows</th><th align="right">Critical</th><th align="left">Last seen (UTC)</th></tr>
+{{- range .}}
+<tr style="border-top: 1px solid #e0e0e0;"><td>{{.Hostname}}</td><td align="right">{{.Total}}</td><td align="right"{{if .Criticals}} style="color: #c62828; font-weight: bold;"{{end}}>{{.Criticals}}</td><td>{{time .LastSeen}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+`))
@@ -0,0 +1,320 @@
+// internal/collector/dmesg.go
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// A result's dmesg text is stored as gzip-compressed blobs in dmesg_blobs,
+// each addressed by the SHA-256 of its text, and listed in order for the
+// result in result_dmesg. The text is split into blobs at lines picked by
+// their hash, so a run of lines that recurs, such as a re-sent delta,
+// splits the same way wherever it turns up and is stored once.
+// results.raw_dmesg is NULL for such rows; rows from before blobs keep
+// their text there until `tasseograph compact`.
+//
+// Blobs are runs of lines, not single lines: each line carries its own
+// timestamp, so few lines ever repeat, and a line alone is too short for
+// gzip or to pay for the reference to it. See "Stored dmesg text" in the
+// README for the measurement.
+
+const (
+	// dmesgChunkMask ends a blob after a line whose hash has these bits
+	// clear: about 32 lines per blob, enough for gzip to find repeats.
+	dmesgChunkMask = 31
+	// dmesgChunkMaxLines bounds a blob when no line ends it.
+	dmesgChunkMaxLines = 256
+	// dmesgBatch is how many results hydrate or compact loads at once.
+	dmesgBatch = 500
+)
+
+// dmesgSchema holds the blobs. size is the uncompressed length, for
+// reporting. The index on hash lets orphaned blobs be found after a prune.
+const dmesgSchema = `
+CREATE TABLE IF NOT EXISTS dmesg_blobs (
+	hash TEXT PRIMARY KEY,
+	data BLOB NOT NULL,
+	size INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS result_dmesg (
+	result_id INTEGER NOT NULL,
+	seq INTEGER NOT NULL,
+	hash TEXT NOT NULL,
+	PRIMARY KEY (result_id, seq)
+);
+CREATE INDEX IF NOT EXISTS idx_result_dmesg_hash ON result_dmesg(hash);
+`
+
+// pgDmesgSchema is dmesgSchema for PostgreSQL.
+const pgDmesgSchema = `
+CREATE TABLE dmesg_blobs (
+	hash TEXT PRIMARY KEY,
+	data BYTEA NOT NULL,
+	size BIGINT NOT NULL
+);
+CREATE TABLE result_dmesg (
+	result_id BIGINT NOT NULL,
+	seq INTEGER NOT NULL,
+	hash TEXT NOT NULL,
+	PRIMARY KEY (result_id, seq)
+);
+CREATE INDEX idx_result_dmesg_hash ON result_dmesg(hash);
+`
+
+// dmesgChunks splits text at line boundaries. Joined with newlines the
+// chunks are text again.
+func dmesgChunks(text string) []string {
+	lines := strings.Split(text, "\n")
+	var chunks []string
+	start := 0
+	for i, line := range lines {
+		h := fnv.New32a()
+		h.Write([]byte(line))
+		if h.Sum32()&dmesgChunkMask == 0 || i+1-start == dmesgChunkMaxLines || i == len(lines)-1 {
+			chunks = append(chunks, strings.Join(lines[start:i+1], "\n"))
+			start = i + 1
+		}
+	}
+	return chunks
+}
+
+func gzipText(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipText(data []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	buf, err := io.ReadAll(zr)
+	return string(buf), err
+}
+
+// storeDmesg writes text as resultID's blobs and returns the compressed
+// bytes of the blobs it had to add. The links go in first: on PostgreSQL
+// that makes a concurrent dropOrphanBlobs wait for this transaction.
+func (d *sqlStore) storeDmesg(tx *sql.Tx, resultID int64, text string) (int64, error) {
+	if text == "" {
+		return 0, nil
+	}
+	var added int64
+	for seq, chunk := range dmesgChunks(text) {
+		sum := sha256.Sum256([]byte(chunk))
+		hash := hex.EncodeToString(sum[:])
+		if _, err := tx.Exec(d.rebind(`INSERT INTO result_dmesg (result_id, seq, hash) VALUES (?, ?, ?)`), resultID, seq, hash); err != nil {
+			return 0, err
+		}
+		var n int
+		if err := tx.QueryRow(d.rebind(`SELECT COUNT(*) FROM dmesg_blobs WHERE hash = ?`), hash).Scan(&n); err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			continue
+		}
+		data, err := gzipText(chunk)
+		if err != nil {
+			return 0, err
+		}
+		res, err := tx.Exec(d.rebind(`INSERT INTO dmesg_blobs (hash, data, size) VALUES (?, ?, ?) ON CONFLICT(hash) DO NOTHING`), hash, data, len(chunk))
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added += int64(len(data))
+		}
+	}
+	return added, nil
+}
+
+// hydrateDmesg fills in RawDmesg for the results at idx, whose text is in
+// blobs.
+func (d *sqlStore) hydrateDmesg(results []protocol.StoredResult, idx []int) error {
+	for len(idx) > 0 {
+		batch := idx[:min(len(idx), dmesgBatch)]
+		idx = idx[len(batch):]
+
+		byID := make(map[int64]*protocol.StoredResult, len(batch))
+		args := make([]interface{}, len(batch))
+		for i, j := range batch {
+			byID[results[j].ID] = &results[j]
+			args[i] = results[j].ID
+		}
+		rows, err := d.query(`
+			SELECT rd.result_id, b.data
+			FROM result_dmesg rd JOIN dmesg_blobs b ON b.hash = rd.hash
+			WHERE rd.result_id IN (?`+strings.Repeat(", ?", len(batch)-1)+`)
+			ORDER BY rd.result_id, rd.seq
+		`, args...)
+		if err != nil {
+			return err
+		}
+		chunks := map[int64][]string{}
+		for rows.Next() {
+			var id int64
+			var data []byte
+			if err := rows.Scan(&id, &data); err != nil {
+				rows.Close()
+				return err
+			}
+			chunk, err := gunzipText(data)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("result %d: dmesg blob: %w", id, err)
+			}
+			chunks[id] = append(chunks[id], chunk)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		for id, c := range chunks {
+			byID[id].RawDmesg = strings.Join(c, "\n")
+		}
+	}
+	return nil
+}
+
+// dropOrphanBlobs deletes the blobs no result refers to any more.
+func (d *sqlStore) dropOrphanBlobs() (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if d.postgres {
+		// Wait out, and hold off, inserts whose links aren't visible yet.
+		if _, err := tx.Exec(`LOCK TABLE result_dmesg IN SHARE MODE`); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM dmesg_blobs WHERE NOT EXISTS (SELECT 1 FROM result_dmesg WHERE result_dmesg.hash = dmesg_blobs.hash)`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// CompactStats reports a Compact run.
+type CompactStats struct {
+	Rows       int64 // results moved to blobs
+	TextBytes  int64 // their dmesg text
+	BlobBytes  int64 // compressed size of the blobs that had to be added
+	SizeBefore int64 // database size before and after
+	SizeAfter  int64
+}
+
+// Compact moves the dmesg text of results stored before blobs into blobs,
+// drops orphaned blobs and, on SQLite, vacuums the database so the file
+// shrinks, switching it to incremental auto-vacuum if it predates that so
+// later prunes shrink it too. VACUUM needs the database to itself: run it
+// with the collector stopped.
+func (d *sqlStore) Compact() (CompactStats, error) {
+	var stats CompactStats
+	var err error
+	if stats.SizeBefore, err = d.size(); err != nil {
+		return stats, err
+	}
+	for {
+		n, err := d.compactBatch(&stats)
+		if err != nil {
+			return stats, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if _, err := d.dropOrphanBlobs(); err != nil {
+		return stats, err
+	}
+	if !d.postgres {
+		if _, err := d.db.Exec(`PRAGMA auto_vacuum = INCREMENTAL; VACUUM`); err != nil {
+			return stats, err
+		}
+	}
+	stats.SizeAfter, err = d.size()
+	return stats, err
+}
+
+// compactBatch moves up to dmesgBatch results' text into blobs in one
+// transaction and returns how many it moved.
+func (d *sqlStore) compactBatch(stats *CompactStats) (int, error) {
+	rows, err := d.query(`SELECT id, raw_dmesg FROM results WHERE raw_dmesg IS NOT NULL ORDER BY id LIMIT ?`, dmesgBatch)
+	if err != nil {
+		return 0, err
+	}
+	type row struct {
+		id   int64
+		text string
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.text); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, r)
+	}
+	if err := rows.Close(); err != nil || len(batch) == 0 {
+		return 0, err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var textBytes, blobBytes int64
+	for _, r := range batch {
+		added, err := d.storeDmesg(tx, r.id, r.text)
+		if err != nil {
+			return 0, fmt.Errorf("result %d: %w", r.id, err)
+		}
+		if _, err := tx.Exec(d.rebind(`UPDATE results SET raw_dmesg = NULL WHERE id = ?`), r.id); err != nil {
+			return 0, err
+		}
+		textBytes += int64(len(r.text))
+		blobBytes += added
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	stats.Rows += int64(len(batch))
+	stats.TextBytes += textBytes
+	stats.BlobBytes += blobBytes
+	return len(batch), nil
+}
+
+// size returns the database's size in bytes.
+func (d *sqlStore) size() (int64, error) {
+	q := `SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`
+	if d.postgres {
+		q = `SELECT pg_database_size(current_database())`
+	}
+	var n int64
+	err := d.db.QueryRow(q).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,95 @@
+// internal/collector/dmesg_test.go
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDmesgChunks(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("[%d.%06d] nvme nvme0: I/O %d QID 3 timeout, completion polled", i, i*7, i))
+	}
+	text := strings.Join(lines, "\n")
+	for _, s := range []string{"", "one line", "trailing newline\n", "\n\n", text} {
+		if got := strings.Join(dmesgChunks(s), "\n"); got != s {
+			t.Errorf("chunks of %.20q rejoin as %.20q", s, got)
+		}
+	}
+
+	chunks := dmesgChunks(text)
+	if len(chunks) < 10 || len(chunks) > 100 {
+		t.Errorf("%d chunks for 1000 lines", len(chunks))
+	}
+	// New lines in front only change the chunks they land in.
+	shifted := dmesgChunks("[0.0] Linux version 6.8.0\n[0.1] Command line: ro quiet\n" + text)
+	have := map[string]bool{}
+	for _, c := range shifted {
+		have[c] = true
+	}
+	same := 0
+	for _, c := range chunks {
+		if have[c] {
+			same++
+		}
+	}
+	if same < len(chunks)-1 {
+		t.Errorf("%d of %d chunks survive two new leading lines", same, len(chunks))
+	}
+}
+
+// TestCompactMigratedDatabase moves a database from before blobs onto
+// them and checks the text reads back, is still searchable and takes less
+// room.
+func TestCompactMigratedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if _, _, err := MigrateDB(path, 10, false); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for i := 0; i < 50; i++ {
+		var lines []string
+		for j := 0; j < 200; j++ {
+			lines = append(lines, fmt.Sprintf("[%d.%03d] pcieport 0000:00:1c.%d: AER: Corrected error received: 0000:00:1c.0", i*200+j, j, j%8))
+		}
+		text := strings.Join(lines, "\n")
+		texts = append(texts, text)
+		if _, err := raw.Exec(`INSERT INTO results (timestamp, hostname, status, issues, raw_dmesg) VALUES (?, ?, 'ok', '[]', ?)`,
+			time.Now().UTC().Format(time.RFC3339), fmt.Sprintf("host-%d", i), text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stats, err := db.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rows != 50 || stats.BlobBytes*4 > stats.TextBytes || stats.SizeAfter >= stats.SizeBefore {
+		t.Errorf("Compact = %+v, want 50 rows in under a quarter of the text, and a smaller file", stats)
+	}
+	for i, text := range texts {
+		r, err := db.QueryResult(int64(i + 1))
+		if err != nil || r == nil || r.RawDmesg != text {
+			t.Fatalf("result %d doesn't read back after compact (%v)", i+1, err)
+		}
+	}
+	hits, err := db.Search(SearchQuery{Query: `"Corrected error received"`, Hostname: "host-7"})
+	if err != nil || len(hits) != 1 || !strings.Contains(hits[0].Snippet, "**Corrected error received**") {
+		t.Errorf("search after compact = %+v, %v", hits, err)
+	}
+}
@@ -0,0 +1,376 @@
+// internal/collector/eval.go
+package collector
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EvalCase is one labeled snippet in an eval corpus. A corpus is a JSON
+// Lines file of these.
+type EvalCase struct {
+	Name       string   `json:"name"`
+	Lines      []string `json:"lines"`
+	Status     string   `json:"status"`               // expected status
+	Categories []string `json:"categories,omitempty"` // expected issue categories
+}
+
+// issueCategories are the categories the prompt asks the model to tag
+// issues with. An issue without one counts as "other".
+var issueCategories = map[string]bool{
+	"memory": true, "storage": true, "network": true, "thermal": true, "driver": true, "other": true,
+}
+
+// LoadCorpus reads and checks an eval corpus.
+func LoadCorpus(path string) ([]EvalCase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []EvalCase
+	names := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var c EvalCase
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("line %d: name is required", n)
+		case names[c.Name]:
+			return nil, fmt.Errorf("line %d: duplicate name %q", n, c.Name)
+		case len(c.Lines) == 0:
+			return nil, fmt.Errorf("line %d (%s): lines is empty", n, c.Name)
+		}
+		if _, ok := statusRank[c.Status]; !ok {
+			return nil, fmt.Errorf("line %d (%s): status must be ok, warning or critical", n, c.Name)
+		}
+		for _, cat := range c.Categories {
+			if !issueCategories[cat] {
+				return nil, fmt.Errorf("line %d (%s): unknown category %q", n, c.Name, cat)
+			}
+		}
+		names[c.Name] = true
+		cases = append(cases, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, errors.New("corpus is empty")
+	}
+	return cases, nil
+}
+
+// EvalOptions tunes an eval run. Prices are per million tokens and only
+// used to report cost.
+type EvalOptions struct {
+	Concurrency     int
+	PricePerMInput  float64
+	PricePerMOutput float64
+}
+
+// EvalReport is the outcome of an eval run. It marshals to stable JSON so
+// reports from two prompt versions can be diffed.
+type EvalReport struct {
+	Generated  time.Time `json:"generated"`
+	PromptHash string    `json:"prompt_hash"` // of the single-host system prompt
+	Models     []string  `json:"models"`      // the fallback chain, in order
+
+	Cases          int     `json:"cases"`
+	Errors         int     `json:"errors"` // cases with no analysis
+	StatusAccuracy float64 `json:"status_accuracy"`
+	// Confusion counts cases by expected status, then the status the model
+	// gave ("error" when it gave none).
+	Confusion  map[string]map[string]int `json:"confusion"`
+	Categories map[string]*CategoryScore `json:"categories"`
+
+	Latency  LatencyStats  `json:"latency"`
+	Tokens   TokenStats    `json:"tokens"`
+	Evidence EvidenceStats `json:"evidence"`
+
+	Results []EvalResult `json:"results"`
+}
+
+// CategoryScore is precision and recall for one issue category.
+type CategoryScore struct {
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+}
+
+type LatencyStats struct {
+	AvgMs int64 `json:"avg_ms"`
+	P50Ms int64 `json:"p50_ms"`
+	P95Ms int64 `json:"p95_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+type TokenStats struct {
+	Prompt     int     `json:"prompt"`
+	Completion int     `json:"completion"`
+	CostUSD    float64 `json:"cost_usd"`
+}
+
+// EvidenceStats counts issues whose evidence isn't in the input: the
+// model made it up, or paraphrased it past recognition.
+type EvidenceStats struct {
+	Issues            int     `json:"issues"`
+	Hallucinated      int     `json:"hallucinated"`
+	HallucinationRate float64 `json:"hallucination_rate"`
+}
+
+// EvalResult is one case's outcome.
+type EvalResult struct {
+	Name         string   `json:"name"`
+	Expected     string   `json:"expected"`
+	Got          string   `json:"got"`
+	Issues       int      `json:"issues"`
+	Categories   []string `json:"categories,omitempty"`   // categories the model gave
+	Hallucinated []string `json:"hallucinated,omitempty"` // evidence not found in the input
+	LatencyMs    int64    `json:"latency_ms"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// RunEval analyzes every case with llm and scores the answers.
+func RunEval(ctx context.Context, llm *LLMClient, cases []EvalCase, opts EvalOptions) *EvalReport {
+	sum := sha256.Sum256([]byte(systemPrompt))
+	r := &EvalReport{
+		Generated:  time.Now().UTC(),
+		PromptHash: hex.EncodeToString(sum[:6]),
+		Cases:      len(cases),
+		Confusion:  map[string]map[string]int{},
+		Categories: map[string]*CategoryScore{},
+		Results:    make([]EvalResult, len(cases)),
+	}
+	for _, ep := range llm.endpoints {
+		r.Models = append(r.Models, ep.Model)
+	}
+
+	metas := make([]AnalysisMeta, len(cases))
+	sem := make(chan struct{}, max(opts.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i, c := range cases {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			result, meta, err := llm.Analyze(ctx, c.Lines)
+			metas[i] = meta
+			res := EvalResult{Name: c.Name, Expected: c.Status, LatencyMs: meta.LatencyMs}
+			if err != nil {
+				res.Got, res.Error = "error", err.Error()
+				r.Results[i] = res
+				return
+			}
+			res.Got, res.Issues = result.Status, len(result.Issues)
+			seen := map[string]bool{}
+			input := normalizeEvidence(strings.Join(c.Lines, "\n"))
+			for _, issue := range result.Issues {
+				cat := issue.Category
+				if !issueCategories[cat] {
+					cat = "other"
+				}
+				if !seen[cat] {
+					seen[cat] = true
+					res.Categories = append(res.Categories, cat)
+				}
+				if !evidenceIn(issue.Evidence, input) {
+					res.Hallucinated = append(res.Hallucinated, issue.Evidence)
+				}
+			}
+			sort.Strings(res.Categories)
+			r.Results[i] = res
+		}()
+	}
+	wg.Wait()
+
+	var latencies []int64
+	correct := 0
+	for i, res := range r.Results {
+		if r.Confusion[res.Expected] == nil {
+			r.Confusion[res.Expected] = map[string]int{}
+		}
+		r.Confusion[res.Expected][res.Got]++
+		if res.Got == res.Expected {
+			correct++
+		}
+		if res.Error != "" {
+			r.Errors++
+		} else {
+			latencies = append(latencies, res.LatencyMs)
+			scoreCategories(r.Categories, cases[i].Categories, res.Categories)
+			r.Evidence.Issues += res.Issues
+			r.Evidence.Hallucinated += len(res.Hallucinated)
+		}
+		r.Tokens.Prompt += metas[i].PromptTokens
+		r.Tokens.Completion += metas[i].CompletionTokens
+	}
+
+	r.StatusAccuracy = ratio(correct, len(cases))
+	for _, s := range r.Categories {
+		s.Precision = ratio(s.TruePositives, s.TruePositives+s.FalsePositives)
+		s.Recall = ratio(s.TruePositives, s.TruePositives+s.FalseNegatives)
+	}
+	r.Evidence.HallucinationRate = ratio(r.Evidence.Hallucinated, r.Evidence.Issues)
+	r.Latency = latencyStats(latencies)
+	r.Tokens.CostUSD = (float64(r.Tokens.Prompt)*opts.PricePerMInput + float64(r.Tokens.Completion)*opts.PricePerMOutput) / 1e6
+	return r
+}
+
+// scoreCategories adds one case's category hits and misses to scores.
+func scoreCategories(scores map[string]*CategoryScore, expected, got []string) {
+	score := func(cat string) *CategoryScore {
+		if scores[cat] == nil {
+			scores[cat] = &CategoryScore{}
+		}
+		return scores[cat]
+	}
+	want := map[string]bool{}
+	for _, cat := range expected {
+		want[cat] = true
+	}
+	for _, cat := range got {
+		if want[cat] {
+			score(cat).TruePositives++
+			delete(want, cat)
+		} else {
+			score(cat).FalsePositives++
+		}
+	}
+	for cat := range want {
+		score(cat).FalseNegatives++
+	}
+}
+
+// normalizeEvidence lowercases s and collapses its whitespace, so evidence
+// that differs from the input only in spacing still matches.
+func normalizeEvidence(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// evidenceIn reports whether evidence was quoted from input (already
+// normalized). Models elide with "..." so each fragment is checked on its
+// own; empty evidence is not a quote.
+func evidenceIn(evidence, input string) bool {
+	evidence = strings.ReplaceAll(evidence, "…", "...")
+	found := false
+	for _, frag := range strings.Split(evidence, "...") {
+		frag = normalizeEvidence(frag)
+		if frag == "" {
+			continue
+		}
+		if !strings.Contains(input, frag) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+func latencyStats(ms []int64) LatencyStats {
+	if len(ms) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i] < ms[j] })
+	var total int64
+	for _, v := range ms {
+		total += v
+	}
+	pct := func(p int) int64 { return ms[(len(ms)-1)*p/100] }
+	return LatencyStats{
+		AvgMs: total / int64(len(ms)),
+		P50Ms: pct(50),
+		P95Ms: pct(95),
+		MaxMs: ms[len(ms)-1],
+	}
+}
+
+// WriteText prints the report for a terminal.
+func (r *EvalReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Prompt %s, models %s\n", r.PromptHash, strings.Join(r.Models, " -> "))
+	fmt.Fprintf(w, "Cases: %d  errors: %d  status accuracy: %.1f%%\n\n", r.Cases, r.Errors, r.StatusAccuracy*100)
+
+	statuses := []string{"ok", "warning", "critical", "error"}
+	fmt.Fprintf(w, "Status confusion (rows expected, columns got):\n  %-10s", "")
+	for _, got := range statuses {
+		fmt.Fprintf(w, "%9s", got)
+	}
+	fmt.Fprintln(w)
+	for _, want := range statuses[:3] {
+		fmt.Fprintf(w, "  %-10s", want)
+		for _, got := range statuses {
+			fmt.Fprintf(w, "%9d", r.Confusion[want][got])
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(r.Categories) > 0 {
+		cats := make([]string, 0, len(r.Categories))
+		for cat := range r.Categories {
+			cats = append(cats, cat)
+		}
+		sort.Strings(cats)
+		fmt.Fprintf(w, "\nCategories:\n  %-10s%11s%9s%5s%5s%5s\n", "", "precision", "recall", "tp", "fp", "fn")
+		for _, cat := range cats {
+			s := r.Categories[cat]
+			fmt.Fprintf(w, "  %-10s%10.1f%%%8.1f%%%5d%5d%5d\n", cat, s.Precision*100, s.Recall*100,
+				s.TruePositives, s.FalsePositives, s.FalseNegatives)
+		}
+	}
+
+	fmt.Fprintf(w, "\nLatency: avg=%dms p50=%dms p95=%dms max=%dms\n",
+		r.Latency.AvgMs, r.Latency.P50Ms, r.Latency.P95Ms, r.Latency.MaxMs)
+	fmt.Fprintf(w, "Tokens: %d prompt, %d completion", r.Tokens.Prompt, r.Tokens.Completion)
+	if r.Tokens.CostUSD > 0 {
+		fmt.Fprintf(w, ", $%.4f", r.Tokens.CostUSD)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Evidence: %d of %d issues not found in the input (%.1f%%)\n",
+		r.Evidence.Hallucinated, r.Evidence.Issues, r.Evidence.HallucinationRate*100)
+
+	var misses []EvalResult
+	for _, res := range r.Results {
+		if res.Got != res.Expected {
+			misses = append(misses, res)
+		}
+	}
+	if len(misses) > 0 {
+		fmt.Fprintln(w, "\nMisses:")
+		for _, res := range misses {
+			fmt.Fprintf(w, "  %-32s expected %-8s got %s", res.Name, res.Expected, res.Got)
+			if res.Error != "" {
+				fmt.Fprintf(w, " (%s)", truncate(res.Error, 80))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// internal/collector/eval_test.go
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/fakellm"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+const evalTestCorpus = `
+# comments and blank lines are skipped
+{"name": "ue", "status": "critical", "categories": ["memory"], "lines": ["[2026-02-03T12:00:00Z] kern.emerg EDAC MC1: 1 UE memory read error"]}
+{"name": "nvme", "status": "critical", "categories": ["storage"], "lines": ["[2026-02-03T12:00:00Z] kern.warning nvme nvme0: I/O 512 QID 3 timeout, reset controller"]}
+{"name": "flap", "status": "warning", "categories": ["network"], "lines": ["[2026-02-03T12:00:00Z] kern.info ens1f0: Link down"]}
+{"name": "boot", "status": "ok", "lines": ["[2026-02-03T12:00:00Z] kern.info usb 1-1: new high-speed USB device"]}
+`
+
+func TestRunEval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+	if err := os.WriteFile(path, []byte(evalTestCorpus), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadCorpus(path)
+	if err != nil {
+		t.Fatalf("LoadCorpus: %v", err)
+	}
+
+	fake, err := fakellm.New(&fakellm.Rules{Rules: []*fakellm.Rule{
+		{Match: "EDAC", Reply: fakellm.Reply{Status: "critical", Issues: []protocol.Issue{
+			{Summary: "Uncorrected memory error", Evidence: "EDAC MC1:   1 UE memory read error", Category: "memory"},
+		}}},
+		// Right status, wrong category, made-up evidence.
+		{Match: "nvme", Reply: fakellm.Reply{Status: "critical", Issues: []protocol.Issue{
+			{Summary: "Controller failure", Evidence: "nvme0: controller is down, will reset", Category: "driver"},
+		}}},
+		{Match: "Link", Reply: fakellm.Reply{Error: 400}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := NewLLMClient([]Endpoint{{URL: server.URL, Model: "fake"}}, 0)
+	report := RunEval(context.Background(), client, cases, EvalOptions{Concurrency: 2, PricePerMInput: 1, PricePerMOutput: 2})
+
+	if report.Cases != 4 || report.Errors != 1 || report.StatusAccuracy != 0.75 {
+		t.Errorf("cases/errors/accuracy = %d/%d/%v, want 4/1/0.75", report.Cases, report.Errors, report.StatusAccuracy)
+	}
+	if report.Confusion["critical"]["critical"] != 2 || report.Confusion["warning"]["error"] != 1 || report.Confusion["ok"]["ok"] != 1 {
+		t.Errorf("confusion = %v", report.Confusion)
+	}
+	if s := report.Categories["memory"]; s == nil || s.Precision != 1 || s.Recall != 1 {
+		t.Errorf("memory = %+v, want perfect precision and recall", s)
+	}
+	if s := report.Categories["storage"]; s == nil || s.FalseNegatives != 1 || s.Recall != 0 {
+		t.Errorf("storage = %+v, want one miss", s)
+	}
+	if s := report.Categories["driver"]; s == nil || s.FalsePositives != 1 || s.Precision != 0 {
+		t.Errorf("driver = %+v, want one false positive", s)
+	}
+	if report.Evidence.Issues != 2 || report.Evidence.Hallucinated != 1 || report.Evidence.HallucinationRate != 0.5 {
+		t.Errorf("evidence = %+v, want 1 of 2 hallucinated", report.Evidence)
+	}
+	if report.Tokens.Prompt == 0 || report.Tokens.CostUSD == 0 {
+		t.Errorf("tokens = %+v, want estimated usage and cost", report.Tokens)
+	}
+	if len(report.Models) != 1 || report.PromptHash == "" {
+		t.Errorf("models = %v, prompt hash = %q", report.Models, report.PromptHash)
+	}
+
+	// The JSON report round-trips and keeps corpus order.
+	buf, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back EvalReport
+	if err := json.Unmarshal(buf, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Results[1].Name != "nvme" || len(back.Results[1].Hallucinated) != 1 {
+		t.Errorf("results[1] = %+v, want nvme with its hallucinated evidence", back.Results[1])
+	}
+
+	var text strings.Builder
+	report.WriteText(&text)
+	for _, want := range []string{"status accuracy: 75.0%", "Evidence: 1 of 2 issues", "flap", "expected warning"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report missing %q\n%s", want, text.String())
+		}
+	}
+}
+
+func TestLoadCorpusRejectsBadCases(t *testing.T) {
+	for _, bad := range []string{
+		`{"name": "x", "status": "fine", "lines": ["a"]}`,
+		`{"name": "x", "status": "ok", "lines": []}`,
+		`{"status": "ok", "lines": ["a"]}`,
+		`{"name": "x", "status": "ok", "categories": ["cpu"], "lines": ["a"]}`,
+		"{\"name\": \"x\", \"status\": \"ok\", \"lines\": [\"a\"]}\n{\"name\": \"x\", \"status\": \"ok\", \"lines\": [\"a\"]}",
+		"",
+	} {
+		path := filepath.Join(t.TempDir(), "corpus.jsonl")
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := LoadCorpus(path); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestEvidenceIn(t *testing.T) {
+	input := normalizeEvidence("[2026-02-03T12:00:00Z] kern.warning nvme nvme0: I/O 512 QID 3 timeout, aborting\nnvme nvme0: reset controller")
+	tests := []struct {
+		evidence string
+		want     bool
+	}{
+		{"nvme0: I/O 512 QID 3 timeout", true},
+		{"NVME0:  i/o 512 qid 3 TIMEOUT", true},
+		{"I/O 512 QID 3 timeout ... reset controller", true},
+		{"I/O 512 QID 3 timeout … controller offline", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := evidenceIn(tt.evidence, input); got != tt.want {
+			t.Errorf("evidenceIn(%q) = %v, want %v", tt.evidence, got, tt.want)
+		}
+	}
+}
+
+func TestShippedCorpusLoads(t *testing.T) {
+	cases, err := LoadCorpus("../../eval/corpus.jsonl")
+	if err != nil {
+		t.Fatalf("eval/corpus.jsonl: %v", err)
+	}
+	// Lines must read as the collector's own rows do, or the eval scores
+	// the model on input it never sees in production.
+	for _, c := range cases {
+		for _, line := range c.Lines {
+			if !isRecordLine(line) {
+				t.Errorf("%s: %q is not in protocol.Record form", c.Name, line)
+			}
+		}
+	}
+}
+
+// isRecordLine reports whether line is as protocol.Record.String renders it.
+func isRecordLine(line string) bool {
+	stamp, rest, ok := strings.Cut(strings.TrimPrefix(line, "["), "] ")
+	if !ok || !strings.HasPrefix(line, "[") {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339, stamp)
+	if err != nil || ts.Format(time.RFC3339) != stamp {
+		return false
+	}
+	prefix, msg, _ := strings.Cut(rest, " ")
+	fac, lvl, ok := strings.Cut(prefix, ".")
+	if !ok || msg == "" {
+		return false
+	}
+	f, err := protocol.ParseFacility(fac)
+	if err != nil {
+		return false
+	}
+	l, err := protocol.ParseLevel(lvl)
+	if err != nil {
+		return false
+	}
+	return protocol.Record{Timestamp: ts, Facility: f, Level: l, Message: msg}.String() == line
+}
@@ -0,0 +1,170 @@
+// internal/collector/export.go
+package collector
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Export formats.
+const (
+	FormatJSONL   = "jsonl"   // one protocol.StoredResult per line
+	FormatCSV     = "csv"     // a header row, then resultFields per row
+	FormatParquet = "parquet" // resultFields as columns
+)
+
+// ResultWriter writes results to an export in one of the formats above.
+// Close finishes the export but leaves the underlying writer open.
+type ResultWriter interface {
+	Write(r *protocol.StoredResult) error
+	Close() error
+}
+
+// NewResultWriter returns a ResultWriter for format writing to w.
+func NewResultWriter(w io.Writer, format string) (ResultWriter, error) {
+	switch format {
+	case FormatJSONL:
+		return jsonlWriter{json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatParquet:
+		return newParquetWriter(w)
+	}
+	return nil, fmt.Errorf("unknown export format %q (want jsonl, csv or parquet)", format)
+}
+
+// Kinds of resultField value.
+const (
+	fieldInt    = iota // int64
+	fieldTime          // time.Time
+	fieldString        // string
+	fieldBool          // bool
+)
+
+// resultField is one column of a CSV or Parquet export. Issues, verdicts
+// and suppressed issues are JSON, as in the database.
+type resultField struct {
+	name string
+	kind int
+	get  func(r *protocol.StoredResult) interface{}
+}
+
+var resultFields = []resultField{
+	{"id", fieldInt, func(r *protocol.StoredResult) interface{} { return r.ID }},
+	{"timestamp", fieldTime, func(r *protocol.StoredResult) interface{} { return r.Timestamp }},
+	{"hostname", fieldString, func(r *protocol.StoredResult) interface{} { return r.Hostname }},
+	{"source", fieldString, func(r *protocol.StoredResult) interface{} { return r.Source }},
+	{"status", fieldString, func(r *protocol.StoredResult) interface{} { return r.Status }},
+	{"issues", fieldString, func(r *protocol.StoredResult) interface{} { return jsonField(r.Issues, "[]") }},
+	{"raw_dmesg", fieldString, func(r *protocol.StoredResult) interface{} { return r.RawDmesg }},
+	{"api_latency_ms", fieldInt, func(r *protocol.StoredResult) interface{} { return r.APILatencyMs }},
+	{"provider", fieldString, func(r *protocol.StoredResult) interface{} { return r.Provider }},
+	{"model", fieldString, func(r *protocol.StoredResult) interface{} { return r.Model }},
+	{"error_class", fieldString, func(r *protocol.StoredResult) interface{} { return r.ErrorClass }},
+	{"verdicts", fieldString, func(r *protocol.StoredResult) interface{} { return jsonField(r.Verdicts, "") }},
+	{"suppressed", fieldString, func(r *protocol.StoredResult) interface{} { return jsonField(r.Suppressed, "") }},
+	{"silenced", fieldBool, func(r *protocol.StoredResult) interface{} { return r.Silenced }},
+	{"created_at", fieldTime, func(r *protocol.StoredResult) interface{} { return r.CreatedAt }},
+}
+
+// jsonField renders a list as JSON, or as empty when it has no entries.
+func jsonField(v interface{}, empty string) string {
+	buf, err := json.Marshal(v)
+	if err != nil || string(buf) == "null" || string(buf) == "[]" {
+		return empty
+	}
+	return string(buf)
+}
+
+type jsonlWriter struct{ enc *json.Encoder }
+
+func (w jsonlWriter) Write(r *protocol.StoredResult) error { return w.enc.Encode(r) }
+func (w jsonlWriter) Close() error                         { return nil }
+
+type csvWriter struct {
+	w   *csv.Writer
+	row []string
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), row: make([]string, len(resultFields))}
+	for i, f := range resultFields {
+		cw.row[i] = f.name
+	}
+	return cw, cw.w.Write(cw.row)
+}
+
+func (cw *csvWriter) Write(r *protocol.StoredResult) error {
+	for i, f := range resultFields {
+		switch v := f.get(r).(type) {
+		case int64:
+			cw.row[i] = strconv.FormatInt(v, 10)
+		case time.Time:
+			cw.row[i] = v.UTC().Format(time.RFC3339)
+		case string:
+			cw.row[i] = v
+		case bool:
+			cw.row[i] = strconv.FormatBool(v)
+		}
+	}
+	return cw.w.Write(cw.row)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ExportResults writes the results whose timestamp is in [since, until) to
+// w, in the order they were stored, and returns how many it wrote. A zero
+// bound is open.
+func (d *sqlStore) ExportResults(since, until time.Time, w ResultWriter) (int, error) {
+	cond, args := `1 = 1`, []interface{}{}
+	if !since.IsZero() {
+		cond += ` AND timestamp >= ?`
+		args = append(args, since.UTC().Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		cond += ` AND timestamp < ?`
+		args = append(args, until.UTC().Format(time.RFC3339))
+	}
+	n := 0
+	err := d.eachResult(cond, args, func(batch []protocol.StoredResult) error {
+		for i := range batch {
+			if err := w.Write(&batch[i]); err != nil {
+				return err
+			}
+		}
+		n += len(batch)
+		return nil
+	})
+	return n, err
+}
+
+// eachResult calls fn with the results matching cond, dmesgBatch at a
+// time in id order.
+func (d *sqlStore) eachResult(cond string, args []interface{}, fn func([]protocol.StoredResult) error) error {
+	var after int64
+	for {
+		rows, err := d.query(`SELECT `+resultColumns+` FROM results WHERE `+cond+` AND id > ? ORDER BY id LIMIT ?`,
+			append(args[:len(args):len(args)], after, dmesgBatch)...)
+		if err != nil {
+			return err
+		}
+		batch, err := d.scanResults(rows)
+		rows.Close()
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		after = batch[len(batch)-1].ID
+	}
+}
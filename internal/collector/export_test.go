@@ -0,0 +1,94 @@
+// internal/collector/export_test.go
+package collector
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewResultWriter(&buf, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := protocol.StoredResult{
+		ID:        7,
+		Timestamp: time.Date(2026, 5, 12, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600)),
+		Hostname:  "db-1",
+		Status:    "warning",
+		Issues:    []protocol.Issue{{Summary: "ECC corrected", Evidence: "EDAC MC0: 1 CE"}},
+		RawDmesg:  "EDAC MC0: 1 CE\nsecond, line",
+		Silenced:  true,
+	}
+	if err := w.Write(&r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0][0] != "id" || records[0][len(records[0])-1] != "created_at" {
+		t.Fatalf("records = %q", records)
+	}
+	row := map[string]string{}
+	for i, name := range records[0] {
+		row[name] = records[1][i]
+	}
+	want := map[string]string{
+		"id": "7", "timestamp": "2026-05-12T08:00:00Z", "hostname": "db-1", "status": "warning",
+		"issues":    `[{"summary":"ECC corrected","evidence":"EDAC MC0: 1 CE"}]`,
+		"raw_dmesg": "EDAC MC0: 1 CE\nsecond, line", "verdicts": "", "silenced": "true",
+	}
+	for k, v := range want {
+		if row[k] != v {
+			t.Errorf("%s = %q, want %q", k, row[k], v)
+		}
+	}
+
+	if _, err := NewResultWriter(&buf, "xml"); err == nil {
+		t.Error("NewResultWriter accepted format xml")
+	}
+}
+
+func testStoreExport(t *testing.T, s Store) {
+	ts := time.Date(2026, 5, 12, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		r := protocol.StoredResult{Timestamp: ts.Add(time.Duration(i) * time.Hour), Hostname: "h", Status: "ok", RawDmesg: "eth0: link up"}
+		if err := s.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []int64
+	n, err := s.ExportResults(ts.Add(time.Hour), ts.Add(4*time.Hour), writerFunc(func(r *protocol.StoredResult) error {
+		if r.RawDmesg != "eth0: link up" {
+			t.Errorf("result %d: dmesg %q", r.ID, r.RawDmesg)
+		}
+		got = append(got, r.ID)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{2, 3, 4}; n != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("exported %d: %v, want %v", n, got, want)
+	}
+	if n, err := s.ExportResults(time.Time{}, time.Time{}, writerFunc(func(*protocol.StoredResult) error { return nil })); n != 5 || err != nil {
+		t.Errorf("unbounded export = %d, %v; want 5", n, err)
+	}
+}
+
+// writerFunc is a ResultWriter calling itself for each result.
+type writerFunc func(r *protocol.StoredResult) error
+
+func (f writerFunc) Write(r *protocol.StoredResult) error { return f(r) }
+func (f writerFunc) Close() error                         { return nil }
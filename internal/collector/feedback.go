@@ -0,0 +1,383 @@
+// internal/collector/feedback.go
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Operator labels feed back into analysis three ways: issues labelled false
+// positives often enough become suppression rules, the most recent ones are
+// shown to the model as examples of noise, and every label can be exported
+// as an eval corpus case.
+
+// feedbackRefresh is how often the collector re-reads labels, so labels
+// added with the CLI take effect without a restart.
+const feedbackRefresh = time.Minute
+
+// maxExampleEvidence caps each false-positive example's evidence in the
+// prompt.
+const maxExampleEvidence = 300
+
+var (
+	sigTimestamp = regexp.MustCompile(`(?m)^\s*\[[^\]]*\]\s*`)
+	sigPCIAddr   = regexp.MustCompile(`\b(?:[0-9a-f]{4}:)?[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]\b`)
+	sigHexPrefix = regexp.MustCompile(`0x[0-9a-f]+`)
+	sigHexWord   = regexp.MustCompile(`\b[0-9a-f]*[0-9][0-9a-f]*\b`)
+	sigDigits    = regexp.MustCompile(`[0-9]+`)
+)
+
+// signature reduces an issue to what identifies the message behind it: its
+// evidence (or, without any, its summary) lowercased, without dmesg
+// timestamps, with PCI addresses, numbers and hex masked and whitespace
+// collapsed. The same fault on another device, address or host has the
+// same signature.
+func signature(issue protocol.Issue) string {
+	s := issue.Evidence
+	if strings.TrimSpace(s) == "" {
+		s = issue.Summary
+	}
+	s = sigTimestamp.ReplaceAllString(strings.ToLower(s), "")
+	s = sigPCIAddr.ReplaceAllString(s, "#")
+	s = sigHexPrefix.ReplaceAllString(s, "#")
+	s = sigHexWord.ReplaceAllString(s, "#")
+	s = sigDigits.ReplaceAllString(s, "#")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Suppression is a rule built from labels: new issues with its signature
+// are dropped from results.
+type Suppression struct {
+	Signature      string    `json:"signature"`
+	Example        string    `json:"example"` // a labelled issue's summary
+	FalsePositives int       `json:"false_positives"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// signatureVerdicts tallies labels per issue signature: how many times
+// each was labelled a false positive, and which were ever confirmed real
+// (a true positive or wrong severity label).
+func signatureVerdicts(rows []labelRow) (falsePositives map[string]int, confirmed map[string]bool, example map[string]string) {
+	falsePositives, confirmed, example = map[string]int{}, map[string]bool{}, map[string]string{}
+	for _, r := range rows {
+		for _, issue := range r.Issues {
+			sig := signature(issue)
+			if sig == "" {
+				continue
+			}
+			if r.Verdict != protocol.LabelFalsePositive {
+				confirmed[sig] = true
+				continue
+			}
+			falsePositives[sig]++
+			if example[sig] == "" {
+				example[sig] = issue.Summary
+			}
+		}
+	}
+	return falsePositives, confirmed, example
+}
+
+// RebuildSuppressions brings the suppression rules in line with the labels:
+// a signature labelled a false positive at least threshold times, and never
+// confirmed, is suppressed. threshold <= 0 removes every rule.
+func (d *sqlStore) RebuildSuppressions(threshold int) error {
+	want := map[string]bool{}
+	var rows []labelRow
+	if threshold > 0 {
+		var err error
+		if rows, err = d.labelRows(); err != nil {
+			return err
+		}
+	}
+	falsePositives, confirmed, example := signatureVerdicts(rows)
+	for sig, n := range falsePositives {
+		if n >= threshold && !confirmed[sig] {
+			want[sig] = true
+		}
+	}
+
+	current, err := d.Suppressions()
+	if err != nil {
+		return err
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range current {
+		if !want[s.Signature] {
+			if _, err := tx.Exec(d.rebind(`DELETE FROM suppressions WHERE signature = ?`), s.Signature); err != nil {
+				return err
+			}
+			log.Printf("Suppression lifted: %q", s.Signature)
+		}
+	}
+	have := make(map[string]bool, len(current))
+	for _, s := range current {
+		have[s.Signature] = true
+	}
+	for sig := range want {
+		if !have[sig] {
+			log.Printf("Suppression added after %d false positive labels: %q", falsePositives[sig], sig)
+		}
+		_, err := tx.Exec(d.rebind(`
+			INSERT INTO suppressions (signature, example, false_positives) VALUES (?, ?, ?)
+			ON CONFLICT(signature) DO UPDATE SET example = excluded.example, false_positives = excluded.false_positives
+		`), sig, example[sig], falsePositives[sig])
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Suppressions returns the suppression rules, oldest first.
+func (d *sqlStore) Suppressions() ([]Suppression, error) {
+	rows, err := d.query(`SELECT signature, COALESCE(example, ''), false_positives, created_at FROM suppressions ORDER BY created_at, signature`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Suppression
+	for rows.Next() {
+		var s Suppression
+		var createdStr string
+		if err := rows.Scan(&s.Signature, &s.Example, &s.FalsePositives, &createdStr); err != nil {
+			return nil, err
+		}
+		s.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdStr)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// suppress moves r's issues that match a suppression rule to r.Suppressed.
+// A result left without issues is ok.
+func (d *sqlStore) suppress(r *protocol.StoredResult) error {
+	if len(r.Issues) == 0 {
+		return nil
+	}
+	rules, err := d.Suppressions()
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	suppressed := make(map[string]bool, len(rules))
+	for _, s := range rules {
+		suppressed[s.Signature] = true
+	}
+
+	var kept []protocol.Issue
+	for _, issue := range r.Issues {
+		if suppressed[signature(issue)] {
+			r.Suppressed = append(r.Suppressed, issue)
+		} else {
+			kept = append(kept, issue)
+		}
+	}
+	if len(r.Suppressed) == 0 {
+		return nil
+	}
+	log.Printf("Suppressed %d of %d issues for %s (labelled false positives)", len(r.Suppressed), len(r.Issues), r.Hostname)
+	r.Issues = nonNil(kept)
+	if len(kept) == 0 {
+		r.Status = "ok"
+	}
+	return nil
+}
+
+// RecentFalsePositives returns up to n of the most recently labelled
+// false-positive issues, one per signature, leaving out any since
+// confirmed real.
+func (d *sqlStore) RecentFalsePositives(n int) ([]protocol.Issue, error) {
+	rows, err := d.labelRows()
+	if err != nil {
+		return nil, err
+	}
+	_, confirmed, _ := signatureVerdicts(rows)
+	var out []protocol.Issue
+	seen := map[string]bool{}
+	for i := len(rows) - 1; i >= 0 && len(out) < n; i-- {
+		if rows[i].Verdict != protocol.LabelFalsePositive {
+			continue
+		}
+		for _, issue := range rows[i].Issues {
+			sig := signature(issue)
+			if sig == "" || seen[sig] || confirmed[sig] || len(out) == n {
+				continue
+			}
+			seen[sig] = true
+			out = append(out, issue)
+		}
+	}
+	return out, nil
+}
+
+// negativesPrompt renders false positives as a system prompt section.
+func negativesPrompt(issues []protocol.Issue) string {
+	if len(issues) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\nOperators reviewed these past findings and marked them as false positives. Don't flag the same messages again unless other lines show a real fault:\n")
+	for _, issue := range issues {
+		evidence := strings.Join(strings.Fields(issue.Evidence), " ")
+		if evidence == "" {
+			evidence = issue.Summary
+		}
+		fmt.Fprintf(&sb, "- %q (flagged as: %s)\n", truncate(evidence, maxExampleEvidence), issue.Summary)
+	}
+	return sb.String()
+}
+
+// feedback applies the labels to a running collector.
+type feedback struct {
+	db            Store
+	llm           *LLMClient
+	suppressAfter int
+	examples      int
+}
+
+// refresh rebuilds the suppression rules and the model's false-positive
+// examples from the labels.
+func (f *feedback) refresh() error {
+	if err := f.db.RebuildSuppressions(f.suppressAfter); err != nil {
+		return err
+	}
+	if f.llm == nil {
+		return nil
+	}
+	var negatives []protocol.Issue
+	if f.examples > 0 {
+		var err error
+		if negatives, err = f.db.RecentFalsePositives(f.examples); err != nil {
+			return err
+		}
+	}
+	f.llm.setNegatives(negatives)
+	return nil
+}
+
+// startFeedback refreshes f now and every feedbackRefresh until ctx is
+// done.
+func startFeedback(ctx context.Context, f *feedback) {
+	go func() {
+		run := func() {
+			if err := f.refresh(); err != nil {
+				log.Printf("Feedback refresh error: %v", err)
+			}
+		}
+		run()
+		ticker := time.NewTicker(feedbackRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
+
+// ExportCorpus writes one eval case per labelled result to w, as JSON
+// Lines LoadCorpus reads, and returns how many it wrote. A result's labels
+// apply in the order they were made, so a later label overrides an
+// earlier one: the expected status is the corrected severity if one was
+// given, ok if every issue is a false positive, and the status the model
+// gave otherwise. Results that were never analyzed are skipped.
+func (d *sqlStore) ExportCorpus(w io.Writer) (int, error) {
+	rows, err := d.labelRows()
+	if err != nil {
+		return 0, err
+	}
+
+	type labelled struct {
+		row      labelRow
+		fp       map[int]bool
+		severity string
+	}
+	var order []int64
+	byResult := map[int64]*labelled{}
+	for _, r := range rows {
+		c := byResult[r.ResultID]
+		if c == nil {
+			c = &labelled{row: r, fp: map[int]bool{}}
+			byResult[r.ResultID] = c
+			order = append(order, r.ResultID)
+		}
+		var idx []int
+		if r.Issue != nil {
+			idx = []int{*r.Issue}
+		} else {
+			for i := range r.allIssues {
+				idx = append(idx, i)
+			}
+		}
+		switch r.Verdict {
+		case protocol.LabelFalsePositive:
+			for _, i := range idx {
+				c.fp[i] = true
+			}
+		case protocol.LabelTruePositive:
+			for _, i := range idx {
+				delete(c.fp, i)
+			}
+		case protocol.LabelWrongSeverity:
+			c.severity = r.Severity
+			for _, i := range idx {
+				delete(c.fp, i)
+			}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	n := 0
+	for _, id := range order {
+		c := byResult[id]
+		if _, ok := statusRank[c.row.status]; !ok || c.row.rawDmesg == "" {
+			continue
+		}
+		ec := EvalCase{
+			Name:   fmt.Sprintf("label-%d-%s", id, c.row.Hostname),
+			Lines:  strings.Split(c.row.rawDmesg, "\n"),
+			Status: c.row.status,
+		}
+		seen := map[string]bool{}
+		for i, issue := range c.row.allIssues {
+			cat := issue.Category
+			if cat == "" || !issueCategories[cat] {
+				cat = "other"
+			}
+			if !c.fp[i] && !seen[cat] {
+				seen[cat] = true
+				ec.Categories = append(ec.Categories, cat)
+			}
+		}
+		switch {
+		case c.severity != "":
+			ec.Status = c.severity
+		case len(c.row.allIssues) > 0 && len(c.fp) == len(c.row.allIssues):
+			ec.Status = "ok"
+		}
+		if ec.Status == "ok" {
+			ec.Categories = nil
+		}
+		if err := enc.Encode(ec); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
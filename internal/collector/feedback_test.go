@@ -0,0 +1,347 @@
+// internal/collector/feedback_test.go
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// aerIssue is the same benign AER message as seen on different hosts and
+// devices.
+func aerIssue(dev string) protocol.Issue {
+	return protocol.Issue{
+		Summary:  "PCIe corrected error on " + dev,
+		Evidence: "[ 8812.2201] pcieport " + dev + ": AER: Corrected error received: " + dev,
+		Category: "network",
+	}
+}
+
+var eccIssue = protocol.Issue{Summary: "ECC uncorrected error", Evidence: "EDAC MC0: 1 UE on DIMM_A1", Category: "memory"}
+
+func insertFlagged(t *testing.T, db *DB, host string, issues ...protocol.Issue) int64 {
+	t.Helper()
+	r := &protocol.StoredResult{
+		Timestamp: time.Now(),
+		Hostname:  host,
+		Status:    "warning",
+		Issues:    issues,
+	}
+	for _, issue := range issues {
+		r.RawDmesg += issue.Evidence + "\n"
+	}
+	r.RawDmesg = strings.TrimSuffix(r.RawDmesg, "\n")
+	if err := db.InsertResult(r); err != nil {
+		t.Fatal(err)
+	}
+	return r.ID
+}
+
+func TestSignature(t *testing.T) {
+	a := signature(aerIssue("0000:3b:00.0"))
+	b := signature(aerIssue("0000:af:02.1"))
+	if a != b {
+		t.Errorf("signatures differ across devices:\n%s\n%s", a, b)
+	}
+	if a != "pcieport #: aer: corrected error received: #" {
+		t.Errorf("signature = %q", a)
+	}
+	if signature(protocol.Issue{Summary: "Disk 3 failing"}) != "disk # failing" {
+		t.Error("issue without evidence should fall back to its summary")
+	}
+	if signature(eccIssue) == a {
+		t.Error("different messages share a signature")
+	}
+}
+
+func TestAddLabelValidates(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	id := insertFlagged(t, db, "host1", eccIssue)
+	two := 2
+
+	for name, l := range map[string]protocol.Label{
+		"unknown verdict":      {ResultID: id, Verdict: "meh"},
+		"missing severity":     {ResultID: id, Verdict: protocol.LabelWrongSeverity},
+		"severity with fp":     {ResultID: id, Verdict: protocol.LabelFalsePositive, Severity: "ok"},
+		"no such result":       {ResultID: id + 100, Verdict: protocol.LabelTruePositive},
+		"issue out of range":   {ResultID: id, Issue: &two, Verdict: protocol.LabelFalsePositive},
+		"bad corrected status": {ResultID: id, Verdict: protocol.LabelWrongSeverity, Severity: "meh"},
+	} {
+		if err := db.AddLabel(&l); !errors.Is(err, ErrInvalidLabel) {
+			t.Errorf("%s: err = %v, want ErrInvalidLabel", name, err)
+		}
+	}
+
+	l := protocol.Label{ResultID: id, Verdict: protocol.LabelWrongSeverity, Severity: "critical", Note: "UE is never a warning", Author: "oncall"}
+	if err := db.AddLabel(&l); err != nil {
+		t.Fatal(err)
+	}
+	labels, err := db.QueryLabels(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 1 {
+		t.Fatalf("labels = %+v, want 1", labels)
+	}
+	got := labels[0]
+	if got.ID != l.ID || got.Hostname != "host1" || got.Severity != "critical" || got.Author != "oncall" ||
+		len(got.Issues) != 1 || got.Issues[0].Summary != eccIssue.Summary || got.CreatedAt.IsZero() {
+		t.Errorf("label = %+v", got)
+	}
+}
+
+func TestSuppressionFromLabels(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Two hosts' AER noise labelled false positive, one issue at a time.
+	zero := 0
+	for _, dev := range []string{"0000:3b:00.0", "0000:5e:00.0"} {
+		id := insertFlagged(t, db, "host-"+dev[5:7], aerIssue(dev), eccIssue)
+		if err := db.AddLabel(&protocol.Label{ResultID: id, Issue: &zero, Verdict: protocol.LabelFalsePositive}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.RebuildSuppressions(3); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := db.Suppressions(); len(rules) != 0 {
+		t.Fatalf("rules = %+v, want none below the threshold", rules)
+	}
+	if err := db.RebuildSuppressions(2); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := db.Suppressions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].FalsePositives != 2 || !strings.HasPrefix(rules[0].Example, "PCIe corrected error") {
+		t.Fatalf("rules = %+v, want the AER signature", rules)
+	}
+
+	// A new host's AER noise is dropped; the ECC error stays.
+	result := &protocol.AnalysisResult{Status: "warning", Issues: []protocol.Issue{aerIssue("0000:d8:00.0"), eccIssue}}
+	stored, err := storeResult(db, "host3", "kmsg", time.Now(), []string{"x"}, result, AnalysisMeta{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "warning" || len(stored.Issues) != 1 || stored.Issues[0].Summary != eccIssue.Summary || len(stored.Suppressed) != 1 {
+		t.Errorf("stored = %+v, want the AER issue suppressed", stored)
+	}
+
+	// With only noise left the result is ok, and the row remembers why.
+	result = &protocol.AnalysisResult{Status: "warning", Issues: []protocol.Issue{aerIssue("0000:d8:00.0")}}
+	stored, err = storeResult(db, "host3", "kmsg", time.Now(), []string{"x"}, result, AnalysisMeta{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.QueryResult(stored.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "ok" || len(got.Issues) != 0 || len(got.Suppressed) != 1 {
+		t.Errorf("row = %+v, want ok with one suppressed issue", got)
+	}
+
+	// Confirming the message is real lifts the rule.
+	id := insertFlagged(t, db, "host4", aerIssue("0000:00:01.0"))
+	if err := db.AddLabel(&protocol.Label{ResultID: id, Verdict: protocol.LabelTruePositive}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RebuildSuppressions(2); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := db.Suppressions(); len(rules) != 0 {
+		t.Errorf("rules = %+v, want the confirmed signature lifted", rules)
+	}
+}
+
+func TestLLMClientFeedbackExamples(t *testing.T) {
+	var system string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct{ Role, Content string } `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		system = req.Messages[0].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": `{"status": "ok", "issues": []}`}}},
+		})
+	}))
+	defer server.Close()
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, dev := range []string{"0000:3b:00.0", "0000:5e:00.0"} {
+		id := insertFlagged(t, db, "host1", aerIssue(dev))
+		if err := db.AddLabel(&protocol.Label{ResultID: id, Verdict: protocol.LabelFalsePositive}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := insertFlagged(t, db, "host1", protocol.Issue{Summary: "USB reset", Evidence: "usb 1-1: reset high-speed USB device"})
+	if err := db.AddLabel(&protocol.Label{ResultID: id, Verdict: protocol.LabelFalsePositive}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewLLMClient([]Endpoint{{URL: server.URL, Model: "m"}}, 0)
+	f := &feedback{db: db, llm: client, examples: 5}
+	if err := f.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.Analyze(context.Background(), []string{"line"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(system, systemPrompt) || !strings.Contains(system, "marked them as false positives") {
+		t.Fatalf("system prompt lacks the examples:\n%s", system)
+	}
+	// One example per signature, newest first.
+	examples := system[len(systemPrompt):]
+	if strings.Count(examples, "AER: Corrected error") != 1 || strings.Index(examples, "usb 1-1") > strings.Index(examples, "AER") {
+		t.Errorf("examples not deduplicated or ordered:\n%s", examples)
+	}
+
+	f.examples = 0
+	if err := f.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if client.prompt(systemPrompt) != systemPrompt {
+		t.Error("examples still in the prompt with feedback_examples 0")
+	}
+}
+
+func TestLabelsHandler(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	id := insertFlagged(t, db, "host1", eccIssue)
+	h := NewLabelsHandler(db, "secret", "operator")
+
+	do := func(method, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/labels", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("GET", "", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("bad key: %d, want 401", rec.Code)
+	}
+	if rec := do("POST", `{"result_id": 999, "verdict": "false_positive"}`, "operator"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown result: %d, want 400", rec.Code)
+	}
+	if rec := do("DELETE", "", "secret"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: %d, want 405", rec.Code)
+	}
+
+	label := `{"result_id": ` + jsonInt(id) + `, "issue": 0, "verdict": "false_positive", "note": "lab box", "author": "sam"}`
+	if rec := do("POST", label, "secret"); rec.Code != http.StatusForbidden {
+		t.Errorf("POST with the agents' key: %d, want 403", rec.Code)
+	}
+	rec := do("POST", label, "operator")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: %d %s", rec.Code, rec.Body)
+	}
+	var created protocol.Label
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.ID == 0 || created.Hostname != "host1" || len(created.Issues) != 1 {
+		t.Errorf("created = %+v", created)
+	}
+
+	rec = do("GET", "", "secret")
+	var list struct{ Labels []protocol.Label }
+	json.NewDecoder(rec.Body).Decode(&list)
+	if rec.Code != http.StatusOK || len(list.Labels) != 1 || list.Labels[0].Note != "lab box" {
+		t.Errorf("GET: %d %+v", rec.Code, list)
+	}
+
+	req := httptest.NewRequest("GET", "/api/suppressions", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeSuppressions(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"suppressions":[]`) {
+		t.Errorf("suppressions: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func jsonInt(n int64) string {
+	buf, _ := json.Marshal(n)
+	return string(buf)
+}
+
+func TestExportCorpus(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	zero, one := 0, 1
+
+	noise := insertFlagged(t, db, "noisy", aerIssue("0000:3b:00.0"))
+	mixed := insertFlagged(t, db, "mixed", aerIssue("0000:3b:00.0"), eccIssue)
+	understated := insertFlagged(t, db, "ecc", eccIssue)
+	confirmed := insertFlagged(t, db, "real", eccIssue)
+	for _, l := range []protocol.Label{
+		{ResultID: noise, Verdict: protocol.LabelFalsePositive},
+		{ResultID: mixed, Issue: &zero, Verdict: protocol.LabelFalsePositive},
+		{ResultID: mixed, Issue: &one, Verdict: protocol.LabelTruePositive},
+		{ResultID: understated, Verdict: protocol.LabelWrongSeverity, Severity: "critical"},
+		{ResultID: confirmed, Verdict: protocol.LabelFalsePositive},
+		{ResultID: confirmed, Verdict: protocol.LabelTruePositive}, // changed their mind
+	} {
+		if err := db.AddLabel(&l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := db.ExportCorpus(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("exported %d cases, want 4:\n%s", n, buf.String())
+	}
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadCorpus(path)
+	if err != nil {
+		t.Fatalf("exported corpus doesn't load: %v", err)
+	}
+	want := map[string]string{
+		"noisy": "ok/", "mixed": "warning/memory", "ecc": "critical/memory", "real": "warning/memory",
+	}
+	for _, c := range cases {
+		host := c.Name[strings.LastIndex(c.Name, "-")+1:]
+		if got := c.Status + "/" + strings.Join(c.Categories, ","); got != want[host] {
+			t.Errorf("%s = %s, want %s", c.Name, got, want[host])
+		}
+	}
+}
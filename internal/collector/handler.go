@@ -2,7 +2,10 @@
 package collector
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -14,14 +17,22 @@ import (
 
 // IngestHandler handles POST /ingest requests from agents
 type IngestHandler struct {
-	db              *DB
+	db              Store
 	llm             *LLMClient
 	apiKey          string
 	maxPayloadBytes int64
+
+	// batcher, when set, pools small deltas from several hosts into one
+	// LLM call.
+	batcher *Batcher
+
+	// queue, when started, takes log shippers' deltas for analysis after
+	// their requests are answered.
+	queue *shipQueue
 }
 
 // NewIngestHandler creates a new ingest handler
-func NewIngestHandler(db *DB, llm *LLMClient, apiKey string, maxPayloadBytes int64) *IngestHandler {
+func NewIngestHandler(db Store, llm *LLMClient, apiKey string, maxPayloadBytes int64) *IngestHandler {
 	return &IngestHandler{
 		db:              db,
 		llm:             llm,
@@ -31,27 +42,8 @@ func NewIngestHandler(db *DB, llm *LLMClient, apiKey string, maxPayloadBytes int
 }
 
 func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Check auth
-	auth := r.Header.Get("Authorization")
-	if !strings.HasPrefix(auth, "Bearer ") || strings.TrimPrefix(auth, "Bearer ") != h.apiKey {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Check content length
-	if r.ContentLength > h.maxPayloadBytes {
-		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
-		return
-	}
-
-	// Read body with limit
-	body, err := io.ReadAll(io.LimitReader(r.Body, h.maxPayloadBytes+1))
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
-		return
-	}
-	if int64(len(body)) > h.maxPayloadBytes {
-		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+	body, ok := h.readBody(w, r)
+	if !ok {
 		return
 	}
 
@@ -70,22 +62,90 @@ func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	stored, meta, err := h.ingest(r.Context(), delta)
+	if errors.Is(err, errBatchPending) {
+		// The row is stored once the batch finishes; a resend would
+		// store it twice.
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "pending"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
 	// Skip if no lines
-	if len(delta.Lines) == 0 {
+	if stored == nil {
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "skipped", "reason": "no lines"})
 		return
 	}
 
-	// Call LLM
-	var result *protocol.AnalysisResult
-	var meta AnalysisMeta
-	var llmErr error
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     stored.Status,
+		"latency_ms": meta.LatencyMs,
+	})
+}
+
+// authorized reports whether r carries the collector's bearer token.
+func authorized(r *http.Request, apiKey string) bool {
+	auth := r.Header.Get("Authorization")
+	return strings.HasPrefix(auth, "Bearer ") && strings.TrimPrefix(auth, "Bearer ") == apiKey
+}
+
+// operatorAuthorized reports whether r carries the operator token. With no
+// operator token configured nothing does.
+func operatorAuthorized(r *http.Request, operatorKey string) bool {
+	return operatorKey != "" && authorized(r, operatorKey)
+}
+
+// readBody checks auth and reads the request body within the payload limit,
+// transparently gunzipping it (log shippers compress by default). On
+// failure it has already written the error response.
+func (h *IngestHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if !authorized(r, h.apiKey) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Check content length
+	if r.ContentLength > h.maxPayloadBytes {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+
+	var src io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+			return nil, false
+		}
+		defer zr.Close()
+		src = zr
+	}
 
-	if h.llm != nil {
-		result, meta, llmErr = h.llm.Analyze(r.Context(), delta.Lines)
+	// Read body with limit. The limit applies after decompression so a
+	// small gzip bomb can't expand past it.
+	body, err := io.ReadAll(io.LimitReader(src, h.maxPayloadBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return nil, false
+	}
+	if int64(len(body)) > h.maxPayloadBytes {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return nil, false
 	}
+	return body, true
+}
 
+// ingest stores a delta's hardware data and analyzes its lines. Returns a
+// nil result when there was nothing to analyze; an error means the DB
+// failed and the sender should retry.
+func (h *IngestHandler) ingest(ctx context.Context, delta protocol.DmesgDelta) (*protocol.StoredResult, AnalysisMeta, error) {
 	// Honor the agent's collection timestamp so retries/queued sends record
 	// when the data was gathered, not when we processed it. Reject obvious
 	// clock skew (or unset/zero values) and fall back to the collector clock.
@@ -95,41 +155,105 @@ func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ts = now
 	}
 
-	// Store result
+	// Structured records are rendered with their facility.level prefix so
+	// the LLM can weigh severity; legacy agents still send bare lines.
+	lines := delta.PromptLines()
+
+	// Hardware counters are stored as a time series on every poll. Any
+	// counter that rose since its last sample is appended to the prompt so
+	// the LLM can see "ECC corrections trending up" even when dmesg is quiet.
+	if len(delta.Metrics) > 0 {
+		increases, err := h.db.CounterIncreases(delta.Hostname, ts, delta.Metrics)
+		if err != nil {
+			return nil, AnalysisMeta{}, err
+		}
+		if err := h.db.InsertMetrics(delta.Hostname, ts, delta.Metrics); err != nil {
+			return nil, AnalysisMeta{}, err
+		}
+		for _, inc := range increases {
+			lines = append(lines, inc.String())
+		}
+	}
+
+	// SMART snapshots are stored per drive serial; threshold crossings and
+	// worsening counters since the drive's last snapshot join the prompt.
+	if len(delta.Smart) > 0 {
+		findings, err := h.db.SmartChanges(delta.Hostname, ts, delta.Smart)
+		if err != nil {
+			return nil, AnalysisMeta{}, err
+		}
+		if err := h.db.InsertSmart(delta.Hostname, ts, delta.Smart); err != nil {
+			return nil, AnalysisMeta{}, err
+		}
+		lines = append(lines, findings...)
+	}
+
+	if len(lines) == 0 {
+		return nil, AnalysisMeta{}, nil
+	}
+	if h.batcher != nil {
+		return h.batcher.Analyze(ctx, delta.Hostname, delta.Source, ts, lines)
+	}
+	return analyzeAndStore(ctx, h.db, h.llm, delta.Hostname, delta.Source, ts, lines)
+}
+
+// analyzeAndStore runs one host's lines through the LLM and stores the
+// outcome. LLM failures are recorded in the row's status rather than
+// returned, so the lines are never lost; only a DB failure is an error.
+// Shared by every ingest path so they all land in the digest the same way.
+func analyzeAndStore(ctx context.Context, db Store, llm *LLMClient, hostname, source string, ts time.Time, lines []string) (*protocol.StoredResult, AnalysisMeta, error) {
+	// Call LLM
+	var result *protocol.AnalysisResult
+	var meta AnalysisMeta
+	var llmErr error
+
+	if llm != nil {
+		result, meta, llmErr = llm.Analyze(ctx, lines)
+	}
+
+	stored, err := storeResult(db, hostname, source, ts, lines, result, meta, llmErr)
+	return stored, meta, err
+}
+
+// storeResult writes one host's analysis outcome, whether it came from its
+// own LLM call or its share of a batch.
+func storeResult(db Store, hostname, source string, ts time.Time, lines []string, result *protocol.AnalysisResult, meta AnalysisMeta, llmErr error) (*protocol.StoredResult, error) {
 	stored := &protocol.StoredResult{
 		Timestamp:    ts,
-		Hostname:     delta.Hostname,
-		RawDmesg:     strings.Join(delta.Lines, "\n"),
+		Hostname:     hostname,
+		Source:       source,
+		RawDmesg:     strings.Join(lines, "\n"),
 		APILatencyMs: meta.LatencyMs,
 		Provider:     meta.Provider,
 		Model:        meta.Model,
+		Verdicts:     meta.Verdicts,
 	}
 
 	if llmErr != nil {
+		stored.ErrorClass = string(ErrorClassOf(llmErr))
 		if IsUnavailable(llmErr) {
 			// LLM service is down - log but don't lose the data
-			log.Printf("LLM unavailable for %s: %v (data preserved)", delta.Hostname, llmErr)
+			log.Printf("LLM unavailable for %s: %v (data preserved)", hostname, llmErr)
 			stored.Status = "llm_unavailable"
 		} else {
-			log.Printf("LLM error for %s: %v", delta.Hostname, llmErr)
+			log.Printf("LLM error for %s: %v", hostname, llmErr)
 			stored.Status = "error"
 		}
 	} else if result != nil {
 		stored.Status = result.Status
 		stored.Issues = result.Issues
+		if err := db.suppress(stored); err != nil {
+			return nil, err
+		}
+		if err := db.silence(stored); err != nil {
+			return nil, err
+		}
 	} else {
 		stored.Status = "error"
 	}
 
-	if err := h.db.InsertResult(stored); err != nil {
-		log.Printf("DB error: %v", err)
-		http.Error(w, "Internal error", http.StatusInternalServerError)
-		return
+	if err := db.InsertResult(stored); err != nil {
+		return nil, err
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":     stored.Status,
-		"latency_ms": meta.LatencyMs,
-	})
+	return stored, nil
 }
@@ -217,3 +217,63 @@ func TestIngestHandlerRejectsSkewedTimestamp(t *testing.T) {
 		t.Errorf("Stored timestamp = %v, expected fallback to ~now", results[0].Timestamp)
 	}
 }
+
+func TestIngestHandlerRendersRecordLevels(t *testing.T) {
+	// Structured records must reach the LLM with their facility.level
+	// prefix, otherwise a KERN_DEBUG line reads the same as KERN_EMERG.
+	dir := t.TempDir()
+	db, _ := NewDB(filepath.Join(dir, "test.db"))
+	defer db.Close()
+
+	var prompt string
+	mockLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"content": `{"status": "ok", "issues": []}`}},
+			},
+		})
+	}))
+	defer mockLLM.Close()
+
+	llmClient := NewLLMClient([]Endpoint{{URL: mockLLM.URL, Model: "test", APIKey: "key"}}, 0)
+	handler := NewIngestHandler(db, llmClient, "secret", 1<<20)
+
+	delta := protocol.DmesgDelta{
+		Hostname: "rec-host",
+		Source:   "kmsg",
+		Records: []protocol.Record{{
+			Timestamp: time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC),
+			Level:     protocol.LevelErr,
+			Subsystem: "pci",
+			Device:    "+pci:0000:00:1c.0",
+			Message:   "AER: Uncorrected (Fatal) error received",
+		}},
+	}
+	body, _ := json.Marshal(delta)
+	req := httptest.NewRequest("POST", "/ingest", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d. Body: %s", rec.Code, rec.Body.String())
+	}
+	want := "[2026-02-03T12:00:00Z] kern.err (pci +pci:0000:00:1c.0) AER: Uncorrected (Fatal) error received"
+	if prompt != want {
+		t.Errorf("prompt = %q, want %q", prompt, want)
+	}
+	results, _ := db.QueryByHostname("rec-host", 1)
+	if len(results) != 1 || results[0].RawDmesg != want {
+		t.Errorf("stored raw_dmesg = %+v, want %q", results, want)
+	}
+	if len(results) == 1 && results[0].Source != "kmsg" {
+		t.Errorf("stored source = %q, want kmsg", results[0].Source)
+	}
+}
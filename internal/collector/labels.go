@@ -0,0 +1,281 @@
+// internal/collector/labels.go
+package collector
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// labelsSchema holds operator labels and the suppression rules built from
+// them. A label keeps a copy of the result it judges (status, issues and
+// lines), so it outlives retention pruning and can still be exported.
+const labelsSchema = `
+CREATE TABLE IF NOT EXISTS labels (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	result_id INTEGER NOT NULL,
+	issue INTEGER,
+	verdict TEXT NOT NULL,
+	severity TEXT,
+	note TEXT,
+	author TEXT,
+	hostname TEXT NOT NULL,
+	status TEXT NOT NULL,
+	issues TEXT NOT NULL,
+	raw_dmesg TEXT,
+	created_at TEXT DEFAULT (datetime('now'))
+);
+CREATE INDEX IF NOT EXISTS idx_labels_result ON labels(result_id);
+
+CREATE TABLE IF NOT EXISTS suppressions (
+	signature TEXT PRIMARY KEY,
+	example TEXT,
+	false_positives INTEGER NOT NULL,
+	created_at TEXT DEFAULT (datetime('now'))
+);
+`
+
+// ErrInvalidLabel is wrapped by AddLabel's errors for labels that can't be
+// stored: a bad verdict or severity, or a result or issue that doesn't
+// exist.
+var ErrInvalidLabel = errors.New("invalid label")
+
+// labelRow is a label with the copy of the result it was made against.
+type labelRow struct {
+	protocol.Label
+	status    string
+	rawDmesg  string
+	allIssues []protocol.Issue
+}
+
+// targets returns the issues a label judges: the one it names, or all of
+// them.
+func targets(l *protocol.Label, issues []protocol.Issue) []protocol.Issue {
+	if l.Issue == nil {
+		return issues
+	}
+	if *l.Issue < 0 || *l.Issue >= len(issues) {
+		return nil
+	}
+	return issues[*l.Issue : *l.Issue+1]
+}
+
+// AddLabel stores an operator's label. ID, Hostname, Issues and CreatedAt
+// are filled in from the labelled result.
+func (d *sqlStore) AddLabel(l *protocol.Label) error {
+	switch l.Verdict {
+	case protocol.LabelTruePositive, protocol.LabelFalsePositive:
+		if l.Severity != "" {
+			return fmt.Errorf("%w: severity only goes with %s", ErrInvalidLabel, protocol.LabelWrongSeverity)
+		}
+	case protocol.LabelWrongSeverity:
+		if _, ok := statusRank[l.Severity]; !ok {
+			return fmt.Errorf("%w: %s needs a severity of ok, warning or critical", ErrInvalidLabel, l.Verdict)
+		}
+	default:
+		return fmt.Errorf("%w: verdict must be %s, %s or %s", ErrInvalidLabel,
+			protocol.LabelTruePositive, protocol.LabelFalsePositive, protocol.LabelWrongSeverity)
+	}
+
+	r, err := d.QueryResult(l.ResultID)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("%w: no result with id %d", ErrInvalidLabel, l.ResultID)
+	}
+	if l.Issue != nil && (*l.Issue < 0 || *l.Issue >= len(r.Issues)) {
+		return fmt.Errorf("%w: result %d has %d issues, no issue %d", ErrInvalidLabel, r.ID, len(r.Issues), *l.Issue)
+	}
+
+	issuesJSON, err := json.Marshal(r.Issues)
+	if err != nil {
+		return err
+	}
+	var issue sql.NullInt64
+	if l.Issue != nil {
+		issue = sql.NullInt64{Int64: int64(*l.Issue), Valid: true}
+	}
+	l.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	l.ID, err = d.insert(`
+		INSERT INTO labels (result_id, issue, verdict, severity, note, author, hostname, status, issues, raw_dmesg, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, issue, l.Verdict, l.Severity, l.Note, l.Author, r.Hostname, r.Status, string(issuesJSON), r.RawDmesg,
+		l.CreatedAt.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return err
+	}
+	l.Hostname = r.Hostname
+	l.Issues = targets(l, r.Issues)
+	return nil
+}
+
+// QueryLabels returns the most recent labels, newest first.
+func (d *sqlStore) QueryLabels(limit int) ([]protocol.Label, error) {
+	rows, err := d.queryLabelRows(`ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]protocol.Label, len(rows))
+	for i, r := range rows {
+		labels[i] = r.Label
+	}
+	return labels, nil
+}
+
+// labelRows returns every label, oldest first.
+func (d *sqlStore) labelRows() ([]labelRow, error) {
+	return d.queryLabelRows(`ORDER BY id`)
+}
+
+func (d *sqlStore) queryLabelRows(tail string, args ...interface{}) ([]labelRow, error) {
+	rows, err := d.query(`
+		SELECT id, result_id, issue, verdict, severity, note, author, hostname, status, issues, raw_dmesg, created_at
+		FROM labels `+tail, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []labelRow
+	for rows.Next() {
+		var r labelRow
+		var issue sql.NullInt64
+		var severity, note, author, rawDmesg sql.NullString
+		var issuesJSON, createdStr string
+		if err := rows.Scan(&r.ID, &r.ResultID, &issue, &r.Verdict, &severity, &note, &author,
+			&r.Hostname, &r.status, &issuesJSON, &rawDmesg, &createdStr); err != nil {
+			return nil, err
+		}
+		if issue.Valid {
+			n := int(issue.Int64)
+			r.Issue = &n
+		}
+		r.Severity, r.Note, r.Author, r.rawDmesg = severity.String, note.String, author.String, rawDmesg.String
+		if err := json.Unmarshal([]byte(issuesJSON), &r.allIssues); err != nil {
+			log.Printf("labels: failed to unmarshal issues for label id=%d: %v", r.ID, err)
+		}
+		r.Issues = targets(&r.Label, r.allIssues)
+		r.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdStr)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// maxLabelsListed caps GET /api/labels?limit=.
+const maxLabelsListed = 1000
+
+// LabelsHandler serves the operator feedback API: GET and POST
+// /api/labels, and GET /api/suppressions. Reads take the agents' bearer
+// token or the operator's; adding a label takes the operator's.
+type LabelsHandler struct {
+	db          Store
+	apiKey      string
+	operatorKey string
+	feedback    *feedback // refreshed after each new label; may be nil
+}
+
+// NewLabelsHandler creates the feedback API handler. An empty operatorKey
+// disables POST.
+func NewLabelsHandler(db Store, apiKey, operatorKey string) *LabelsHandler {
+	return &LabelsHandler{db: db, apiKey: apiKey, operatorKey: operatorKey}
+}
+
+func (h *LabelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operator := operatorAuthorized(r, h.operatorKey)
+	if !operator && !authorized(r, h.apiKey) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodPost && !operator {
+		http.Error(w, "Adding labels needs the operator API key", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxLabelsListed)
+		}
+		labels, err := h.db.QueryLabels(limit)
+		if err != nil {
+			log.Printf("DB error: %v", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"labels": nonNil(labels)})
+
+	case http.MethodPost:
+		var l protocol.Label
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&l); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := h.db.AddLabel(&l); err != nil {
+			if errors.Is(err, ErrInvalidLabel) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("DB error: %v", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Label %d: result %d (%s) marked %s by %q", l.ID, l.ResultID, l.Hostname, l.Verdict, l.Author)
+		if h.feedback != nil {
+			if err := h.feedback.refresh(); err != nil {
+				log.Printf("Feedback refresh error: %v", err)
+			}
+		}
+		writeJSON(w, http.StatusCreated, l)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ServeSuppressions lists the suppression rules in force.
+func (h *LabelsHandler) ServeSuppressions(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.apiKey) && !operatorAuthorized(r, h.operatorKey) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rules, err := h.db.Suppressions()
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"suppressions": nonNil(rules)})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// nonNil makes an empty list marshal as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -9,15 +9,20 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/signalnine/tasseograph/internal/protocol"
 )
 
-const systemPrompt = `You are a Linux kernel expert reviewing dmesg output from bare metal servers. Flag messages indicating:
+// analysisGuidance is what to look for; systemPrompt and batchSystemPrompt
+// append the response format for one host or several.
+const analysisGuidance = `You are a Linux kernel expert reviewing dmesg output from bare metal servers. Flag messages indicating:
 
 - Memory errors (MCE, EDAC, ECC corrections trending up)
 - Storage degradation (NVMe controller warnings, SMART predictive, I/O errors)
@@ -27,31 +32,111 @@ const systemPrompt = `You are a Linux kernel expert reviewing dmesg output from
 
 Ignore routine noise: ACPI info, systemd lifecycle, USB enumeration, normal driver init.
 
+Lines may carry a syslog facility.level prefix after the timestamp (e.g. "kern.err", "kern.debug"). Weigh the kernel's own severity: emerg/alert/crit/err lines deserve scrutiny, while info/debug lines are rarely actionable on their own unless they repeat or corroborate a more severe line. Lines tagged (ras:mc ...), (ras:aer ...) or (ras:mce ...) are events already decoded by rasdaemon, with the DIMM location or PCIe device named for you. Lines tagged (ipmi:sel ...) come from the BMC's System Event Log and name the sensor that fired; they are independent of the host OS and still count when the kernel logged nothing.
+
+Lines starting with "[hw]" are not log messages: they report hardware error counters read from sysfs (EDAC corrected/uncorrected memory errors per DIMM, PCIe AER totals per device) that increased since the previous poll, with the current and previous hourly rate. Any uncorrected (ue/fatal/nonfatal) increase is serious; corrected counts that are TRENDING UP indicate degradation.
+
+Lines starting with "[smart]" report drive health from NVMe/ATA SMART logs: critical warning bits, spare capacity below threshold, endurance milestones, and media error or reallocated/pending sector counts that grew since the previous snapshot. A FAILING attribute, a critical warning, or read-only media is critical.
+`
+
+const systemPrompt = analysisGuidance + `
 Respond with JSON only:
-{"status": "ok" | "warning" | "critical", "issues": [{"summary": "brief description", "evidence": "relevant log snippet"}]}
+{"status": "ok" | "warning" | "critical", "confidence": 0.0-1.0, "issues": [{"summary": "brief description", "evidence": "relevant log snippet", "category": "memory" | "storage" | "network" | "thermal" | "driver" | "other"}]}
+
+confidence is how sure you are of the status. evidence must be copied verbatim from the input.
 
 If nothing notable, return {"status": "ok", "issues": []}`
 
+const batchSystemPrompt = analysisGuidance + `
+The input covers several hosts. Each host's lines appear between "=== host: NAME ===" and "=== end: NAME ===". Judge every host on its own lines only; never attribute one host's messages to another.
+
+Respond with JSON only, with exactly one entry per host:
+{"hosts": [{"hostname": "NAME", "status": "ok" | "warning" | "critical", "confidence": 0.0-1.0, "issues": [{"summary": "brief description", "evidence": "relevant log snippet", "category": "memory" | "storage" | "network" | "thermal" | "driver" | "other"}]}]}
+
+A host with nothing notable gets {"hostname": "NAME", "status": "ok", "issues": []}`
+
 // ErrLLMUnavailable indicates all LLM endpoints are down
 var ErrLLMUnavailable = errors.New("all LLM endpoints unavailable")
 
 // maxLLMResponseBytes caps the size of an LLM response body so a misbehaving
 // or compromised endpoint cannot exhaust collector memory. Real responses are
-// bounded by max_tokens=1024 in the request and run well under 100KB.
+// bounded by the endpoint's max_tokens and run well under 100KB.
 const maxLLMResponseBytes = 1 << 20 // 1 MiB
 
+// Token budgets for endpoints that don't configure their own.
+const (
+	defaultContextTokens   = 32000
+	defaultMaxOutputTokens = 1024
+	// chunkHeaderTokens covers the "(part N of M ...)" note on a chunk.
+	chunkHeaderTokens = 32
+)
+
 // Endpoint represents a single LLM provider
 type Endpoint struct {
 	URL    string
 	Model  string
 	APIKey string
+
+	// ContextTokens is the model's context window and MaxOutputTokens the
+	// reply budget sent as max_tokens; whatever the system prompt leaves
+	// of the difference is the input budget. Zero means the default.
+	ContextTokens   int
+	MaxOutputTokens int
+
+	// Timeout bounds each request attempt; zero means defaultLLMTimeout.
+	// MaxConcurrent caps requests in flight to the endpoint (zero is
+	// unlimited); further calls queue. JSONFormat asks the server to
+	// constrain its output to JSON, and Grammar, if set, is passed to a
+	// llama.cpp server to constrain it further. Local marks a local-profile
+	// server, which is also sent Ollama's native JSON flag; hosted APIs
+	// reject arguments they don't know.
+	Timeout       time.Duration
+	MaxConcurrent int
+	JSONFormat    bool
+	Grammar       string
+	Local         bool
+}
+
+// defaultLLMTimeout is a hosted endpoint's per-attempt timeout.
+const defaultLLMTimeout = 60 * time.Second
+
+func (ep Endpoint) timeout() time.Duration {
+	if ep.Timeout > 0 {
+		return ep.Timeout
+	}
+	return defaultLLMTimeout
+}
+
+func (ep Endpoint) outputTokens() int {
+	if ep.MaxOutputTokens > 0 {
+		return ep.MaxOutputTokens
+	}
+	return defaultMaxOutputTokens
+}
+
+// inputBudget is how many estimated tokens of log lines fit alongside
+// system in one request.
+func (ep Endpoint) inputBudget(system string) int {
+	window := ep.ContextTokens
+	if window <= 0 {
+		window = defaultContextTokens
+	}
+	return max(window-ep.outputTokens()-estimateTokens([]string{system})-chunkHeaderTokens, 1)
 }
 
 // LLMClient calls LLM inference APIs with fallback support (OpenAI-compatible format)
 type LLMClient struct {
 	endpoints  []Endpoint
+	breakers   []*breaker      // one per endpoint
+	slots      []chan struct{} // per endpoint; nil when unlimited
+	fallback   map[ErrorClass]bool
+	voters     int    // consensus check endpoints; 0 disables
+	strategy   string // consensus strategy
 	maxRetries int
 	client     *http.Client
+
+	mu        sync.RWMutex
+	negatives string // system prompt section of labelled false positives
 }
 
 // NewLLMClient creates a new LLM client with fallback chain.
@@ -62,11 +147,23 @@ func NewLLMClient(endpoints []Endpoint, maxRetries int) *LLMClient {
 	if maxRetries < 0 {
 		maxRetries = 0
 	}
+	breakers := make([]*breaker, len(endpoints))
+	slots := make([]chan struct{}, len(endpoints))
+	for i, ep := range endpoints {
+		breakers[i] = newBreaker(fmt.Sprintf("endpoint %d (%s)", i+1, ep.Model), defaultBreakerThreshold, defaultBreakerCooldown)
+		if ep.MaxConcurrent > 0 {
+			slots[i] = make(chan struct{}, ep.MaxConcurrent)
+		}
+	}
 	return &LLMClient{
 		endpoints:  endpoints,
+		breakers:   breakers,
+		slots:      slots,
+		fallback:   maps.Clone(defaultFallback),
 		maxRetries: maxRetries,
+		// Each attempt is bounded by its endpoint's timeout instead of a
+		// client-wide one, so a local model can take minutes.
 		client: &http.Client{
-			Timeout: 60 * time.Second,
 			Transport: &http.Transport{
 				DialContext: (&net.Dialer{
 					Timeout: 5 * time.Second,
@@ -76,6 +173,39 @@ func NewLLMClient(endpoints []Endpoint, maxRetries int) *LLMClient {
 	}
 }
 
+// configureBreakers overrides the default circuit breaker settings.
+func (c *LLMClient) configureBreakers(threshold int, cooldown time.Duration) {
+	for _, b := range c.breakers {
+		b.threshold = threshold
+		b.cooldown = cooldown
+	}
+}
+
+// configureFallback overrides whether the chain moves on to the next
+// endpoint after an error of each given class.
+func (c *LLMClient) configureFallback(policy map[ErrorClass]bool) {
+	for class, fallback := range policy {
+		c.fallback[class] = fallback
+	}
+}
+
+// setNegatives replaces the false positives shown to the model as examples
+// of noise.
+func (c *LLMClient) setNegatives(issues []protocol.Issue) {
+	section := negativesPrompt(issues)
+	c.mu.Lock()
+	c.negatives = section
+	c.mu.Unlock()
+}
+
+// prompt returns the system prompt base followed by any false-positive
+// examples.
+func (c *LLMClient) prompt(base string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return base + c.negatives
+}
+
 // AnalysisMeta is per-call metadata returned alongside the parsed result.
 // Provider/Model come from the upstream's response body when available
 // (OpenRouter returns both); empty strings for endpoints that don't.
@@ -83,37 +213,266 @@ type AnalysisMeta struct {
 	LatencyMs int64
 	Provider  string
 	Model     string
+	Verdicts  []protocol.Verdict // set when a consensus check ran
+
+	// Tokens spent, from the response's usage where the endpoint reports
+	// it and estimated otherwise. Failed attempts count too.
+	PromptTokens     int
+	CompletionTokens int
+
+	endpoint int // index of the endpoint that answered
+}
+
+// add accumulates another call's latency and tokens into m.
+func (m *AnalysisMeta) add(o AnalysisMeta) {
+	m.LatencyMs += o.LatencyMs
+	m.PromptTokens += o.PromptTokens
+	m.CompletionTokens += o.CompletionTokens
 }
 
 // Analyze sends dmesg lines to the LLM and returns the analysis.
 // Tries each endpoint in order; returns ErrLLMUnavailable only if ALL fail.
+//
+// Lines that don't fit the endpoint's input budget are split into chunks
+// that are analyzed separately and merged (see mergeResults). Chunking is
+// per endpoint, so falling back to a smaller model re-splits the lines.
 func (c *LLMClient) Analyze(ctx context.Context, lines []string) (*protocol.AnalysisResult, AnalysisMeta, error) {
-	if len(c.endpoints) == 0 {
-		return nil, AnalysisMeta{}, errors.New("no LLM endpoints configured")
+	var result *protocol.AnalysisResult
+	meta, err := c.complete(ctx, func(i int, ep Endpoint) (AnalysisMeta, error) {
+		var meta AnalysisMeta
+		var err error
+		result, meta, err = c.analyzeOn(ctx, i, ep, lines)
+		return meta, err
+	})
+	if err != nil {
+		return nil, meta, err
 	}
+	result, meta = c.reconsider(ctx, lines, result, meta)
+	return result, meta, nil
+}
 
-	var lastErr error
+// analyzeOn analyzes lines on endpoint i alone, in chunks if they don't fit
+// its budget.
+func (c *LLMClient) analyzeOn(ctx context.Context, i int, ep Endpoint, lines []string) (*protocol.AnalysisResult, AnalysisMeta, error) {
+	system := c.prompt(systemPrompt)
+	chunks := chunkLines(lines, ep.inputBudget(system))
+	if len(chunks) > 1 {
+		log.Printf("LLM endpoint %d (%s): %d lines over input budget, analyzing in %d chunks", i+1, ep.Model, len(lines), len(chunks))
+	}
+	var parts []protocol.AnalysisResult
 	var meta AnalysisMeta
+	for n, chunk := range chunks {
+		user := strings.Join(chunk, "\n")
+		if len(chunks) > 1 {
+			user = fmt.Sprintf("(part %d of %d of this host's log; the other parts are reviewed separately)\n", n+1, len(chunks)) + user
+		}
+		var part protocol.AnalysisResult
+		chunkMeta, err := c.request(ctx, i, ep, system, user, func(content string) error {
+			if err := json.Unmarshal([]byte(content), &part); err != nil {
+				return err
+			}
+			return validateResult(&part)
+		})
+		meta.add(chunkMeta)
+		meta.Provider, meta.Model = chunkMeta.Provider, chunkMeta.Model
+		if err != nil {
+			return nil, meta, err
+		}
+		parts = append(parts, part)
+	}
+	return mergeResults(parts), meta, nil
+}
 
-	for i, ep := range c.endpoints {
-		var (
-			result      *protocol.AnalysisResult
-			attemptMeta AnalysisMeta
-			err         error
-		)
-		// One initial attempt plus up to maxRetries retries against this
-		// endpoint, but only retry on transient (availability) errors.
-		for attempt := 0; attempt <= c.maxRetries; attempt++ {
-			result, attemptMeta, err = c.tryEndpoint(ctx, ep, lines)
-			meta.LatencyMs += attemptMeta.LatencyMs
-
-			if err == nil || !isUnavailableErr(err) {
-				break
+// chunkLines splits lines into runs whose estimated tokens fit budget,
+// keeping order. A single line over budget is cut to fit rather than sent
+// whole to an endpoint that will reject it.
+func chunkLines(lines []string, budget int) [][]string {
+	var chunks [][]string
+	var cur []string
+	tokens := 0
+	for _, line := range lines {
+		n := estimateTokens([]string{line})
+		if n > budget {
+			line = truncateLine(line, (budget-1)*4)
+			n = estimateTokens([]string{line})
+		}
+		if len(cur) > 0 && tokens+n > budget {
+			chunks = append(chunks, cur)
+			cur, tokens = nil, 0
+		}
+		cur = append(cur, line)
+		tokens += n
+	}
+	if len(cur) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// truncatedMarker ends a line cut to fit the prompt, so the model doesn't
+// take the cut for where the kernel stopped.
+const truncatedMarker = " [truncated]"
+
+// truncateLine cuts line to at most limit bytes, marker included, on a
+// rune boundary so no UTF-8 sequence is split.
+func truncateLine(line string, limit int) string {
+	marker := truncatedMarker
+	if limit <= len(marker) {
+		marker = ""
+	}
+	cut := max(limit-len(marker), 0)
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + marker
+}
+
+// validateResult checks a parsed reply is a usable analysis.
+func validateResult(r *protocol.AnalysisResult) error {
+	if _, ok := statusRank[r.Status]; !ok {
+		return &LLMError{Class: ClassValidation, Err: fmt.Errorf("unknown status %q", r.Status)}
+	}
+	for _, issue := range r.Issues {
+		if strings.TrimSpace(issue.Summary) == "" {
+			return &LLMError{Class: ClassValidation, Err: errors.New("issue without a summary")}
+		}
+	}
+	if r.Issues == nil {
+		r.Issues = []protocol.Issue{}
+	}
+	r.Confidence = min(max(r.Confidence, 0), 1)
+	return nil
+}
+
+// statusRank orders statuses for merging; anything unrecognised ranks
+// below ok so a malformed chunk can't mask a real verdict.
+var statusRank = map[string]int{"ok": 0, "warning": 1, "critical": 2}
+
+// mergeResults reduces per-chunk results to one: the most severe status,
+// the highest confidence given for it, and the union of issues,
+// deduplicated by summary (a repeating fault shows up in every chunk it
+// spans; the first chunk's evidence is kept).
+func mergeResults(parts []protocol.AnalysisResult) *protocol.AnalysisResult {
+	if len(parts) == 1 {
+		return &parts[0]
+	}
+	merged := &protocol.AnalysisResult{Status: parts[0].Status, Confidence: parts[0].Confidence, Issues: []protocol.Issue{}}
+	seen := map[string]bool{}
+	for _, p := range parts {
+		if rank, ok := statusRank[p.Status]; ok {
+			cur, curOK := statusRank[merged.Status]
+			switch {
+			case !curOK || rank > cur:
+				merged.Status, merged.Confidence = p.Status, p.Confidence
+			case rank == cur:
+				merged.Confidence = max(merged.Confidence, p.Confidence)
 			}
-			if attempt < c.maxRetries {
-				log.Printf("LLM endpoint %d (%s) attempt %d failed: %v, retrying...", i+1, ep.Model, attempt+1, err)
+		}
+		for _, issue := range p.Issues {
+			key := strings.ToLower(strings.Join(strings.Fields(issue.Summary), " "))
+			if seen[key] {
+				continue
 			}
+			seen[key] = true
+			merged.Issues = append(merged.Issues, issue)
+		}
+	}
+	return merged
+}
+
+// HostLines is one host's share of a batched analysis.
+type HostLines struct {
+	Hostname string
+	Lines    []string
+}
+
+// AnalyzeBatch analyzes several hosts in one call, returning results keyed
+// by hostname. A host the model left out of its answer is simply missing
+// from the map; the caller decides whether to retry it alone. Hostnames
+// must be unique within a batch.
+func (c *LLMClient) AnalyzeBatch(ctx context.Context, hosts []HostLines) (map[string]*protocol.AnalysisResult, AnalysisMeta, error) {
+	var sb strings.Builder
+	for _, h := range hosts {
+		fmt.Fprintf(&sb, "=== host: %s ===\n", h.Hostname)
+		for _, line := range h.Lines {
+			sb.WriteString(line)
+			sb.WriteByte('\n')
+		}
+		fmt.Fprintf(&sb, "=== end: %s ===\n", h.Hostname)
+	}
+
+	var resp struct {
+		Hosts []struct {
+			Hostname string `json:"hostname"`
+			protocol.AnalysisResult
+		} `json:"hosts"`
+	}
+	system := c.prompt(batchSystemPrompt)
+	meta, err := c.complete(ctx, func(i int, ep Endpoint) (AnalysisMeta, error) {
+		resp.Hosts = nil
+		return c.request(ctx, i, ep, system, sb.String(), func(content string) error {
+			return json.Unmarshal([]byte(content), &resp)
+		})
+	})
+	if err != nil {
+		return nil, meta, err
+	}
+
+	want := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		want[h.Hostname] = true
+	}
+	results := make(map[string]*protocol.AnalysisResult, len(hosts))
+	for i := range resp.Hosts {
+		r := &resp.Hosts[i]
+		// Ignore hosts we didn't ask about and, if the model repeats a
+		// host, keep its first answer. An invalid entry counts as missing.
+		if want[r.Hostname] && results[r.Hostname] == nil && validateResult(&r.AnalysisResult) == nil {
+			results[r.Hostname] = &r.AnalysisResult
 		}
+	}
+	return results, meta, nil
+}
+
+// estimateTokens approximates the prompt tokens lines will cost. Log text
+// averages a little under four bytes per token across the tokenizers we
+// use; each line adds one more for its newline.
+func estimateTokens(lines []string) int {
+	n := 0
+	for _, line := range lines {
+		n += len(line)/4 + 1
+	}
+	return n
+}
+
+// batchBudget is the largest batch prompt every endpoint in the chain can
+// take, so a batch never has to be re-split on fallback.
+func (c *LLMClient) batchBudget() int {
+	budget := 0
+	for i, ep := range c.endpoints {
+		if b := ep.inputBudget(c.prompt(batchSystemPrompt)); i == 0 || b < budget {
+			budget = b
+		}
+	}
+	return budget
+}
+
+// complete runs call against each endpoint in turn until one succeeds.
+// call makes its requests with c.request. Whether a failure moves on to the
+// next endpoint depends on its class and the fallback policy. When every
+// endpoint has failed, the error wraps both ErrLLMUnavailable and the last
+// endpoint's error.
+func (c *LLMClient) complete(ctx context.Context, call func(i int, ep Endpoint) (AnalysisMeta, error)) (AnalysisMeta, error) {
+	if len(c.endpoints) == 0 {
+		return AnalysisMeta{}, errors.New("no LLM endpoints configured")
+	}
+
+	var lastErr error
+	var meta AnalysisMeta
+
+	for i, ep := range c.endpoints {
+		attemptMeta, err := call(i, ep)
+		meta.add(attemptMeta)
 
 		if err == nil {
 			if i > 0 {
@@ -124,77 +483,153 @@ func (c *LLMClient) Analyze(ctx context.Context, lines []string) (*protocol.Anal
 			// any failed primary attempts.
 			meta.Provider = attemptMeta.Provider
 			meta.Model = attemptMeta.Model
-			return result, meta, nil
+			meta.endpoint = i
+			return meta, nil
 		}
 
 		lastErr = err
-		if isUnavailableErr(err) {
-			log.Printf("LLM endpoint %d (%s) unavailable after %d attempts: %v, trying next...", i+1, ep.Model, c.maxRetries+1, err)
+		class := ErrorClassOf(err)
+		if class == ClassCircuitOpen {
+			log.Printf("LLM endpoint %d (%s) circuit open, trying next...", i+1, ep.Model)
+			continue
+		}
+		if c.fallback[class] {
+			log.Printf("LLM endpoint %d (%s) failed: %v, trying next...", i+1, ep.Model, err)
 			continue
 		}
 
-		// Non-availability error (e.g., parse error) - don't try fallback
-		return nil, meta, err
+		// The policy says another endpoint won't do better (e.g. the model
+		// answered with something unusable).
+		return meta, err
 	}
 
 	// All endpoints failed
-	return nil, meta, fmt.Errorf("%w: %v", ErrLLMUnavailable, lastErr)
+	return meta, fmt.Errorf("%w: %w", ErrLLMUnavailable, lastErr)
 }
 
-func (c *LLMClient) tryEndpoint(ctx context.Context, ep Endpoint, lines []string) (*protocol.AnalysisResult, AnalysisMeta, error) {
+// request sends one system/user exchange to ep, handing the reply (code
+// fences stripped) to parse. It makes one initial attempt plus up to
+// maxRetries retries, but only retries transient errors, backing off
+// between them. Every attempt first asks the endpoint's circuit breaker,
+// so a dead endpoint is skipped rather than retried.
+func (c *LLMClient) request(ctx context.Context, i int, ep Endpoint, system, user string, parse func(content string) error) (AnalysisMeta, error) {
+	br := c.breakers[i]
+	var meta AnalysisMeta
+	var err error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if !br.allow(time.Now()) {
+			if attempt == 0 {
+				err = &LLMError{Class: ClassCircuitOpen, Err: errCircuitOpen}
+			}
+			break
+		}
+
+		var attemptMeta AnalysisMeta
+		attemptMeta, err = c.tryEndpoint(ctx, i, ep, system, user, parse)
+		meta.add(attemptMeta)
+		meta.Provider, meta.Model = attemptMeta.Provider, attemptMeta.Model
+
+		var le *LLMError
+		if err == nil || !errors.As(err, &le) || !le.Class.transient() {
+			// It answered, even if with something unusable.
+			br.success()
+			break
+		}
+		br.failure(time.Now(), le.RetryAfter)
+		if attempt == c.maxRetries || le.RetryAfter > maxRetryAfter {
+			break
+		}
+
+		delay := retryDelay(attempt, le.RetryAfter)
+		log.Printf("LLM endpoint %d (%s) attempt %d failed: %v, retrying in %s...", i+1, ep.Model, attempt+1, err, delay.Round(time.Millisecond))
+		br.countRetry()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return meta, err
+		}
+	}
+	return meta, err
+}
+
+func (c *LLMClient) tryEndpoint(ctx context.Context, i int, ep Endpoint, system, user string, parse func(content string) error) (AnalysisMeta, error) {
 	start := time.Now()
 
+	// Wait for a slot on an endpoint with a concurrency limit. The wait
+	// counts towards latency but not towards the endpoint's timeout.
+	if slot := c.slots[i]; slot != nil {
+		select {
+		case slot <- struct{}{}:
+			defer func() { <-slot }()
+		case <-ctx.Done():
+			return AnalysisMeta{LatencyMs: time.Since(start).Milliseconds()}, &LLMError{Class: ClassTransport, Err: ctx.Err()}
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, ep.timeout())
+	defer cancel()
+
 	// Build request body (OpenAI Chat Completions format)
 	reqBody := map[string]interface{}{
 		"model": ep.Model,
 		"messages": []map[string]string{
-			{"role": "system", "content": systemPrompt},
-			{"role": "user", "content": strings.Join(lines, "\n")},
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
 		},
-		"max_tokens": 1024,
+		"max_tokens": ep.outputTokens(),
+	}
+	if ep.JSONFormat {
+		// OpenAI, llama.cpp and vLLM read response_format; Ollama's
+		// OpenAI-compatible route does too, but older releases only
+		// honour its native "format", which OpenAI answers with a 400.
+		reqBody["response_format"] = map[string]string{"type": "json_object"}
+		if ep.Local {
+			reqBody["format"] = "json"
+		}
+	}
+	if ep.Grammar != "" {
+		reqBody["grammar"] = ep.Grammar
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, AnalysisMeta{}, err
+		return AnalysisMeta{}, err
 	}
 
 	url := strings.TrimSuffix(ep.URL, "/") + "/chat/completions"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
 	if err != nil {
-		return nil, AnalysisMeta{}, err
+		return AnalysisMeta{}, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+ep.APIKey)
+	if ep.APIKey != "" {
+		// Local servers run without a key, and some reject a bare "Bearer".
+		req.Header.Set("Authorization", "Bearer "+ep.APIKey)
+	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
+		// Everything the transport can fail with (refused, reset, DNS,
+		// TLS, timeout) means we never got an answer.
 		meta := AnalysisMeta{LatencyMs: time.Since(start).Milliseconds()}
-		var netErr net.Error
-		if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
-			return nil, meta, fmt.Errorf("connection failed: %w", err)
-		}
-		return nil, meta, err
+		return meta, &LLMError{Class: ClassTransport, Err: err}
 	}
 	defer resp.Body.Close()
 
 	meta := AnalysisMeta{LatencyMs: time.Since(start).Milliseconds()}
-
-	// Transient errors - try next endpoint
-	if resp.StatusCode == http.StatusRequestTimeout ||
-		resp.StatusCode == http.StatusTooManyRequests ||
-		resp.StatusCode == http.StatusBadGateway ||
-		resp.StatusCode == http.StatusServiceUnavailable ||
-		resp.StatusCode == http.StatusGatewayTimeout {
-		return nil, meta, fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
 	limitedBody := io.LimitReader(resp.Body, maxLLMResponseBytes)
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(limitedBody)
-		return nil, meta, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(io.LimitReader(limitedBody, 512))
+		le := &LLMError{
+			Class:      classifyStatus(resp.StatusCode),
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("%s", strings.TrimSpace(string(body))),
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			le.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return meta, le
 	}
 
 	// Parse the OpenAI-compatible envelope plus the optional model/provider
@@ -207,26 +642,41 @@ func (c *LLMClient) tryEndpoint(ctx context.Context, ep Endpoint, lines []string
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
 	}
 	if err := json.NewDecoder(limitedBody).Decode(&apiResp); err != nil {
-		return nil, meta, err
+		return meta, &LLMError{Class: ClassParse, Err: fmt.Errorf("decode response envelope: %w", err)}
 	}
 	meta.Model = apiResp.Model
 	meta.Provider = apiResp.Provider
+	meta.PromptTokens = apiResp.Usage.PromptTokens
+	if meta.PromptTokens == 0 {
+		meta.PromptTokens = estimateTokens([]string{system, user})
+	}
+	meta.CompletionTokens = apiResp.Usage.CompletionTokens
+	if meta.CompletionTokens == 0 && len(apiResp.Choices) > 0 {
+		meta.CompletionTokens = estimateTokens([]string{apiResp.Choices[0].Message.Content})
+	}
 
 	if len(apiResp.Choices) == 0 {
-		return nil, meta, fmt.Errorf("empty response from API")
+		return meta, &LLMError{Class: ClassParse, Err: errors.New("empty response from API")}
 	}
 
 	// Parse the JSON from the message content. Some models wrap structured
 	// output in markdown code fences despite prompts that say "JSON only".
-	content := stripCodeFence(apiResp.Choices[0].Message.Content)
-	var result protocol.AnalysisResult
-	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		return nil, meta, fmt.Errorf("failed to parse LLM response: %w", err)
+	content := stripCodeFence(stripThinking(apiResp.Choices[0].Message.Content))
+	if err := parse(content); err != nil {
+		var le *LLMError
+		if errors.As(err, &le) {
+			return meta, err
+		}
+		return meta, &LLMError{Class: ClassParse, Err: fmt.Errorf("failed to parse LLM response: %w", err)}
 	}
 
-	return &result, meta, nil
+	return meta, nil
 }
 
 // stripCodeFence removes a leading ``` (optionally followed by a language tag
@@ -246,18 +696,17 @@ func stripCodeFence(s string) string {
 	return strings.TrimSpace(s)
 }
 
-// isUnavailableErr checks if an error indicates a transient availability issue
-func isUnavailableErr(err error) bool {
-	if err == nil {
-		return false
-	}
-	s := err.Error()
-	return strings.Contains(s, "connection") ||
-		strings.Contains(s, "HTTP 408") ||
-		strings.Contains(s, "HTTP 429") ||
-		strings.Contains(s, "HTTP 502") ||
-		strings.Contains(s, "HTTP 503") ||
-		strings.Contains(s, "HTTP 504")
+// stripThinking drops the <think>...</think> block reasoning models served
+// locally (DeepSeek-R1, Qwen3) put before their answer.
+func stripThinking(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "<think>") {
+		return s
+	}
+	if end := strings.Index(s, "</think>"); end >= 0 {
+		return s[end+len("</think>"):]
+	}
+	return s
 }
 
 // IsUnavailable checks if the error indicates all LLM endpoints are down
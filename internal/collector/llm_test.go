@@ -4,9 +4,17 @@ package collector
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/signalnine/tasseograph/internal/protocol"
 )
@@ -381,3 +389,216 @@ func TestLLMClientAllUnavailable(t *testing.T) {
 		t.Errorf("Expected ErrLLMUnavailable, got: %v", err)
 	}
 }
+
+func TestChunkLines(t *testing.T) {
+	lines := []string{strings.Repeat("a", 36), strings.Repeat("b", 36), strings.Repeat("c", 36), strings.Repeat("d", 200)}
+	// 10 tokens per short line; the long one is cut to the budget.
+	chunks := chunkLines(lines, 20)
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %d, want 3: %q", len(chunks), chunks)
+	}
+	if len(chunks[0]) != 2 || len(chunks[1]) != 1 || len(chunks[2]) != 1 {
+		t.Errorf("chunk sizes = %d/%d/%d, want 2/1/1", len(chunks[0]), len(chunks[1]), len(chunks[2]))
+	}
+	if n := estimateTokens(chunks[2]); n > 20 {
+		t.Errorf("oversized line still %d tokens", n)
+	}
+	if !strings.HasSuffix(chunks[2][0], truncatedMarker) {
+		t.Errorf("cut line %q isn't marked truncated", chunks[2][0])
+	}
+
+	// A cut never splits a multi-byte rune.
+	chunks = chunkLines([]string{"a" + strings.Repeat("é", 100)}, 20)
+	if line := chunks[0][0]; !utf8.ValidString(line) || !strings.HasSuffix(line, truncatedMarker) {
+		t.Errorf("cut line = %q, want valid UTF-8 ending %q", line, truncatedMarker)
+	}
+
+	if chunks := chunkLines(nil, 20); len(chunks) != 1 {
+		t.Errorf("empty input gave %d chunks, want 1", len(chunks))
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	merged := mergeResults([]protocol.AnalysisResult{
+		{Status: "warning", Issues: []protocol.Issue{{Summary: "NVMe timeouts", Evidence: "first"}}},
+		{Status: "bogus"},
+		{Status: "critical", Issues: []protocol.Issue{{Summary: "nvme  TIMEOUTS", Evidence: "second"}, {Summary: "MCE", Evidence: "mce"}}},
+		{Status: "ok", Issues: []protocol.Issue{}},
+	})
+	if merged.Status != "critical" {
+		t.Errorf("status = %q, want critical", merged.Status)
+	}
+	want := []protocol.Issue{{Summary: "NVMe timeouts", Evidence: "first"}, {Summary: "MCE", Evidence: "mce"}}
+	if len(merged.Issues) != len(want) || merged.Issues[0] != want[0] || merged.Issues[1] != want[1] {
+		t.Errorf("issues = %+v, want %+v", merged.Issues, want)
+	}
+}
+
+func TestLLMClientChunksOverBudget(t *testing.T) {
+	var calls int32
+	var maxTokens []float64
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MaxTokens float64 `json:"max_tokens"`
+			Messages  []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		n := atomic.AddInt32(&calls, 1)
+		mu.Lock()
+		maxTokens = append(maxTokens, req.MaxTokens)
+		mu.Unlock()
+
+		content := `{"status": "ok", "issues": []}`
+		if n == 2 {
+			if !strings.HasPrefix(req.Messages[1].Content, "(part 2 of ") {
+				t.Errorf("chunk prompt = %.40q, want part header", req.Messages[1].Content)
+			}
+			content = `{"status": "warning", "issues": [{"summary": "link flapping", "evidence": "eth0"}]}`
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer server.Close()
+
+	// Leave room for roughly 400 tokens of lines after the system prompt.
+	ep := Endpoint{URL: server.URL, Model: "small", APIKey: "k", MaxOutputTokens: 256}
+	ep.ContextTokens = 256 + estimateTokens([]string{systemPrompt}) + chunkHeaderTokens + 400
+	client := NewLLMClient([]Endpoint{ep}, 0)
+
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, fmt.Sprintf("[%d] e1000e eth0: NIC Link is Down %s", i, strings.Repeat(".", 20)))
+	}
+	result, _, err := client.Analyze(context.Background(), lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls < 2 {
+		t.Fatalf("calls = %d, want the delta split", calls)
+	}
+	if result.Status != "warning" || len(result.Issues) != 1 {
+		t.Errorf("merged = %+v, want the warning chunk's issue", result)
+	}
+	for _, mt := range maxTokens {
+		if mt != 256 {
+			t.Errorf("max_tokens = %v, want 256", mt)
+		}
+	}
+}
+
+func TestLLMClientErrorClasses(t *testing.T) {
+	reply := func(content string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+			})
+		}
+	}
+	status := func(code int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(code) }
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    ErrorClass
+	}{
+		{"unauthorized", status(401), ClassAuth},
+		{"forbidden", status(403), ClassAuth},
+		{"bad request", status(400), ClassBadRequest},
+		{"rate limited", status(429), ClassRateLimited},
+		{"internal error", status(500), ClassServer},
+		{"gateway timeout", status(504), ClassServer},
+		{"not json", reply("I'm sorry, I cannot help."), ClassParse},
+		{"unknown status", reply(`{"status":"fine","issues":[]}`), ClassValidation},
+		{"issue without summary", reply(`{"status":"warning","issues":[{"summary":" ","evidence":"x"}]}`), ClassValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			client := NewLLMClient([]Endpoint{{URL: server.URL, Model: "m", APIKey: "k"}}, 0)
+			_, _, err := client.Analyze(context.Background(), []string{"line"})
+			if got := ErrorClassOf(err); got != tt.want {
+				t.Errorf("class = %q, want %q (err: %v)", got, tt.want, err)
+			}
+		})
+	}
+
+	client := NewLLMClient([]Endpoint{{URL: "http://127.0.0.1:59998", Model: "m", APIKey: "k"}}, 0)
+	_, _, err := client.Analyze(context.Background(), []string{"line"})
+	if got := ErrorClassOf(err); got != ClassTransport {
+		t.Errorf("refused connection: class = %q, want transport (err: %v)", got, err)
+	}
+}
+
+func TestLLMClientFallbackPolicy(t *testing.T) {
+	var primaryCalls, secondaryCalls atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryCalls.Add(1)
+		w.Write([]byte(`{"choices":[{"message":{"content":"{\"status\":\"ok\",\"issues\":[]}"}}]}`))
+	}))
+	defer secondary.Close()
+	endpoints := []Endpoint{
+		{URL: primary.URL, Model: "primary", APIKey: "k"},
+		{URL: secondary.URL, Model: "secondary", APIKey: "k"},
+	}
+
+	// Auth failures fall back by default, and aren't retried.
+	client := NewLLMClient(endpoints, 3)
+	result, _, err := client.Analyze(context.Background(), []string{"line"})
+	if err != nil || result.Status != "ok" {
+		t.Fatalf("default policy: result=%v err=%v, want fallback to secondary", result, err)
+	}
+	if primaryCalls.Load() != 1 {
+		t.Errorf("primary calls = %d, want 1 (auth errors aren't retried)", primaryCalls.Load())
+	}
+
+	// Turned off, the 401 is returned as is.
+	client = NewLLMClient(endpoints, 3)
+	client.configureFallback(map[ErrorClass]bool{ClassAuth: false})
+	_, _, err = client.Analyze(context.Background(), []string{"line"})
+	var le *LLMError
+	if !errors.As(err, &le) || le.Class != ClassAuth || le.StatusCode != 401 {
+		t.Fatalf("err = %v, want auth LLMError with status 401", err)
+	}
+	if IsUnavailable(err) {
+		t.Error("a policy stop shouldn't be reported as unavailable")
+	}
+	if secondaryCalls.Load() != 1 {
+		t.Errorf("secondary calls = %d, want 1 (only the default-policy run)", secondaryCalls.Load())
+	}
+}
+
+func TestStoreResultRecordsErrorClass(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	llmErr := fmt.Errorf("%w: %w", ErrLLMUnavailable, &LLMError{Class: ClassRateLimited, StatusCode: 429, Err: errors.New("slow down")})
+	stored, err := storeResult(db, "host1", "kmsg", time.Now(), []string{"line"}, nil, AnalysisMeta{}, llmErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "llm_unavailable" || stored.ErrorClass != "rate_limited" {
+		t.Errorf("stored = %s/%s, want llm_unavailable/rate_limited", stored.Status, stored.ErrorClass)
+	}
+	rows, err := db.QueryNonOK(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ErrorClass != "rate_limited" {
+		t.Errorf("queried rows = %+v, want one with error_class rate_limited", rows)
+	}
+}
@@ -0,0 +1,92 @@
+// internal/collector/llmerror.go
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrorClass says why an LLM call failed. It decides whether the call is
+// retried, whether the fallback chain moves on, and is stored on the
+// result row so the digest can say why analyses failed.
+type ErrorClass string
+
+const (
+	ClassTransport   ErrorClass = "transport"    // connection refused, DNS, TLS, timeout
+	ClassRateLimited ErrorClass = "rate_limited" // 429
+	ClassServer      ErrorClass = "server"       // 5xx, 408
+	ClassAuth        ErrorClass = "auth"         // 401, 403
+	ClassBadRequest  ErrorClass = "bad_request"  // any other 4xx
+	ClassParse       ErrorClass = "parse"        // reply isn't the JSON we asked for
+	ClassValidation  ErrorClass = "validation"   // JSON, but not a valid analysis
+	ClassCircuitOpen ErrorClass = "circuit_open" // skipped: the endpoint's breaker is open
+)
+
+// ErrorClasses lists the classes in the order the digest reports them.
+var ErrorClasses = []ErrorClass{
+	ClassTransport, ClassRateLimited, ClassServer, ClassAuth,
+	ClassBadRequest, ClassParse, ClassValidation, ClassCircuitOpen,
+}
+
+// transient reports whether a class is worth retrying on the same endpoint
+// and counts against its circuit breaker.
+func (c ErrorClass) transient() bool {
+	return c == ClassTransport || c == ClassRateLimited || c == ClassServer
+}
+
+// defaultFallback is which classes move on to the next endpoint. An
+// endpoint that's down, throttled or refusing our key says nothing about
+// the next one; a reply we can't use usually means the prompt, not the
+// endpoint, is the problem. A circuit-open skip always falls back.
+var defaultFallback = map[ErrorClass]bool{
+	ClassTransport:   true,
+	ClassRateLimited: true,
+	ClassServer:      true,
+	ClassAuth:        true,
+	ClassBadRequest:  false,
+	ClassParse:       false,
+	ClassValidation:  false,
+}
+
+// LLMError is the error LLMClient returns for a failed call to one
+// endpoint. Errors from the whole chain wrap the last one, so ErrorClassOf
+// works on either.
+type LLMError struct {
+	Class      ErrorClass
+	StatusCode int           // HTTP status, when there was a response
+	RetryAfter time.Duration // from a 429/503's Retry-After header
+	Err        error
+}
+
+func (e *LLMError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: HTTP %d: %v", e.Class, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Class, e.Err)
+}
+
+func (e *LLMError) Unwrap() error { return e.Err }
+
+// ErrorClassOf returns the class of the LLMError in err's chain, or "" if
+// there is none (e.g. no endpoints configured).
+func ErrorClassOf(err error) ErrorClass {
+	var le *LLMError
+	if errors.As(err, &le) {
+		return le.Class
+	}
+	return ""
+}
+
+// classifyStatus maps a non-200 HTTP status onto a class.
+func classifyStatus(code int) ErrorClass {
+	switch {
+	case code == 429:
+		return ClassRateLimited
+	case code == 401 || code == 403:
+		return ClassAuth
+	case code == 408 || code >= 500:
+		return ClassServer
+	}
+	return ClassBadRequest
+}
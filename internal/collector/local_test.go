@@ -0,0 +1,196 @@
+// internal/collector/local_test.go
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// localServer emulates the quirks of Ollama and llama.cpp's server that the
+// local profile exists for: no API key, a slow first request while the
+// model loads, one GPU serving one request at a time, a reasoning model's
+// <think> block before every answer, and prose around the JSON unless
+// asked for JSON output.
+type localServer struct {
+	*httptest.Server
+	loadDelay time.Duration // first request only
+	delay     time.Duration
+
+	mu       sync.Mutex
+	loaded   bool
+	inFlight int
+	peak     int
+	authSeen atomic.Bool
+	grammar  atomic.Value // last grammar sent
+}
+
+func newLocalServer(t *testing.T, loadDelay, delay time.Duration) *localServer {
+	t.Helper()
+	s := &localServer{loadDelay: loadDelay, delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *localServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "" {
+		s.authSeen.Store(true)
+	}
+	var req struct {
+		ResponseFormat struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+		Format  string `json:"format"`
+		Grammar string `json:"grammar"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.grammar.Store(req.Grammar)
+
+	s.mu.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	wait := s.delay
+	if !s.loaded {
+		wait, s.loaded = s.loadDelay, true
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(wait):
+	case <-r.Context().Done():
+		return
+	}
+
+	answer := `{"status":"ok","issues":[]}`
+	if req.ResponseFormat.Type != "json_object" && req.Format != "json" {
+		answer = "Sure! Here is my analysis:\n" + answer + "\nLet me know if you need more."
+	}
+	content := "<think>\nThe log looks routine.\n</think>\n" + answer
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"model":   "qwen2.5:7b-instruct-q4_K_M",
+		"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+	})
+}
+
+func (s *localServer) peakInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+func TestLLMClientLocalProfile(t *testing.T) {
+	server := newLocalServer(t, 200*time.Millisecond, 20*time.Millisecond)
+	client := NewLLMClient([]Endpoint{{
+		URL:           server.URL,
+		Model:         "qwen2.5:7b-instruct",
+		Timeout:       2 * time.Second,
+		MaxConcurrent: 1,
+		JSONFormat:    true,
+		Grammar:       `root ::= "{" [^}]* "}"`,
+		Local:         true,
+	}}, 0)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, meta, err := client.Analyze(context.Background(), []string{fmt.Sprintf("line %d", i)})
+			if err == nil && (result.Status != "ok" || meta.Model != "qwen2.5:7b-instruct-q4_K_M") {
+				err = fmt.Errorf("result = %+v, model = %q", result, meta.Model)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+	if peak := server.peakInFlight(); peak != 1 {
+		t.Errorf("peak in-flight requests = %d, want 1 (max_concurrent)", peak)
+	}
+	if server.authSeen.Load() {
+		t.Error("Authorization header sent without an API key")
+	}
+	if g, _ := server.grammar.Load().(string); g == "" {
+		t.Error("grammar wasn't passed through")
+	}
+}
+
+// A hosted endpoint asked for JSON gets response_format only: OpenAI
+// rejects Ollama's "format" as an unrecognized argument.
+func TestLLMClientHostedJSONFormat(t *testing.T) {
+	var body map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["format"]; ok {
+			http.Error(w, `{"error": {"message": "Unrecognized request argument supplied: format"}}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": `{"status":"ok","issues":[]}`}}},
+		})
+	}))
+	defer server.Close()
+
+	client := NewLLMClient([]Endpoint{{URL: server.URL, Model: "gpt-4o-mini", APIKey: "key", JSONFormat: true}}, 0)
+	if _, _, err := client.Analyze(context.Background(), []string{"line"}); err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if string(body["response_format"]) != `{"type":"json_object"}` {
+		t.Errorf("response_format = %s, want json_object", body["response_format"])
+	}
+	if _, ok := body["format"]; ok {
+		t.Errorf("hosted request carries format: %s", body["format"])
+	}
+}
+
+func TestLLMClientLocalQuirks(t *testing.T) {
+	// Without JSON mode the model wraps its answer in prose.
+	server := newLocalServer(t, 0, 0)
+	client := NewLLMClient([]Endpoint{{URL: server.URL, Model: "m"}}, 0)
+	_, _, err := client.Analyze(context.Background(), []string{"line"})
+	if ErrorClassOf(err) != ClassParse {
+		t.Errorf("without JSON mode: err = %v, want a parse error", err)
+	}
+
+	// A model load that outlasts the endpoint's timeout is a transport
+	// failure; the per-endpoint timeout, not a client-wide one, applies.
+	slow := newLocalServer(t, 500*time.Millisecond, 0)
+	client = NewLLMClient([]Endpoint{{URL: slow.URL, Model: "m", Timeout: 50 * time.Millisecond, JSONFormat: true}}, 0)
+	_, _, err = client.Analyze(context.Background(), []string{"line"})
+	if ErrorClassOf(err) != ClassTransport {
+		t.Errorf("slow load: err = %v, want a transport error", err)
+	}
+}
+
+func TestStripThinking(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"<think>hmm</think>\n{\"status\":\"ok\"}", "\n{\"status\":\"ok\"}"},
+		{"{\"status\":\"ok\"}", "{\"status\":\"ok\"}"},
+		{"<think>never closed", "<think>never closed"},
+	}
+	for _, tt := range tests {
+		if got := stripThinking(tt.in); got != tt.want {
+			t.Errorf("stripThinking(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
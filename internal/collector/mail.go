@@ -5,22 +5,26 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net"
 	"net/smtp"
+	"net/textproto"
 	"os"
 	"strings"
 
 	"github.com/signalnine/tasseograph/internal/config"
 )
 
-// SendMail dispatches one plain-text email via SMTP. STARTTLS + PLAIN auth
-// are both opt-in via config, so the same code path works against an
-// authenticated submission service (Fastmail :587) or a local relay (:25).
+// SendMail dispatches one email via SMTP. STARTTLS + PLAIN auth are both
+// opt-in via config, so the same code path works against an authenticated
+// submission service (Fastmail :587) or a local relay (:25).
 //
-// Wire format: a single plain-text part with CRLF line endings. We don't
-// bother with multipart/HTML -- the digest body is intentionally terminal-
-// friendly and the recipient (on-call) reads it as text.
-func SendMail(cfg *config.CollectorConfig, subject, body string) error {
+// Wire format: the plain-text body with CRLF line endings, and when html
+// isn't empty, an HTML alternative after it (see buildMessage). The text
+// stays terminal-friendly for whoever reads their mail that way.
+func SendMail(cfg *config.CollectorConfig, subject, body, html string) error {
 	if cfg.SMTPHost == "" || cfg.SMTPFrom == "" || cfg.SMTPTo == "" {
 		return errors.New("SMTPHost, SMTPFrom, SMTPTo all required")
 	}
@@ -81,7 +85,7 @@ func SendMail(cfg *config.CollectorConfig, subject, body string) error {
 	if err != nil {
 		return fmt.Errorf("DATA: %w", err)
 	}
-	if _, err := wc.Write(buildMessage(cfg.SMTPFrom, cfg.SMTPTo, subject, body)); err != nil {
+	if _, err := wc.Write(buildMessage(cfg.SMTPFrom, cfg.SMTPTo, subject, body, html)); err != nil {
 		wc.Close()
 		return fmt.Errorf("write body: %w", err)
 	}
@@ -96,20 +100,51 @@ func SendMail(cfg *config.CollectorConfig, subject, body string) error {
 // line endings. The net/smtp package's Data() writer already dot-stuffs and
 // terminates with the EOM marker, so we just produce a well-formed RFC822
 // message and let the library handle the SMTP-specific transformations.
-func buildMessage(from, to, subject, body string) []byte {
+//
+// With html, the message is multipart/alternative: the text part first,
+// then the HTML, which clients prefer when they can show it. The HTML is
+// quoted-printable, which keeps its lines within SMTP's 998-octet limit.
+func buildMessage(from, to, subject, body, html string) []byte {
 	var sb strings.Builder
 	fmt.Fprintf(&sb, "From: %s\r\n", from)
 	fmt.Fprintf(&sb, "To: %s\r\n", to)
 	fmt.Fprintf(&sb, "Subject: %s\r\n", subject)
 	sb.WriteString("MIME-Version: 1.0\r\n")
-	sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	if html == "" {
+		sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		sb.WriteString("\r\n")
+		writeCRLF(&sb, body)
+		return []byte(sb.String())
+	}
+
+	// Writes to a strings.Builder don't fail.
+	mw := multipart.NewWriter(&sb)
+	fmt.Fprintf(&sb, "Content-Type: multipart/alternative; boundary=%q\r\n", mw.Boundary())
 	sb.WriteString("\r\n")
+	part, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	var text strings.Builder
+	writeCRLF(&text, body)
+	io.WriteString(part, text.String())
+	part, _ = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qp := quotedprintable.NewWriter(part)
+	io.WriteString(qp, html)
+	qp.Close()
+	mw.Close()
+	return []byte(sb.String())
+}
+
+// writeCRLF writes body with CRLF line endings.
+func writeCRLF(sb *strings.Builder, body string) {
 	body = strings.ReplaceAll(body, "\r\n", "\n")
 	for _, line := range strings.Split(body, "\n") {
 		sb.WriteString(line)
 		sb.WriteString("\r\n")
 	}
-	return []byte(sb.String())
 }
 
 // localHelo is the name we announce in EHLO. Fastmail and most providers
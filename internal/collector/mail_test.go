@@ -5,7 +5,10 @@ import (
 	"bufio"
 	"encoding/base64"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net"
+	"net/mail"
 	"strings"
 	"sync"
 	"testing"
@@ -142,7 +145,7 @@ func TestSendMail_DeliversBodyAndHeaders(t *testing.T) {
 		SMTPTo:   "to@example.com",
 	}
 
-	err := SendMail(cfg, "subj line", "hello\nworld")
+	err := SendMail(cfg, "subj line", "hello\nworld", "")
 	if err != nil {
 		t.Fatalf("SendMail: %v", err)
 	}
@@ -178,7 +181,7 @@ func TestSendMail_DotStuffing(t *testing.T) {
 		SMTPTo:   "to@example.com",
 	}
 
-	if err := SendMail(cfg, "x", ".dotted line\nfollowup"); err != nil {
+	if err := SendMail(cfg, "x", ".dotted line\nfollowup", ""); err != nil {
 		t.Fatalf("SendMail: %v", err)
 	}
 	if !strings.Contains(m.data, "\r\n..dotted line\r\n") {
@@ -186,6 +189,53 @@ func TestSendMail_DotStuffing(t *testing.T) {
 	}
 }
 
+func TestSendMail_MultipartAlternative(t *testing.T) {
+	m := newMockSMTP(t)
+	defer m.close()
+
+	cfg := &config.CollectorConfig{
+		SMTPHost: m.addr,
+		SMTPFrom: "from@example.com",
+		SMTPTo:   "to@example.com",
+	}
+	html := "<p>" + strings.Repeat("<b>host</b> ", 200) + "</p>\n<p>caf\u00e9</p>"
+	if err := SendMail(cfg, "subj", "hello\nworld", html); err != nil {
+		t.Fatalf("SendMail: %v", err)
+	}
+	for _, line := range strings.Split(m.data, "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("line of %d octets on the wire", len(line))
+		}
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(m.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+	// Clients show the last part they can, so the HTML comes last.
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for _, want := range []struct{ typ, body string }{
+		{"text/plain; charset=utf-8", "hello\r\nworld\r\n"},
+		{"text/html; charset=utf-8", strings.ReplaceAll(html, "\n", "\r\n")},
+	} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("%s part: %v", want.typ, err)
+		}
+		body, _ := io.ReadAll(part)
+		if part.Header.Get("Content-Type") != want.typ || string(body) != want.body {
+			t.Errorf("part %s:\n%q\nwant %s:\n%q", part.Header.Get("Content-Type"), body, want.typ, want.body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("more than two parts: %v", err)
+	}
+}
+
 func TestSendMail_RefusesPasswordWithoutTLS(t *testing.T) {
 	// We never want PLAIN credentials over an unencrypted channel.
 	m := newMockSMTP(t)
@@ -200,7 +250,7 @@ func TestSendMail_RefusesPasswordWithoutTLS(t *testing.T) {
 		SMTPStartTLS: false,
 	}
 
-	err := SendMail(cfg, "subj", "body")
+	err := SendMail(cfg, "subj", "body", "")
 	if err == nil {
 		t.Fatal("expected error sending password without STARTTLS, got nil")
 	}
@@ -217,7 +267,7 @@ func TestSendMail_MissingFieldsErrors(t *testing.T) {
 	}
 	for name, cfg := range cases {
 		t.Run(name, func(t *testing.T) {
-			if err := SendMail(cfg, "s", "b"); err == nil {
+			if err := SendMail(cfg, "s", "b", ""); err == nil {
 				t.Fatal("expected error, got nil")
 			}
 		})
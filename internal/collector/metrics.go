@@ -0,0 +1,158 @@
+// internal/collector/metrics.go
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// metricsSchema stores every hardware sample as its own row, keyed by
+// hostname and series so "the previous sample for this DIMM" is one index
+// probe. Volumes are modest: a few dozen series per host per poll.
+const metricsSchema = `
+CREATE TABLE IF NOT EXISTS metrics (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	hostname TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	series TEXT NOT NULL,
+	name TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	labels TEXT,
+	value REAL NOT NULL,
+	created_at TEXT DEFAULT (datetime('now'))
+);
+CREATE INDEX IF NOT EXISTS idx_metrics_series ON metrics(hostname, series, timestamp);
+`
+
+// MetricSample is one stored point of a hardware series.
+type MetricSample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// InsertMetrics stores one sample per metric for hostname at ts, in a single
+// transaction so a host's poll is never half-recorded.
+func (d *sqlStore) InsertMetrics(hostname string, ts time.Time, metrics []protocol.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tsStr := ts.UTC().Format(time.RFC3339)
+	for _, m := range metrics {
+		labelsJSON, err := json.Marshal(m.Labels)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(d.rebind(`
+			INSERT INTO metrics (hostname, timestamp, series, name, kind, labels, value)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`), hostname, tsStr, m.SeriesKey(), m.Name, m.Kind, string(labelsJSON), m.Value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// QueryMetricSeries returns the most recent samples of one series strictly
+// before `before`, newest first.
+func (d *sqlStore) QueryMetricSeries(hostname, series string, before time.Time, limit int) ([]MetricSample, error) {
+	rows, err := d.query(`
+		SELECT timestamp, value FROM metrics
+		WHERE hostname = ? AND series = ? AND timestamp < ?
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, hostname, series, before.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []MetricSample
+	for rows.Next() {
+		var s MetricSample
+		var tsStr string
+		if err := rows.Scan(&tsStr, &s.Value); err != nil {
+			return nil, err
+		}
+		s.Timestamp, _ = time.Parse(time.RFC3339, tsStr)
+		samples = append(samples, s)
+	}
+	return samples, rows.Err()
+}
+
+// CounterIncrease is a hardware counter that went up since its previous
+// sample. PrevRatePerHour is the rate over the interval before that, so a
+// caller can tell "a few corrections" from "corrections accelerating".
+type CounterIncrease struct {
+	Series          string
+	Delta           float64
+	Elapsed         time.Duration
+	RatePerHour     float64
+	PrevRatePerHour float64
+	HasPrevRate     bool
+}
+
+// TrendingUp reports whether the counter is rising faster than it did over
+// the previous interval.
+func (c CounterIncrease) TrendingUp() bool {
+	return c.HasPrevRate && c.RatePerHour > c.PrevRatePerHour
+}
+
+// String renders the increase as a prompt line. The [hw] tag matches the
+// system prompt's description of sysfs-derived context.
+func (c CounterIncrease) String() string {
+	s := fmt.Sprintf("[hw] %s +%g over %s (%.1f/h", c.Series, c.Delta, c.Elapsed.Round(time.Second), c.RatePerHour)
+	if c.HasPrevRate {
+		s += fmt.Sprintf(", previous interval %.1f/h", c.PrevRatePerHour)
+	}
+	s += ")"
+	if c.TrendingUp() {
+		s += " TRENDING UP"
+	}
+	return s
+}
+
+// CounterIncreases compares each counter in metrics against the stored
+// history for hostname and returns the ones that rose. Call it before
+// InsertMetrics for the same poll. A drop is treated as a counter reset
+// (reboot, driver reload) and reported as nothing; gauges are skipped.
+func (d *sqlStore) CounterIncreases(hostname string, ts time.Time, metrics []protocol.Metric) ([]CounterIncrease, error) {
+	var out []CounterIncrease
+	for _, m := range metrics {
+		if m.Kind != protocol.MetricCounter {
+			continue
+		}
+		series := m.SeriesKey()
+		prev, err := d.QueryMetricSeries(hostname, series, ts, 2)
+		if err != nil {
+			return nil, fmt.Errorf("series %s: %w", series, err)
+		}
+		if len(prev) == 0 || m.Value <= prev[0].Value {
+			continue
+		}
+		inc := CounterIncrease{
+			Series:  series,
+			Delta:   m.Value - prev[0].Value,
+			Elapsed: ts.Sub(prev[0].Timestamp),
+		}
+		if inc.Elapsed > 0 {
+			inc.RatePerHour = inc.Delta / inc.Elapsed.Hours()
+		}
+		if len(prev) == 2 {
+			if dt := prev[0].Timestamp.Sub(prev[1].Timestamp); dt > 0 && prev[0].Value >= prev[1].Value {
+				inc.PrevRatePerHour = (prev[0].Value - prev[1].Value) / dt.Hours()
+				inc.HasPrevRate = true
+			}
+		}
+		out = append(out, inc)
+	}
+	return out, nil
+}
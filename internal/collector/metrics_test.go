@@ -0,0 +1,139 @@
+// internal/collector/metrics_test.go
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func ceCount(v float64) protocol.Metric {
+	return protocol.Metric{
+		Name:   "edac_ce_count",
+		Kind:   protocol.MetricCounter,
+		Labels: map[string]string{"mc": "mc0", "dimm": "dimm0"},
+		Value:  v,
+	}
+}
+
+func TestCounterIncreases(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB error: %v", err)
+	}
+	defer db.Close()
+
+	t0 := time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)
+	temp := protocol.Metric{Name: "hwmon_temperature_celsius", Kind: protocol.MetricGauge, Value: 50}
+
+	// First sample: nothing to compare against.
+	inc, err := db.CounterIncreases("h", t0, []protocol.Metric{ceCount(10), temp})
+	if err != nil {
+		t.Fatalf("CounterIncreases: %v", err)
+	}
+	if len(inc) != 0 {
+		t.Errorf("first sample increases = %+v, want none", inc)
+	}
+	if err := db.InsertMetrics("h", t0, []protocol.Metric{ceCount(10), temp}); err != nil {
+		t.Fatalf("InsertMetrics: %v", err)
+	}
+
+	// +1 in the first hour.
+	t1 := t0.Add(time.Hour)
+	db.InsertMetrics("h", t1, []protocol.Metric{ceCount(11)})
+
+	// +12 in the next hour: increase, and faster than before.
+	t2 := t1.Add(time.Hour)
+	inc, err = db.CounterIncreases("h", t2, []protocol.Metric{ceCount(23), temp})
+	if err != nil {
+		t.Fatalf("CounterIncreases: %v", err)
+	}
+	if len(inc) != 1 {
+		t.Fatalf("increases = %+v, want 1", inc)
+	}
+	if inc[0].Delta != 12 || inc[0].RatePerHour != 12 || inc[0].PrevRatePerHour != 1 {
+		t.Errorf("increase = %+v, want delta 12, rate 12/h, prev 1/h", inc[0])
+	}
+	if !inc[0].TrendingUp() {
+		t.Error("TrendingUp = false, want true")
+	}
+	if s := inc[0].String(); !strings.HasPrefix(s, "[hw] edac_ce_count{") || !strings.HasSuffix(s, "TRENDING UP") {
+		t.Errorf("String() = %q", s)
+	}
+
+	// A drop is a counter reset, not an increase.
+	inc, _ = db.CounterIncreases("h", t2, []protocol.Metric{ceCount(0)})
+	if len(inc) != 0 {
+		t.Errorf("reset increases = %+v, want none", inc)
+	}
+
+	// Other hosts' series are independent.
+	inc, _ = db.CounterIncreases("other", t2, []protocol.Metric{ceCount(500)})
+	if len(inc) != 0 {
+		t.Errorf("other host increases = %+v, want none", inc)
+	}
+}
+
+func TestIngestHandlerAnalyzesCounterIncreaseWithoutLines(t *testing.T) {
+	// A quiet dmesg with a climbing ECC counter still deserves an LLM look.
+	dir := t.TempDir()
+	db, _ := NewDB(filepath.Join(dir, "test.db"))
+	defer db.Close()
+
+	var prompts []string
+	mockLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompts = append(prompts, req.Messages[len(req.Messages)-1].Content)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"content": `{"status": "warning", "issues": []}`}},
+			},
+		})
+	}))
+	defer mockLLM.Close()
+
+	llmClient := NewLLMClient([]Endpoint{{URL: mockLLM.URL, Model: "test", APIKey: "key"}}, 0)
+	handler := NewIngestHandler(db, llmClient, "secret", 1<<20)
+
+	post := func(ts time.Time, v float64) map[string]interface{} {
+		body, _ := json.Marshal(protocol.DmesgDelta{
+			Hostname:  "ecc-host",
+			Timestamp: ts,
+			Metrics:   []protocol.Metric{ceCount(v)},
+		})
+		req := httptest.NewRequest("POST", "/ingest", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Status = %d. Body: %s", rec.Code, rec.Body.String())
+		}
+		var resp map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if resp := post(now.Add(-10*time.Minute), 5); resp["status"] != "skipped" {
+		t.Errorf("first poll status = %v, want skipped (no baseline yet)", resp["status"])
+	}
+	if resp := post(now, 9); resp["status"] != "warning" {
+		t.Errorf("second poll status = %v, want warning", resp["status"])
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "[hw] edac_ce_count") {
+		t.Errorf("prompts = %q, want one [hw] edac_ce_count line", prompts)
+	}
+}
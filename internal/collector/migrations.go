@@ -0,0 +1,214 @@
+// internal/collector/migrations.go
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migration is one step of the database schema's history. Migrations run
+// in Version order, each in its own transaction together with its row in
+// schema_migrations, so a failed step leaves the database at the version
+// before it.
+//
+// Databases from before schema_migrations existed were built by
+// CREATE TABLE IF NOT EXISTS and addColumnIfMissing, so every migration up
+// to and including version 9 is written the same way: such a database is
+// brought under version control by running them all, each one a no-op for
+// whatever is already there. Later migrations needn't be idempotent.
+type Migration struct {
+	Version int
+	Name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations is the SQLite schema's history; pgMigrations is
+// PostgreSQL's. Append only: never edit or reorder a migration that has
+// shipped.
+var migrations = []Migration{
+	{1, "results table", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS results (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp TEXT NOT NULL,
+			hostname TEXT NOT NULL,
+			status TEXT NOT NULL,
+			issues TEXT,
+			raw_dmesg TEXT,
+			api_latency_ms INTEGER,
+			created_at TEXT DEFAULT (datetime('now'))
+		);
+		CREATE INDEX IF NOT EXISTS idx_results_hostname ON results(hostname);
+		CREATE INDEX IF NOT EXISTS idx_results_status ON results(status);
+		CREATE INDEX IF NOT EXISTS idx_results_timestamp ON results(timestamp);
+		`)
+		return err
+	}},
+	{2, "results provider and model", func(tx *sql.Tx) error {
+		if err := addColumnIfMissing(tx, "results", "provider", "TEXT"); err != nil {
+			return err
+		}
+		return addColumnIfMissing(tx, "results", "model", "TEXT")
+	}},
+	{3, "hardware metrics", execMigration(metricsSchema)},
+	{4, "SMART snapshots", execMigration(smartSchema)},
+	{5, "results source", func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "results", "source", "TEXT")
+	}},
+	{6, "results error_class", func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "results", "error_class", "TEXT")
+	}},
+	{7, "results verdicts", func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "results", "verdicts", "TEXT")
+	}},
+	{8, "labels and suppressions", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(labelsSchema); err != nil {
+			return err
+		}
+		return addColumnIfMissing(tx, "results", "suppressed", "TEXT")
+	}},
+	{9, "silences", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(silencesSchema); err != nil {
+			return err
+		}
+		return addColumnIfMissing(tx, "results", "silenced", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{10, "full-text search", execMigration(searchSchema)},
+	{11, "compressed dmesg blobs", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(dmesgSchema); err != nil {
+			return err
+		}
+		_, err := tx.Exec(contentlessSearchSchema)
+		return err
+	}},
+}
+
+func execMigration(schema string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(schema)
+		return err
+	}
+}
+
+// latestSchemaVersion is the version the last migration brings a database
+// to.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// schemaVersion returns the version db is at: 0 for an empty database, or
+// one from before schema_migrations.
+func schemaVersion(db *sql.DB) (int, error) {
+	return (&sqlStore{db: db}).schemaVersion()
+}
+
+func (d *sqlStore) schemaVersion() (int, error) {
+	exists := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	if d.postgres {
+		exists = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`
+	}
+	var n int
+	err := d.db.QueryRow(exists).Scan(&n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	var version int
+	err = d.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// migrate brings db from its current version to version to, returning
+// the version it found and the migrations it ran. With dryRun it only
+// returns the migrations it would run.
+func migrate(db *sql.DB, to int, dryRun bool) (from int, pending []Migration, err error) {
+	return (&sqlStore{db: db}).migrate(migrations, to, dryRun)
+}
+
+// migrate runs history, one backend's migrations, as far as version to.
+func (d *sqlStore) migrate(history []Migration, to int, dryRun bool) (from int, pending []Migration, err error) {
+	from, err = d.schemaVersion()
+	if err != nil {
+		return 0, nil, fmt.Errorf("read schema version: %w", err)
+	}
+	latest := history[len(history)-1].Version
+	switch {
+	case from > latest:
+		return from, nil, fmt.Errorf("database schema version %d is newer than this collector's (%d); upgrade the collector", from, latest)
+	case to < from:
+		return from, nil, fmt.Errorf("database is at schema version %d; migrations only go forward", from)
+	case to > latest:
+		return from, nil, fmt.Errorf("no schema version %d (latest is %d)", to, latest)
+	}
+	for _, m := range history {
+		if m.Version > from && m.Version <= to {
+			pending = append(pending, m)
+		}
+	}
+	if dryRun || len(pending) == 0 {
+		return from, pending, nil
+	}
+
+	if _, err := d.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT DEFAULT ` + nowDefault(d.postgres) + `
+		)`); err != nil {
+		return from, nil, err
+	}
+	for i, m := range pending {
+		if err := d.runMigration(m); err != nil {
+			return from, pending[:i], fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return from, pending, nil
+}
+
+func (d *sqlStore) runMigration(m Migration) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if d.postgres {
+		// Collectors sharing a database may start at the same time: the
+		// lock holds the others back until the first has migrated, and
+		// they then find the migration already applied.
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('tasseograph schema_migrations'))`); err != nil {
+			return err
+		}
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, m.Version).Scan(&n); err != nil || n > 0 {
+			return err
+		}
+	}
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(d.rebind(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`), m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrateDB opens the database at path and migrates it to schema version
+// to, or to the latest when to is 0. With dryRun nothing is changed and
+// the migrations returned are the ones that would run. It returns the
+// version the database was at and the migrations run.
+func MigrateDB(path string, to int, dryRun bool) (from int, ran []Migration, err error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer db.Close()
+	if to == 0 {
+		to = latestSchemaVersion()
+	}
+	if !dryRun {
+		// As in NewDB, for a database this creates.
+		if _, err := db.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+			return 0, nil, err
+		}
+	}
+	return migrate(db, to, dryRun)
+}
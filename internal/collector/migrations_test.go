@@ -0,0 +1,234 @@
+// internal/collector/migrations_test.go
+package collector
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schemaOf lists every table's columns and every index, ignoring column
+// order and DDL text, which differ between a table created whole and one
+// grown by ALTER TABLE.
+func schemaOf(t *testing.T, db *sql.DB) map[string][]string {
+	t.Helper()
+	rows, err := db.Query(`SELECT type, name, tbl_name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type object struct{ kind, name, table string }
+	var objects []object
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name, &o.table); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+
+	schema := map[string][]string{}
+	for _, o := range objects {
+		if o.kind == "index" {
+			schema["index "+o.table] = append(schema["index "+o.table], o.name)
+			continue
+		}
+		cols, err := db.Query(`SELECT name, type, "notnull", COALESCE(dflt_value, '') FROM pragma_table_info(?)`, o.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for cols.Next() {
+			var name, typ, dflt string
+			var notNull bool
+			if err := cols.Scan(&name, &typ, &notNull, &dflt); err != nil {
+				t.Fatal(err)
+			}
+			schema[o.name] = append(schema[o.name], fmt.Sprintf("%s %s notnull=%v default=%s", name, typ, notNull, dflt))
+		}
+		cols.Close()
+	}
+	for _, v := range schema {
+		sort.Strings(v)
+	}
+	return schema
+}
+
+func freshSchema(t *testing.T) map[string][]string {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "fresh.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	return schemaOf(t, db.db)
+}
+
+func TestMigrateFromEveryVersion(t *testing.T) {
+	want := freshSchema(t)
+	latest := latestSchemaVersion()
+
+	for v := 0; v <= latest; v++ {
+		t.Run(fmt.Sprintf("v%d", v), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+			if v > 0 {
+				from, ran, err := MigrateDB(path, v, false)
+				if err != nil {
+					t.Fatalf("migrate to %d: %v", v, err)
+				}
+				if from != 0 || len(ran) != v {
+					t.Fatalf("migrate to %d: from %d, ran %d", v, from, len(ran))
+				}
+				// A row written by a collector of that version.
+				raw, err := sql.Open("sqlite", path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := raw.Exec(`INSERT INTO results (timestamp, hostname, status, issues) VALUES (?, 'old-host', 'warning', '[{"summary":"ECC"}]')`,
+					time.Now().UTC().Format(time.RFC3339)); err != nil {
+					t.Fatal(err)
+				}
+				raw.Close()
+			}
+
+			db, err := NewDB(path)
+			if err != nil {
+				t.Fatalf("NewDB from version %d: %v", v, err)
+			}
+			defer db.Close()
+			if got, _ := schemaVersion(db.db); got != latest {
+				t.Errorf("version = %d, want %d", got, latest)
+			}
+			if got := schemaOf(t, db.db); !reflect.DeepEqual(got, want) {
+				t.Errorf("schema differs from a fresh database:\ngot  %v\nwant %v", got, want)
+			}
+			if v > 0 {
+				r, err := db.QueryResult(1)
+				if err != nil || r == nil || r.Hostname != "old-host" || len(r.Issues) != 1 || r.Silenced {
+					t.Errorf("old row = %+v, %v", r, err)
+				}
+			}
+		})
+	}
+}
+
+// TestMigrateUnversionedDatabase adopts a database built before
+// schema_migrations existed, by the original NewDB.
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = raw.Exec(`
+	CREATE TABLE results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp TEXT NOT NULL,
+		hostname TEXT NOT NULL,
+		status TEXT NOT NULL,
+		issues TEXT,
+		raw_dmesg TEXT,
+		api_latency_ms INTEGER,
+		provider TEXT,
+		model TEXT,
+		created_at TEXT DEFAULT (datetime('now'))
+	);
+	CREATE INDEX idx_results_hostname ON results(hostname);
+	CREATE INDEX idx_results_status ON results(status);
+	CREATE INDEX idx_results_timestamp ON results(timestamp);
+	INSERT INTO results (timestamp, hostname, status, model) VALUES ('2026-01-02T03:04:05Z', 'legacy', 'ok', 'gpt-4o-mini');
+	`)
+	raw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer db.Close()
+	if got := schemaOf(t, db.db); !reflect.DeepEqual(got, freshSchema(t)) {
+		t.Errorf("schema differs from a fresh database: %v", got)
+	}
+	var n int
+	db.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&n)
+	if n != len(migrations) {
+		t.Errorf("schema_migrations has %d rows, want %d", n, len(migrations))
+	}
+	if r, _ := db.QueryResult(1); r == nil || r.Model != "gpt-4o-mini" {
+		t.Errorf("legacy row = %+v", r)
+	}
+}
+
+func TestMigrateDryRunAndBounds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if _, _, err := MigrateDB(path, 3, false); err != nil {
+		t.Fatal(err)
+	}
+
+	from, pending, err := MigrateDB(path, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 3 || len(pending) != latestSchemaVersion()-3 || pending[0].Version != 4 {
+		t.Errorf("dry run: from %d, pending %+v", from, pending)
+	}
+	if from, _, _ := MigrateDB(path, 0, true); from != 3 {
+		t.Errorf("dry run changed the version to %d", from)
+	}
+
+	if _, _, err := MigrateDB(path, 2, false); err == nil {
+		t.Error("migrating backwards succeeded")
+	}
+	if _, _, err := MigrateDB(path, latestSchemaVersion()+1, false); err == nil {
+		t.Error("migrating past the latest version succeeded")
+	}
+
+	// A database from a newer collector is refused rather than written to.
+	if _, _, err := MigrateDB(path, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := sql.Open("sqlite", path)
+	raw.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from the future')`, latestSchemaVersion()+1)
+	raw.Close()
+	if _, err := NewDB(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("NewDB on a newer schema: err = %v", err)
+	}
+}
+
+func TestMigrationFailureRollsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	saved := migrations
+	defer func() { migrations = saved }()
+	latest := latestSchemaVersion()
+	migrations = append(migrations[:len(migrations):len(migrations)], Migration{latest + 1, "half done", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE half_done (id INTEGER)`); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	}})
+
+	if _, ran, err := migrate(db.db, latest+1, false); err == nil || len(ran) != 0 {
+		t.Fatalf("migrate: ran %v, err %v; want the failure reported", ran, err)
+	}
+	if v, _ := schemaVersion(db.db); v != latest {
+		t.Errorf("version = %d after a failed migration, want %d", v, latest)
+	}
+	var n int
+	db.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&n)
+	if n != 0 {
+		t.Error("failed migration's table was left behind")
+	}
+}
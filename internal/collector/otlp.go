@@ -0,0 +1,476 @@
+// internal/collector/otlp.go
+package collector
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// otlpLog is one OTLP LogRecord with its resource and record attributes and
+// body flattened into fields. Record attributes override resource ones.
+type otlpLog struct {
+	fields       map[string]string
+	timeNano     uint64
+	observedNano uint64
+	severity     int
+	severityText string
+}
+
+// ServeOTLP handles POST /v1/logs, the OTLP/HTTP logs endpoint, so an
+// OpenTelemetry Collector (journald or filelog receiver) can export kernel
+// logs here directly. Both the protobuf and JSON encodings are accepted.
+func (h *IngestHandler) ServeOTLP(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	isJSON := false
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		isJSON = mt == "application/json"
+	}
+
+	var logs []otlpLog
+	var err error
+	if isJSON {
+		logs, err = decodeOTLPJSON(body)
+	} else {
+		logs, err = decodeOTLPProto(body)
+	}
+	if err != nil {
+		http.Error(w, "Invalid OTLP payload", http.StatusBadRequest)
+		return
+	}
+
+	var hosts []string
+	var records []protocol.Record
+	for _, l := range logs {
+		host, rec, ok := otlpRecord(l)
+		if !ok {
+			continue
+		}
+		hosts = append(hosts, host)
+		records = append(records, rec)
+	}
+
+	deltas, dropped := groupDeltas(hosts, records, otlpSource)
+	if len(deltas) == 0 && dropped > 0 {
+		http.Error(w, "host.name is required", http.StatusBadRequest)
+		return
+	}
+	if !h.ingestAll(w, r, deltas, dropped) {
+		return
+	}
+
+	// An empty ExportLogsServiceResponse means full success.
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{}"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// otlpRecord maps an OTLP log onto a host and Record. OTLP's own severity
+// and timestamps win over anything found in the attributes.
+func otlpRecord(l otlpLog) (string, protocol.Record, bool) {
+	host, rec, ok := shippedRecord(l.fields)
+	if !ok {
+		return "", rec, false
+	}
+	if lvl, ok := otlpSeverityLevel(l.severity); ok {
+		rec.Level = lvl
+	} else if lvl, ok := parseShippedLevel(l.severityText); ok {
+		rec.Level = lvl
+	}
+	switch {
+	case l.timeNano > 0:
+		rec.Timestamp = time.Unix(0, int64(l.timeNano))
+	case l.observedNano > 0:
+		rec.Timestamp = time.Unix(0, int64(l.observedNano))
+	default:
+		rec.Timestamp = shipperTimestamp(l.fields)
+		if rec.Timestamp.IsZero() {
+			rec.Timestamp = time.Now()
+		}
+	}
+	return host, rec, true
+}
+
+// otlpSeverityLevel maps an OTLP SeverityNumber range (TRACE 1-4, DEBUG
+// 5-8, INFO 9-12, WARN 13-16, ERROR 17-20, FATAL 21-24) onto a syslog
+// level. Zero is UNSPECIFIED.
+func otlpSeverityLevel(n int) (int, bool) {
+	switch {
+	case n >= 1 && n <= 8:
+		return protocol.LevelDebug, true
+	case n >= 9 && n <= 12:
+		return protocol.LevelInfo, true
+	case n >= 13 && n <= 16:
+		return protocol.LevelWarning, true
+	case n >= 17 && n <= 20:
+		return protocol.LevelErr, true
+	case n >= 21 && n <= 24:
+		return protocol.LevelCrit, true
+	}
+	return 0, false
+}
+
+// The protobuf decoder walks the wire format by field number rather than
+// pulling in the generated OTLP packages; only the handful of fields below
+// matter here and unknown ones are skipped, as protobuf requires.
+//
+//	ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+//	Resource     { repeated KeyValue attributes = 1; }
+//	ScopeLogs    { repeated LogRecord log_records = 2; }
+//	LogRecord    { fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2;
+//	               string severity_text = 3; AnyValue body = 5;
+//	               repeated KeyValue attributes = 6; fixed64 observed_time_unix_nano = 11; }
+//	KeyValue     { string key = 1; AnyValue value = 2; }
+//	AnyValue     { oneof { string = 1; bool = 2; int64 = 3; double = 4;
+//	               ArrayValue = 5; KeyValueList = 6; bytes = 7; } }
+
+var errBadWire = errors.New("malformed protobuf")
+
+// eachField calls fn for every field in a message. v holds varint and
+// fixed values; b holds length-delimited ones.
+func eachField(data []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errBadWire
+		}
+		data = data[n:]
+
+		var v uint64
+		var b []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(data)
+			v = uint64(v32)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return errBadWire
+		}
+		data = data[n:]
+		if err := fn(num, typ, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeOTLPProto(data []byte) ([]otlpLog, error) {
+	var logs []otlpLog
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		rl, err := decodeResourceLogsProto(b)
+		logs = append(logs, rl...)
+		return err
+	})
+	return logs, err
+}
+
+func decodeResourceLogsProto(data []byte) ([]otlpLog, error) {
+	resource := map[string]string{}
+	var scopes [][]byte
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			return eachField(b, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+				if num == 1 && typ == protowire.BytesType {
+					return decodeKeyValueProto(b, "", resource)
+				}
+				return nil
+			})
+		case 2:
+			// The resource may follow its scopes on the wire; decode
+			// records once it's known.
+			scopes = append(scopes, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []otlpLog
+	for _, scope := range scopes {
+		err := eachField(scope, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+			if num != 2 || typ != protowire.BytesType {
+				return nil
+			}
+			l, err := decodeLogRecordProto(b, resource)
+			logs = append(logs, l)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return logs, nil
+}
+
+func decodeLogRecordProto(data []byte, resource map[string]string) (otlpLog, error) {
+	l := otlpLog{fields: make(map[string]string, len(resource)+4)}
+	for k, v := range resource {
+		l.fields[k] = v
+	}
+	var body []byte
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			l.timeNano = v
+		case num == 2 && typ == protowire.VarintType:
+			l.severity = int(v)
+		case num == 3 && typ == protowire.BytesType:
+			l.severityText = string(b)
+		case num == 5 && typ == protowire.BytesType:
+			body = b
+		case num == 6 && typ == protowire.BytesType:
+			return decodeKeyValueProto(b, "", l.fields)
+		case num == 11 && typ == protowire.Fixed64Type:
+			l.observedNano = v
+		}
+		return nil
+	})
+	if err != nil {
+		return l, err
+	}
+	if body != nil {
+		err = decodeBodyProto(body, l.fields)
+	}
+	return l, err
+}
+
+// decodeBodyProto stores a string body as the message; a map body (as the
+// journald receiver produces) is flattened so MESSAGE, PRIORITY and friends
+// are found like any other field.
+func decodeBodyProto(data []byte, out map[string]string) error {
+	body := map[string]string{}
+	if err := decodeAnyValueProto(data, "", body); err != nil {
+		return err
+	}
+	if s, ok := body[""]; ok {
+		out["message"] = s
+		return nil
+	}
+	for k, v := range body {
+		out[k] = v
+	}
+	return nil
+}
+
+func decodeKeyValueProto(data []byte, prefix string, out map[string]string) error {
+	var key string
+	var value []byte
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			key = string(b)
+		case 2:
+			value = b
+		}
+		return nil
+	})
+	if err != nil || value == nil {
+		return err
+	}
+	return decodeAnyValueProto(value, joinKey(prefix, key), out)
+}
+
+func decodeAnyValueProto(data []byte, key string, out map[string]string) error {
+	var items []string
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			out[key] = string(b)
+		case 2:
+			out[key] = strconv.FormatBool(v != 0)
+		case 3:
+			out[key] = strconv.FormatInt(int64(v), 10)
+		case 4:
+			out[key] = strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64)
+		case 5:
+			// ArrayValue { repeated AnyValue values = 1; }: rendered as a
+			// space-separated list of its scalar elements.
+			return eachField(b, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+				if num != 1 || typ != protowire.BytesType {
+					return nil
+				}
+				elem := map[string]string{}
+				if err := decodeAnyValueProto(b, "", elem); err != nil {
+					return err
+				}
+				if s, ok := elem[""]; ok {
+					items = append(items, s)
+				}
+				return nil
+			})
+		case 6:
+			// KeyValueList { repeated KeyValue values = 1; }
+			return eachField(b, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+				if num == 1 && typ == protowire.BytesType {
+					return decodeKeyValueProto(b, key, out)
+				}
+				return nil
+			})
+		case 7:
+			out[key] = base64.StdEncoding.EncodeToString(b)
+		}
+		return nil
+	})
+	if items != nil {
+		out[key] = strings.Join(items, " ")
+	}
+	return err
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// OTLP/JSON mirrors the protobuf with lowerCamelCase names; 64-bit integers
+// are encoded as strings, which json.Number accepts along with bare numbers.
+type otlpJSONRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			LogRecords []struct {
+				TimeUnixNano         json.Number        `json:"timeUnixNano"`
+				ObservedTimeUnixNano json.Number        `json:"observedTimeUnixNano"`
+				SeverityNumber       json.Number        `json:"severityNumber"`
+				SeverityText         string             `json:"severityText"`
+				Body                 *otlpJSONAnyValue  `json:"body"`
+				Attributes           []otlpJSONKeyValue `json:"attributes"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string           `json:"key"`
+	Value otlpJSONAnyValue `json:"value"`
+}
+
+type otlpJSONAnyValue struct {
+	StringValue *string      `json:"stringValue"`
+	BoolValue   *bool        `json:"boolValue"`
+	IntValue    *json.Number `json:"intValue"`
+	DoubleValue *float64     `json:"doubleValue"`
+	ArrayValue  *struct {
+		Values []otlpJSONAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []otlpJSONKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+	BytesValue *string `json:"bytesValue"`
+}
+
+func (a otlpJSONAnyValue) flatten(key string, out map[string]string) {
+	switch {
+	case a.StringValue != nil:
+		out[key] = *a.StringValue
+	case a.BoolValue != nil:
+		out[key] = strconv.FormatBool(*a.BoolValue)
+	case a.IntValue != nil:
+		out[key] = a.IntValue.String()
+	case a.DoubleValue != nil:
+		out[key] = strconv.FormatFloat(*a.DoubleValue, 'g', -1, 64)
+	case a.BytesValue != nil:
+		out[key] = *a.BytesValue
+	case a.ArrayValue != nil:
+		var items []string
+		for _, v := range a.ArrayValue.Values {
+			elem := map[string]string{}
+			v.flatten("", elem)
+			if s, ok := elem[""]; ok {
+				items = append(items, s)
+			}
+		}
+		out[key] = strings.Join(items, " ")
+	case a.KvlistValue != nil:
+		for _, kv := range a.KvlistValue.Values {
+			kv.Value.flatten(joinKey(key, kv.Key), out)
+		}
+	}
+}
+
+func decodeOTLPJSON(data []byte) ([]otlpLog, error) {
+	var req otlpJSONRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	var logs []otlpLog
+	for _, rl := range req.ResourceLogs {
+		resource := map[string]string{}
+		for _, kv := range rl.Resource.Attributes {
+			kv.Value.flatten(kv.Key, resource)
+		}
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				l := otlpLog{fields: make(map[string]string, len(resource)+4), severityText: lr.SeverityText}
+				for k, v := range resource {
+					l.fields[k] = v
+				}
+				for _, kv := range lr.Attributes {
+					kv.Value.flatten(kv.Key, l.fields)
+				}
+				if lr.Body != nil {
+					body := map[string]string{}
+					lr.Body.flatten("", body)
+					if s, ok := body[""]; ok {
+						l.fields["message"] = s
+					} else {
+						for k, v := range body {
+							l.fields[k] = v
+						}
+					}
+				}
+				l.timeNano, _ = strconv.ParseUint(lr.TimeUnixNano.String(), 10, 64)
+				l.observedNano, _ = strconv.ParseUint(lr.ObservedTimeUnixNano.String(), 10, 64)
+				sev, _ := strconv.Atoi(lr.SeverityNumber.String())
+				l.severity = sev
+				logs = append(logs, l)
+			}
+		}
+	}
+	return logs, nil
+}
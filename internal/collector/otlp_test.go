@@ -0,0 +1,137 @@
+// internal/collector/otlp_test.go
+package collector
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Helpers to hand-build OTLP protobuf messages field by field.
+func pbBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func pbString(num protowire.Number, s string) []byte {
+	return pbBytes(nil, num, []byte(s))
+}
+
+func pbKeyValue(key, value string) []byte {
+	return append(pbString(1, key), pbBytes(nil, 2, pbString(1, value))...)
+}
+
+func TestServeOTLPProtobuf(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+
+	ts := time.Date(2026, 2, 3, 12, 25, 1, 0, time.UTC)
+
+	// A filelog-style record: string body, severity number ERROR.
+	var rec1 []byte
+	rec1 = protowire.AppendTag(rec1, 1, protowire.Fixed64Type)
+	rec1 = protowire.AppendFixed64(rec1, uint64(ts.UnixNano()))
+	rec1 = protowire.AppendTag(rec1, 2, protowire.VarintType)
+	rec1 = protowire.AppendVarint(rec1, 17)
+	rec1 = pbBytes(rec1, 5, pbString(1, "EXT4-fs error (device sda1)"))
+
+	// A journald-receiver record: map body carrying journal fields, no
+	// severity number, only an observed timestamp.
+	var kvlist []byte
+	for _, kv := range [][2]string{{"MESSAGE", "mce: [Hardware Error]"}, {"PRIORITY", "2"}, {"_TRANSPORT", "kernel"}} {
+		kvlist = pbBytes(kvlist, 1, pbKeyValue(kv[0], kv[1]))
+	}
+	var rec2 []byte
+	rec2 = protowire.AppendTag(rec2, 11, protowire.Fixed64Type)
+	rec2 = protowire.AppendFixed64(rec2, uint64(ts.Add(time.Second).UnixNano()))
+	rec2 = pbBytes(rec2, 5, pbBytes(nil, 6, kvlist))
+
+	// A userspace journal record is dropped.
+	var kvlist3 []byte
+	for _, kv := range [][2]string{{"MESSAGE", "sshd started"}, {"_TRANSPORT", "syslog"}} {
+		kvlist3 = pbBytes(kvlist3, 1, pbKeyValue(kv[0], kv[1]))
+	}
+	rec3 := pbBytes(nil, 5, pbBytes(nil, 6, kvlist3))
+
+	scope := pbBytes(nil, 2, rec2)
+	scope = pbBytes(scope, 2, rec1)
+	scope = pbBytes(scope, 2, rec3)
+	// Scope before resource: the decoder must not depend on field order.
+	resourceLogs := pbBytes(nil, 2, scope)
+	resourceLogs = pbBytes(resourceLogs, 1, pbBytes(nil, 1, pbKeyValue("host.name", "web01")))
+	body := pbBytes(nil, 1, resourceLogs)
+
+	req := httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	handler.ServeOTLP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	results, _ := db.QueryByHostname("web01", 10)
+	if len(results) != 1 {
+		t.Fatalf("rows = %d, want 1", len(results))
+	}
+	want := "[2026-02-03T12:25:01Z] kern.err EXT4-fs error (device sda1)\n[2026-02-03T12:25:02Z] kern.crit mce: [Hardware Error]"
+	if results[0].RawDmesg != want || results[0].Source != otlpSource {
+		t.Errorf("row = %q/%q, want %q", results[0].Source, results[0].RawDmesg, want)
+	}
+}
+
+func TestServeOTLPJSON(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+
+	body := `{"resourceLogs": [{
+		"resource": {"attributes": [{"key": "host.name", "value": {"stringValue": "db01"}}]},
+		"scopeLogs": [{"logRecords": [{
+			"timeUnixNano": "1770121501000000000",
+			"severityNumber": 13,
+			"severityText": "WARN",
+			"body": {"stringValue": "nvme0: I/O timeout"},
+			"attributes": [{"key": "_KERNEL_SUBSYSTEM", "value": {"stringValue": "nvme"}}]
+		}]}]
+	}]}`
+	req := httptest.NewRequest("POST", "/v1/logs", bytes.NewReader([]byte(body)))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeOTLP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "{}" {
+		t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+	}
+
+	results, _ := db.QueryByHostname("db01", 10)
+	want := "[2026-02-03T12:25:01Z] kern.warning (nvme) nvme0: I/O timeout"
+	if len(results) != 1 || results[0].RawDmesg != want {
+		t.Errorf("rows = %+v, want one with %q", results, want)
+	}
+}
+
+func TestServeOTLPRejectsMalformed(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+
+	// A length prefix running past the end of the buffer.
+	req := httptest.NewRequest("POST", "/v1/logs", bytes.NewReader([]byte{0x0a, 0x7f, 0x01}))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	handler.ServeOTLP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
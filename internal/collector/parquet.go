@@ -0,0 +1,103 @@
+// internal/collector/parquet.go
+package collector
+
+import (
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Parquet exports are written with parquet-go: every column REQUIRED and
+// gzip-compressed, times as millisecond timestamps, and issues, verdicts
+// and suppressed issues with the JSON logical type. parquet-go orders a
+// schema's columns by name, so they don't follow resultFields as CSV does.
+
+const (
+	// A row group is written out once it holds this many rows or bytes.
+	parquetGroupRows  = 10000
+	parquetGroupBytes = 64 << 20
+)
+
+// parquetSchema is resultFields as a Parquet schema; parquetColumns gives
+// each of its columns' index in resultFields.
+var parquetSchema, parquetColumns = func() (*parquet.Schema, []int) {
+	group := parquet.Group{}
+	index := map[string]int{}
+	for i, f := range resultFields {
+		group[f.name] = parquetNode(f)
+		index[f.name] = i
+	}
+	schema := parquet.NewSchema("result", group)
+	var columns []int
+	for _, path := range schema.Columns() {
+		columns = append(columns, index[path[0]])
+	}
+	return schema, columns
+}()
+
+// parquetNode returns a field's column type.
+func parquetNode(f resultField) parquet.Node {
+	switch f.kind {
+	case fieldInt:
+		return parquet.Int(64)
+	case fieldTime:
+		return parquet.Timestamp(parquet.Millisecond)
+	case fieldBool:
+		return parquet.Leaf(parquet.BooleanType)
+	}
+	switch f.name {
+	case "issues", "verdicts", "suppressed":
+		return parquet.JSON()
+	}
+	return parquet.String()
+}
+
+type parquetWriter struct {
+	w     *parquet.Writer
+	row   parquet.Row
+	rows  int // in the row group being gathered
+	bytes int
+}
+
+func newParquetWriter(w io.Writer) (*parquetWriter, error) {
+	return &parquetWriter{w: parquet.NewWriter(w, parquetSchema,
+		parquet.Compression(&parquet.Gzip),
+		parquet.CreatedBy("tasseograph", "", ""),
+	)}, nil
+}
+
+func (pw *parquetWriter) Write(r *protocol.StoredResult) error {
+	pw.row = pw.row[:0]
+	for col, i := range parquetColumns {
+		var v parquet.Value
+		switch x := resultFields[i].get(r).(type) {
+		case int64:
+			v = parquet.Int64Value(x)
+		case time.Time:
+			v = parquet.Int64Value(x.UnixMilli())
+		case string:
+			v = parquet.ByteArrayValue([]byte(x))
+		case bool:
+			v = parquet.BooleanValue(x)
+		}
+		pw.row = append(pw.row, v.Level(0, 0, col))
+	}
+	if _, err := pw.w.WriteRows([]parquet.Row{pw.row}); err != nil {
+		return err
+	}
+	pw.rows++
+	pw.bytes += len(r.RawDmesg)
+	if pw.rows >= parquetGroupRows || pw.bytes >= parquetGroupBytes {
+		pw.rows, pw.bytes = 0, 0
+		return pw.w.Flush()
+	}
+	return nil
+}
+
+// Close writes the last row group and the footer.
+func (pw *parquetWriter) Close() error {
+	return pw.w.Close()
+}
@@ -0,0 +1,90 @@
+// internal/collector/parquet_test.go
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestParquetWriter(t *testing.T) {
+	ts := time.Date(2026, 5, 12, 10, 0, 0, 0, time.UTC)
+	const rows = parquetGroupRows + 5
+	var buf bytes.Buffer
+	w, err := NewResultWriter(&buf, FormatParquet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		r := protocol.StoredResult{ID: int64(i + 1), Timestamp: ts, Hostname: fmt.Sprintf("web-%d", i), Status: "ok", Silenced: i%3 == 0,
+			Issues: []protocol.Issue{{Summary: "link flap"}}}
+		if err := w.Write(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.NumRows() != rows {
+		t.Errorf("num_rows = %d, want %d", f.NumRows(), rows)
+	}
+	groups := f.RowGroups()
+	if len(groups) != 2 || groups[1].NumRows() != 5 {
+		t.Fatalf("row groups = %d, want %d rows then 5", len(groups), parquetGroupRows)
+	}
+	for _, field := range resultFields {
+		col, ok := f.Schema().Lookup(field.name)
+		if !ok {
+			t.Fatalf("no column %s", field.name)
+		}
+		if !col.Node.Required() {
+			t.Errorf("%s is not REQUIRED", field.name)
+		}
+	}
+	for name, want := range map[string]string{"timestamp": "TIMESTAMP", "issues": "JSON", "hostname": "STRING"} {
+		col, _ := f.Schema().Lookup(name)
+		if lt := col.Node.Type().LogicalType(); lt == nil || !strings.Contains(lt.String(), want) {
+			t.Errorf("%s logical type = %v, want %s", name, lt, want)
+		}
+	}
+
+	read := make([]parquet.Row, 3)
+	rr := parquet.NewReader(bytes.NewReader(buf.Bytes()), parquetSchema)
+	defer rr.Close()
+	if n, err := rr.ReadRows(read); n != len(read) && err != io.EOF {
+		t.Fatalf("read %d rows: %v", n, err)
+	}
+	value := func(row parquet.Row, name string) parquet.Value {
+		col, _ := parquetSchema.Lookup(name)
+		return row[col.ColumnIndex]
+	}
+	if id := value(read[1], "id").Int64(); id != 2 {
+		t.Errorf("second id = %d", id)
+	}
+	if ms := value(read[0], "timestamp").Int64(); ms != ts.UnixMilli() {
+		t.Errorf("timestamp = %d ms", ms)
+	}
+	if host := value(read[0], "hostname").String(); host != "web-0" {
+		t.Errorf("first hostname = %q", host)
+	}
+	if issues := value(read[0], "issues").ByteArray(); !bytes.Contains(issues, []byte(`"summary":"link flap"`)) {
+		t.Errorf("issues = %q", issues)
+	}
+	for i, want := range []bool{true, false, false} {
+		if got := value(read[i], "silenced").Boolean(); got != want {
+			t.Errorf("row %d silenced = %v, want %v", i, got, want)
+		}
+	}
+}
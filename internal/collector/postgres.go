@@ -0,0 +1,155 @@
+// internal/collector/postgres.go
+package collector
+
+import (
+	"database/sql"
+	"errors"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PGStore is the PostgreSQL Store, which several collectors can share. It
+// runs the same statements as DB on the same column layout, so rows mean
+// the same thing on either backend.
+type PGStore struct {
+	sqlStore
+}
+
+// pgSchema is the SQLite schema at version 9 in PostgreSQL's types.
+// Timestamps stay RFC3339 text, collated bytewise so they compare the
+// way they do in SQLite whatever the database's locale.
+var pgSchema = `
+CREATE TABLE IF NOT EXISTS results (
+	id BIGSERIAL PRIMARY KEY,
+	timestamp TEXT COLLATE "C" NOT NULL,
+	hostname TEXT NOT NULL,
+	status TEXT NOT NULL,
+	issues TEXT,
+	raw_dmesg TEXT,
+	api_latency_ms BIGINT,
+	provider TEXT,
+	model TEXT,
+	source TEXT,
+	error_class TEXT,
+	verdicts TEXT,
+	suppressed TEXT,
+	silenced BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TEXT COLLATE "C" DEFAULT ` + nowDefault(true) + `
+);
+CREATE INDEX IF NOT EXISTS idx_results_hostname ON results(hostname);
+CREATE INDEX IF NOT EXISTS idx_results_status ON results(status);
+CREATE INDEX IF NOT EXISTS idx_results_timestamp ON results(timestamp);
+
+CREATE TABLE IF NOT EXISTS metrics (
+	id BIGSERIAL PRIMARY KEY,
+	hostname TEXT NOT NULL,
+	timestamp TEXT COLLATE "C" NOT NULL,
+	series TEXT NOT NULL,
+	name TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	labels TEXT,
+	value DOUBLE PRECISION NOT NULL,
+	created_at TEXT COLLATE "C" DEFAULT ` + nowDefault(true) + `
+);
+CREATE INDEX IF NOT EXISTS idx_metrics_series ON metrics(hostname, series, timestamp);
+
+CREATE TABLE IF NOT EXISTS smart_snapshots (
+	id BIGSERIAL PRIMARY KEY,
+	hostname TEXT NOT NULL,
+	timestamp TEXT COLLATE "C" NOT NULL,
+	serial TEXT NOT NULL,
+	device TEXT,
+	model TEXT,
+	protocol TEXT,
+	critical_warning BIGINT,
+	media_errors BIGINT,
+	percentage_used BIGINT,
+	available_spare BIGINT,
+	snapshot TEXT NOT NULL,
+	created_at TEXT COLLATE "C" DEFAULT ` + nowDefault(true) + `
+);
+CREATE INDEX IF NOT EXISTS idx_smart_serial ON smart_snapshots(hostname, serial, timestamp);
+
+CREATE TABLE IF NOT EXISTS labels (
+	id BIGSERIAL PRIMARY KEY,
+	result_id BIGINT NOT NULL,
+	issue INTEGER,
+	verdict TEXT NOT NULL,
+	severity TEXT,
+	note TEXT,
+	author TEXT,
+	hostname TEXT NOT NULL,
+	status TEXT NOT NULL,
+	issues TEXT NOT NULL,
+	raw_dmesg TEXT,
+	created_at TEXT COLLATE "C" DEFAULT ` + nowDefault(true) + `
+);
+CREATE INDEX IF NOT EXISTS idx_labels_result ON labels(result_id);
+
+CREATE TABLE IF NOT EXISTS suppressions (
+	signature TEXT PRIMARY KEY,
+	example TEXT,
+	false_positives INTEGER NOT NULL,
+	created_at TEXT COLLATE "C" DEFAULT ` + nowDefault(true) + `
+);
+
+CREATE TABLE IF NOT EXISTS silences (
+	id BIGSERIAL PRIMARY KEY,
+	hostname TEXT,
+	category TEXT,
+	summary TEXT,
+	starts_at TEXT COLLATE "C" NOT NULL,
+	ends_at TEXT COLLATE "C" NOT NULL,
+	reason TEXT NOT NULL,
+	author TEXT,
+	created_at TEXT COLLATE "C" DEFAULT ` + nowDefault(true) + `
+);
+CREATE INDEX IF NOT EXISTS idx_silences_ends_at ON silences(ends_at);
+`
+
+// pgMigrations is the PostgreSQL schema's history, numbered on its own:
+// PostgreSQL support starts from the SQLite schema's version 9. Append
+// only, like migrations.
+var pgMigrations = []Migration{
+	{1, "initial schema", execMigration(pgSchema)},
+	{2, "full-text search", execMigration(pgSearchSchema)},
+	{3, "compressed dmesg blobs", execMigration(pgDmesgSchema + pgStoredSearchSchema)},
+}
+
+// NewPGStore connects to the PostgreSQL database at url (a postgres://
+// URL or a libpq key=value string; the password may come from PGPASSWORD
+// or ~/.pgpass) and migrates its schema to the latest version.
+func NewPGStore(url string) (*PGStore, error) {
+	if url == "" {
+		return nil, errors.New("no PostgreSQL URL")
+	}
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &PGStore{sqlStore{db: db, postgres: true}}
+	if _, _, err := s.migrate(pgMigrations, pgMigrations[len(pgMigrations)-1].Version, false); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// MigratePostgres is MigrateDB for a PostgreSQL database.
+func MigratePostgres(url string, to int, dryRun bool) (from int, ran []Migration, err error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer db.Close()
+	latest := pgMigrations[len(pgMigrations)-1].Version
+	if to == 0 {
+		to = latest
+	}
+	return (&sqlStore{db: db, postgres: true}).migrate(pgMigrations, to, dryRun)
+}
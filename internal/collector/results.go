@@ -0,0 +1,50 @@
+// internal/collector/results.go
+package collector
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResultsHandler serves GET /api/results/{id}: one stored result, as JSON.
+// It takes the agents' bearer token, so a browser following a digest link
+// here gets a 401; result_url should point at a page that holds the token.
+type ResultsHandler struct {
+	db     Store
+	apiKey string
+}
+
+// NewResultsHandler creates the results API handler.
+func NewResultsHandler(db Store, apiKey string) *ResultsHandler {
+	return &ResultsHandler{db: db, apiKey: apiKey}
+}
+
+func (h *ResultsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.apiKey) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/results/"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid result id", http.StatusBadRequest)
+		return
+	}
+	result, err := h.db.QueryResult(id)
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if result == nil {
+		http.Error(w, "No such result", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
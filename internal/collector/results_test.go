@@ -0,0 +1,55 @@
+// internal/collector/results_test.go
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestResultsHandler(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	r := protocol.StoredResult{Timestamp: time.Date(2026, 5, 12, 10, 0, 0, 0, time.UTC), Hostname: "web-1", Status: "critical",
+		Issues: []protocol.Issue{{Summary: "PCIe fatal error"}}}
+	if err := db.InsertResult(&r); err != nil {
+		t.Fatal(err)
+	}
+	h := NewResultsHandler(db, "secret")
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/results/1", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET: %d %s", rec.Code, rec.Body)
+	}
+	var got protocol.StoredResult
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.ID != 1 || got.Hostname != "web-1" || len(got.Issues) != 1 {
+		t.Errorf("GET = %+v", got)
+	}
+	for path, code := range map[string]int{"/api/results/2": http.StatusNotFound, "/api/results/x": http.StatusBadRequest} {
+		if rec := get(path, "secret"); rec.Code != code {
+			t.Errorf("GET %s: %d, want %d", path, rec.Code, code)
+		}
+	}
+	if rec := get("/api/results/1", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,180 @@
+// internal/collector/retention.go
+package collector
+
+import (
+	"database/sql"
+
+	"github.com/signalnine/tasseograph/internal/config"
+)
+
+// hasDmesg is true for a result that still has dmesg text, inline or in
+// blobs.
+const hasDmesg = `(raw_dmesg IS NOT NULL OR EXISTS (SELECT 1 FROM result_dmesg WHERE result_dmesg.result_id = results.id))`
+
+// PruneStats reports a Prune run.
+type PruneStats struct {
+	Deleted   int64 // rows deleted: results, hardware metrics and SMART snapshots
+	Dropped   int64 // results whose dmesg text was dropped
+	Archived  int64 // results archived before either
+	Reclaimed int64 // bytes the database shrank by
+}
+
+// Prune applies the retention rules to results, then deletes the results
+// of statuses without a delete rule, and the hardware history, whose
+// created_at is more than days old (days <= 0 keeps them). With an archive,
+// results are archived before they are deleted or lose their text. It
+// finishes by dropping orphaned dmesg blobs and an incremental vacuum.
+func (d *sqlStore) Prune(days int, rules []config.RetentionRule, archive *Archiver) (PruneStats, error) {
+	var stats PruneStats
+	before, err := d.size()
+	if err != nil {
+		return stats, err
+	}
+
+	// prune archives, then deletes or drops the dmesg of, the results
+	// matching cond.
+	prune := func(action, cond string, args ...interface{}) error {
+		if action == config.RetentionDropDmesg {
+			n, err := d.archiveResults(archive, cond+` AND `+hasDmesg, args...)
+			stats.Archived += n
+			if err != nil {
+				return err
+			}
+			n, err = d.dropDmesg(cond, args...)
+			stats.Dropped += n
+			return err
+		}
+		n, err := d.archiveResults(archive, cond, args...)
+		stats.Archived += n
+		if err != nil {
+			return err
+		}
+		n, err = d.deleteResults(cond, args...)
+		stats.Deleted += n
+		return err
+	}
+
+	deleteRule := map[string]bool{}
+	for _, r := range rules {
+		if r.Action == config.RetentionDelete {
+			deleteRule[r.Status] = true
+		}
+		if err := prune(r.Action, `status = ? AND created_at < ?`, r.Status, createdAtCutoff(r.Days)); err != nil {
+			return stats, err
+		}
+	}
+
+	if days > 0 {
+		cutoff := createdAtCutoff(days)
+		cond, args := `created_at < ?`, []interface{}{cutoff}
+		for status := range deleteRule {
+			cond += ` AND status != ?`
+			args = append(args, status)
+		}
+		if err := prune(config.RetentionDelete, cond, args...); err != nil {
+			return stats, err
+		}
+		for _, table := range []string{"metrics", "smart_snapshots"} {
+			res, err := d.exec(`DELETE FROM `+table+` WHERE created_at < ?`, cutoff)
+			if err != nil {
+				return stats, err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return stats, err
+			}
+			stats.Deleted += n
+		}
+	}
+
+	if _, err := d.dropOrphanBlobs(); err != nil {
+		return stats, err
+	}
+	if err := d.vacuumIncremental(); err != nil {
+		return stats, err
+	}
+	after, err := d.size()
+	if err != nil {
+		return stats, err
+	}
+	stats.Reclaimed = max(0, before-after)
+	return stats, nil
+}
+
+// deleteResults deletes the results matching cond, with their links to
+// dmesg blobs, and returns how many it deleted.
+func (d *sqlStore) deleteResults(cond string, args ...interface{}) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(d.rebind(`DELETE FROM result_dmesg WHERE result_id IN (SELECT id FROM results WHERE `+cond+`)`), args...); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(d.rebind(`DELETE FROM results WHERE `+cond), args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// dropDmesg removes the dmesg text of the results matching cond, leaving
+// the rows (and their issues) for the statistics and for search, and
+// returns how many results lost text.
+func (d *sqlStore) dropDmesg(cond string, args ...interface{}) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Reindex first: afterwards there's no telling which rows had text.
+	var res sql.Result
+	if d.postgres {
+		res, err = tx.Exec(d.rebind(`UPDATE results SET search = to_tsvector('simple', `+pgIssueTextSQL+`) WHERE `+cond+` AND `+hasDmesg), args...)
+	} else {
+		if _, err = tx.Exec(`DELETE FROM results_fts WHERE rowid IN (SELECT id FROM results WHERE `+cond+` AND `+hasDmesg+`)`, args...); err != nil {
+			return 0, err
+		}
+		res, err = tx.Exec(`INSERT INTO results_fts (rowid, dmesg, issues) SELECT id, '', `+searchIssuesSQL("issues")+` FROM results WHERE `+cond+` AND `+hasDmesg, args...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(d.rebind(`UPDATE results SET raw_dmesg = NULL WHERE `+cond+` AND raw_dmesg IS NOT NULL`), args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(d.rebind(`DELETE FROM result_dmesg WHERE result_id IN (SELECT id FROM results WHERE `+cond+`)`), args...); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// vacuumIncremental hands pages freed by a prune back to the filesystem.
+// On SQLite that needs auto_vacuum = INCREMENTAL, which NewDB sets on new
+// databases and Compact on older ones; PostgreSQL's VACUUM makes the space
+// reusable, and returns it only from the end of a table.
+func (d *sqlStore) vacuumIncremental() error {
+	if d.postgres {
+		_, err := d.db.Exec(`VACUUM results, result_dmesg, dmesg_blobs, metrics, smart_snapshots`)
+		return err
+	}
+	// incremental_vacuum frees a page per step: read it to the end.
+	rows, err := d.db.Query(`PRAGMA incremental_vacuum`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
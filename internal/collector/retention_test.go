@@ -0,0 +1,90 @@
+// internal/collector/retention_test.go
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func autoVacuum(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var mode int
+	if err := db.QueryRow(`PRAGMA auto_vacuum`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	return mode
+}
+
+// TestPruneReclaimsSpace checks a prune shrinks the SQLite file, not just
+// frees pages inside it.
+func TestPruneReclaimsSpace(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if mode := autoVacuum(t, db.db); mode != 2 {
+		t.Fatalf("auto_vacuum = %d on a new database, want 2 (incremental)", mode)
+	}
+	for i := 0; i < 100; i++ {
+		var lines []string
+		for j := 0; j < 100; j++ {
+			lines = append(lines, fmt.Sprintf("[%d.%03d] nvme nvme%d: I/O %d QID %d timeout, aborting", i, j, i, i*100+j, j%8))
+		}
+		r := protocol.StoredResult{Timestamp: time.Now().UTC(), Hostname: "h", Status: "ok", RawDmesg: strings.Join(lines, "\n")}
+		if err := db.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.exec(`UPDATE results SET created_at = ?`, "2000-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.Prune(0, []config.RetentionRule{{Status: "ok", Days: 7, Action: config.RetentionDropDmesg}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Dropped != 100 || stats.Reclaimed <= 0 {
+		t.Errorf("Prune = %+v, want 100 dropped and bytes reclaimed", stats)
+	}
+	var blobs int
+	if err := db.queryRow(`SELECT COUNT(*) FROM dmesg_blobs`).Scan(&blobs); err != nil || blobs != 0 {
+		t.Errorf("%d blobs left (%v)", blobs, err)
+	}
+}
+
+// TestCompactEnablesIncrementalVacuum checks Compact converts a database
+// created before incremental auto-vacuum.
+func TestCompactEnablesIncrementalVacuum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := migrate(raw, latestSchemaVersion(), false); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if mode := autoVacuum(t, db.db); mode != 0 {
+		t.Fatalf("auto_vacuum = %d before compact, want 0", mode)
+	}
+	if _, err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if mode := autoVacuum(t, db.db); mode != 2 {
+		t.Errorf("auto_vacuum = %d after compact, want 2", mode)
+	}
+}
@@ -0,0 +1,385 @@
+// internal/collector/search.go
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Full-text search covers each result's dmesg lines and its issues'
+// summaries and evidence. SQLite indexes them in an FTS5 table,
+// results_fts, that keeps no copy of the text (that is in the dmesg blobs);
+// PostgreSQL in a tsvector column, results.search. InsertResult adds to
+// either, and a trigger or the row's deletion takes results away again.
+// Snippets are cut from the stored text in Go, the same way on both.
+
+// searchIssuesSQL is the SQLite expression for the searchable text of an
+// issues column: every summary and evidence, space separated. Anything
+// that isn't a JSON array contributes nothing rather than failing the
+// write.
+func searchIssuesSQL(col string) string {
+	return `COALESCE((SELECT group_concat(COALESCE(json_extract(value, '$.summary'), '') || ' ' || COALESCE(json_extract(value, '$.evidence'), ''), ' ')
+		FROM json_each(CASE WHEN json_valid(` + col + `) AND json_type(` + col + `) = 'array' THEN ` + col + ` END)), '')`
+}
+
+// searchSchema was the first SQLite search index, which kept its own copy
+// of the text and was filled by triggers. Migration 11 replaces it with
+// contentlessSearchSchema.
+var searchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS results_fts USING fts5(dmesg, issues, tokenize = 'unicode61');
+
+CREATE TRIGGER IF NOT EXISTS results_fts_insert AFTER INSERT ON results BEGIN
+	INSERT INTO results_fts (rowid, dmesg, issues)
+	VALUES (new.id, COALESCE(new.raw_dmesg, ''), ` + searchIssuesSQL("new.issues") + `);
+END;
+CREATE TRIGGER IF NOT EXISTS results_fts_delete AFTER DELETE ON results BEGIN
+	DELETE FROM results_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS results_fts_update AFTER UPDATE OF raw_dmesg, issues ON results BEGIN
+	DELETE FROM results_fts WHERE rowid = old.id;
+	INSERT INTO results_fts (rowid, dmesg, issues)
+	VALUES (new.id, COALESCE(new.raw_dmesg, ''), ` + searchIssuesSQL("new.issues") + `);
+END;
+
+DELETE FROM results_fts;
+INSERT INTO results_fts (rowid, dmesg, issues)
+SELECT id, COALESCE(raw_dmesg, ''), ` + searchIssuesSQL("issues") + ` FROM results;
+`
+
+// contentlessSearchSchema rebuilds the SQLite index without a copy of the
+// text. Results are indexed by InsertResult; only deletion is left to a
+// trigger. It runs before any result's text has moved to blobs.
+var contentlessSearchSchema = `
+DROP TRIGGER IF EXISTS results_fts_insert;
+DROP TRIGGER IF EXISTS results_fts_update;
+DROP TRIGGER IF EXISTS results_fts_delete;
+DROP TABLE IF EXISTS results_fts;
+CREATE VIRTUAL TABLE results_fts USING fts5(dmesg, issues, tokenize = 'unicode61', content = '', contentless_delete = 1);
+
+CREATE TRIGGER results_fts_delete AFTER DELETE ON results BEGIN
+	DELETE FROM results_fts WHERE rowid = old.id;
+END;
+
+INSERT INTO results_fts (rowid, dmesg, issues)
+SELECT id, COALESCE(raw_dmesg, ''), ` + searchIssuesSQL("issues") + ` FROM results;
+`
+
+// pgSearchSchema is searchSchema for PostgreSQL. to_tsvector over jsonb
+// indexes the issues' string values, not their keys.
+const pgSearchSchema = `
+ALTER TABLE results ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	to_tsvector('simple', COALESCE(raw_dmesg, '')) ||
+	to_tsvector('simple', COALESCE(NULLIF(issues, '')::jsonb, '[]'::jsonb))
+) STORED;
+CREATE INDEX idx_results_search ON results USING GIN (search);
+`
+
+// pgIssueTextSQL is searchIssuesSQL for PostgreSQL, over results.issues.
+const pgIssueTextSQL = `COALESCE((
+	SELECT string_agg(COALESCE(i->>'summary', '') || ' ' || COALESCE(i->>'evidence', ''), ' ')
+	FROM jsonb_array_elements(CASE WHEN jsonb_typeof(NULLIF(issues, '')::jsonb) = 'array' THEN issues::jsonb ELSE '[]'::jsonb END) AS i
+), '')`
+
+// pgStoredSearchSchema makes results.search an ordinary column, which
+// InsertResult fills in, since raw_dmesg no longer holds the text.
+const pgStoredSearchSchema = `
+ALTER TABLE results DROP COLUMN search;
+ALTER TABLE results ADD COLUMN search tsvector;
+UPDATE results SET search = to_tsvector('simple', COALESCE(raw_dmesg, '') || ' ' || ` + pgIssueTextSQL + `);
+CREATE INDEX idx_results_search ON results USING GIN (search);
+`
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+)
+
+// ErrInvalidSearch is wrapped by Search's errors for queries that can't
+// be run.
+var ErrInvalidSearch = errors.New("invalid search")
+
+// SearchQuery selects results by the words in their dmesg lines and
+// issues. Words must all appear; a double-quoted phrase must appear as
+// written. Punctuation only separates words, so `AER: Uncorrected` finds
+// "AER: Uncorrected (Non-Fatal)". Hostname, Since and Until narrow the
+// search when set.
+type SearchQuery struct {
+	Query    string
+	Hostname string
+	Since    time.Time
+	Until    time.Time
+	Limit    int // 0 means defaultSearchLimit
+}
+
+// SearchHit is a result that matched a search. Snippet is the text around
+// the matches, with each match wrapped in ** and elided text shown as ...
+type SearchHit struct {
+	ResultID  int64     `json:"result_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Hostname  string    `json:"hostname"`
+	Status    string    `json:"status"`
+	Snippet   string    `json:"snippet"`
+}
+
+// searchTerms splits a query into its quoted phrases and bare words.
+// Terms without a letter or digit are dropped: they can't match anything.
+func searchTerms(q string) []string {
+	var terms []string
+	add := func(t string) {
+		t = strings.Join(strings.Fields(t), " ")
+		if strings.IndexFunc(t, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			terms = append(terms, t)
+		}
+	}
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			add(part)
+			continue
+		}
+		for _, w := range strings.Fields(part) {
+			add(w)
+		}
+	}
+	return terms
+}
+
+// matchExpr renders terms as a query both FTS5 MATCH and PostgreSQL's
+// websearch_to_tsquery read the same way: each term a quoted phrase, all
+// of them required. Quoting keeps the user's text from being read as
+// operators (AND, OR, NEAR, -, column filters).
+func matchExpr(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + t + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// issueText is the searchable text of issues: every summary and
+// evidence, space separated.
+func issueText(issues []protocol.Issue) string {
+	var parts []string
+	for _, issue := range issues {
+		parts = append(parts, issue.Summary, issue.Evidence)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Search returns the results matching q, newest first.
+func (d *sqlStore) Search(q SearchQuery) ([]SearchHit, error) {
+	terms := searchTerms(q.Query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: query has no words to search for", ErrInvalidSearch)
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return nil, fmt.Errorf("%w: until must be after since", ErrInvalidSearch)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	query := `SELECT ` + resultColumns + ` FROM results WHERE id IN (SELECT rowid FROM results_fts WHERE results_fts MATCH ?)`
+	if d.postgres {
+		query = `SELECT ` + resultColumns + ` FROM results WHERE search @@ websearch_to_tsquery('simple', ?)`
+	}
+	args := []interface{}{matchExpr(terms)}
+	if q.Hostname != "" {
+		query += ` AND hostname = ?`
+		args = append(args, q.Hostname)
+	}
+	if !q.Since.IsZero() {
+		query += ` AND timestamp >= ?`
+		args = append(args, q.Since.UTC().Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		query += ` AND timestamp < ?`
+		args = append(args, q.Until.UTC().Format(time.RFC3339))
+	}
+	query += ` ORDER BY timestamp DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results, err := d.scanResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []SearchHit
+	for _, r := range results {
+		out = append(out, SearchHit{
+			ResultID:  r.ID,
+			Timestamp: r.Timestamp,
+			Hostname:  r.Hostname,
+			Status:    r.Status,
+			Snippet:   snippet(r.RawDmesg+"\n"+issueText(r.Issues), terms),
+		})
+	}
+	return out, nil
+}
+
+const (
+	// snippetWords is how many words a snippet shows, snippetLead how
+	// many of them come before the first match.
+	snippetWords = 16
+	snippetLead  = 4
+)
+
+// searchToken is a word of text, at text[start:end].
+type searchToken struct{ start, end int }
+
+// searchTokens splits s into words the way the index does: runs of
+// letters and digits.
+func searchTokens(s string) []searchToken {
+	var toks []searchToken
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			toks = append(toks, searchToken{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		toks = append(toks, searchToken{start, len(s)})
+	}
+	return toks
+}
+
+// snippet cuts the words around the first match of terms out of text,
+// wraps the matches in ** and marks elided text with ... It is on one
+// line: dmesg's newlines would break up the output.
+func snippet(text string, terms []string) string {
+	toks := searchTokens(text)
+	matched := make([]bool, len(toks))
+	first := -1
+	for _, term := range terms {
+		termToks := searchTokens(term)
+		for i := 0; i+len(termToks) <= len(toks); i++ {
+			ok := true
+			for j, tt := range termToks {
+				if !strings.EqualFold(text[toks[i+j].start:toks[i+j].end], term[tt.start:tt.end]) {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			for j := range termToks {
+				matched[i+j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if len(toks) == 0 {
+		return ""
+	}
+
+	from := max(0, min(first-snippetLead, len(toks)-snippetWords))
+	to := min(len(toks), from+snippetWords)
+	var sb strings.Builder
+	if from > 0 {
+		sb.WriteString("...")
+	}
+	for i := from; i < to; i++ {
+		if i > from {
+			sb.WriteString(text[toks[i-1].end:toks[i].start])
+		} else if from == 0 {
+			sb.WriteString(text[:toks[i].start])
+		}
+		if matched[i] && (i == from || !matched[i-1]) {
+			sb.WriteString("**")
+		}
+		sb.WriteString(text[toks[i].start:toks[i].end])
+		if matched[i] && (i == to-1 || !matched[i+1]) {
+			sb.WriteString("**")
+		}
+	}
+	if to < len(toks) {
+		sb.WriteString("...")
+	} else {
+		sb.WriteString(text[toks[to-1].end:])
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// SearchHandler serves GET /api/search?q=...&host=...&since=...&until=...&limit=...
+// with since and until as RFC3339 times. It takes the agents' bearer
+// token.
+type SearchHandler struct {
+	db     Store
+	apiKey string
+}
+
+// NewSearchHandler creates the search API handler.
+func NewSearchHandler(db Store, apiKey string) *SearchHandler {
+	return &SearchHandler{db: db, apiKey: apiKey}
+}
+
+func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.apiKey) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	q := SearchQuery{Query: params.Get("q"), Hostname: params.Get("host")}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		v := params.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, p.name+" must be an RFC3339 time", http.StatusBadRequest)
+			return
+		}
+		*p.dst = t
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		q.Limit = n
+	}
+
+	hits, err := h.db.Search(q)
+	if err != nil {
+		if errors.Is(err, ErrInvalidSearch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"hits": nonNil(hits)})
+}
@@ -0,0 +1,141 @@
+// internal/collector/search_test.go
+package collector
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestSearchTerms(t *testing.T) {
+	for q, want := range map[string][]string{
+		`AER: Uncorrected`:             {"AER:", "Uncorrected"},
+		`"AER:   Uncorrected" eth0`:    {"AER: Uncorrected", "eth0"},
+		`unterminated "phrase here`:    {"unterminated", "phrase here"},
+		`-- :: "" NEAR(a b) col:x`:     {"NEAR(a", "b)", "col:x"},
+		`  `:                           nil,
+		`Ошибка "ядро 5"`:              {"Ошибка", "ядро 5"},
+		`"say ""hi"" twice" quoted"ok`: {"say", "hi", "twice", "quoted", "ok"},
+	} {
+		if got := searchTerms(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("searchTerms(%q) = %q, want %q", q, got, want)
+		}
+	}
+	if got := matchExpr([]string{"AER:", "link up"}); got != `"AER:" "link up"` {
+		t.Errorf("matchExpr = %s", got)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	line := "[12.5] pcieport 0000:00:1c.0: AER: Uncorrected (Fatal) error received: 0000:00:1c.0"
+	long := strings.Repeat("eth0: link up\n", 10) + line + "\n" + strings.Repeat("eth0: link down\n", 10)
+	for _, tc := range []struct {
+		text  string
+		terms []string
+		want  string
+	}{
+		{line, []string{"aer: uncorrected"}, "[12.5] pcieport 0000:00:1c.0: **AER: Uncorrected** (Fatal) error received: 0000:00:1c.0"},
+		{line, []string{"fatal", "pcieport"}, "[12.5] **pcieport** 0000:00:1c.0: AER: Uncorrected (**Fatal**) error received: 0000:00:1c.0"},
+		{long, []string{"uncorrected"}, "...00:1c.0: AER: **Uncorrected** (Fatal) error received: 0000:00:1c.0 eth0: link down eth0..."},
+		{line, []string{"absent"}, line},
+		{"", []string{"aer"}, ""},
+	} {
+		if got := snippet(tc.text, tc.terms); got != tc.want {
+			t.Errorf("snippet(%.30q, %q) =\n%s\nwant\n%s", tc.text, tc.terms, got, tc.want)
+		}
+	}
+}
+
+// TestSearchIndexesExistingResults checks the migration that adds search
+// indexes the results already in the database.
+func TestSearchIndexesExistingResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if _, _, err := MigrateDB(path, 9, false); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issues := range []string{`[{"summary": "NVMe controller reset", "evidence": "nvme0: resetting controller"}]`, `not json`, `{"summary": "not a list"}`} {
+		if _, err := raw.Exec(`INSERT INTO results (timestamp, hostname, status, issues, raw_dmesg) VALUES (?, 'old', 'warning', ?, 'nvme0: I/O timeout')`,
+			time.Now().UTC().Format(time.RFC3339), issues); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	hits, err := db.Search(SearchQuery{Query: "controller reset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].ResultID != 1 {
+		t.Errorf("issue search = %+v, want result 1", hits)
+	}
+	if hits, _ := db.Search(SearchQuery{Query: "timeout"}); len(hits) != 3 {
+		t.Errorf("dmesg search found %d results, want 3", len(hits))
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ts := time.Date(2026, 5, 12, 10, 0, 0, 0, time.UTC)
+	for _, host := range []string{"web-1", "web-2"} {
+		r := protocol.StoredResult{Timestamp: ts, Hostname: host, Status: "critical", RawDmesg: "pcieport 0000:00:1c.0: AER: Uncorrected (Fatal) error received"}
+		if err := db.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewSearchHandler(db, "secret")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/search?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("q=%22AER%3A+Uncorrected%22&host=web-2&since=2026-05-12T00:00:00Z&until=2026-05-13T00:00:00Z")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET: %d %s", rec.Code, rec.Body)
+	}
+	var resp struct{ Hits []SearchHit }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Hits) != 1 || resp.Hits[0].ResultID != 2 || !strings.Contains(resp.Hits[0].Snippet, "**AER") {
+		t.Errorf("GET = %+v", resp)
+	}
+
+	if rec := get("q=nothing+like+this"); !strings.Contains(rec.Body.String(), `"hits":[]`) {
+		t.Errorf("no hits: %s", rec.Body)
+	}
+	for _, query := range []string{"", "q=%3A%3A", "q=aer&since=yesterday", "q=aer&limit=0"} {
+		if rec := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET ?%s: %d, want 400", query, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/search?q=aer", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: %d, want 401", rec.Code)
+	}
+}
@@ -15,34 +15,77 @@ import (
 
 // Server is the central collector
 type Server struct {
-	cfg    *config.CollectorConfig
-	db     *DB
-	llm    *LLMClient
-	server *http.Server
+	cfg      *config.CollectorConfig
+	db       Store
+	llm      *LLMClient
+	batcher  *Batcher
+	feedback *feedback
+	ingest   *IngestHandler
+	server   *http.Server
 }
 
-// NewServer creates a new collector server
-func NewServer(cfg *config.CollectorConfig) (*Server, error) {
-	db, err := NewDB(cfg.DBPath)
-	if err != nil {
-		return nil, fmt.Errorf("open database: %w", err)
-	}
-
+// NewLLMClientFromConfig builds the LLM fallback chain a collector with cfg
+// would use, for tools that analyze outside the server (e.g. eval).
+func NewLLMClientFromConfig(cfg *config.CollectorConfig) *LLMClient {
 	// Convert config endpoints to LLM client endpoints
 	var endpoints []Endpoint
 	for _, ep := range cfg.LLMEndpoints {
 		endpoints = append(endpoints, Endpoint{
-			URL:    ep.URL,
-			Model:  ep.Model,
-			APIKey: ep.APIKey,
+			URL:             ep.URL,
+			Model:           ep.Model,
+			APIKey:          ep.APIKey,
+			ContextTokens:   ep.ContextTokens,
+			MaxOutputTokens: ep.MaxOutputTokens,
+			Timeout:         ep.Timeout,
+			MaxConcurrent:   ep.MaxConcurrent,
+			JSONFormat:      ep.ResponseFormat == "json",
+			Grammar:         ep.Grammar,
+			Local:           ep.Profile == config.ProfileLocal,
 		})
 	}
 	llm := NewLLMClient(endpoints, cfg.MaxRetries)
+	llm.configureBreakers(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	fallback := make(map[ErrorClass]bool, len(cfg.LLMFallback))
+	for class, on := range cfg.LLMFallback {
+		fallback[ErrorClass(class)] = on
+	}
+	llm.configureFallback(fallback)
+	llm.configureConsensus(cfg.ConsensusVoters, cfg.ConsensusStrategy)
+	return llm
+}
+
+// NewServer creates a new collector server
+func NewServer(cfg *config.CollectorConfig) (*Server, error) {
+	db, err := OpenStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	llm := NewLLMClientFromConfig(cfg)
 
 	handler := NewIngestHandler(db, llm, cfg.APIKey, cfg.MaxPayloadBytes)
+	var batcher *Batcher
+	if cfg.BatchWindow > 0 {
+		batcher = NewBatcher(db, llm, cfg.BatchWindow, cfg.BatchMaxHosts, cfg.BatchMaxTokens)
+		handler.batcher = batcher
+	}
+
+	fb := &feedback{db: db, llm: llm, suppressAfter: cfg.SuppressAfter, examples: cfg.FeedbackExamples}
+	labels := NewLabelsHandler(db, cfg.APIKey, cfg.OperatorAPIKey)
+	labels.feedback = fb
 
 	mux := http.NewServeMux()
 	mux.Handle("/ingest", handler)
+	mux.HandleFunc("/ingest/json", handler.ServeShipper)
+	mux.HandleFunc("/v1/logs", handler.ServeOTLP)
+	mux.Handle("/api/labels", labels)
+	mux.HandleFunc("/api/suppressions", labels.ServeSuppressions)
+	silences := NewSilencesHandler(db, cfg.APIKey, cfg.OperatorAPIKey)
+	mux.Handle("/api/silences", silences)
+	mux.Handle("/api/silences/", silences)
+	mux.Handle("/api/search", NewSearchHandler(db, cfg.APIKey))
+	mux.Handle("/api/results/", NewResultsHandler(db, cfg.APIKey))
+	mux.HandleFunc("/metrics", metricsHandler(llm))
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
@@ -57,10 +100,13 @@ func NewServer(cfg *config.CollectorConfig) (*Server, error) {
 	}
 
 	return &Server{
-		cfg:    cfg,
-		db:     db,
-		llm:    llm,
-		server: server,
+		cfg:      cfg,
+		db:       db,
+		llm:      llm,
+		batcher:  batcher,
+		feedback: fb,
+		ingest:   handler,
+		server:   server,
 	}, nil
 }
 
@@ -69,6 +115,9 @@ func (s *Server) Run(ctx context.Context) error {
 	defer s.db.Close()
 
 	log.Printf("Collector starting on %s", s.cfg.ListenAddr)
+	if s.cfg.OperatorAPIKey == "" {
+		log.Println("operator_api_key not set: labels and silences are read-only over the API")
+	}
 
 	// Load TLS cert
 	cert, err := tls.LoadX509KeyPair(s.cfg.TLSCert, s.cfg.TLSKey)
@@ -81,8 +130,15 @@ func (s *Server) Run(ctx context.Context) error {
 		MinVersion:   tls.VersionTLS12,
 	}
 
-	startPruner(ctx, s.db, s.cfg.RetentionDays)
+	startPruner(ctx, s.db, s.cfg)
+	startBackups(ctx, s.cfg)
 	startSummary(ctx, s.db, s.cfg)
+	startFeedback(ctx, s.feedback)
+	syslogDone, err := startSyslog(ctx, s.db, s.llm, s.batcher, s.cfg, s.server.TLSConfig)
+	if err != nil {
+		return err
+	}
+	drainShipped := s.ingest.startQueue()
 
 	// Start server in goroutine
 	errCh := make(chan error, 1)
@@ -99,7 +155,10 @@ func (s *Server) Run(ctx context.Context) error {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		s.server.Shutdown(shutdownCtx)
+		drainShipped()
+		<-syslogDone
 	case err := <-errCh:
+		drainShipped()
 		return err
 	}
 
@@ -129,8 +188,15 @@ func (s *Server) RunAndGetAddr(ctx context.Context) (string, error) {
 	addr := ln.Addr().String()
 	log.Printf("Collector starting on %s", addr)
 
-	startPruner(ctx, s.db, s.cfg.RetentionDays)
+	startPruner(ctx, s.db, s.cfg)
+	startBackups(ctx, s.cfg)
 	startSummary(ctx, s.db, s.cfg)
+	syslogDone, err := startSyslog(ctx, s.db, s.llm, s.batcher, s.cfg, s.server.TLSConfig)
+	if err != nil {
+		ln.Close()
+		return "", err
+	}
+	drainShipped := s.ingest.startQueue()
 
 	// Start server in goroutine
 	go func() {
@@ -147,6 +213,8 @@ func (s *Server) RunAndGetAddr(ctx context.Context) (string, error) {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		s.server.Shutdown(shutdownCtx)
+		drainShipped()
+		<-syslogDone
 		s.db.Close()
 	}()
 
@@ -156,26 +224,26 @@ func (s *Server) RunAndGetAddr(ctx context.Context) (string, error) {
 // SendSummaryOnce builds and dispatches a single email digest covering the
 // last cfg.SummaryInterval. Returns the subject sent on success; exposed so
 // CLI flags (e.g. --send-summary-now) and the periodic ticker share one path.
-func SendSummaryOnce(cfg *config.CollectorConfig, db *DB) (string, error) {
+func SendSummaryOnce(cfg *config.CollectorConfig, db Store) (string, error) {
 	if cfg.SummaryInterval <= 0 {
 		return "", fmt.Errorf("summary_interval must be > 0")
 	}
 	now := time.Now()
-	subject, body, err := BuildSummary(db, now.Add(-cfg.SummaryInterval), now, cfg.AlertErrorRate)
+	digest, err := BuildDigest(db, now.Add(-cfg.SummaryInterval), now, cfg.AlertErrorRate, cfg.ResultURL)
 	if err != nil {
 		return "", fmt.Errorf("build summary: %w", err)
 	}
-	if err := SendMail(cfg, subject, body); err != nil {
+	if err := SendMail(cfg, digest.Subject, digest.Text, digest.HTML); err != nil {
 		return "", fmt.Errorf("send mail: %w", err)
 	}
-	return subject, nil
+	return digest.Subject, nil
 }
 
 // startSummary fires a digest on every cfg.SummaryInterval tick. Unlike
 // startPruner it does NOT run immediately on startup -- otherwise a flapping
 // collector would spam the inbox. Operators trigger an immediate test send
 // with `tasseograph collector --send-summary-now`.
-func startSummary(ctx context.Context, db *DB, cfg *config.CollectorConfig) {
+func startSummary(ctx context.Context, db Store, cfg *config.CollectorConfig) {
 	if cfg.SummaryInterval <= 0 {
 		return
 	}
@@ -198,23 +266,27 @@ func startSummary(ctx context.Context, db *DB, cfg *config.CollectorConfig) {
 	}()
 }
 
-// startPruner kicks off a background goroutine that deletes rows older than
-// retentionDays once at startup and then once a day until ctx is canceled.
-// retentionDays <= 0 disables pruning entirely.
-func startPruner(ctx context.Context, db *DB, retentionDays int) {
-	if retentionDays <= 0 {
+// startPruner kicks off a background goroutine that applies the retention
+// rules and deletes rows older than RetentionDays once at startup and then
+// once a day until ctx is canceled, archiving results first when ArchiveDir
+// is set. With neither configured it does nothing.
+func startPruner(ctx context.Context, db Store, cfg *config.CollectorConfig) {
+	if cfg.RetentionDays <= 0 && len(cfg.Retention) == 0 {
 		return
 	}
+	var archive *Archiver
+	if cfg.ArchiveDir != "" {
+		archive = &Archiver{Dir: cfg.ArchiveDir}
+	}
 	go func() {
 		runPrune := func() {
-			n, err := db.PruneOlderThan(retentionDays)
+			stats, err := db.Prune(cfg.RetentionDays, cfg.Retention, archive)
 			if err != nil {
 				log.Printf("Retention prune error: %v", err)
 				return
 			}
-			if n > 0 {
-				log.Printf("Retention: pruned %d rows older than %d days", n, retentionDays)
-			}
+			log.Printf("Retention: deleted %d rows, dropped dmesg of %d results, archived %d results, reclaimed %d bytes",
+				stats.Deleted, stats.Dropped, stats.Archived, stats.Reclaimed)
 		}
 		runPrune()
 		ticker := time.NewTicker(24 * time.Hour)
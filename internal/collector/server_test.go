@@ -32,7 +32,7 @@ func TestServerRunClosesDBOnTLSError(t *testing.T) {
 
 	// DB must be closed after Run returns. Calling a method that requires
 	// the open handle should now fail with sql: database is closed.
-	if pingErr := s.db.db.Ping(); pingErr == nil {
+	if pingErr := s.db.(*DB).db.Ping(); pingErr == nil {
 		t.Error("expected db.Ping() to fail because DB should be closed after Run returns; got nil")
 	}
 }
@@ -0,0 +1,381 @@
+// internal/collector/shipper.go
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Source tags for rows that arrived through a log shipper rather than the
+// agent.
+const (
+	otlpSource     = "otlp"
+	shipperSource  = "shipper"
+	kernelFacility = 0
+)
+
+// Field names shippers use for the same thing. Fluent Bit's systemd input
+// and the OpenTelemetry journald receiver pass journal fields through
+// verbatim (MESSAGE, PRIORITY, ...); tail and syslog inputs use lowercase
+// names; ECS-style records nest host.name.
+var (
+	hostFields      = []string{"host.name", "hostname", "host", "_HOSTNAME", "HOSTNAME"}
+	messageFields   = []string{"message", "MESSAGE", "log", "msg"}
+	levelFields     = []string{"PRIORITY", "priority", "syslog.severity", "severity", "level"}
+	facilityFields  = []string{"SYSLOG_FACILITY", "syslog.facility", "facility"}
+	subsystemFields = []string{"_KERNEL_SUBSYSTEM", "subsystem"}
+	deviceFields    = []string{"_KERNEL_DEVICE", "device"}
+)
+
+// levelAliases extends protocol.ParseLevel with the severity words other
+// logging ecosystems use.
+var levelAliases = map[string]int{
+	"fatal":       protocol.LevelCrit,
+	"critical":    protocol.LevelCrit,
+	"panic":       protocol.LevelEmerg,
+	"emergency":   protocol.LevelEmerg,
+	"information": protocol.LevelInfo,
+	"trace":       protocol.LevelDebug,
+}
+
+// firstField returns the first non-empty value among names.
+func firstField(fields map[string]string, names []string) string {
+	for _, n := range names {
+		if v := fields[n]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseShippedLevel accepts a numeric syslog level or a severity word.
+func parseShippedLevel(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= protocol.LevelDebug {
+		return n, true
+	}
+	if lvl, err := protocol.ParseLevel(s); err == nil {
+		return lvl, true
+	}
+	lvl, ok := levelAliases[strings.ToLower(strings.TrimSpace(s))]
+	return lvl, ok
+}
+
+// shippedRecord maps a flattened shipper record onto a host and Record.
+// Shippers are pointed at kernel logs, so a record that doesn't say which
+// facility it's from is assumed to be kern; one that names another facility
+// is dropped (ok=false), as the syslog receiver does. Timestamp and, for
+// OTLP, level are filled in by the caller's format-specific fields.
+func shippedRecord(fields map[string]string) (string, protocol.Record, bool) {
+	r := protocol.Record{
+		Level:     protocol.LevelInfo,
+		Facility:  kernelFacility,
+		Subsystem: firstField(fields, subsystemFields),
+		Device:    firstField(fields, deviceFields),
+		Message:   firstField(fields, messageFields),
+	}
+	if r.Message == "" {
+		return "", r, false
+	}
+	if lvl, ok := parseShippedLevel(firstField(fields, levelFields)); ok {
+		r.Level = lvl
+	}
+	if f := firstField(fields, facilityFields); f != "" {
+		if n, err := strconv.Atoi(f); err == nil {
+			r.Facility = n
+		} else if n, err := protocol.ParseFacility(f); err == nil {
+			r.Facility = n
+		}
+	} else if t := fields["_TRANSPORT"]; t != "" && t != "kernel" {
+		r.Facility = 1 // journald omits SYSLOG_FACILITY only for kernel messages
+	}
+	if r.Facility != kernelFacility {
+		return "", r, false
+	}
+	return firstField(fields, hostFields), r, true
+}
+
+// flattenFields turns a decoded JSON object into dotted string keys, so
+// {"host": {"name": "web01"}} becomes host.name=web01. Non-string leaves
+// are rendered with fmt; arrays are kept as their JSON text.
+func flattenFields(prefix string, v interface{}, out map[string]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenFields(key, child, out)
+		}
+	case string:
+		out[prefix] = t
+	case nil:
+	case []interface{}:
+		b, _ := json.Marshal(t)
+		out[prefix] = string(b)
+	case json.Number:
+		out[prefix] = t.String()
+	default:
+		out[prefix] = fmt.Sprint(t)
+	}
+}
+
+// shipperTimestamp reads the record time from the fields Fluent Bit
+// ("date", float seconds) and Vector ("timestamp", RFC 3339) emit, or a
+// journal realtime stamp. Zero when none parse.
+func shipperTimestamp(fields map[string]string) time.Time {
+	if d := fields["date"]; d != "" {
+		if secs, err := strconv.ParseFloat(d, 64); err == nil {
+			return time.Unix(0, int64(secs*float64(time.Second)))
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, d); err == nil {
+			return ts
+		}
+	}
+	for _, k := range []string{"timestamp", "@timestamp", "time"} {
+		if ts, err := time.Parse(time.RFC3339Nano, fields[k]); err == nil {
+			return ts
+		}
+	}
+	if usec, err := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		return time.UnixMicro(usec)
+	}
+	return time.Time{}
+}
+
+// groupDeltas builds one delta per host from shipped records, in host order
+// and with each host's records sorted by time. Records with no host are
+// counted and dropped: a row nobody can query by hostname is useless.
+func groupDeltas(hosts []string, records []protocol.Record, source string) ([]protocol.DmesgDelta, int) {
+	byHost := map[string][]protocol.Record{}
+	dropped := 0
+	for i, r := range records {
+		if hosts[i] == "" {
+			dropped++
+			continue
+		}
+		byHost[hosts[i]] = append(byHost[hosts[i]], r)
+	}
+
+	names := make([]string, 0, len(byHost))
+	for h := range byHost {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+
+	deltas := make([]protocol.DmesgDelta, 0, len(names))
+	for _, h := range names {
+		recs := byHost[h]
+		sort.SliceStable(recs, func(i, j int) bool { return recs[i].Timestamp.Before(recs[j].Timestamp) })
+		deltas = append(deltas, protocol.DmesgDelta{
+			Hostname:  h,
+			Timestamp: time.Now(),
+			Source:    source,
+			Records:   recs,
+		})
+	}
+	return deltas, dropped
+}
+
+// A shipper request can carry dozens of hosts, each an LLM call. Analyzed
+// inline, it outlasts the shipper's request timeout, and a failure part way
+// makes the shipper resend hosts already stored. So the server acknowledges
+// a request once its deltas are queued and analyzes them in the background.
+const (
+	shipperWorkers = 4
+	// shipperQueueSize is how many requests may wait; past it the shipper
+	// is told to back off and retry, with nothing stored.
+	shipperQueueSize = 64
+	// shipperDrainTimeout bounds analysis of what's queued at shutdown.
+	shipperDrainTimeout = 2 * time.Minute
+)
+
+// shipQueue holds shipped requests' deltas until a worker analyzes them.
+type shipQueue struct {
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan []protocol.DmesgDelta
+}
+
+// enqueue queues deltas, reporting false if the queue is full or closed.
+func (q *shipQueue) enqueue(deltas []protocol.DmesgDelta) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- deltas:
+		return true
+	default:
+		return false
+	}
+}
+
+// startQueue starts the workers that analyze shipped deltas. The returned
+// drain stops taking requests and waits, up to shipperDrainTimeout, for
+// the queued ones; call it once the HTTP server has shut down.
+func (h *IngestHandler) startQueue() (drain func()) {
+	q := &shipQueue{jobs: make(chan []protocol.DmesgDelta, shipperQueueSize)}
+	h.queue = q
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < shipperWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for deltas := range q.jobs {
+				h.ingestDeltas(ctx, deltas)
+			}
+		}()
+	}
+	return func() {
+		q.mu.Lock()
+		q.closed = true
+		close(q.jobs)
+		q.mu.Unlock()
+		timer := time.AfterFunc(shipperDrainTimeout, cancel)
+		wg.Wait()
+		timer.Stop()
+		cancel()
+	}
+}
+
+// ingestDeltas runs each delta through the same path as /ingest, and
+// returns how many failed. Each host stands alone: one failing doesn't
+// stop the rest.
+func (h *IngestHandler) ingestDeltas(ctx context.Context, deltas []protocol.DmesgDelta) int {
+	var mu sync.Mutex
+	failed := 0
+	ingest := func(d protocol.DmesgDelta) {
+		if _, _, err := h.ingest(ctx, d); err != nil && !errors.Is(err, errBatchPending) {
+			log.Printf("DB error: %s delta for %s: %v", d.Source, d.Hostname, err)
+			mu.Lock()
+			failed++
+			mu.Unlock()
+		}
+	}
+	if h.batcher == nil {
+		for _, d := range deltas {
+			ingest(d)
+		}
+		return failed
+	}
+	// Submit every host before waiting so they can share batches.
+	var wg sync.WaitGroup
+	for _, d := range deltas {
+		wg.Add(1)
+		go func(d protocol.DmesgDelta) {
+			defer wg.Done()
+			ingest(d)
+		}(d)
+	}
+	wg.Wait()
+	return failed
+}
+
+// ingestAll queues a shipper request's deltas, or with no queue (as in
+// tests) ingests them there and then. Either way, once any host may have
+// been stored the answer is success, so a retry can't store it twice: only
+// a full queue, or every host failing, asks the shipper to resend.
+func (h *IngestHandler) ingestAll(w http.ResponseWriter, r *http.Request, deltas []protocol.DmesgDelta, dropped int) bool {
+	if dropped > 0 {
+		log.Printf("%s: dropped %d records without a hostname", r.URL.Path, dropped)
+	}
+	if len(deltas) == 0 {
+		return true
+	}
+	if h.queue != nil {
+		if !h.queue.enqueue(deltas) {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Analysis queue full", http.StatusServiceUnavailable)
+			return false
+		}
+		return true
+	}
+	if h.ingestDeltas(r.Context(), deltas) == len(deltas) {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// ServeShipper handles POST /ingest/json from Fluent Bit's and Vector's
+// HTTP outputs: either a JSON array of records or newline-delimited JSON.
+func (h *IngestHandler) ServeShipper(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	objects, err := decodeShipperBody(body)
+	if err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var hosts []string
+	var records []protocol.Record
+	for _, obj := range objects {
+		fields := map[string]string{}
+		flattenFields("", obj, fields)
+		host, rec, ok := shippedRecord(fields)
+		if !ok {
+			continue
+		}
+		rec.Timestamp = shipperTimestamp(fields)
+		if rec.Timestamp.IsZero() {
+			rec.Timestamp = time.Now()
+		}
+		hosts = append(hosts, host)
+		records = append(records, rec)
+	}
+
+	deltas, dropped := groupDeltas(hosts, records, shipperSource)
+	if len(deltas) == 0 && dropped > 0 {
+		http.Error(w, "hostname is required", http.StatusBadRequest)
+		return
+	}
+	if !h.ingestAll(w, r, deltas, dropped) {
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "hosts": len(deltas)})
+}
+
+// decodeShipperBody accepts a JSON array (Vector's json codec, Fluent Bit
+// format json), a single object, or newline-delimited objects (Fluent Bit
+// format json_lines, Vector ndjson framing).
+func decodeShipperBody(body []byte) ([]interface{}, error) {
+	body = bytes.TrimSpace(body)
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if bytes.HasPrefix(body, []byte("[")) {
+		var arr []interface{}
+		if err := dec.Decode(&arr); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	var objects []interface{}
+	for dec.More() {
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
@@ -0,0 +1,153 @@
+// internal/collector/shipper_test.go
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestServeShipperFluentBitArray(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+
+	// Fluent Bit's http output with format json and the systemd input:
+	// journal fields pass through verbatim, "date" is float seconds.
+	body := `[
+		{"date": 1770121502.5, "_HOSTNAME": "web01", "_TRANSPORT": "kernel", "PRIORITY": "3", "MESSAGE": "second", "_KERNEL_SUBSYSTEM": "pci", "_KERNEL_DEVICE": "+pci:0000:3b:00.0"},
+		{"date": 1770121501, "_HOSTNAME": "web01", "_TRANSPORT": "kernel", "PRIORITY": "4", "MESSAGE": "first"},
+		{"date": 1770121501, "_HOSTNAME": "web01", "_TRANSPORT": "syslog", "PRIORITY": "3", "MESSAGE": "userspace is filtered"}
+	]`
+	req := httptest.NewRequest("POST", "/ingest/json", bytes.NewReader([]byte(body)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeShipper(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	results, _ := db.QueryByHostname("web01", 10)
+	if len(results) != 1 {
+		t.Fatalf("rows = %d, want 1", len(results))
+	}
+	want := "[2026-02-03T12:25:01Z] kern.warning first\n[2026-02-03T12:25:02Z] kern.err (pci +pci:0000:3b:00.0) second"
+	if results[0].RawDmesg != want || results[0].Source != shipperSource {
+		t.Errorf("row = %q/%q, want %q", results[0].Source, results[0].RawDmesg, want)
+	}
+}
+
+func TestServeShipperVectorNDJSONGzip(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+
+	// Vector's http sink with ndjson framing and gzip, records from a
+	// file source on kern.log shaped with ECS-style host.name.
+	ndjson := `{"timestamp":"2026-02-03T12:25:01Z","host":{"name":"db01"},"message":"EXT4-fs error (device sda1)","level":"error"}
+{"timestamp":"2026-02-03T12:25:01Z","host":{"name":"db02"},"message":"nvme0: I/O timeout","severity":"critical"}
+{"timestamp":"2026-02-03T12:25:01Z","message":"no host"}
+`
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(ndjson))
+	zw.Close()
+
+	req := httptest.NewRequest("POST", "/ingest/json", &buf)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeShipper(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for host, want := range map[string]string{
+		"db01": "[2026-02-03T12:25:01Z] kern.err EXT4-fs error (device sda1)",
+		"db02": "[2026-02-03T12:25:01Z] kern.crit nvme0: I/O timeout",
+	} {
+		results, _ := db.QueryByHostname(host, 10)
+		if len(results) != 1 || results[0].RawDmesg != want {
+			t.Errorf("%s rows = %+v, want one with %q", host, results, want)
+		}
+	}
+}
+
+func TestServeShipperRejectsHostless(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+
+	req := httptest.NewRequest("POST", "/ingest/json", bytes.NewReader([]byte(`{"message":"orphan"}`)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeShipper(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest("POST", "/ingest/json", bytes.NewReader([]byte(`[{"message": `)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeShipper(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("truncated JSON: Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServeShipperQueued(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+	drain := handler.startQueue()
+
+	body := `[{"host": "web01", "message": "one"}, {"host": "web02", "message": "two"}]`
+	req := httptest.NewRequest("POST", "/ingest/json", bytes.NewReader([]byte(body)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeShipper(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Draining waits for the queued hosts to be stored.
+	drain()
+	for _, host := range []string{"web01", "web02"} {
+		if results, _ := db.QueryByHostname(host, 10); len(results) != 1 {
+			t.Errorf("%s rows = %d, want 1", host, len(results))
+		}
+	}
+
+	// Once drained, the queue takes nothing more and the shipper is told
+	// to retry.
+	req = httptest.NewRequest("POST", "/ingest/json", bytes.NewReader([]byte(body)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeShipper(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("after drain: Status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestServeShipperQueueFull(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	handler := NewIngestHandler(db, nil, "secret", 1<<20)
+	handler.queue = &shipQueue{jobs: make(chan []protocol.DmesgDelta)} // no workers, no room
+
+	req := httptest.NewRequest("POST", "/ingest/json", bytes.NewReader([]byte(`{"host": "web01", "message": "one"}`)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeShipper(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if results, _ := db.QueryByHostname("web01", 10); len(results) != 0 {
+		t.Errorf("rows = %d, want 0 so the retry isn't a duplicate", len(results))
+	}
+}
@@ -0,0 +1,258 @@
+// internal/collector/silence.go
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// silencesSchema holds operator silences. Times are RFC3339 UTC, like
+// results.timestamp, so they compare as text.
+const silencesSchema = `
+CREATE TABLE IF NOT EXISTS silences (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	hostname TEXT,
+	category TEXT,
+	summary TEXT,
+	starts_at TEXT NOT NULL,
+	ends_at TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	author TEXT,
+	created_at TEXT DEFAULT (datetime('now'))
+);
+CREATE INDEX IF NOT EXISTS idx_silences_ends_at ON silences(ends_at);
+`
+
+// ErrInvalidSilence is wrapped by AddSilence's errors for silences that
+// can't be stored.
+var ErrInvalidSilence = errors.New("invalid silence")
+
+// AddSilence stores a silence. A zero StartsAt means now; ID and CreatedAt
+// are filled in.
+func (d *sqlStore) AddSilence(s *protocol.Silence) error {
+	now := time.Now().UTC()
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	s.StartsAt, s.EndsAt = s.StartsAt.UTC().Truncate(time.Second), s.EndsAt.UTC().Truncate(time.Second)
+	switch {
+	case s.Hostname == "" && s.Category == "" && s.Summary == "":
+		return fmt.Errorf("%w: set at least one of hostname, category or summary", ErrInvalidSilence)
+	case strings.TrimSpace(s.Reason) == "":
+		return fmt.Errorf("%w: reason is required", ErrInvalidSilence)
+	case !s.EndsAt.After(s.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidSilence)
+	case !s.EndsAt.After(now):
+		return fmt.Errorf("%w: ends_at is in the past", ErrInvalidSilence)
+	case s.Category != "" && !issueCategories[s.Category]:
+		return fmt.Errorf("%w: unknown category %q", ErrInvalidSilence, s.Category)
+	}
+	if _, err := path.Match(s.Hostname, ""); err != nil {
+		return fmt.Errorf("%w: hostname: %v", ErrInvalidSilence, err)
+	}
+	if _, err := regexp.Compile(s.Summary); err != nil {
+		return fmt.Errorf("%w: summary: %v", ErrInvalidSilence, err)
+	}
+
+	s.CreatedAt = now.Truncate(time.Second)
+	var err error
+	s.ID, err = d.insert(`
+		INSERT INTO silences (hostname, category, summary, starts_at, ends_at, reason, author, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.Hostname, s.Category, s.Summary, s.StartsAt.Format(time.RFC3339), s.EndsAt.Format(time.RFC3339),
+		s.Reason, s.Author, s.CreatedAt.Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// QuerySilences returns the silences in force at any point between since
+// and until, soonest ending first.
+func (d *sqlStore) QuerySilences(since, until time.Time) ([]protocol.Silence, error) {
+	rows, err := d.query(`
+		SELECT id, COALESCE(hostname, ''), COALESCE(category, ''), COALESCE(summary, ''),
+		       starts_at, ends_at, reason, COALESCE(author, ''), created_at
+		FROM silences
+		WHERE starts_at <= ? AND ends_at > ?
+		ORDER BY ends_at, id
+	`, until.UTC().Format(time.RFC3339), since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []protocol.Silence
+	for rows.Next() {
+		var s protocol.Silence
+		var startsStr, endsStr, createdStr string
+		if err := rows.Scan(&s.ID, &s.Hostname, &s.Category, &s.Summary, &startsStr, &endsStr, &s.Reason, &s.Author, &createdStr); err != nil {
+			return nil, err
+		}
+		s.StartsAt, _ = time.Parse(time.RFC3339, startsStr)
+		s.EndsAt, _ = time.Parse(time.RFC3339, endsStr)
+		s.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdStr)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// ExpireSilence ends a silence now. It reports whether there was an
+// unexpired silence with that id.
+func (d *sqlStore) ExpireSilence(id int64) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := d.exec(`UPDATE silences SET ends_at = ? WHERE id = ? AND ends_at > ?`, now, id, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// silences reports whether s covers a warning or critical result: its
+// host matches, and so does every issue.
+func silences(s protocol.Silence, r *protocol.StoredResult) bool {
+	if s.Hostname != "" {
+		if ok, _ := path.Match(s.Hostname, r.Hostname); !ok {
+			return false
+		}
+	}
+	if s.Category == "" && s.Summary == "" {
+		return true
+	}
+	if len(r.Issues) == 0 {
+		return false
+	}
+	var re *regexp.Regexp
+	if s.Summary != "" {
+		var err error
+		if re, err = regexp.Compile(s.Summary); err != nil {
+			return false
+		}
+	}
+	for _, issue := range r.Issues {
+		category := issue.Category
+		if category == "" {
+			category = "other"
+		}
+		if s.Category != "" && category != s.Category {
+			return false
+		}
+		if re != nil && !re.MatchString(issue.Summary) {
+			return false
+		}
+	}
+	return true
+}
+
+// silence flags a warning or critical result that a silence in force at
+// its timestamp covers. Error rows are never silenced: a broken pipeline
+// still needs to be seen during maintenance.
+func (d *sqlStore) silence(r *protocol.StoredResult) error {
+	if r.Status != "warning" && r.Status != "critical" {
+		return nil
+	}
+	active, err := d.QuerySilences(r.Timestamp, r.Timestamp)
+	if err != nil {
+		return err
+	}
+	for _, s := range active {
+		if silences(s, r) {
+			log.Printf("Silenced %s result for %s (silence %d: %s)", r.Status, r.Hostname, s.ID, s.Reason)
+			r.Silenced = true
+			return nil
+		}
+	}
+	return nil
+}
+
+// SilencesHandler serves the silences API: GET and POST /api/silences,
+// and DELETE /api/silences/{id} to end one early. Listing takes the agents'
+// bearer token or the operator's; adding and ending take the operator's,
+// since a silence hides criticals from the digest.
+type SilencesHandler struct {
+	db          Store
+	apiKey      string
+	operatorKey string
+}
+
+// NewSilencesHandler creates the silences API handler. An empty
+// operatorKey disables POST and DELETE.
+func NewSilencesHandler(db Store, apiKey, operatorKey string) *SilencesHandler {
+	return &SilencesHandler{db: db, apiKey: apiKey, operatorKey: operatorKey}
+}
+
+func (h *SilencesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operator := operatorAuthorized(r, h.operatorKey)
+	if !operator && !authorized(r, h.apiKey) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if (r.Method == http.MethodPost || r.Method == http.MethodDelete) && !operator {
+		http.Error(w, "Changing silences needs the operator API key", http.StatusForbidden)
+		return
+	}
+	idStr := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/silences"), "/")
+	switch {
+	case r.Method == http.MethodGet && idStr == "":
+		// Everything current or scheduled.
+		active, err := h.db.QuerySilences(time.Now(), time.Now().AddDate(100, 0, 0))
+		if err != nil {
+			log.Printf("DB error: %v", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"silences": nonNil(active)})
+
+	case r.Method == http.MethodPost && idStr == "":
+		var s protocol.Silence
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&s); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := h.db.AddSilence(&s); err != nil {
+			if errors.Is(err, ErrInvalidSilence) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Printf("DB error: %v", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Silence %d added by %q until %s: %s", s.ID, s.Author, s.EndsAt.Format(time.RFC3339), s.Reason)
+		writeJSON(w, http.StatusCreated, s)
+
+	case r.Method == http.MethodDelete && idStr != "":
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid silence id", http.StatusBadRequest)
+			return
+		}
+		ok, err := h.db.ExpireSilence(id)
+		if err != nil {
+			log.Printf("DB error: %v", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "No such active silence", http.StatusNotFound)
+			return
+		}
+		log.Printf("Silence %d expired", id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case idStr == "":
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		w.Header().Set("Allow", "DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
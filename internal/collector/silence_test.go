@@ -0,0 +1,199 @@
+// internal/collector/silence_test.go
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestAddSilenceValidates(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	end := time.Now().Add(time.Hour)
+
+	for name, s := range map[string]protocol.Silence{
+		"no matcher":       {EndsAt: end, Reason: "x"},
+		"no reason":        {Hostname: "db-*", EndsAt: end},
+		"no end":           {Hostname: "db-*", Reason: "x"},
+		"already over":     {Hostname: "db-*", StartsAt: end.Add(-3 * time.Hour), EndsAt: end.Add(-2 * time.Hour), Reason: "x"},
+		"bad glob":         {Hostname: "db-[", EndsAt: end, Reason: "x"},
+		"bad regexp":       {Summary: "EDAC(", EndsAt: end, Reason: "x"},
+		"unknown category": {Category: "cosmic", EndsAt: end, Reason: "x"},
+	} {
+		if err := db.AddSilence(&s); !errors.Is(err, ErrInvalidSilence) {
+			t.Errorf("%s: err = %v, want ErrInvalidSilence", name, err)
+		}
+	}
+
+	s := protocol.Silence{Hostname: "db-*", EndsAt: end, Reason: "burn-in"}
+	if err := db.AddSilence(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID == 0 || s.StartsAt.IsZero() {
+		t.Errorf("silence = %+v, want an id and a start of now", s)
+	}
+}
+
+func TestSilenceMatching(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	now := time.Now()
+	for _, s := range []protocol.Silence{
+		{Hostname: "db-*", Category: "memory", EndsAt: now.Add(time.Hour), Reason: "DIMM swap"},
+		{Summary: "(?i)firmware", EndsAt: now.Add(time.Hour), Reason: "NIC firmware rollout"},
+		{Hostname: "web-1", StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour), Reason: "tomorrow"},
+	} {
+		if err := db.AddSilence(&s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ecc := protocol.Issue{Summary: "ECC errors on DIMM_B2", Category: "memory"}
+	link := protocol.Issue{Summary: "NIC link flapping", Category: "network"}
+	fw := protocol.Issue{Summary: "NIC firmware reset", Category: "network"}
+	for _, tc := range []struct {
+		name   string
+		host   string
+		status string
+		issues []protocol.Issue
+		want   bool
+	}{
+		{"host and category", "db-7", "critical", []protocol.Issue{ecc}, true},
+		{"other host", "web-1", "critical", []protocol.Issue{ecc}, false},
+		{"another issue still alerts", "db-7", "critical", []protocol.Issue{ecc, link}, false},
+		{"summary regexp, any host", "web-2", "warning", []protocol.Issue{fw}, true},
+		{"not started yet", "web-1", "warning", []protocol.Issue{link}, false},
+		{"pipeline errors are never silenced", "db-7", "error", nil, false},
+	} {
+		var result *protocol.AnalysisResult
+		var llmErr error
+		if tc.status == "error" {
+			llmErr = errors.New("boom")
+		} else {
+			result = &protocol.AnalysisResult{Status: tc.status, Issues: tc.issues}
+		}
+		stored, err := storeResult(db, tc.host, "kmsg", now, []string{"x"}, result, AnalysisMeta{}, llmErr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.QueryResult(stored.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Silenced != tc.want {
+			t.Errorf("%s: silenced = %v, want %v", tc.name, got.Silenced, tc.want)
+		}
+	}
+}
+
+func TestBuildSummary_LeavesOutSilenced(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Date(2026, 5, 12, 22, 0, 0, 0, time.UTC)
+	since := now.Add(-24 * time.Hour)
+	seedRow(t, db, "db-7", "critical", since.Add(time.Hour), 200, []protocol.Issue{{Summary: "DIMM_B2 uncorrectable", Category: "memory"}})
+	seedRow(t, db, "web-1", "warning", since.Add(2*time.Hour), 200, []protocol.Issue{{Summary: "link flapping", Category: "network"}})
+	if _, err := db.db.Exec(`UPDATE results SET silenced = 1 WHERE hostname = 'db-7'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.db.Exec(`INSERT INTO silences (hostname, starts_at, ends_at, reason) VALUES ('db-*', ?, ?, 'DIMM swap')`,
+		since.Format(time.RFC3339), since.Add(3*time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	subj, body, err := BuildSummary(db, since, now, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(subj, "[WARN]") || !strings.Contains(subj, "1 warning") {
+		t.Errorf("subject = %q, want [WARN] with the silenced critical left out", subj)
+	}
+	for _, want := range []string{"Silenced: 1 critical, 0 warning", "#1  db-*", "DIMM swap"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "CRITICAL events") || strings.Contains(body, "DIMM_B2") {
+		t.Errorf("silenced critical listed in the digest\n%s", body)
+	}
+}
+
+func TestSilencesHandler(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := NewSilencesHandler(db, "secret", "operator")
+
+	key := "operator"
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	// The agents' key can list silences but not add or end them.
+	key = "secret"
+	if rec := do("POST", "/api/silences", `{"hostname": "db-*", "ends_at": "`+end+`", "reason": "x"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("POST with the agents' key: %d, want 403", rec.Code)
+	}
+	if rec := do("DELETE", "/api/silences/1", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("DELETE with the agents' key: %d, want 403", rec.Code)
+	}
+	if rec := do("GET", "/api/silences", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET with the agents' key: %d, want 200", rec.Code)
+	}
+	key = "operator"
+
+	rec := do("POST", "/api/silences", `{"hostname": "db-*", "ends_at": "`+end+`", "reason": "burn-in", "author": "sam"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: %d %s", rec.Code, rec.Body)
+	}
+	var created protocol.Silence
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	if rec := do("POST", "/api/silences", `{"ends_at": "`+end+`", "reason": "everything"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST without a matcher: %d, want 400", rec.Code)
+	}
+
+	rec = do("GET", "/api/silences", "")
+	var list struct{ Silences []protocol.Silence }
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list.Silences) != 1 || list.Silences[0].ID != created.ID || list.Silences[0].Author != "sam" {
+		t.Errorf("GET = %+v", list)
+	}
+
+	if rec := do("DELETE", "/api/silences/"+jsonInt(created.ID), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: %d, want 204", rec.Code)
+	}
+	if rec := do("DELETE", "/api/silences/"+jsonInt(created.ID), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE: %d, want 404", rec.Code)
+	}
+	rec = do("GET", "/api/silences", "")
+	if !strings.Contains(rec.Body.String(), `"silences":[]`) {
+		t.Errorf("expired silence still listed: %s", rec.Body)
+	}
+}
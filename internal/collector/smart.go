@@ -0,0 +1,222 @@
+// internal/collector/smart.go
+package collector
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// smartSchema keeps one row per drive per snapshot. The headline NVMe
+// fields get their own columns for ad-hoc sqlite3 queries; the full
+// snapshot (including ATA attributes) lives in the JSON column.
+const smartSchema = `
+CREATE TABLE IF NOT EXISTS smart_snapshots (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	hostname TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	serial TEXT NOT NULL,
+	device TEXT,
+	model TEXT,
+	protocol TEXT,
+	critical_warning INTEGER,
+	media_errors INTEGER,
+	percentage_used INTEGER,
+	available_spare INTEGER,
+	snapshot TEXT NOT NULL,
+	created_at TEXT DEFAULT (datetime('now'))
+);
+CREATE INDEX IF NOT EXISTS idx_smart_serial ON smart_snapshots(hostname, serial, timestamp);
+`
+
+// smartKey identifies a drive across snapshots. Serial survives device
+// renames (/dev/sda becoming /dev/sdb after a reboot); device is the
+// fallback for drives that don't report one.
+func smartKey(s protocol.SmartSnapshot) string {
+	if s.Serial != "" {
+		return s.Serial
+	}
+	return s.Device
+}
+
+// InsertSmart stores one row per snapshot for hostname at ts.
+func (d *sqlStore) InsertSmart(hostname string, ts time.Time, snaps []protocol.SmartSnapshot) error {
+	if len(snaps) == 0 {
+		return nil
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tsStr := ts.UTC().Format(time.RFC3339)
+	for _, s := range snaps {
+		snapJSON, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(d.rebind(`
+			INSERT INTO smart_snapshots (hostname, timestamp, serial, device, model, protocol,
+				critical_warning, media_errors, percentage_used, available_spare, snapshot)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`), hostname, tsStr, smartKey(s), s.Device, s.Model, s.Protocol,
+			s.CriticalWarning, s.MediaErrors, s.PercentageUsed, s.AvailableSpare, string(snapJSON)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LatestSmart returns the most recent snapshot of a drive strictly before
+// `before`, or nil if this is the first one we've seen.
+func (d *sqlStore) LatestSmart(hostname, serial string, before time.Time) (*protocol.SmartSnapshot, error) {
+	var snapJSON string
+	err := d.queryRow(`
+		SELECT snapshot FROM smart_snapshots
+		WHERE hostname = ? AND serial = ? AND timestamp < ?
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`, hostname, serial, before.UTC().Format(time.RFC3339)).Scan(&snapJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s protocol.SmartSnapshot
+	if err := json.Unmarshal([]byte(snapJSON), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SmartChanges compares each snapshot against the drive's previous one and
+// returns prompt lines for threshold crossings and worsening counters. Call
+// it before InsertSmart for the same poll.
+func (d *sqlStore) SmartChanges(hostname string, ts time.Time, snaps []protocol.SmartSnapshot) ([]string, error) {
+	var lines []string
+	for _, s := range snaps {
+		prev, err := d.LatestSmart(hostname, smartKey(s), ts)
+		if err != nil {
+			return nil, fmt.Errorf("smart %s: %w", smartKey(s), err)
+		}
+		lines = append(lines, SmartFindings(prev, s)...)
+	}
+	return lines, nil
+}
+
+// nvmeCriticalWarningBits names the NVMe SMART critical warning bits.
+var nvmeCriticalWarningBits = []string{
+	"available spare below threshold",
+	"temperature threshold exceeded",
+	"NVM subsystem reliability degraded",
+	"media placed in read-only mode",
+	"volatile memory backup failed",
+	"persistent memory region read-only",
+}
+
+// nvmeUsedThresholds are the endurance milestones worth a line when
+// percentage_used crosses them.
+var nvmeUsedThresholds = []int{80, 90, 100}
+
+// ataWatchedAttrs are ATA attributes whose raw count going up means the
+// drive is losing sectors or the link is flaky.
+var ataWatchedAttrs = map[int]bool{5: true, 10: true, 184: true, 187: true, 188: true, 197: true, 198: true, 199: true}
+
+// ataFirstSightAttrs are reported on a drive's first snapshot if non-zero,
+// since there's no previous value to diff against yet.
+var ataFirstSightAttrs = map[int]bool{5: true, 197: true, 198: true}
+
+// SmartFindings returns one "[smart] ..." prompt line per notable change
+// from prev to cur: a warning or failing attribute that wasn't there
+// before, a threshold crossed, a counter gone up. A condition already true
+// in prev isn't repeated, so a failed drive doesn't flag every poll. prev
+// may be nil for a drive's first snapshot, in which case only absolute
+// conditions (warnings, failing attributes, lifetime error counts) are
+// reported.
+func SmartFindings(prev *protocol.SmartSnapshot, cur protocol.SmartSnapshot) []string {
+	var findings []string
+	add := func(format string, args ...interface{}) {
+		findings = append(findings, fmt.Sprintf(format, args...))
+	}
+
+	switch cur.Protocol {
+	case protocol.SmartNVMe:
+		set, newly := cur.CriticalWarning, ""
+		if prev != nil {
+			set, newly = cur.CriticalWarning&^prev.CriticalWarning, "newly "
+		}
+		if set != 0 {
+			var bits []string
+			for i, name := range nvmeCriticalWarningBits {
+				if set&(1<<i) != 0 {
+					bits = append(bits, name)
+				}
+			}
+			add("critical warning 0x%02x %sset: %s", cur.CriticalWarning, newly, strings.Join(bits, ", "))
+		}
+		lowSpare := func(s *protocol.SmartSnapshot) bool {
+			return s.AvailableSpareThreshold > 0 && s.AvailableSpare < s.AvailableSpareThreshold
+		}
+		if lowSpare(&cur) && (prev == nil || !lowSpare(prev)) {
+			add("available spare %d%% below threshold %d%%", cur.AvailableSpare, cur.AvailableSpareThreshold)
+		}
+		for _, t := range nvmeUsedThresholds {
+			crossed := prev != nil && prev.PercentageUsed < t && cur.PercentageUsed >= t
+			if prev == nil && t >= 90 && cur.PercentageUsed >= t {
+				crossed = true
+			}
+			if crossed {
+				add("percentage used reached %d%% (now %d%%)", t, cur.PercentageUsed)
+			}
+		}
+		switch {
+		case prev != nil && cur.MediaErrors > prev.MediaErrors:
+			add("media errors +%d (total %d)", cur.MediaErrors-prev.MediaErrors, cur.MediaErrors)
+		case prev == nil && cur.MediaErrors > 0:
+			add("%d media errors over drive lifetime", cur.MediaErrors)
+		}
+
+	case protocol.SmartATA:
+		failing := func(a protocol.SmartAttribute) bool { return a.Threshold > 0 && a.Value <= a.Threshold }
+		prevRaw := map[int]uint64{}
+		prevFailing := map[int]bool{}
+		if prev != nil {
+			for _, a := range prev.Attributes {
+				prevRaw[a.ID] = a.Raw
+				prevFailing[a.ID] = failing(a)
+			}
+		}
+		for _, a := range cur.Attributes {
+			name := a.Name
+			if name == "" {
+				name = fmt.Sprintf("attr%d", a.ID)
+			}
+			if failing(a) && !prevFailing[a.ID] {
+				add("%s (%d) FAILING: normalized value %d <= threshold %d", name, a.ID, a.Value, a.Threshold)
+			}
+			if !ataWatchedAttrs[a.ID] {
+				continue
+			}
+			if p, ok := prevRaw[a.ID]; ok && a.Raw > p {
+				add("%s (%d) raw +%d (now %d)", name, a.ID, a.Raw-p, a.Raw)
+			} else if prev == nil && ataFirstSightAttrs[a.ID] && a.Raw > 0 {
+				add("%s (%d) raw %d", name, a.ID, a.Raw)
+			}
+		}
+	}
+
+	prefix := fmt.Sprintf("[smart] %s serial=%s", cur.Device, cur.Serial)
+	if cur.Model != "" {
+		prefix += fmt.Sprintf(" model=%q", cur.Model)
+	}
+	for i, f := range findings {
+		findings[i] = prefix + ": " + f
+	}
+	return findings
+}
@@ -0,0 +1,132 @@
+// internal/collector/smart_test.go
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestSmartFindingsNVMe(t *testing.T) {
+	prev := &protocol.SmartSnapshot{
+		Device: "/dev/nvme0", Protocol: protocol.SmartNVMe, Serial: "S1",
+		AvailableSpare: 100, AvailableSpareThreshold: 10, PercentageUsed: 79, MediaErrors: 2,
+	}
+	cur := *prev
+	cur.PercentageUsed = 81
+	cur.MediaErrors = 5
+
+	got := SmartFindings(prev, cur)
+	want := []string{
+		"[smart] /dev/nvme0 serial=S1: percentage used reached 80% (now 81%)",
+		"[smart] /dev/nvme0 serial=S1: media errors +3 (total 5)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Unchanged drive: nothing to say.
+	if got := SmartFindings(&cur, cur); len(got) != 0 {
+		t.Errorf("unchanged findings = %q, want none", got)
+	}
+
+	// Critical warning and spare below threshold are reported even on the
+	// first snapshot.
+	bad := cur
+	bad.CriticalWarning = 0x05
+	bad.AvailableSpare = 4
+	got = SmartFindings(nil, bad)
+	joined := strings.Join(got, "\n")
+	for _, want := range []string{
+		"critical warning 0x05 set: available spare below threshold, NVM subsystem reliability degraded",
+		"available spare 4% below threshold 10%",
+		"5 media errors over drive lifetime",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("findings missing %q:\n%s", want, joined)
+		}
+	}
+}
+
+func TestSmartFindingsATA(t *testing.T) {
+	prev := &protocol.SmartSnapshot{
+		Device: "/dev/sda", Protocol: protocol.SmartATA, Serial: "WD1",
+		Attributes: []protocol.SmartAttribute{
+			{ID: 5, Name: "Reallocated_Sector_Ct", Value: 100, Threshold: 36, Raw: 0},
+			{ID: 9, Name: "Power_On_Hours", Value: 50, Threshold: 0, Raw: 1000},
+		},
+	}
+	cur := *prev
+	cur.Attributes = []protocol.SmartAttribute{
+		{ID: 5, Name: "Reallocated_Sector_Ct", Value: 30, Threshold: 36, Raw: 120},
+		{ID: 9, Name: "Power_On_Hours", Value: 50, Threshold: 0, Raw: 1005},
+	}
+
+	got := SmartFindings(prev, cur)
+	want := []string{
+		"[smart] /dev/sda serial=WD1: Reallocated_Sector_Ct (5) FAILING: normalized value 30 <= threshold 36",
+		"[smart] /dev/sda serial=WD1: Reallocated_Sector_Ct (5) raw +120 (now 120)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// A drive that stays failed is reported when it fails, not on every poll.
+func TestSmartFindingsRepeatedFailure(t *testing.T) {
+	nvme := protocol.SmartSnapshot{
+		Device: "/dev/nvme0", Protocol: protocol.SmartNVMe, Serial: "S1",
+		CriticalWarning: 0x05, AvailableSpare: 4, AvailableSpareThreshold: 10, MediaErrors: 5,
+	}
+	ata := protocol.SmartSnapshot{
+		Device: "/dev/sda", Protocol: protocol.SmartATA, Serial: "WD1",
+		Attributes: []protocol.SmartAttribute{{ID: 5, Name: "Reallocated_Sector_Ct", Value: 30, Threshold: 36, Raw: 120}},
+	}
+	for _, snap := range []protocol.SmartSnapshot{nvme, ata} {
+		if got := SmartFindings(nil, snap); len(got) == 0 {
+			t.Errorf("%s: first failing snapshot gave no findings", snap.Device)
+		}
+		if got := SmartFindings(&snap, snap); len(got) != 0 {
+			t.Errorf("%s: identical failing snapshot gave %q, want none", snap.Device, got)
+		}
+	}
+
+	// A further warning bit is still news, and only it is named.
+	worse := nvme
+	worse.CriticalWarning |= 0x08
+	got := SmartFindings(&nvme, worse)
+	want := "[smart] /dev/nvme0 serial=S1: critical warning 0x0d newly set: media placed in read-only mode"
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("findings = %q, want [%q]", got, want)
+	}
+}
+
+func TestSmartChangesUsesPreviousSnapshotBySerial(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB error: %v", err)
+	}
+	defer db.Close()
+
+	t0 := time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)
+	first := protocol.SmartSnapshot{Device: "/dev/nvme0", Protocol: protocol.SmartNVMe, Serial: "S1", MediaErrors: 1}
+	if err := db.InsertSmart("h", t0, []protocol.SmartSnapshot{first}); err != nil {
+		t.Fatalf("InsertSmart: %v", err)
+	}
+
+	// Same drive enumerated under a new name after a reboot.
+	second := first
+	second.Device = "/dev/nvme1"
+	second.MediaErrors = 4
+	lines, err := db.SmartChanges("h", t0.Add(time.Hour), []protocol.SmartSnapshot{second})
+	if err != nil {
+		t.Fatalf("SmartChanges: %v", err)
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], "media errors +3 (total 4)") {
+		t.Errorf("lines = %q, want one media errors +3 line", lines)
+	}
+}
@@ -0,0 +1,151 @@
+// internal/collector/store.go
+package collector
+
+import (
+	"database/sql"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// Store is the collector's database: everything the ingest paths, the
+// digest, the pruner and the operator APIs read or write. DB (SQLite) and
+// PGStore (PostgreSQL) implement it; a fleet big enough to need several
+// collectors points them all at one PostgreSQL database.
+type Store interface {
+	// Analysis results.
+	InsertResult(r *protocol.StoredResult) error
+	QueryResult(id int64) (*protocol.StoredResult, error)
+	QueryByHostname(hostname string, limit int) ([]protocol.StoredResult, error)
+	QueryNonOK(limit int) ([]protocol.StoredResult, error)
+	StatusCounts() (map[string]int, error)
+	SummaryWindow(since, until time.Time) (*SummaryWindow, error)
+	PruneOlderThan(days int) (int64, error)
+	Prune(days int, rules []config.RetentionRule, archive *Archiver) (PruneStats, error)
+	ExportResults(since, until time.Time, w ResultWriter) (int, error)
+	Search(q SearchQuery) ([]SearchHit, error)
+	Compact() (CompactStats, error)
+
+	// Hardware history.
+	InsertMetrics(hostname string, ts time.Time, metrics []protocol.Metric) error
+	CounterIncreases(hostname string, ts time.Time, metrics []protocol.Metric) ([]CounterIncrease, error)
+	InsertSmart(hostname string, ts time.Time, snaps []protocol.SmartSnapshot) error
+	SmartChanges(hostname string, ts time.Time, snaps []protocol.SmartSnapshot) ([]string, error)
+
+	// Operator feedback.
+	AddLabel(l *protocol.Label) error
+	QueryLabels(limit int) ([]protocol.Label, error)
+	RebuildSuppressions(threshold int) error
+	Suppressions() ([]Suppression, error)
+	RecentFalsePositives(n int) ([]protocol.Issue, error)
+	ExportCorpus(w io.Writer) (int, error)
+	AddSilence(s *protocol.Silence) error
+	QuerySilences(since, until time.Time) ([]protocol.Silence, error)
+	ExpireSilence(id int64) (bool, error)
+
+	// suppress and silence apply the feedback to a result about to be
+	// stored.
+	suppress(r *protocol.StoredResult) error
+	silence(r *protocol.StoredResult) error
+
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*PGStore)(nil)
+)
+
+// OpenStore opens the database cfg.DBDriver names and migrates its schema
+// to the latest version.
+func OpenStore(cfg *config.CollectorConfig) (Store, error) {
+	if cfg.DBDriver == "postgres" {
+		return NewPGStore(cfg.DBURL)
+	}
+	return NewDB(cfg.DBPath)
+}
+
+// MigrateStore migrates the database cfg.DBDriver names; see MigrateDB.
+func MigrateStore(cfg *config.CollectorConfig, to int, dryRun bool) (from int, ran []Migration, err error) {
+	if cfg.DBDriver == "postgres" {
+		return MigratePostgres(cfg.DBURL, to, dryRun)
+	}
+	return MigrateDB(cfg.DBPath, to, dryRun)
+}
+
+// sqlStore is the SQL both backends share. Statements are written with ?
+// placeholders and the few SQLite-only constructs are kept out of them;
+// exec, query and queryRow rewrite the placeholders for PostgreSQL.
+// Timestamps are RFC3339 UTC text on both, so they compare as text.
+type sqlStore struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// Close closes the database connection
+func (d *sqlStore) Close() error {
+	return d.db.Close()
+}
+
+// rebind rewrites query's ? placeholders as $1, $2, ... for PostgreSQL.
+// Question marks inside quoted strings are left alone.
+func (d *sqlStore) rebind(query string) string {
+	if !d.postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func (d *sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.db.Exec(d.rebind(query), args...)
+}
+
+func (d *sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.db.Query(d.rebind(query), args...)
+}
+
+func (d *sqlStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return d.db.QueryRow(d.rebind(query), args...)
+}
+
+// insert runs an INSERT and returns the new row's id. Both backends
+// support RETURNING; PostgreSQL has no LastInsertId.
+func (d *sqlStore) insert(query string, args ...interface{}) (int64, error) {
+	var id int64
+	err := d.queryRow(query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// nowDefault is the created_at column default: the current UTC time as
+// "2006-01-02 15:04:05", which is what SQLite's datetime('now') gives.
+func nowDefault(postgres bool) string {
+	if postgres {
+		return `(to_char(now() AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'))`
+	}
+	return `(datetime('now'))`
+}
+
+// createdAtCutoff renders the time days ago the way created_at stores it.
+func createdAtCutoff(days int) string {
+	return time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02 15:04:05")
+}
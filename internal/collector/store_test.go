@@ -0,0 +1,707 @@
+// internal/collector/store_test.go
+package collector
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// The Store conformance suite runs every case against each backend.
+// SQLite always runs. PostgreSQL runs against the server
+// TASSEOGRAPH_TEST_POSTGRES_URL names (each test gets its own schema, so
+// the role needs CREATE on the database), or, with
+// TASSEOGRAPH_TEST_EMBEDDED_POSTGRES=1, against a throwaway server
+// downloaded and started for the run (initdb won't run as root).
+
+var (
+	embeddedOnce sync.Once
+	embeddedPG   *embeddedpostgres.EmbeddedPostgres
+	embeddedDir  string
+	embeddedURL  string
+	embeddedErr  error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if embeddedPG != nil {
+		embeddedPG.Stop()
+	}
+	if embeddedDir != "" {
+		os.RemoveAll(embeddedDir)
+	}
+	os.Exit(code)
+}
+
+// postgresURL returns the server the PostgreSQL backend runs against, or
+// "" to skip it.
+func postgresURL(t *testing.T) string {
+	t.Helper()
+	if u := os.Getenv("TASSEOGRAPH_TEST_POSTGRES_URL"); u != "" {
+		return u
+	}
+	if os.Getenv("TASSEOGRAPH_TEST_EMBEDDED_POSTGRES") != "1" {
+		return ""
+	}
+	embeddedOnce.Do(func() {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			embeddedErr = err
+			return
+		}
+		port := uint32(ln.Addr().(*net.TCPAddr).Port)
+		ln.Close()
+		if embeddedDir, embeddedErr = os.MkdirTemp("", "tasseograph-pg"); embeddedErr != nil {
+			return
+		}
+		cfg := embeddedpostgres.DefaultConfig().Port(port).RuntimePath(embeddedDir).Logger(nil)
+		embeddedPG = embeddedpostgres.NewDatabase(cfg)
+		if embeddedErr = embeddedPG.Start(); embeddedErr != nil {
+			embeddedPG = nil
+			return
+		}
+		embeddedURL = cfg.GetConnectionURL() + "?sslmode=disable"
+	})
+	if embeddedErr != nil {
+		t.Fatalf("start embedded postgres: %v", embeddedErr)
+	}
+	return embeddedURL
+}
+
+// withSearchPath points a connection string at schema.
+func withSearchPath(conn, schema string) string {
+	u, err := url.Parse(conn)
+	if err != nil || u.Scheme == "" {
+		return conn + " search_path=" + schema
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// storeBackends returns, for each backend, a function opening a new empty
+// Store that is closed when the test ends.
+func storeBackends(t *testing.T) map[string]func(t *testing.T) Store {
+	backends := map[string]func(t *testing.T) Store{
+		"sqlite": func(t *testing.T) Store {
+			db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Close() })
+			return db
+		},
+	}
+	base := postgresURL(t)
+	if base == "" {
+		return backends
+	}
+	backends["postgres"] = func(t *testing.T) Store {
+		admin, err := sql.Open("pgx", base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.Close() })
+		schema := fmt.Sprintf("tasseograph_test_%d", time.Now().UnixNano())
+		if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+		s, err := NewPGStore(withSearchPath(base, schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	return backends
+}
+
+// rawStore gives a test the SQL underneath a Store, for setting up rows
+// the Store won't write (old created_at values, say).
+func rawStore(t *testing.T, s Store) *sqlStore {
+	t.Helper()
+	switch s := s.(type) {
+	case *DB:
+		return &s.sqlStore
+	case *PGStore:
+		return &s.sqlStore
+	}
+	t.Fatalf("unknown Store %T", s)
+	return nil
+}
+
+func TestStoreConformance(t *testing.T) {
+	cases := map[string]func(t *testing.T, s Store){
+		"results":     testStoreResults,
+		"summary":     testStoreSummaryWindow,
+		"prune":       testStorePrune,
+		"retention":   testStoreRetention,
+		"hardware":    testStoreHardware,
+		"labels":      testStoreLabels,
+		"silences":    testStoreSilences,
+		"search":      testStoreSearch,
+		"export":      testStoreExport,
+		"dmesg blobs": testStoreDmesgBlobs,
+		"empty store": testStoreEmpty,
+	}
+	for backend, open := range storeBackends(t) {
+		t.Run(backend, func(t *testing.T) {
+			for name, tc := range cases {
+				t.Run(name, func(t *testing.T) { tc(t, open(t)) })
+			}
+		})
+	}
+}
+
+func testStoreResults(t *testing.T, s Store) {
+	ts := time.Date(2026, 5, 12, 10, 0, 0, 0, time.UTC)
+	want := &protocol.StoredResult{
+		Timestamp:    ts,
+		Hostname:     "db-1",
+		Status:       "warning",
+		Source:       "kmsg",
+		Issues:       []protocol.Issue{{Summary: "ECC corrected", Category: "memory", Evidence: "EDAC MC0: 1 CE"}},
+		Suppressed:   []protocol.Issue{{Summary: "AER corrected"}},
+		Verdicts:     []protocol.Verdict{{Model: "a", Status: "warning"}, {Model: "b", Status: "ok", Confidence: 0.4}},
+		Silenced:     true,
+		RawDmesg:     "EDAC MC0: 1 CE\nsecond line",
+		APILatencyMs: 321,
+		Provider:     "openai",
+		Model:        "gpt-4o-mini",
+	}
+	if err := s.InsertResult(want); err != nil {
+		t.Fatal(err)
+	}
+	if want.ID == 0 {
+		t.Fatal("InsertResult didn't set the id")
+	}
+	for i, st := range []string{"ok", "critical", "error"} {
+		r := &protocol.StoredResult{Timestamp: ts.Add(time.Duration(i+1) * time.Minute), Hostname: "db-1", Status: st}
+		if st == "error" {
+			r.Hostname, r.ErrorClass = "web-1", "timeout"
+		}
+		if err := s.InsertResult(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.QueryResult(want.ID)
+	if err != nil || got == nil {
+		t.Fatalf("QueryResult = %v, %v", got, err)
+	}
+	got.CreatedAt = time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\ngot  %+v\nwant %+v", got, want)
+	}
+	if r, err := s.QueryResult(want.ID + 100); r != nil || err != nil {
+		t.Errorf("QueryResult(missing) = %v, %v; want nil, nil", r, err)
+	}
+
+	byHost, err := s.QueryByHostname("db-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byHost) != 2 || byHost[0].Status != "critical" || byHost[1].Status != "ok" {
+		t.Errorf("QueryByHostname = %+v, want the two newest, newest first", byHost)
+	}
+	nonOK, err := s.QueryNonOK(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nonOK) != 3 || nonOK[0].Hostname != "web-1" || nonOK[0].ErrorClass != "timeout" {
+		t.Errorf("QueryNonOK = %+v", nonOK)
+	}
+	counts, err := s.StatusCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"ok": 1, "warning": 1, "critical": 1, "error": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("StatusCounts = %v, want %v", counts, want)
+	}
+}
+
+func testStoreSummaryWindow(t *testing.T, s Store) {
+	since := time.Date(2026, 5, 12, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	dimm := protocol.Issue{Summary: "DIMM_B2 uncorrectable", Category: "memory"}
+	link := protocol.Issue{Summary: "link flapping", Category: "network"}
+	for i, r := range []protocol.StoredResult{
+		{Hostname: "db-1", Status: "critical", Issues: []protocol.Issue{dimm}, APILatencyMs: 100},
+		{Hostname: "db-1", Status: "critical", Issues: []protocol.Issue{dimm}, APILatencyMs: 300, Silenced: true},
+		{Hostname: "db-1", Status: "warning", Issues: []protocol.Issue{dimm, link}, APILatencyMs: 200,
+			Verdicts: []protocol.Verdict{{Model: "a", Status: "warning"}, {Model: "b", Status: "ok"}}},
+		{Hostname: "web-1", Status: "error", ErrorClass: "rate_limited", APILatencyMs: 9000},
+		{Hostname: "web-1", Status: "ok", Issues: []protocol.Issue{}},
+	} {
+		r.Timestamp = since.Add(time.Duration(i+1) * time.Hour)
+		if err := s.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := protocol.StoredResult{Timestamp: until.Add(time.Hour), Hostname: "db-9", Status: "critical"}
+	if err := s.InsertResult(&outside); err != nil {
+		t.Fatal(err)
+	}
+	silence := protocol.Silence{Hostname: "db-*", StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour), Reason: "DIMM swap"}
+	if err := s.AddSilence(&silence); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := s.SummaryWindow(since, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Total != 5 || w.StatusCounts["critical"] != 2 || w.StatusCounts["ok"] != 1 {
+		t.Errorf("Total = %d, StatusCounts = %v", w.Total, w.StatusCounts)
+	}
+	if !reflect.DeepEqual(w.Silenced, map[string]int{"critical": 1}) {
+		t.Errorf("Silenced = %v", w.Silenced)
+	}
+	if !reflect.DeepEqual(w.ErrorClasses, map[string]int{"rate_limited": 1}) {
+		t.Errorf("ErrorClasses = %v", w.ErrorClasses)
+	}
+	if len(w.Hostnames) != 2 || w.Hostnames[0].Hostname != "db-1" || w.Hostnames[0].Total != 3 ||
+		!w.Hostnames[0].LastSeen.Equal(since.Add(3*time.Hour)) {
+		t.Errorf("Hostnames = %+v", w.Hostnames)
+	}
+	if w.LatencyAvgMs != 200 || w.LatencyMaxMs != 300 {
+		t.Errorf("latency avg/max = %d/%d, want 200/300", w.LatencyAvgMs, w.LatencyMaxMs)
+	}
+	wantTop := []IssueCount{{dimm.Summary, 2}, {link.Summary, 1}}
+	if !reflect.DeepEqual(w.TopIssues, wantTop) {
+		t.Errorf("TopIssues = %+v, want %+v", w.TopIssues, wantTop)
+	}
+	if len(w.Criticals) != 1 || w.Criticals[0].Silenced {
+		t.Errorf("Criticals = %+v, want the one unsilenced", w.Criticals)
+	}
+	if w.ConsensusChecks != 1 || len(w.Disagreements) != 1 {
+		t.Errorf("consensus = %d checks, %d disagreements", w.ConsensusChecks, len(w.Disagreements))
+	}
+	// The silence starts now, long after the window.
+	if len(w.Silences) != 0 {
+		t.Errorf("Silences = %+v", w.Silences)
+	}
+}
+
+func testStorePrune(t *testing.T, s Store) {
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		r := protocol.StoredResult{Timestamp: now, Hostname: "h", Status: "ok"}
+		if err := s.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metric := []protocol.Metric{{Name: "edac_ce", Kind: protocol.MetricCounter, Value: 1}}
+	if err := s.InsertMetrics("h", now, metric); err != nil {
+		t.Fatal(err)
+	}
+	raw := rawStore(t, s)
+	old := now.AddDate(0, 0, -40).Format("2006-01-02 15:04:05")
+	for _, q := range []string{`UPDATE results SET created_at = ? WHERE id = 1`, `UPDATE metrics SET created_at = ?`} {
+		if _, err := raw.exec(q, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := s.PruneOlderThan(0); n != 0 || err != nil {
+		t.Errorf("PruneOlderThan(0) = %d, %v; want a no-op", n, err)
+	}
+	n, err := s.PruneOlderThan(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("pruned %d rows, want 2", n)
+	}
+	if counts, _ := s.StatusCounts(); counts["ok"] != 2 {
+		t.Errorf("after prune: %v", counts)
+	}
+}
+
+func testStoreRetention(t *testing.T, s Store) {
+	now := time.Now().UTC()
+	raw := rawStore(t, s)
+	// Two results of each status, one 10 and one 100 days old.
+	for _, status := range []string{"ok", "warning", "critical", "error"} {
+		for _, age := range []int{10, 100} {
+			r := protocol.StoredResult{Timestamp: now, Hostname: "h", Status: status, RawDmesg: "nvme0: I/O timeout",
+				Issues: []protocol.Issue{{Summary: "NVMe timeout", Evidence: "nvme0: controller reset"}}}
+			if err := s.InsertResult(&r); err != nil {
+				t.Fatal(err)
+			}
+			created := now.AddDate(0, 0, -age).Format("2006-01-02 15:04:05")
+			if _, err := raw.exec(`UPDATE results SET created_at = ? WHERE id = ?`, created, r.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	rules := []config.RetentionRule{
+		{Status: "critical", Days: 365, Action: config.RetentionDelete},
+		{Status: "warning", Days: 90, Action: config.RetentionDelete},
+		{Status: "ok", Days: 7, Action: config.RetentionDropDmesg},
+		{Status: "ok", Days: 300, Action: config.RetentionDelete},
+	}
+	stats, err := s.Prune(50, rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The old warning by its rule, the old error by retention_days.
+	if stats.Deleted != 2 || stats.Dropped != 2 || stats.Reclaimed < 0 {
+		t.Errorf("Prune = %+v, want 2 deleted and 2 dropped", stats)
+	}
+	want := map[string]int{"ok": 2, "warning": 1, "critical": 2, "error": 1}
+	if counts, _ := s.StatusCounts(); !reflect.DeepEqual(counts, want) {
+		t.Errorf("after prune: %v, want %v", counts, want)
+	}
+	kept, err := s.QueryByHostname("h", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range kept {
+		if (r.Status == "ok") != (r.RawDmesg == "") || len(r.Issues) != 1 {
+			t.Errorf("%s result %d: dmesg %q, issues %v", r.Status, r.ID, r.RawDmesg, r.Issues)
+		}
+	}
+	// Dropped text is out of the search index; issues are still in it.
+	hits, err := s.Search(SearchQuery{Query: "I/O timeout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 4 {
+		t.Errorf("dmesg search found %d results, want 4", len(hits))
+	}
+	if hits, _ := s.Search(SearchQuery{Query: "NVMe timeout"}); len(hits) != 6 {
+		t.Errorf("issue search found %d results, want 6", len(hits))
+	}
+
+	if stats, err := s.Prune(50, rules, nil); err != nil || stats.Deleted != 0 || stats.Dropped != 0 {
+		t.Errorf("second Prune = %+v, %v", stats, err)
+	}
+}
+
+func testStoreSearch(t *testing.T, s Store) {
+	ts := time.Date(2026, 5, 12, 10, 0, 0, 0, time.UTC)
+	for _, r := range []protocol.StoredResult{
+		{Timestamp: ts, Hostname: "web-1", Status: "critical", RawDmesg: "[1.0] pcieport 0000:00:1c.0: AER: Uncorrected (Fatal) error received\n[1.1] eth0: link up",
+			Issues: []protocol.Issue{{Summary: "PCIe fatal error", Evidence: "AER: Uncorrected (Fatal)", Category: "driver"}}},
+		{Timestamp: ts.Add(time.Hour), Hostname: "web-2", Status: "ok", RawDmesg: "[2.0] AER: Corrected error received, Uncorrected count 0"},
+		{Timestamp: ts.Add(2 * time.Hour), Hostname: "db-1", Status: "warning", RawDmesg: "[3.0] EDAC MC0: 1 CE memory read error",
+			Issues: []protocol.Issue{{Summary: "Correctable ECC errors on DIMM", Evidence: "EDAC MC0: 1 CE", Category: "memory"}}},
+	} {
+		if err := s.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(hits []SearchHit) []int64 {
+		var out []int64
+		for _, h := range hits {
+			out = append(out, h.ResultID)
+		}
+		return out
+	}
+
+	hits, err := s.Search(SearchQuery{Query: `"AER: Uncorrected"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].ResultID != 1 || hits[0].Hostname != "web-1" || hits[0].Status != "critical" || !hits[0].Timestamp.Equal(ts) {
+		t.Fatalf("phrase search = %+v", hits)
+	}
+	if !strings.Contains(hits[0].Snippet, "**AER: Uncorrected**") || strings.Contains(hits[0].Snippet, "\n") {
+		t.Errorf("snippet = %q", hits[0].Snippet)
+	}
+	if hits, _ := s.Search(SearchQuery{Query: "AER: Uncorrected"}); fmt.Sprint(ids(hits)) != "[2 1]" {
+		t.Errorf("word search = %v, want [2 1] (newest first)", ids(hits))
+	}
+	if hits, _ := s.Search(SearchQuery{Query: "dimm"}); fmt.Sprint(ids(hits)) != "[3]" {
+		t.Errorf("issue summary search = %v, want [3]", ids(hits))
+	}
+	if hits, _ := s.Search(SearchQuery{Query: "uncorrected", Hostname: "web-1"}); fmt.Sprint(ids(hits)) != "[1]" {
+		t.Errorf("host filter = %v, want [1]", ids(hits))
+	}
+	if hits, _ := s.Search(SearchQuery{Query: "uncorrected", Since: ts.Add(30 * time.Minute), Until: ts.Add(90 * time.Minute)}); fmt.Sprint(ids(hits)) != "[2]" {
+		t.Errorf("time filter = %v, want [2]", ids(hits))
+	}
+	if hits, _ := s.Search(SearchQuery{Query: "uncorrected", Limit: 1}); fmt.Sprint(ids(hits)) != "[2]" {
+		t.Errorf("limit = %v, want [2]", ids(hits))
+	}
+	// Operator syntax is searched for, not obeyed.
+	if hits, err := s.Search(SearchQuery{Query: `AER OR NEAR(x) -link dmesg:edac`}); err != nil || len(hits) != 0 {
+		t.Errorf("operators = %v, %v; want no hits and no error", ids(hits), err)
+	}
+	for _, q := range []SearchQuery{{Query: " :: "}, {Query: "aer", Since: ts, Until: ts}} {
+		if _, err := s.Search(q); !errors.Is(err, ErrInvalidSearch) {
+			t.Errorf("Search(%+v) err = %v, want ErrInvalidSearch", q, err)
+		}
+	}
+
+	// Pruned results leave the index with them.
+	if _, err := rawStore(t, s).exec(`UPDATE results SET created_at = ? WHERE id = 1`, "2000-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PruneOlderThan(30); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _ := s.Search(SearchQuery{Query: `"AER: Uncorrected"`}); len(hits) != 0 {
+		t.Errorf("pruned result still found: %v", ids(hits))
+	}
+}
+
+func testStoreHardware(t *testing.T, s Store) {
+	t0 := time.Date(2026, 5, 12, 0, 0, 0, 0, time.UTC)
+	ce := func(v float64) []protocol.Metric {
+		return []protocol.Metric{
+			{Name: "edac_ce", Kind: protocol.MetricCounter, Labels: map[string]string{"dimm": "B2"}, Value: v},
+			{Name: "temp", Kind: "gauge", Value: v},
+		}
+	}
+	for i, v := range []float64{10, 12} {
+		if err := s.InsertMetrics("db-1", t0.Add(time.Duration(i)*time.Hour), ce(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	incs, err := s.CounterIncreases("db-1", t0.Add(2*time.Hour), ce(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(incs) != 1 || incs[0].Delta != 8 || !incs[0].HasPrevRate || incs[0].PrevRatePerHour != 2 || !incs[0].TrendingUp() {
+		t.Errorf("CounterIncreases = %+v", incs)
+	}
+	if incs, _ := s.CounterIncreases("db-2", t0.Add(2*time.Hour), ce(20)); len(incs) != 0 {
+		t.Errorf("another host's history was used: %+v", incs)
+	}
+
+	snap := protocol.SmartSnapshot{Device: "/dev/nvme0", Serial: "S1", Protocol: protocol.SmartNVMe, MediaErrors: 1}
+	if err := s.InsertSmart("db-1", t0, []protocol.SmartSnapshot{snap}); err != nil {
+		t.Fatal(err)
+	}
+	snap.MediaErrors = 4
+	lines, err := s.SmartChanges("db-1", t0.Add(time.Hour), []protocol.SmartSnapshot{snap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], "media errors +3") {
+		t.Errorf("SmartChanges = %q", lines)
+	}
+}
+
+func testStoreLabels(t *testing.T, s Store) {
+	aer := protocol.Issue{Summary: "AER corrected", Category: "pcie", Evidence: "pcieport 0000:00:1c.0: AER: Corrected error received: 0000:01:00.0"}
+	ecc := protocol.Issue{Summary: "ECC", Category: "memory", Evidence: "EDAC MC0: 1 CE on DIMM_B2"}
+	var ids []int64
+	for _, host := range []string{"web-1", "web-2"} {
+		r := protocol.StoredResult{Timestamp: time.Now(), Hostname: host, Status: "warning", Issues: []protocol.Issue{aer, ecc}, RawDmesg: aer.Evidence + "\n" + ecc.Evidence}
+		if err := s.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, r.ID)
+	}
+	zero := 0
+	for _, id := range ids {
+		l := protocol.Label{ResultID: id, Issue: &zero, Verdict: protocol.LabelFalsePositive, Author: "sam"}
+		if err := s.AddLabel(&l); err != nil {
+			t.Fatal(err)
+		}
+		if l.ID == 0 || len(l.Issues) != 1 || l.Issues[0].Summary != aer.Summary {
+			t.Errorf("label = %+v", l)
+		}
+	}
+	if err := s.AddLabel(&protocol.Label{ResultID: ids[0] + 100, Verdict: protocol.LabelTruePositive}); err == nil {
+		t.Error("label on a missing result stored")
+	}
+
+	labels, err := s.QueryLabels(1)
+	if err != nil || len(labels) != 1 || labels[0].ResultID != ids[1] {
+		t.Errorf("QueryLabels(1) = %+v, %v", labels, err)
+	}
+	if err := s.RebuildSuppressions(2); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := s.Suppressions()
+	if err != nil || len(rules) != 1 || rules[0].FalsePositives != 2 || rules[0].CreatedAt.IsZero() {
+		t.Fatalf("Suppressions = %+v, %v", rules, err)
+	}
+	// Rebuilding again updates the rule in place.
+	if err := s.RebuildSuppressions(2); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &protocol.StoredResult{Hostname: "web-3", Status: "warning", Issues: []protocol.Issue{aer, ecc}}
+	if err := s.suppress(r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Issues) != 1 || len(r.Suppressed) != 1 || r.Suppressed[0].Summary != aer.Summary {
+		t.Errorf("suppress = %+v", r)
+	}
+	fps, err := s.RecentFalsePositives(5)
+	if err != nil || len(fps) != 1 {
+		t.Errorf("RecentFalsePositives = %+v, %v", fps, err)
+	}
+	var buf bytes.Buffer
+	if n, err := s.ExportCorpus(&buf); err != nil || n != 2 {
+		t.Errorf("ExportCorpus = %d, %v", n, err)
+	}
+
+	if err := s.RebuildSuppressions(0); err != nil {
+		t.Fatal(err)
+	}
+	if rules, _ := s.Suppressions(); len(rules) != 0 {
+		t.Errorf("rules left with suppression off: %+v", rules)
+	}
+}
+
+func testStoreSilences(t *testing.T, s Store) {
+	now := time.Now().UTC()
+	active := protocol.Silence{Hostname: "db-*", Category: "memory", EndsAt: now.Add(time.Hour), Reason: "DIMM swap", Author: "sam"}
+	later := protocol.Silence{Summary: "(?i)firmware", StartsAt: now.Add(2 * time.Hour), EndsAt: now.Add(3 * time.Hour), Reason: "rollout"}
+	for _, si := range []*protocol.Silence{&active, &later} {
+		if err := s.AddSilence(si); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddSilence(&protocol.Silence{EndsAt: now.Add(time.Hour), Reason: "x"}); err == nil {
+		t.Error("silence without a matcher stored")
+	}
+
+	list, err := s.QuerySilences(now, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != active.ID || list[0].Author != "sam" || !list[0].EndsAt.Equal(active.EndsAt) {
+		t.Errorf("QuerySilences = %+v", list)
+	}
+	if list, _ := s.QuerySilences(now, now); len(list) != 1 {
+		t.Errorf("silences in force now = %+v", list)
+	}
+
+	r := &protocol.StoredResult{Timestamp: now, Hostname: "db-7", Status: "critical", Issues: []protocol.Issue{{Summary: "ECC", Category: "memory"}}}
+	if err := s.silence(r); err != nil || !r.Silenced {
+		t.Errorf("silence = %v, %v; want the result silenced", r.Silenced, err)
+	}
+
+	if ok, err := s.ExpireSilence(active.ID); !ok || err != nil {
+		t.Errorf("ExpireSilence = %v, %v", ok, err)
+	}
+	if ok, _ := s.ExpireSilence(active.ID); ok {
+		t.Error("expired a silence twice")
+	}
+	r.Silenced = false
+	if err := s.silence(r); err != nil || r.Silenced {
+		t.Errorf("after expiry: silenced = %v, %v", r.Silenced, err)
+	}
+}
+
+func testStoreDmesgBlobs(t *testing.T, s Store) {
+	var lines []string
+	for i := 0; i < 300; i++ {
+		lines = append(lines, fmt.Sprintf("[%d.000000] EDAC MC0: 1 CE memory read error on CPU_SrcID#0_Ha#0_Chan#1_DIMM#0 (page:0x%x)", i, i))
+	}
+	boot := strings.Join(lines, "\n")
+	raw := rawStore(t, s)
+	count := func(table string) int {
+		var n int
+		if err := raw.queryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// The same lines on two hosts, then again after a new one.
+	now := time.Now().UTC()
+	for _, text := range []string{boot, boot, "[300.000000] eth0: link up\n" + boot, ""} {
+		r := protocol.StoredResult{Timestamp: now, Hostname: "h", Status: "ok", RawDmesg: text}
+		if err := s.InsertResult(&r); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.QueryResult(r.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.RawDmesg != text {
+			t.Fatalf("result %d: dmesg doesn't round-trip: %d bytes stored, %d read", r.ID, len(text), len(got.RawDmesg))
+		}
+	}
+	blobs := count("dmesg_blobs")
+	if want := len(dmesgChunks(boot)) + 2; blobs > want {
+		t.Errorf("%d blobs for three copies of one boot, want at most %d", blobs, want)
+	}
+	var stored int
+	if err := raw.queryRow(`SELECT COUNT(*) FROM results WHERE raw_dmesg IS NOT NULL`).Scan(&stored); err != nil || stored != 0 {
+		t.Errorf("%d results kept their text in raw_dmesg (%v)", stored, err)
+	}
+
+	// A result from before blobs, compacted into the ones already there.
+	if _, err := raw.exec(`INSERT INTO results (timestamp, hostname, status, issues, raw_dmesg) VALUES (?, 'old', 'ok', '[]', ?)`,
+		now.Format(time.RFC3339), boot); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rows != 1 || stats.TextBytes != int64(len(boot)) || stats.BlobBytes != 0 || stats.SizeBefore <= 0 || stats.SizeAfter <= 0 {
+		t.Errorf("Compact = %+v", stats)
+	}
+	if got, err := s.QueryByHostname("old", 1); err != nil || len(got) != 1 || got[0].RawDmesg != boot {
+		t.Errorf("compacted result doesn't read back (%v)", err)
+	}
+	if stats, err := s.Compact(); err != nil || stats.Rows != 0 {
+		t.Errorf("second Compact = %+v, %v", stats, err)
+	}
+
+	// Pruning the results leaves no blobs behind.
+	if _, err := raw.exec(`UPDATE results SET created_at = ?`, "2000-01-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PruneOlderThan(30); err != nil {
+		t.Fatal(err)
+	}
+	if n, m := count("dmesg_blobs"), count("result_dmesg"); n != 0 || m != 0 {
+		t.Errorf("after prune: %d blobs, %d links", n, m)
+	}
+}
+
+func testStoreEmpty(t *testing.T, s Store) {
+	w, err := s.SummaryWindow(time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Total != 0 || w.LatencyAvgMs != 0 || len(w.TopIssues) != 0 {
+		t.Errorf("empty window = %+v", w)
+	}
+	if counts, err := s.StatusCounts(); err != nil || len(counts) != 0 {
+		t.Errorf("StatusCounts = %v, %v", counts, err)
+	}
+	if rules, err := s.Suppressions(); err != nil || len(rules) != 0 {
+		t.Errorf("Suppressions = %v, %v", rules, err)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	pg := &sqlStore{postgres: true}
+	got := pg.rebind(`SELECT '?' FROM t WHERE a = ? AND b IN (?, ?)`)
+	if want := `SELECT '?' FROM t WHERE a = $1 AND b IN ($2, $3)`; got != want {
+		t.Errorf("rebind = %q, want %q", got, want)
+	}
+	if got := (&sqlStore{}).rebind(`a = ?`); got != `a = ?` {
+		t.Errorf("SQLite rebind = %q", got)
+	}
+}
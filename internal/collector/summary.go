@@ -12,16 +12,28 @@ import (
 )
 
 // SummaryWindow aggregates everything the digest needs about a time window.
-// Populated by (*DB).SummaryWindow; consumed by BuildSummary.
+// Populated by Store.SummaryWindow; consumed by BuildDigest.
 type SummaryWindow struct {
 	Since, Until time.Time
 	Total        int
 	StatusCounts map[string]int
+	ErrorClasses map[string]int // error/llm_unavailable rows by LLMError class
 	Hostnames    []HostnameStat
 	TopIssues    []IssueCount
 	LatencyAvgMs int64
 	LatencyMaxMs int64
 	Criticals    []protocol.StoredResult
+
+	// Silenced results by status, and the silences in force during the
+	// window. Silenced rows still count in StatusCounts but not towards
+	// the digest's severity, TopIssues or Criticals.
+	Silenced map[string]int
+	Silences []protocol.Silence
+
+	// Consensus checks in the window, and the ones where the models didn't
+	// all give the same status.
+	ConsensusChecks int
+	Disagreements   []protocol.StoredResult
 }
 
 type HostnameStat struct {
@@ -46,17 +58,19 @@ var pipelineErrorStatuses = map[string]bool{
 // SummaryWindow runs one query per dimension instead of trying to cram
 // everything into a single SQL statement. Volumes are small (one row per
 // agent poll per host), so the I/O is negligible and the code stays readable.
-func (d *DB) SummaryWindow(since, until time.Time) (*SummaryWindow, error) {
+func (d *sqlStore) SummaryWindow(since, until time.Time) (*SummaryWindow, error) {
 	w := &SummaryWindow{
 		Since:        since,
 		Until:        until,
 		StatusCounts: map[string]int{},
+		ErrorClasses: map[string]int{},
+		Silenced:     map[string]int{},
 	}
 	sinceStr := since.UTC().Format(time.RFC3339)
 	untilStr := until.UTC().Format(time.RFC3339)
 
 	// Total + status counts.
-	rows, err := d.db.Query(
+	rows, err := d.query(
 		`SELECT status, COUNT(*) FROM results
 		 WHERE timestamp >= ? AND timestamp <= ?
 		 GROUP BY status`,
@@ -77,9 +91,57 @@ func (d *DB) SummaryWindow(since, until time.Time) (*SummaryWindow, error) {
 	}
 	rows.Close()
 
+	rows, err = d.query(
+		`SELECT status, COUNT(*) FROM results
+		 WHERE timestamp >= ? AND timestamp <= ?
+		   AND silenced
+		 GROUP BY status`,
+		sinceStr, untilStr,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("silenced counts: %w", err)
+	}
+	for rows.Next() {
+		var st string
+		var n int
+		if err := rows.Scan(&st, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		w.Silenced[st] = n
+	}
+	rows.Close()
+	w.Silences, err = d.QuerySilences(since, until)
+	if err != nil {
+		return nil, fmt.Errorf("silences: %w", err)
+	}
+
+	// Why the failed rows failed. Rows from before error classes were
+	// recorded have none and are counted as "".
+	rows, err = d.query(
+		`SELECT COALESCE(error_class, ''), COUNT(*) FROM results
+		 WHERE timestamp >= ? AND timestamp <= ?
+		   AND status IN ('error', 'llm_unavailable')
+		 GROUP BY 1`,
+		sinceStr, untilStr,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error classes: %w", err)
+	}
+	for rows.Next() {
+		var class string
+		var n int
+		if err := rows.Scan(&class, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		w.ErrorClasses[class] = n
+	}
+	rows.Close()
+
 	// Per-hostname activity. Useful both for fleet visibility and for spotting
 	// agents that have gone silent (low Total relative to the rest).
-	rows, err = d.db.Query(
+	rows, err = d.query(
 		`SELECT hostname, COUNT(*) AS n, MAX(timestamp) AS last_seen
 		 FROM results
 		 WHERE timestamp >= ? AND timestamp <= ?
@@ -105,7 +167,7 @@ func (d *DB) SummaryWindow(since, until time.Time) (*SummaryWindow, error) {
 	// Latency stats. Restrict to successful analyses; error rows have
 	// latency too but it's noise for "how fast is the LLM."
 	var avg, maxLat sql.NullFloat64
-	err = d.db.QueryRow(
+	err = d.queryRow(
 		`SELECT AVG(api_latency_ms), MAX(api_latency_ms) FROM results
 		 WHERE timestamp >= ? AND timestamp <= ?
 		   AND api_latency_ms > 0
@@ -123,12 +185,20 @@ func (d *DB) SummaryWindow(since, until time.Time) (*SummaryWindow, error) {
 	}
 
 	// Issue summaries -- exploded out of the JSON column and grouped. The
-	// json_each table-valued function ships with modernc.org/sqlite by default.
-	rows, err = d.db.Query(
-		`SELECT json_extract(value, '$.summary') AS summary, COUNT(*) AS n
-		 FROM results, json_each(results.issues)
+	// json_each table-valued function ships with modernc.org/sqlite by
+	// default; PostgreSQL has jsonb_array_elements, which errors on anything
+	// but an array.
+	exploded := `SELECT json_extract(value, '$.summary') AS summary, COUNT(*) AS n
+		 FROM results, json_each(results.issues)`
+	if d.postgres {
+		exploded = `SELECT issue->>'summary' AS summary, COUNT(*) AS n
+		 FROM results, jsonb_array_elements(CASE WHEN jsonb_typeof(NULLIF(issues, '')::jsonb) = 'array' THEN issues::jsonb ELSE '[]'::jsonb END) AS issue`
+	}
+	rows, err = d.query(
+		exploded+`
 		 WHERE timestamp >= ? AND timestamp <= ?
 		   AND status IN ('warning','critical')
+		   AND NOT silenced
 		   AND issues IS NOT NULL AND issues != '' AND issues != 'null'
 		 GROUP BY summary
 		 ORDER BY n DESC
@@ -149,21 +219,46 @@ func (d *DB) SummaryWindow(since, until time.Time) (*SummaryWindow, error) {
 	rows.Close()
 
 	// Full criticals (small N, we want all of them in the email body).
-	rows, err = d.db.Query(
+	rows, err = d.query(
 		`SELECT `+resultColumns+`
 		 FROM results
 		 WHERE timestamp >= ? AND timestamp <= ?
 		   AND status = 'critical'
+		   AND NOT silenced
 		 ORDER BY timestamp DESC`,
 		sinceStr, untilStr,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("criticals: %w", err)
 	}
-	w.Criticals, err = scanResults(rows)
+	w.Criticals, err = d.scanResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consensus checks. How often the models disagree is a measure of how
+	// far to trust any one of them.
+	rows, err = d.query(
+		`SELECT `+resultColumns+`
+		 FROM results
+		 WHERE timestamp >= ? AND timestamp <= ?
+		   AND verdicts IS NOT NULL
+		 ORDER BY timestamp DESC`,
+		sinceStr, untilStr,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("consensus checks: %w", err)
+	}
+	checks, err := d.scanResults(rows)
 	if err != nil {
 		return nil, err
 	}
+	w.ConsensusChecks = len(checks)
+	for _, r := range checks {
+		if disagree(r.Verdicts) {
+			w.Disagreements = append(w.Disagreements, r)
+		}
+	}
 
 	return w, nil
 }
@@ -171,14 +266,33 @@ func (d *DB) SummaryWindow(since, until time.Time) (*SummaryWindow, error) {
 // BuildSummary renders an email subject and body for the window between
 // `since` and `now`. alertErrorRate is the threshold (0..1) at which
 // pipeline-error dominance escalates the digest to [CRITICAL].
-func BuildSummary(db *DB, since, now time.Time, alertErrorRate float64) (subject, body string, err error) {
-	w, err := db.SummaryWindow(since, now)
+func BuildSummary(db Store, since, now time.Time, alertErrorRate float64) (subject, body string, err error) {
+	d, err := BuildDigest(db, since, now, alertErrorRate, "")
 	if err != nil {
 		return "", "", err
 	}
+	return d.Subject, d.Text, nil
+}
 
-	criticalCount := w.StatusCounts["critical"]
-	warningCount := w.StatusCounts["warning"]
+// Digest is the digest email: BuildSummary's subject and text body, and
+// the same window rendered as HTML.
+type Digest struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// BuildDigest is BuildSummary with an HTML body as well. resultURL links
+// each result in the HTML to the collector API or a UI: "{id}" in it is
+// replaced by the result id. Empty leaves results unlinked.
+func BuildDigest(db Store, since, now time.Time, alertErrorRate float64, resultURL string) (*Digest, error) {
+	w, err := db.SummaryWindow(since, now)
+	if err != nil {
+		return nil, err
+	}
+
+	criticalCount := w.StatusCounts["critical"] - w.Silenced["critical"]
+	warningCount := w.StatusCounts["warning"] - w.Silenced["warning"]
 	errorCount := 0
 	for st := range w.StatusCounts {
 		if pipelineErrorStatuses[st] {
@@ -208,11 +322,62 @@ func BuildSummary(db *DB, since, now time.Time, alertErrorRate float64) (subject
 		headline = fmt.Sprintf("%d warning", warningCount)
 	}
 
-	subject = fmt.Sprintf("[%s] tasseograph %s -- %s",
-		severity, formatWindow(since, now), headline)
+	html, err := renderHTML(w, severity, headline, errorRate, resultURL)
+	if err != nil {
+		return nil, fmt.Errorf("render html: %w", err)
+	}
+	return &Digest{
+		Subject: fmt.Sprintf("[%s] tasseograph %s -- %s", severity, formatWindow(since, now), headline),
+		Text:    renderBody(w, errorRate),
+		HTML:    html,
+	}, nil
+}
 
-	body = renderBody(w, errorRate)
-	return subject, body, nil
+// errorClassHints explains each LLM error class in the digest.
+var errorClassHints = map[ErrorClass]string{
+	ClassTransport:   "couldn't reach the endpoint",
+	ClassRateLimited: "rate limited (429)",
+	ClassServer:      "endpoint returned 5xx or timed out",
+	ClassAuth:        "API key rejected (401/403) -- check api_key_env",
+	ClassBadRequest:  "request rejected (4xx) -- check model name and token limits",
+	ClassParse:       "reply wasn't the JSON we asked for",
+	ClassValidation:  "reply had an unknown status or an issue with no summary",
+	ClassCircuitOpen: "skipped while the endpoint's circuit breaker was open",
+}
+
+// renderErrorClasses breaks the LLM error rate down by cause, most common
+// first.
+func renderErrorClasses(sb *strings.Builder, classes map[string]int) {
+	if len(classes) == 0 {
+		return
+	}
+	for _, class := range byCount(classes) {
+		label, hint := errorClassLabel(class)
+		fmt.Fprintf(sb, "  %-12s %4d  %s\n", label, classes[class], hint)
+	}
+}
+
+// byCount returns the keys of counts, largest count first.
+func byCount(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// errorClassLabel names an error class and explains it.
+func errorClassLabel(class string) (label, hint string) {
+	if class == "" {
+		return "unknown", "no cause recorded"
+	}
+	return class, errorClassHints[ErrorClass(class)]
 }
 
 // formatWindow renders the digest window concisely. A 24h window becomes
@@ -269,6 +434,7 @@ func renderBody(w *SummaryWindow, errorRate float64) string {
 		if errorRate >= 0.5 {
 			sb.WriteString("  -> check `journalctl -u tasseograph-collector` -- the LLM endpoint is likely broken.\n")
 		}
+		renderErrorClasses(&sb, w.ErrorClasses)
 		sb.WriteString("\n")
 	}
 
@@ -279,7 +445,8 @@ func renderBody(w *SummaryWindow, errorRate float64) string {
 	if len(w.Criticals) > 0 {
 		sb.WriteString("CRITICAL events:\n")
 		for _, r := range w.Criticals {
-			fmt.Fprintf(&sb, "  %s  %s\n", r.Timestamp.UTC().Format(time.RFC3339), r.Hostname)
+			// The result id is what `tasseograph label add` takes.
+			fmt.Fprintf(&sb, "  %s  %s  (result %d)\n", r.Timestamp.UTC().Format(time.RFC3339), r.Hostname, r.ID)
 			for _, iss := range r.Issues {
 				fmt.Fprintf(&sb, "    - %s\n      evidence: %s\n", iss.Summary, truncate(iss.Evidence, 200))
 			}
@@ -287,6 +454,29 @@ func renderBody(w *SummaryWindow, errorRate float64) string {
 		sb.WriteString("\n")
 	}
 
+	if len(w.Silences) > 0 || len(w.Silenced) > 0 {
+		fmt.Fprintf(&sb, "Silenced: %d critical, %d warning\n", w.Silenced["critical"], w.Silenced["warning"])
+		for _, s := range w.Silences {
+			fmt.Fprintf(&sb, "  #%d  %s  %s to %s  %s\n", s.ID, silenceMatch(s),
+				s.StartsAt.UTC().Format("01-02 15:04"), s.EndsAt.UTC().Format("01-02 15:04"), s.Reason)
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(w.Disagreements) > 0 {
+		fmt.Fprintf(&sb, "Model disagreements: %d of %d consensus checks\n",
+			len(w.Disagreements), w.ConsensusChecks)
+		for i, r := range w.Disagreements {
+			if i == maxDigestDisagreements {
+				fmt.Fprintf(&sb, "  ... and %d more\n", len(w.Disagreements)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "  %s  %s -> %s  (%s)\n",
+				r.Timestamp.UTC().Format(time.RFC3339), r.Hostname, r.Status, votes(r))
+		}
+		sb.WriteString("\n")
+	}
+
 	if len(w.TopIssues) > 0 {
 		sb.WriteString("Top issue summaries (warning + critical):\n")
 		for _, ic := range w.TopIssues {
@@ -307,6 +497,33 @@ func renderBody(w *SummaryWindow, errorRate float64) string {
 	return sb.String()
 }
 
+// silenceMatch lists what a silence matches on.
+func silenceMatch(s protocol.Silence) string {
+	var match []string
+	for _, m := range []string{s.Hostname, s.Category, s.Summary} {
+		if m != "" {
+			match = append(match, m)
+		}
+	}
+	return strings.Join(match, " ")
+}
+
+// votes lists each model's answer in a consensus check.
+func votes(r protocol.StoredResult) string {
+	votes := make([]string, len(r.Verdicts))
+	for i, v := range r.Verdicts {
+		answer := v.Status
+		if answer == "" {
+			answer = "failed (" + v.Error + ")"
+		}
+		votes[i] = v.Model + ": " + answer
+	}
+	return strings.Join(votes, ", ")
+}
+
+// maxDigestDisagreements caps how many disagreements the digest lists.
+const maxDigestDisagreements = 20
+
 func truncate(s string, n int) string {
 	if len(s) <= n {
 		return s
@@ -202,3 +202,93 @@ func TestBuildSummary_RespectsWindow(t *testing.T) {
 		t.Errorf("body must not include rows outside the window\n%s", body)
 	}
 }
+
+func TestBuildSummary_ExplainsErrorClasses(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := NewDB(filepath.Join(dir, "test.db"))
+	defer db.Close()
+
+	now := time.Date(2026, 5, 12, 22, 0, 0, 0, time.UTC)
+	since := now.Add(-24 * time.Hour)
+
+	for i, class := range []string{"auth", "auth", "auth", "parse"} {
+		seedRow(t, db, "host1", "error", since.Add(time.Hour*time.Duration(i+1)), 100, nil)
+		if _, err := db.db.Exec(`UPDATE results SET error_class = ? WHERE id = last_insert_rowid()`, class); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seedRow(t, db, "host1", "ok", since.Add(time.Hour), 100, nil)
+
+	_, body, err := BuildSummary(db, since, now, 0.9)
+	if err != nil {
+		t.Fatalf("BuildSummary: %v", err)
+	}
+	auth := strings.Index(body, "auth")
+	parse := strings.Index(body, "parse")
+	if auth < 0 || parse < 0 || auth > parse {
+		t.Errorf("body should list auth (3) before parse (1)\n%s", body)
+	}
+	if !strings.Contains(body, "api_key_env") {
+		t.Errorf("body should explain what an auth failure means\n%s", body)
+	}
+}
+
+func TestBuildDigest_HTML(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := NewDB(filepath.Join(dir, "test.db"))
+	defer db.Close()
+
+	now := time.Date(2026, 5, 12, 22, 0, 0, 0, time.UTC)
+	since := now.Add(-24 * time.Hour)
+
+	seedRow(t, db, "db-1", "critical", since.Add(time.Hour), 400, []protocol.Issue{
+		{Summary: "PCIe fatal error", Evidence: "pcieport 0000:00:1c.0: AER: <Fatal> error received"},
+	})
+	for i := 0; i < 3; i++ {
+		seedRow(t, db, "web-1", "ok", since.Add(time.Hour*time.Duration(2+i)), 200, nil)
+	}
+
+	d, err := BuildDigest(db, since, now, 0.5, "https://dash.example/results/{id}")
+	if err != nil {
+		t.Fatalf("BuildDigest: %v", err)
+	}
+	subj, body, err := BuildSummary(db, since, now, 0.5)
+	if err != nil {
+		t.Fatalf("BuildSummary: %v", err)
+	}
+	if d.Subject != subj || d.Text != body {
+		t.Errorf("BuildDigest's subject and text differ from BuildSummary's")
+	}
+
+	for _, want := range []string{
+		`<h2 style="margin: 0 0 4px; color: #c62828;">[CRITICAL] 1 critical, 0 warning</h2>`,
+		`<a href="https://dash.example/results/1">result 1</a>`,
+		`<details style="margin-left: 16px;"><summary>PCIe fatal error</summary>`,
+		// Evidence is escaped, not markup.
+		`AER: &lt;Fatal&gt; error received</pre></details>`,
+	} {
+		if !strings.Contains(d.HTML, want) {
+			t.Errorf("HTML missing %s\n%s", want, d.HTML)
+		}
+	}
+	if strings.Contains(d.HTML, "<script") {
+		t.Errorf("HTML carries a script, which mail clients won't run")
+	}
+	// Two pre-sorted host tables: hosts with criticals, then every host
+	// busiest first.
+	crit, busy, ok := strings.Cut(d.HTML[strings.Index(d.HTML, "Hosts with critical events"):], "Per-host activity, busiest first")
+	if !ok || !strings.Contains(crit, "<td>db-1</td>") || strings.Contains(crit, "<td>web-1</td>") {
+		t.Errorf("criticals table should list db-1 alone\n%s", d.HTML)
+	}
+	if web, dbHost := strings.Index(busy, "<td>web-1</td>"), strings.Index(busy, "<td>db-1</td>"); web < 0 || dbHost < 0 || web > dbHost {
+		t.Errorf("host table not sorted by rows\n%s", d.HTML)
+	}
+
+	d, err = BuildDigest(db, since, now, 0.5, "")
+	if err != nil {
+		t.Fatalf("BuildDigest: %v", err)
+	}
+	if strings.Contains(d.HTML, "<a href") || !strings.Contains(d.HTML, "&middot; result 1</p>") {
+		t.Errorf("result linked without a result_url\n%s", d.HTML)
+	}
+}
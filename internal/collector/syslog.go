@@ -0,0 +1,542 @@
+// internal/collector/syslog.go
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+const (
+	// syslogSource tags rows analyzed from forwarded syslog.
+	syslogSource = "syslog"
+	// syslogMaxMessage bounds one message; RFC 5425 requires receivers to
+	// accept at least 2 KiB and recommends 8 KiB.
+	syslogMaxMessage = 64 << 10
+	// syslogMaxLines caps one host's window, matching the agent's cap so a
+	// chatty appliance costs no more than an agent host.
+	syslogMaxLines = 500
+	// syslogMaxHosts is the default cap on hosts buffered per window.
+	syslogMaxHosts = 1000
+	// syslogFlushTimeout bounds the final flush at shutdown.
+	syslogFlushTimeout = 2 * time.Minute
+)
+
+// syslogMessage is one parsed syslog message.
+type syslogMessage struct {
+	Hostname string
+	AppName  string
+	Record   protocol.Record
+}
+
+// parseSyslog parses an RFC 5424 or RFC 3164 message. received stamps
+// messages that carry no usable timestamp and anchors the year of 3164's
+// year-less one.
+func parseSyslog(data []byte, received time.Time) (syslogMessage, error) {
+	s := strings.TrimRight(string(data), "\r\n\x00")
+	if !strings.HasPrefix(s, "<") {
+		return syslogMessage{}, errors.New("missing <PRI>")
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return syslogMessage{}, errors.New("malformed <PRI>")
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri > 191 {
+		return syslogMessage{}, fmt.Errorf("invalid PRI %q", s[1:end])
+	}
+	rest := s[end+1:]
+
+	var m syslogMessage
+	if strings.HasPrefix(rest, "1 ") {
+		m, err = parse5424(rest[2:], received)
+	} else {
+		m = parse3164(rest, received)
+	}
+	if err != nil {
+		return syslogMessage{}, err
+	}
+	m.Record.Level = pri & 7
+	m.Record.Facility = pri >> 3
+	m.Record.Message = stripPrintkTime(m.Record.Message)
+	return m, nil
+}
+
+// parse5424 parses the part after "<PRI>1 ":
+//
+//	TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parse5424(s string, received time.Time) (syslogMessage, error) {
+	fields := make([]string, 0, 5)
+	for len(fields) < 5 {
+		f, after, ok := strings.Cut(s, " ")
+		if !ok {
+			return syslogMessage{}, errors.New("truncated RFC 5424 header")
+		}
+		fields = append(fields, f)
+		s = after
+	}
+
+	m := syslogMessage{Record: protocol.Record{Timestamp: received}}
+	if ts, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		m.Record.Timestamp = ts
+	}
+	if fields[1] != "-" {
+		m.Hostname = fields[1]
+	}
+	if fields[2] != "-" {
+		m.AppName = fields[2]
+	}
+
+	msg, err := skipStructuredData(s)
+	if err != nil {
+		return syslogMessage{}, err
+	}
+	m.Record.Message = strings.TrimPrefix(msg, "\ufeff")
+	return m, nil
+}
+
+// skipStructuredData returns what follows the STRUCTURED-DATA field: either
+// "-" or one or more [id param="value"] elements, where values may contain
+// escaped quotes and brackets.
+func skipStructuredData(s string) (string, error) {
+	if strings.HasPrefix(s, "-") {
+		return strings.TrimPrefix(s[1:], " "), nil
+	}
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case c == ']' && !inQuote:
+			if i+1 < len(s) && s[i+1] == '[' {
+				continue
+			}
+			return strings.TrimPrefix(s[i+1:], " "), nil
+		}
+	}
+	return "", errors.New("unterminated structured data")
+}
+
+// parse3164 parses the part after "<PRI>" in the traditional BSD format:
+//
+//	Feb  3 12:25:01 host kernel: message
+//
+// rsyslog's forwarding template sends an RFC 3339 timestamp in the same
+// position, which is accepted too. Messages without a recognisable
+// timestamp are taken whole, per RFC 3164 section 4.3.3.
+func parse3164(s string, received time.Time) syslogMessage {
+	m := syslogMessage{Record: protocol.Record{Timestamp: received, Message: s}}
+
+	var rest string
+	if first, after, ok := strings.Cut(s, " "); ok {
+		if ts, err := time.Parse(time.RFC3339Nano, first); err == nil {
+			m.Record.Timestamp, rest = ts, after
+		}
+	}
+	if rest == "" && len(s) > 16 {
+		if ts, err := time.ParseInLocation(time.Stamp, s[:15], time.Local); err == nil {
+			ts = ts.AddDate(received.Year(), 0, 0)
+			if ts.After(received.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			m.Record.Timestamp, rest = ts, s[16:]
+		}
+	}
+	if rest == "" {
+		return m
+	}
+
+	host, rest, _ := strings.Cut(rest, " ")
+	m.Hostname = host
+	if tag, msg, ok := strings.Cut(rest, ": "); ok && !strings.ContainsAny(tag, " ") {
+		m.AppName, _, _ = strings.Cut(tag, "[")
+		rest = msg
+	}
+	m.Record.Message = rest
+	return m
+}
+
+// stripPrintkTime drops a leading "[ 5140.900000] " that some forwarders
+// copy from the kernel ring buffer; the syslog header has the real time.
+func stripPrintkTime(msg string) string {
+	if !strings.HasPrefix(msg, "[") {
+		return msg
+	}
+	i := strings.IndexByte(msg, ']')
+	if i < 0 {
+		return msg
+	}
+	if _, err := strconv.ParseFloat(strings.TrimSpace(msg[1:i]), 64); err != nil {
+		return msg
+	}
+	return strings.TrimPrefix(msg[i+1:], " ")
+}
+
+// readSyslogFrame reads one message from a stream, accepting both framings
+// of RFC 6587: octet counting ("123 <13>1 ...") and newline-terminated.
+func readSyslogFrame(br *bufio.Reader) ([]byte, error) {
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '1' && first[0] <= '9' {
+		lenStr, err := br.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(lenStr, " "))
+		if err != nil || n > syslogMaxMessage {
+			return nil, fmt.Errorf("invalid frame length %q", strings.TrimSpace(lenStr))
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+
+	var line []byte
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > syslogMaxMessage {
+			return nil, errors.New("message exceeds maximum size")
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// SyslogReceiver collects kernel-facility syslog from hosts that can't run
+// the agent, gathers each host's messages for one window, then analyzes
+// the window exactly like an agent delta.
+type SyslogReceiver struct {
+	db     Store
+	llm    *LLMClient
+	window time.Duration
+
+	// batcher, when set, lets a window's hosts share LLM calls.
+	batcher *Batcher
+
+	// allowed, when set, are the only sender addresses accepted. maxHosts
+	// bounds the hosts one window buffers: each costs an LLM call, and a
+	// sender can name any host it likes.
+	allowed  []netip.Prefix
+	maxHosts int
+
+	mu       sync.Mutex
+	pending  map[string][]protocol.Record
+	dropped  map[string]int // oldest messages discarded this window, per host
+	rejected int            // messages from senders not allowed, this window
+	overflow int            // messages from hosts past maxHosts, this window
+}
+
+// NewSyslogReceiver creates a receiver that flushes every window.
+func NewSyslogReceiver(db Store, llm *LLMClient, window time.Duration) *SyslogReceiver {
+	return &SyslogReceiver{
+		db:       db,
+		llm:      llm,
+		window:   window,
+		maxHosts: syslogMaxHosts,
+		pending:  make(map[string][]protocol.Record),
+		dropped:  make(map[string]int),
+	}
+}
+
+// allowedSource reports whether remote may send syslog.
+func (s *SyslogReceiver) allowedSource(remote net.Addr) bool {
+	if len(s.allowed) == 0 {
+		return true
+	}
+	var ip netip.Addr
+	switch a := remote.(type) {
+	case *net.UDPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	case *net.TCPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	default:
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range s.allowed {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// reject counts a message from a sender that isn't allowed.
+func (s *SyslogReceiver) reject() {
+	s.mu.Lock()
+	s.rejected++
+	s.mu.Unlock()
+}
+
+// Handle parses one message and buffers it if it's from the kernel
+// facility. remote names the host when the message doesn't.
+func (s *SyslogReceiver) Handle(data []byte, remote net.Addr) {
+	if !s.allowedSource(remote) {
+		s.reject()
+		return
+	}
+	m, err := parseSyslog(data, time.Now())
+	if err != nil {
+		log.Printf("Syslog from %v: %v", remote, err)
+		return
+	}
+	if m.Record.Facility != 0 {
+		return
+	}
+	host := m.Hostname
+	if host == "" && remote != nil {
+		host, _, _ = net.SplitHostPort(remote.String())
+	}
+	if host == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[host]; !ok && s.maxHosts > 0 && len(s.pending) >= s.maxHosts {
+		s.overflow++
+		return
+	}
+	// Keep the window bounded in memory; like the agent, the newest lines
+	// are the ones worth sending.
+	if len(s.pending[host]) >= syslogMaxLines {
+		s.pending[host] = s.pending[host][1:]
+		s.dropped[host]++
+	}
+	s.pending[host] = append(s.pending[host], m.Record)
+}
+
+// Flush analyzes and stores every host's buffered window.
+func (s *SyslogReceiver) Flush(ctx context.Context) {
+	s.mu.Lock()
+	pending, dropped := s.pending, s.dropped
+	rejected, overflow := s.rejected, s.overflow
+	s.pending = make(map[string][]protocol.Record)
+	s.dropped = make(map[string]int)
+	s.rejected, s.overflow = 0, 0
+	s.mu.Unlock()
+
+	if rejected > 0 {
+		log.Printf("WARNING: syslog window rejected %d messages from senders outside syslog_allowed_sources", rejected)
+	}
+	if overflow > 0 {
+		log.Printf("WARNING: syslog window reached %d hosts (syslog_max_hosts); dropped %d messages from further hosts", s.maxHosts, overflow)
+	}
+
+	hosts := make([]string, 0, len(pending))
+	for h := range pending {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, host := range hosts {
+		records := pending[host]
+		// UDP delivery and multiple TCP connections can reorder.
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].Timestamp.Before(records[j].Timestamp)
+		})
+		if n := dropped[host]; n > 0 {
+			log.Printf("WARNING: syslog window for %s truncated to %d lines (dropped %d oldest)", host, syslogMaxLines, n)
+		}
+		lines := make([]string, len(records))
+		for i, r := range records {
+			lines[i] = r.String()
+		}
+		if s.batcher != nil {
+			// Submit every host before waiting so they can share batches.
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+				if _, _, err := s.batcher.Analyze(ctx, host, syslogSource, time.Now(), lines); err != nil && !errors.Is(err, errBatchPending) {
+					log.Printf("DB error: syslog window for %s: %v", host, err)
+				}
+			}(host)
+			continue
+		}
+		if _, _, err := analyzeAndStore(ctx, s.db, s.llm, host, syslogSource, time.Now(), lines); err != nil {
+			log.Printf("DB error: syslog window for %s: %v", host, err)
+		}
+	}
+}
+
+// Run flushes every window until ctx is canceled, then flushes once more so
+// a shutdown doesn't drop the partial window.
+func (s *SyslogReceiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), syslogFlushTimeout)
+			s.Flush(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+			s.Flush(ctx)
+		}
+	}
+}
+
+// ServeUDP reads one message per datagram until conn is closed.
+func (s *SyslogReceiver) ServeUDP(conn net.PacketConn) {
+	buf := make([]byte, syslogMaxMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Syslog UDP: %v", err)
+			}
+			return
+		}
+		s.Handle(buf[:n], addr)
+	}
+}
+
+// ServeTCP accepts stream connections (plain or TLS, depending on ln) until
+// ln is closed or ctx is canceled.
+func (s *SyslogReceiver) ServeTCP(ctx context.Context, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Syslog TCP: %v", err)
+			}
+			return
+		}
+		if !s.allowedSource(conn.RemoteAddr()) {
+			s.reject()
+			conn.Close()
+			continue
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
+
+func (s *SyslogReceiver) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	br := bufio.NewReader(conn)
+	for {
+		msg, err := readSyslogFrame(br)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Syslog from %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(bytes.TrimSpace(msg)) > 0 {
+			s.Handle(msg, conn.RemoteAddr())
+		}
+	}
+}
+
+// startSyslog opens whichever syslog listeners are configured and starts
+// the window flusher. Listeners close when ctx is canceled; the returned
+// channel closes once the final window has been stored, so the caller can
+// hold the DB open until then. A no-op when no syslog address is set.
+func startSyslog(ctx context.Context, db Store, llm *LLMClient, batcher *Batcher, cfg *config.CollectorConfig, tlsConfig *tls.Config) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	if cfg.SyslogUDPAddr == "" && cfg.SyslogTCPAddr == "" && cfg.SyslogTLSAddr == "" {
+		close(done)
+		return done, nil
+	}
+	recv := NewSyslogReceiver(db, llm, cfg.SyslogWindow)
+	recv.batcher = batcher
+	recv.allowed = cfg.SyslogAllowedNets
+	recv.maxHosts = cfg.SyslogMaxHosts
+	if len(recv.allowed) == 0 && (cfg.SyslogUDPAddr != "" || cfg.SyslogTCPAddr != "") {
+		log.Printf("WARNING: syslog listeners accept messages from any address; set syslog_allowed_sources to limit them")
+	}
+	if cfg.SyslogTLSClientCA != "" {
+		pem, err := os.ReadFile(cfg.SyslogTLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("syslog_tls_client_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("syslog_tls_client_ca: no certificates in %s", cfg.SyslogTLSClientCA)
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	var closers []io.Closer
+	fail := func(err error) error {
+		for _, c := range closers {
+			c.Close()
+		}
+		return err
+	}
+	if cfg.SyslogUDPAddr != "" {
+		conn, err := net.ListenPacket("udp", cfg.SyslogUDPAddr)
+		if err != nil {
+			return nil, fail(fmt.Errorf("syslog udp: %w", err))
+		}
+		closers = append(closers, conn)
+		log.Printf("Syslog receiver listening on udp %s", conn.LocalAddr())
+		go recv.ServeUDP(conn)
+	}
+	if cfg.SyslogTCPAddr != "" {
+		ln, err := net.Listen("tcp", cfg.SyslogTCPAddr)
+		if err != nil {
+			return nil, fail(fmt.Errorf("syslog tcp: %w", err))
+		}
+		closers = append(closers, ln)
+		log.Printf("Syslog receiver listening on tcp %s", ln.Addr())
+		go recv.ServeTCP(ctx, ln)
+	}
+	if cfg.SyslogTLSAddr != "" {
+		ln, err := tls.Listen("tcp", cfg.SyslogTLSAddr, tlsConfig)
+		if err != nil {
+			return nil, fail(fmt.Errorf("syslog tls: %w", err))
+		}
+		closers = append(closers, ln)
+		log.Printf("Syslog receiver listening on tls %s", ln.Addr())
+		go recv.ServeTCP(ctx, ln)
+	}
+
+	go func() {
+		<-ctx.Done()
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+	go func() {
+		recv.Run(ctx)
+		close(done)
+	}()
+	return done, nil
+}
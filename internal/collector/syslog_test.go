@@ -0,0 +1,223 @@
+// internal/collector/syslog_test.go
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+func TestParseSyslog5424(t *testing.T) {
+	received := time.Date(2026, 2, 3, 13, 0, 0, 0, time.UTC)
+	m, err := parseSyslog([]byte(`<3>1 2026-02-03T12:25:01.5Z nas01 kernel - - [meta sequenceId="7" note="a \"quoted\" ]"] [ 5140.900000] ata3.00: failed command: READ FPDMA QUEUED`), received)
+	if err != nil {
+		t.Fatalf("parseSyslog: %v", err)
+	}
+	if m.Hostname != "nas01" || m.AppName != "kernel" {
+		t.Errorf("host/app = %q/%q", m.Hostname, m.AppName)
+	}
+	if m.Record.Facility != 0 || m.Record.Level != protocol.LevelErr {
+		t.Errorf("facility/level = %d/%d, want kern/err", m.Record.Facility, m.Record.Level)
+	}
+	if m.Record.Message != "ata3.00: failed command: READ FPDMA QUEUED" {
+		t.Errorf("Message = %q", m.Record.Message)
+	}
+	if !m.Record.Timestamp.Equal(time.Date(2026, 2, 3, 12, 25, 1, 5e8, time.UTC)) {
+		t.Errorf("Timestamp = %v", m.Record.Timestamp)
+	}
+
+	// Nil values fall back to the receive time.
+	m, err = parseSyslog([]byte("<4>1 - - - - - -"), received)
+	if err != nil || !m.Record.Timestamp.Equal(received) || m.Hostname != "" || m.Record.Message != "" {
+		t.Errorf("nil fields = %+v, %v", m, err)
+	}
+}
+
+func TestParseSyslog3164(t *testing.T) {
+	received := time.Date(2026, 2, 3, 13, 0, 0, 0, time.Local)
+	m, err := parseSyslog([]byte("<4>Feb  3 12:25:01 switch7 kernel: EDAC MC0: 1 CE memory read error\n"), received)
+	if err != nil {
+		t.Fatalf("parseSyslog: %v", err)
+	}
+	if m.Hostname != "switch7" || m.AppName != "kernel" || m.Record.Level != protocol.LevelWarning {
+		t.Errorf("got %+v", m)
+	}
+	if m.Record.Message != "EDAC MC0: 1 CE memory read error" {
+		t.Errorf("Message = %q", m.Record.Message)
+	}
+	if want := time.Date(2026, 2, 3, 12, 25, 1, 0, time.Local); !m.Record.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", m.Record.Timestamp, want)
+	}
+
+	// Userspace facility with a pid in the tag.
+	m, _ = parseSyslog([]byte("<30>2026-02-03T12:25:01+00:00 nas01 smartd[812]: Device: /dev/sda, 8 Currently unreadable sectors"), received)
+	if m.Record.Facility != 3 || m.AppName != "smartd" || m.Hostname != "nas01" {
+		t.Errorf("daemon message = %+v", m)
+	}
+
+	for _, bad := range []string{"", "no pri", "<>x", "<999>x", "<ab>x", "<3>1 2026-02-03T12:25:01Z host"} {
+		if _, err := parseSyslog([]byte(bad), received); err == nil {
+			t.Errorf("parseSyslog(%q) accepted malformed message", bad)
+		}
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	want := []string{"<3>1 - h kernel - - a", "<4>Feb  3 12:25:01 h kernel: b", "<3>1 - - - - -"}
+	// Mixed framing on one stream: octet-counted, newline, octet-counted.
+	stream := fmt.Sprintf("%d %s%s\n%d %s", len(want[0]), want[0], want[1], len(want[2]), want[2])
+	br := bufio.NewReader(strings.NewReader(stream))
+	var got []string
+	for {
+		msg, err := readSyslogFrame(br)
+		if err != nil {
+			break
+		}
+		got = append(got, string(msg))
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+
+	if _, err := readSyslogFrame(bufio.NewReader(strings.NewReader("99999999 <3>x"))); err == nil {
+		t.Error("expected error for oversized octet count")
+	}
+}
+
+func TestSyslogReceiverWindows(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	prompts := map[string]string{}
+	mockLLM := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt := req.Messages[len(req.Messages)-1].Content
+		prompts[strings.Fields(prompt)[2]] = prompt
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"content": `{"status": "warning", "issues": []}`}},
+			},
+		})
+	}))
+	defer mockLLM.Close()
+
+	recv := NewSyslogReceiver(db, NewLLMClient([]Endpoint{{URL: mockLLM.URL, Model: "test", APIKey: "key"}}, 0), time.Minute)
+	remote := &net.UDPAddr{IP: net.ParseIP("192.0.2.7"), Port: 514}
+
+	recv.Handle([]byte("<3>1 2026-02-03T12:25:02Z nas01 kernel - - - second"), remote)
+	recv.Handle([]byte("<3>1 2026-02-03T12:25:01Z nas01 kernel - - - first"), remote)
+	recv.Handle([]byte("<30>1 2026-02-03T12:25:01Z nas01 smartd - - - userspace is filtered"), remote)
+	recv.Handle([]byte("<4>1 2026-02-03T12:25:01Z - kernel - - - hostless"), remote)
+	recv.Flush(context.Background())
+
+	results, _ := db.QueryByHostname("nas01", 10)
+	if len(results) != 1 {
+		t.Fatalf("nas01 rows = %d, want 1", len(results))
+	}
+	r := results[0]
+	if r.Status != "warning" || r.Source != syslogSource {
+		t.Errorf("row status/source = %q/%q", r.Status, r.Source)
+	}
+	want := "[2026-02-03T12:25:01Z] kern.err first\n[2026-02-03T12:25:02Z] kern.err second"
+	if r.RawDmesg != want {
+		t.Errorf("raw_dmesg = %q, want %q", r.RawDmesg, want)
+	}
+
+	// No hostname in the message: the sender address stands in.
+	if results, _ := db.QueryByHostname("192.0.2.7", 10); len(results) != 1 {
+		t.Errorf("sender-address rows = %d, want 1", len(results))
+	}
+
+	// An empty window stores nothing.
+	recv.Flush(context.Background())
+	if results, _ := db.QueryByHostname("nas01", 10); len(results) != 1 {
+		t.Errorf("empty flush added rows: %d", len(results))
+	}
+}
+
+func TestSyslogReceiverServeUDPAndTCP(t *testing.T) {
+	db, _ := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+	recv := NewSyslogReceiver(db, nil, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go recv.ServeUDP(pc)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go recv.ServeTCP(ctx, ln)
+
+	udp, _ := net.Dial("udp", pc.LocalAddr().String())
+	udp.Write([]byte("<3>1 2026-02-03T12:25:01Z udp-host kernel - - - over udp"))
+	udp.Close()
+
+	tcp, _ := net.Dial("tcp", ln.Addr().String())
+	tcp.Write([]byte("<3>Feb  3 12:25:01 tcp-host kernel: over tcp\n"))
+	tcp.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		recv.mu.Lock()
+		n := len(recv.pending)
+		recv.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending hosts = %d, want 2", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestSyslogReceiverLimits checks senders outside the allowed networks are
+// turned away, and a window stops taking new hosts at maxHosts.
+func TestSyslogReceiverLimits(t *testing.T) {
+	recv := NewSyslogReceiver(nil, nil, time.Minute)
+	recv.allowed = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	recv.maxHosts = 2
+
+	outside := &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 514}
+	recv.Handle([]byte("<3>1 2026-02-03T12:25:01Z nas01 kernel - - - spoofed"), outside)
+	// IPv4 arriving on a dual-stack socket is still matched.
+	inside := &net.UDPAddr{IP: net.ParseIP("::ffff:192.0.2.7"), Port: 514}
+	for i := 0; i < 5; i++ {
+		recv.Handle([]byte(fmt.Sprintf("<3>1 2026-02-03T12:25:01Z host-%d kernel - - - line", i)), inside)
+	}
+	recv.Handle([]byte("<3>1 2026-02-03T12:25:02Z host-0 kernel - - - known host"), inside)
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	if len(recv.pending) != 2 || len(recv.pending["host-0"]) != 2 || recv.pending["nas01"] != nil {
+		t.Errorf("pending = %v", recv.pending)
+	}
+	if recv.rejected != 1 || recv.overflow != 3 {
+		t.Errorf("rejected %d, overflow %d; want 1, 3", recv.rejected, recv.overflow)
+	}
+}
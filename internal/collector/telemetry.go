@@ -0,0 +1,59 @@
+// internal/collector/telemetry.go
+package collector
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// metricsHandler serves GET /metrics in the Prometheus text format. It
+// carries no log content, so like /health it needs no bearer token.
+func metricsHandler(llm *LLMClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		llm.writeMetrics(w)
+	}
+}
+
+// writeMetrics reports each endpoint's circuit breaker.
+func (c *LLMClient) writeMetrics(w io.Writer) {
+	type sample struct {
+		labels                  string
+		state                   breakerState
+		trips, skipped, retries uint64
+	}
+	samples := make([]sample, len(c.breakers))
+	for i, b := range c.breakers {
+		s := &samples[i]
+		s.labels = fmt.Sprintf(`endpoint="%d",model="%s"`, i+1, promEscape(c.endpoints[i].Model))
+		s.state, s.trips, s.skipped, s.retries = b.snapshot()
+	}
+
+	fmt.Fprintln(w, "# HELP tasseograph_llm_breaker_state Circuit breaker state per LLM endpoint: 0 closed, 1 open, 2 half-open.")
+	fmt.Fprintln(w, "# TYPE tasseograph_llm_breaker_state gauge")
+	for _, s := range samples {
+		fmt.Fprintf(w, "tasseograph_llm_breaker_state{%s} %d\n", s.labels, s.state)
+	}
+	fmt.Fprintln(w, "# HELP tasseograph_llm_breaker_trips_total Times the breaker opened.")
+	fmt.Fprintln(w, "# TYPE tasseograph_llm_breaker_trips_total counter")
+	for _, s := range samples {
+		fmt.Fprintf(w, "tasseograph_llm_breaker_trips_total{%s} %d\n", s.labels, s.trips)
+	}
+	fmt.Fprintln(w, "# HELP tasseograph_llm_breaker_skipped_total Requests that skipped the endpoint because its breaker was open.")
+	fmt.Fprintln(w, "# TYPE tasseograph_llm_breaker_skipped_total counter")
+	for _, s := range samples {
+		fmt.Fprintf(w, "tasseograph_llm_breaker_skipped_total{%s} %d\n", s.labels, s.skipped)
+	}
+	fmt.Fprintln(w, "# HELP tasseograph_llm_retries_total Retries after a transient failure.")
+	fmt.Fprintln(w, "# TYPE tasseograph_llm_retries_total counter")
+	for _, s := range samples {
+		fmt.Fprintf(w, "tasseograph_llm_retries_total{%s} %d\n", s.labels, s.retries)
+	}
+}
+
+// promEscape escapes a Prometheus label value.
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -4,34 +4,125 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/signalnine/tasseograph/internal/protocol"
 	"gopkg.in/yaml.v3"
 )
 
 // AgentConfig for the host agent
 type AgentConfig struct {
-	CollectorURL  string        `yaml:"collector_url"`
-	PollInterval  time.Duration `yaml:"poll_interval"`
-	StateFile     string        `yaml:"state_file"`
-	Hostname      string        `yaml:"hostname"`
-	TLSSkipVerify bool          `yaml:"tls_skip_verify"`
-	APIKey        string        `yaml:"-"` // from env only
+	CollectorURL    string         `yaml:"collector_url"`
+	PollInterval    time.Duration  `yaml:"poll_interval"`
+	StateFile       string         `yaml:"state_file"`
+	Hostname        string         `yaml:"hostname"`
+	TLSSkipVerify   bool           `yaml:"tls_skip_verify"`
+	MinLevel        string         `yaml:"min_level"`        // syslog level keyword; records less severe are not sent
+	MinLevelValue   int            `yaml:"-"`                // resolved from MinLevel at load time
+	HardwareMetrics bool           `yaml:"hardware_metrics"` // sample EDAC/AER/temperature sysfs counters each poll
+	SmartInterval   time.Duration  `yaml:"smart_interval"`   // NVMe/ATA SMART snapshot cadence; 0 disables
+	Sources         []SourceConfig `yaml:"sources"`          // log sources to tail; empty means the kernel ring buffer
+	RasdaemonDB     string         `yaml:"rasdaemon_db"`     // deprecated: read as a rasdaemon source named "rasdaemon"
+	APIKey          string         `yaml:"-"`                // from env only
 }
 
+// SourceConfig is one entry in the agent's sources list.
+type SourceConfig struct {
+	Type       string   `yaml:"type"`    // kmsg, dmesg, file, journal, rasdaemon
+	Name       string   `yaml:"name"`    // cursor key and delta tag; defaults from type and path
+	Path       string   `yaml:"path"`    // file, rasdaemon, or journal export file
+	Command    []string `yaml:"command"` // journal: command printing export format, instead of path
+	Format     string   `yaml:"format"`  // file: syslog (default), sel, raw
+	Level      string   `yaml:"level"`   // file: level for lines that don't carry one; default notice
+	LevelValue int      `yaml:"-"`       // resolved from Level at load time
+}
+
+// fileFormats are the line formats a file source knows how to parse.
+var fileFormats = map[string]bool{"syslog": true, "sel": true, "raw": true}
+
 // LLMEndpoint represents one LLM provider in the fallback chain
 type LLMEndpoint struct {
 	URL       string `yaml:"url"`
 	Model     string `yaml:"model"`
 	APIKeyEnv string `yaml:"api_key_env"` // env var name for API key
 	APIKey    string `yaml:"-"`           // resolved at load time
+
+	// Token budgets. Deltas that don't fit context_tokens minus
+	// max_output_tokens (and the prompt) are analyzed in chunks.
+	ContextTokens   int `yaml:"context_tokens"`
+	MaxOutputTokens int `yaml:"max_output_tokens"` // sent as max_tokens
+
+	// Profile picks defaults for the fields below: "hosted" (the default)
+	// for a third-party API, "local" for Ollama or a llama.cpp server,
+	// which needs no API key, is slow to load a model and serves one
+	// request at a time.
+	Profile        string        `yaml:"profile"`
+	Timeout        time.Duration `yaml:"timeout"`         // per request attempt
+	MaxConcurrent  int           `yaml:"max_concurrent"`  // requests in flight; 0 is unlimited
+	ResponseFormat string        `yaml:"response_format"` // "text" or "json" (ask the server to constrain output to JSON)
+	Grammar        string        `yaml:"grammar"`         // GBNF grammar for llama.cpp's server, sent as is
+}
+
+// Retention actions.
+const (
+	RetentionDelete    = "delete"     // delete the result
+	RetentionDropDmesg = "drop_dmesg" // keep the result, drop its dmesg text
+)
+
+// RetentionRule ages out the results with one status. Results whose status
+// has no delete rule are deleted after retention_days, as before.
+type RetentionRule struct {
+	Status string `yaml:"status"` // ok, warning, critical or error
+	Days   int    `yaml:"days"`
+	Action string `yaml:"action"` // delete (the default) or drop_dmesg
+}
+
+// retentionStatuses are the statuses a stored result can have.
+var retentionStatuses = map[string]bool{"ok": true, "warning": true, "critical": true, "error": true, "llm_unavailable": true}
+
+// resolveRetention defaults and checks the retention rules: at most one
+// rule per status and action, and dmesg dropped before the row goes.
+func resolveRetention(rules []RetentionRule) error {
+	days := map[RetentionRule]int{}
+	for i := range rules {
+		r := &rules[i]
+		if r.Action == "" {
+			r.Action = RetentionDelete
+		}
+		switch {
+		case !retentionStatuses[r.Status]:
+			return fmt.Errorf("retention[%d]: unknown status %q (want ok, warning, critical, error or llm_unavailable)", i, r.Status)
+		case r.Action != RetentionDelete && r.Action != RetentionDropDmesg:
+			return fmt.Errorf("retention[%d]: unknown action %q (want delete or drop_dmesg)", i, r.Action)
+		case r.Days <= 0:
+			return fmt.Errorf("retention[%d]: days must be > 0", i)
+		}
+		key := RetentionRule{Status: r.Status, Action: r.Action}
+		if _, dup := days[key]; dup {
+			return fmt.Errorf("retention[%d]: more than one %s rule for status %s", i, r.Action, r.Status)
+		}
+		days[key] = r.Days
+	}
+	for key, n := range days {
+		if key.Action != RetentionDropDmesg {
+			continue
+		}
+		if del, ok := days[RetentionRule{Status: key.Status, Action: RetentionDelete}]; ok && n >= del {
+			return fmt.Errorf("retention: %s results are deleted after %d days, so dropping their dmesg after %d does nothing", key.Status, del, n)
+		}
+	}
+	return nil
 }
 
 // CollectorConfig for the central collector
 type CollectorConfig struct {
 	ListenAddr      string        `yaml:"listen_addr"`
-	DBPath          string        `yaml:"db_path"`
+	DBDriver        string        `yaml:"db_driver"` // "sqlite" (default) or "postgres"
+	DBPath          string        `yaml:"db_path"`   // SQLite database file
+	DBURL           string        `yaml:"db_url"`    // PostgreSQL URL; TASSEOGRAPH_DB_URL overrides
 	MaxRetries      int           `yaml:"max_retries"`
 	MaxPayloadBytes int64         `yaml:"max_payload_bytes"`
 	RetentionDays   int           `yaml:"retention_days"` // 0 disables pruning
@@ -40,6 +131,67 @@ type CollectorConfig struct {
 	LLMEndpoints    []LLMEndpoint `yaml:"llm_endpoints"` // fallback chain
 	APIKey          string        `yaml:"-"`             // agent auth, from env
 
+	// OperatorAPIKey authorizes adding labels and silences, which change
+	// what the digest reports; the agents' key, on every host, can only
+	// read them. TASSEOGRAPH_OPERATOR_API_KEY overrides. Empty disables
+	// writes over the API.
+	OperatorAPIKey string `yaml:"operator_api_key"`
+
+	// Retention rules for results, by status; see RetentionRule. Pruning
+	// runs daily when either this or RetentionDays is set.
+	Retention []RetentionRule `yaml:"retention"`
+	// Where pruned results are archived first; empty keeps no archive.
+	ArchiveDir string `yaml:"archive_dir"`
+
+	// Scheduled online backups of the SQLite database into BackupDir,
+	// keeping the newest BackupKeep. Disabled when BackupInterval == 0.
+	BackupInterval time.Duration `yaml:"backup_interval"`
+	BackupDir      string        `yaml:"backup_dir"`
+	BackupKeep     int           `yaml:"backup_keep"`
+
+	// Syslog receiver for hosts that can't run the agent. Each listener is
+	// disabled when its address is empty; TLS reuses tls_cert/tls_key.
+	SyslogUDPAddr string        `yaml:"syslog_udp_addr"` // e.g. ":514"
+	SyslogTCPAddr string        `yaml:"syslog_tcp_addr"` // e.g. ":514"
+	SyslogTLSAddr string        `yaml:"syslog_tls_addr"` // e.g. ":6514"
+	SyslogWindow  time.Duration `yaml:"syslog_window"`   // how long a host's messages are gathered before analysis
+	// Syslog is unauthenticated and names its own host, so who may send
+	// it, and how many hosts one window holds, are bounded.
+	SyslogAllowedSources []string       `yaml:"syslog_allowed_sources"` // CIDRs or addresses; empty allows any
+	SyslogAllowedNets    []netip.Prefix `yaml:"-"`                      // resolved from SyslogAllowedSources
+	SyslogMaxHosts       int            `yaml:"syslog_max_hosts"`       // hosts buffered per window
+	SyslogTLSClientCA    string         `yaml:"syslog_tls_client_ca"`   // CA bundle; when set, TLS senders need a client cert it signed
+
+	// Per-endpoint circuit breaker: after BreakerThreshold consecutive
+	// availability failures the endpoint is skipped for BreakerCooldown.
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+
+	// LLMFallback overrides, per error class, whether a failure moves on to
+	// the next endpoint, e.g. {auth: false, parse: true}. Unset classes
+	// keep the collector's defaults.
+	LLMFallback map[string]bool `yaml:"llm_fallback"`
+
+	// Consensus checks: a warning or critical verdict is re-asked of the
+	// next ConsensusVoters endpoints and the stored status is chosen by
+	// ConsensusStrategy ("majority" or "confidence"). Disabled when
+	// ConsensusVoters == 0.
+	ConsensusVoters   int    `yaml:"consensus_voters"`
+	ConsensusStrategy string `yaml:"consensus_strategy"`
+
+	// Operator feedback. An issue labelled a false positive SuppressAfter
+	// times (and never confirmed) is dropped from new results; the
+	// FeedbackExamples most recent false positives are shown to the model as
+	// examples of noise. Each is disabled when 0.
+	SuppressAfter    int `yaml:"suppress_after"`
+	FeedbackExamples int `yaml:"feedback_examples"`
+
+	// Batching of small deltas from several hosts into one LLM call.
+	// Disabled when BatchWindow == 0.
+	BatchWindow    time.Duration `yaml:"batch_window"`     // how long the first delta waits for company
+	BatchMaxHosts  int           `yaml:"batch_max_hosts"`  // hosts per call
+	BatchMaxTokens int           `yaml:"batch_max_tokens"` // estimated prompt tokens per call
+
 	// Email summary digest. Disabled when SummaryInterval == 0.
 	SummaryInterval time.Duration `yaml:"summary_interval"`
 	AlertErrorRate  float64       `yaml:"alert_error_rate"` // 0..1, fraction of rows in window that mark the digest [CRITICAL]
@@ -49,7 +201,8 @@ type CollectorConfig struct {
 	SMTPUsername    string        `yaml:"smtp_username"`     // defaults to SMTPFrom when empty
 	SMTPPasswordEnv string        `yaml:"smtp_password_env"` // env var name for password
 	SMTPStartTLS    bool          `yaml:"smtp_starttls"`
-	SMTPPassword    string        `yaml:"-"` // resolved at load time
+	SMTPPassword    string        `yaml:"-"`          // resolved at load time
+	ResultURL       string        `yaml:"result_url"` // links results in the HTML digest; {id} is the result id
 }
 
 // LoadAgentConfig loads agent config from YAML file with env overrides
@@ -97,9 +250,172 @@ func LoadAgentConfig(path string) (*AgentConfig, error) {
 		return nil, errors.New("state_file is required in config")
 	}
 
+	if cfg.SmartInterval < 0 {
+		return nil, errors.New("smart_interval must be >= 0 (0 disables SMART snapshots)")
+	}
+
+	// Default to sending everything; debug is the least severe level.
+	cfg.MinLevelValue = protocol.LevelDebug
+	if cfg.MinLevel != "" {
+		lvl, err := protocol.ParseLevel(cfg.MinLevel)
+		if err != nil {
+			return nil, fmt.Errorf("min_level: %w", err)
+		}
+		cfg.MinLevelValue = lvl
+	}
+
+	seen := map[string]bool{}
+	for i := range cfg.Sources {
+		src := &cfg.Sources[i]
+		if err := resolveSource(src); err != nil {
+			return nil, fmt.Errorf("sources[%d]: %w", i, err)
+		}
+		if seen[src.Name] {
+			return nil, fmt.Errorf("sources[%d]: duplicate name %q (set name: to tell them apart)", i, src.Name)
+		}
+		seen[src.Name] = true
+	}
+	// rasdaemon_db predates the sources list. The agent still reads it,
+	// after the listed sources (or the kernel ring buffer), under the
+	// name its cursor had.
+	if cfg.RasdaemonDB != "" && seen[LegacyRasdaemonSource] {
+		return nil, fmt.Errorf("rasdaemon_db is deprecated and a source is already named %q: move it to sources: [{type: rasdaemon, path: %s}]", LegacyRasdaemonSource, cfg.RasdaemonDB)
+	}
+
 	return &cfg, nil
 }
 
+// LegacyRasdaemonSource names the source read from the deprecated
+// rasdaemon_db key.
+const LegacyRasdaemonSource = "rasdaemon"
+
+// resolveSource validates one source entry and fills in its defaults. The
+// default name includes the path so two files of the same type get
+// separate cursors.
+func resolveSource(src *SourceConfig) error {
+	switch src.Type {
+	case "kmsg", "dmesg":
+		if src.Name == "" {
+			src.Name = src.Type
+		}
+	case "file":
+		if src.Path == "" {
+			return errors.New("path is required for file sources")
+		}
+		if src.Format == "" {
+			src.Format = "syslog"
+		}
+		if !fileFormats[src.Format] {
+			return fmt.Errorf("unknown file format %q (want syslog, sel or raw)", src.Format)
+		}
+	case "journal":
+		if (src.Path == "") == (len(src.Command) == 0) {
+			return errors.New("journal sources need exactly one of path or command")
+		}
+		if src.Name == "" && len(src.Command) > 0 {
+			src.Name = "journal:" + src.Command[0]
+		}
+	case "rasdaemon":
+		if src.Path == "" {
+			return errors.New("path is required for rasdaemon sources")
+		}
+	case "":
+		return errors.New("type is required")
+	default:
+		return fmt.Errorf("unknown source type %q", src.Type)
+	}
+	if src.Name == "" {
+		src.Name = src.Type + ":" + src.Path
+	}
+
+	src.LevelValue = protocol.LevelNotice
+	if src.Level != "" {
+		lvl, err := protocol.ParseLevel(src.Level)
+		if err != nil {
+			return fmt.Errorf("level: %w", err)
+		}
+		src.LevelValue = lvl
+	}
+	return nil
+}
+
+// minPromptTokens is the room an endpoint must leave for the system prompt
+// and at least some log lines.
+const minPromptTokens = 2048
+
+// llmErrorClasses are the LLM error classes llm_fallback can set. A skip
+// because a circuit breaker is open always falls back, so it isn't one.
+var llmErrorClasses = map[string]bool{
+	"transport": true, "rate_limited": true, "server": true, "auth": true,
+	"bad_request": true, "parse": true, "validation": true,
+}
+
+// Endpoint profiles. A local model has a smaller context than a hosted
+// one, can take minutes to load on its first request, and a single GPU
+// serves one request at a time.
+const (
+	ProfileHosted = "hosted"
+	ProfileLocal  = "local"
+)
+
+// resolveProfile defaults an endpoint's timeout, concurrency and response
+// format from its profile. Token budgets are resolved afterwards, so a
+// local endpoint's smaller context default is set here.
+func resolveProfile(ep *LLMEndpoint) error {
+	if ep.Timeout < 0 {
+		return errors.New("timeout must be >= 0 (0 means use default)")
+	}
+	if ep.MaxConcurrent < 0 {
+		return errors.New("max_concurrent must be >= 0 (0 means unlimited, or 1 for profile local)")
+	}
+	switch ep.Profile {
+	case "", ProfileHosted:
+		ep.Profile = ProfileHosted
+		if ep.Timeout == 0 {
+			ep.Timeout = 60 * time.Second
+		}
+		if ep.ResponseFormat == "" {
+			ep.ResponseFormat = "text"
+		}
+	case ProfileLocal:
+		if ep.Timeout == 0 {
+			ep.Timeout = 5 * time.Minute
+		}
+		if ep.MaxConcurrent == 0 {
+			ep.MaxConcurrent = 1
+		}
+		if ep.ResponseFormat == "" {
+			ep.ResponseFormat = "json"
+		}
+		if ep.ContextTokens == 0 {
+			ep.ContextTokens = 8192
+		}
+	default:
+		return fmt.Errorf("unknown profile %q (want hosted or local)", ep.Profile)
+	}
+	if ep.ResponseFormat != "text" && ep.ResponseFormat != "json" {
+		return fmt.Errorf("unknown response_format %q (want text or json)", ep.ResponseFormat)
+	}
+	return nil
+}
+
+// resolveTokenBudget defaults and checks an endpoint's token budgets.
+func resolveTokenBudget(ep *LLMEndpoint) error {
+	if ep.ContextTokens < 0 || ep.MaxOutputTokens < 0 {
+		return errors.New("context_tokens and max_output_tokens must be >= 0 (0 means use default)")
+	}
+	if ep.ContextTokens == 0 {
+		ep.ContextTokens = 32000
+	}
+	if ep.MaxOutputTokens == 0 {
+		ep.MaxOutputTokens = 1024
+	}
+	if ep.ContextTokens < ep.MaxOutputTokens+minPromptTokens {
+		return fmt.Errorf("context_tokens must be at least max_output_tokens + %d", minPromptTokens)
+	}
+	return nil
+}
+
 // LoadCollectorConfig loads collector config from YAML file with env overrides
 func LoadCollectorConfig(path string) (*CollectorConfig, error) {
 	data, err := os.ReadFile(path)
@@ -116,18 +432,33 @@ func LoadCollectorConfig(path string) (*CollectorConfig, error) {
 	if key := os.Getenv("TASSEOGRAPH_API_KEY"); key != "" {
 		cfg.APIKey = key
 	}
+	if url := os.Getenv("TASSEOGRAPH_DB_URL"); url != "" {
+		cfg.DBURL = url
+	}
+	if key := os.Getenv("TASSEOGRAPH_OPERATOR_API_KEY"); key != "" {
+		cfg.OperatorAPIKey = key
+	}
 
 	// Resolve API keys for each LLM endpoint from env vars
 	for i := range cfg.LLMEndpoints {
 		if cfg.LLMEndpoints[i].APIKeyEnv != "" {
 			cfg.LLMEndpoints[i].APIKey = os.Getenv(cfg.LLMEndpoints[i].APIKeyEnv)
 		}
+		if err := resolveProfile(&cfg.LLMEndpoints[i]); err != nil {
+			return nil, fmt.Errorf("llm_endpoints[%d]: %w", i, err)
+		}
+		if err := resolveTokenBudget(&cfg.LLMEndpoints[i]); err != nil {
+			return nil, fmt.Errorf("llm_endpoints[%d]: %w", i, err)
+		}
 	}
 
 	// Validate required fields
 	if cfg.APIKey == "" {
 		return nil, errors.New("TASSEOGRAPH_API_KEY environment variable required")
 	}
+	if cfg.OperatorAPIKey != "" && cfg.OperatorAPIKey == cfg.APIKey {
+		return nil, errors.New("operator_api_key must differ from TASSEOGRAPH_API_KEY, which every agent holds")
+	}
 	if len(cfg.LLMEndpoints) == 0 {
 		return nil, errors.New("at least one llm_endpoints entry required")
 	}
@@ -140,8 +471,38 @@ func LoadCollectorConfig(path string) (*CollectorConfig, error) {
 	if cfg.RetentionDays < 0 {
 		return nil, errors.New("retention_days must be >= 0 (0 disables pruning)")
 	}
-	if cfg.DBPath == "" {
-		return nil, errors.New("db_path is required in config")
+	if err := resolveRetention(cfg.Retention); err != nil {
+		return nil, err
+	}
+	switch cfg.DBDriver {
+	case "", "sqlite":
+		cfg.DBDriver = "sqlite"
+		if cfg.DBPath == "" {
+			return nil, errors.New("db_path is required in config")
+		}
+	case "postgres":
+		if cfg.DBURL == "" {
+			return nil, errors.New("db_url (or TASSEOGRAPH_DB_URL) is required with db_driver: postgres")
+		}
+	default:
+		return nil, fmt.Errorf("unknown db_driver %q (want sqlite or postgres)", cfg.DBDriver)
+	}
+	if cfg.BackupInterval < 0 {
+		return nil, errors.New("backup_interval must be >= 0 (0 disables backups)")
+	}
+	if cfg.BackupKeep < 0 {
+		return nil, errors.New("backup_keep must be >= 0 (0 means use default)")
+	}
+	if cfg.BackupKeep == 0 {
+		cfg.BackupKeep = 7
+	}
+	if cfg.BackupInterval > 0 {
+		if cfg.DBDriver != "sqlite" {
+			return nil, errors.New("backup_interval is for SQLite; back up PostgreSQL with pg_dump")
+		}
+		if cfg.BackupDir == "" {
+			return nil, errors.New("backup_dir is required when backup_interval is set")
+		}
 	}
 	if cfg.TLSCert == "" {
 		return nil, errors.New("tls_cert is required in config")
@@ -150,6 +511,87 @@ func LoadCollectorConfig(path string) (*CollectorConfig, error) {
 		return nil, errors.New("tls_key is required in config")
 	}
 
+	if cfg.SyslogWindow < 0 {
+		return nil, errors.New("syslog_window must be >= 0 (0 means use default)")
+	}
+	if cfg.SyslogWindow == 0 {
+		cfg.SyslogWindow = 5 * time.Minute // one agent poll_interval's worth
+	}
+	for _, src := range cfg.SyslogAllowedSources {
+		prefix, err := netip.ParsePrefix(src)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(src)
+			if aerr != nil {
+				return nil, fmt.Errorf("syslog_allowed_sources: %q is not a CIDR or an address", src)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cfg.SyslogAllowedNets = append(cfg.SyslogAllowedNets, prefix.Masked())
+	}
+	if cfg.SyslogMaxHosts < 0 {
+		return nil, errors.New("syslog_max_hosts must be >= 0 (0 means use default)")
+	}
+	if cfg.SyslogMaxHosts == 0 {
+		cfg.SyslogMaxHosts = 1000
+	}
+	if cfg.SyslogTLSClientCA != "" && cfg.SyslogTLSAddr == "" {
+		return nil, errors.New("syslog_tls_client_ca needs syslog_tls_addr")
+	}
+
+	if cfg.BreakerThreshold < 0 {
+		return nil, errors.New("breaker_threshold must be >= 0 (0 means use default)")
+	}
+	if cfg.BreakerThreshold == 0 {
+		cfg.BreakerThreshold = 5
+	}
+	if cfg.BreakerCooldown < 0 {
+		return nil, errors.New("breaker_cooldown must be >= 0 (0 means use default)")
+	}
+	if cfg.BreakerCooldown == 0 {
+		cfg.BreakerCooldown = 30 * time.Second
+	}
+	if cfg.ConsensusVoters < 0 || cfg.ConsensusVoters >= len(cfg.LLMEndpoints) {
+		return nil, fmt.Errorf("consensus_voters must be between 0 and %d (one less than the number of llm_endpoints)", len(cfg.LLMEndpoints)-1)
+	}
+	switch cfg.ConsensusStrategy {
+	case "":
+		cfg.ConsensusStrategy = "majority"
+	case "majority", "confidence":
+	default:
+		return nil, fmt.Errorf("unknown consensus_strategy %q (want majority or confidence)", cfg.ConsensusStrategy)
+	}
+
+	if cfg.SuppressAfter < 0 {
+		return nil, errors.New("suppress_after must be >= 0 (0 disables suppression)")
+	}
+	if cfg.FeedbackExamples < 0 {
+		return nil, errors.New("feedback_examples must be >= 0 (0 disables them)")
+	}
+
+	for class := range cfg.LLMFallback {
+		if !llmErrorClasses[class] {
+			return nil, fmt.Errorf("llm_fallback: unknown error class %q (want transport, rate_limited, server, auth, bad_request, parse or validation)", class)
+		}
+	}
+
+	// Agents time out after 30s and wait on their delta's batch, so the
+	// window has to leave room for the LLM call itself.
+	if cfg.BatchWindow < 0 || cfg.BatchWindow > 10*time.Second {
+		return nil, errors.New("batch_window must be between 0 and 10s (0 disables batching)")
+	}
+	if cfg.BatchMaxHosts < 0 {
+		return nil, errors.New("batch_max_hosts must be >= 0 (0 means use default)")
+	}
+	if cfg.BatchMaxHosts == 0 {
+		cfg.BatchMaxHosts = 10
+	}
+	if cfg.BatchMaxTokens < 0 {
+		return nil, errors.New("batch_max_tokens must be >= 0 (0 means use default)")
+	}
+	if cfg.BatchMaxTokens == 0 {
+		cfg.BatchMaxTokens = 8000
+	}
+
 	// Summary/SMTP: only validate when the feature is turned on. Disabled
 	// (interval == 0) is the supported zero-value default; everything else
 	// must be fully specified so we fail fast instead of silently never sending.
@@ -183,6 +625,9 @@ func LoadCollectorConfig(path string) (*CollectorConfig, error) {
 		if cfg.AlertErrorRate == 0 {
 			cfg.AlertErrorRate = 0.5 // default: >50% error rate flags the digest as critical
 		}
+		if cfg.ResultURL != "" && !strings.Contains(cfg.ResultURL, "{id}") {
+			return nil, errors.New("result_url must contain {id}, which is replaced by the result id")
+		}
 	}
 
 	return &cfg, nil
@@ -2,10 +2,13 @@
 package config
 
 import (
+	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadAgentConfig(t *testing.T) {
@@ -133,6 +136,148 @@ poll_interval: 5m
 	}
 }
 
+func TestLoadAgentConfig_MinLevel(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "agent.yaml")
+	t.Setenv("TASSEOGRAPH_API_KEY", "test-key")
+
+	base := `
+collector_url: "https://collector.internal:9311/ingest"
+poll_interval: 5m
+state_file: /var/lib/tasseograph/last_timestamp
+`
+	// Unset sends everything.
+	if err := os.WriteFile(configPath, []byte(base), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadAgentConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadAgentConfig failed: %v", err)
+	}
+	if cfg.MinLevelValue != 7 {
+		t.Errorf("MinLevelValue = %d, want 7 (debug)", cfg.MinLevelValue)
+	}
+
+	if err := os.WriteFile(configPath, []byte(base+"min_level: warn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadAgentConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadAgentConfig failed: %v", err)
+	}
+	if cfg.MinLevelValue != 4 {
+		t.Errorf("MinLevelValue = %d, want 4 (warning)", cfg.MinLevelValue)
+	}
+
+	if err := os.WriteFile(configPath, []byte(base+"min_level: loud\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadAgentConfig(configPath)
+	if err == nil {
+		t.Fatal("expected error for unknown min_level, got nil")
+	}
+	if !strings.Contains(err.Error(), "min_level") {
+		t.Errorf("error %q does not mention min_level", err.Error())
+	}
+}
+
+func TestLoadAgentConfig_Sources(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "agent.yaml")
+	t.Setenv("TASSEOGRAPH_API_KEY", "test-key")
+
+	base := `
+collector_url: "https://collector.internal:9311/ingest"
+poll_interval: 5m
+state_file: /var/lib/tasseograph/last_timestamp
+`
+	content := base + `sources:
+  - type: kmsg
+  - type: file
+    path: /var/log/kern.log
+  - type: file
+    path: /var/log/ipmi-sel.log
+    format: sel
+    level: warning
+  - type: journal
+    command: [journalctl, -k, -o, export]
+  - type: rasdaemon
+    path: /var/lib/rasdaemon/ras-mc_event.db
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadAgentConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadAgentConfig failed: %v", err)
+	}
+	wantNames := []string{"kmsg", "file:/var/log/kern.log", "file:/var/log/ipmi-sel.log", "journal:journalctl", "rasdaemon:/var/lib/rasdaemon/ras-mc_event.db"}
+	if len(cfg.Sources) != len(wantNames) {
+		t.Fatalf("got %d sources, want %d", len(cfg.Sources), len(wantNames))
+	}
+	for i, want := range wantNames {
+		if cfg.Sources[i].Name != want {
+			t.Errorf("sources[%d].Name = %q, want %q", i, cfg.Sources[i].Name, want)
+		}
+	}
+	if cfg.Sources[1].Format != "syslog" || cfg.Sources[1].LevelValue != 5 {
+		t.Errorf("kern.log defaults = %q/%d, want syslog/5 (notice)", cfg.Sources[1].Format, cfg.Sources[1].LevelValue)
+	}
+	if cfg.Sources[2].LevelValue != 4 {
+		t.Errorf("SEL LevelValue = %d, want 4 (warning)", cfg.Sources[2].LevelValue)
+	}
+
+	bad := map[string]string{
+		"unknown type":      "  - type: carrier-pigeon\n",
+		"file without path": "  - type: file\n",
+		"bad format":        "  - type: file\n    path: /x\n    format: csv\n",
+		"journal both":      "  - type: journal\n    path: /x\n    command: [journalctl]\n",
+		"duplicate name":    "  - type: kmsg\n  - type: dmesg\n    name: kmsg\n",
+	}
+	for name, entry := range bad {
+		if err := os.WriteFile(configPath, []byte(base+"sources:\n"+entry), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadAgentConfig(configPath)
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		} else if !strings.Contains(err.Error(), "sources[") {
+			t.Errorf("%s: error %q does not point at the entry", name, err.Error())
+		}
+	}
+}
+
+// TestLoadAgentConfig_RasdaemonDB checks the pre-sources rasdaemon_db key
+// still loads, and clashes with a source holding its cursor name.
+func TestLoadAgentConfig_RasdaemonDB(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	t.Setenv("TASSEOGRAPH_API_KEY", "test-key")
+	base := `
+collector_url: "https://collector.internal:9311/ingest"
+poll_interval: 5m
+state_file: /var/lib/tasseograph/last_timestamp
+rasdaemon_db: /var/lib/rasdaemon/ras-mc_event.db
+`
+	if err := os.WriteFile(configPath, []byte(base), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadAgentConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadAgentConfig failed: %v", err)
+	}
+	if cfg.RasdaemonDB != "/var/lib/rasdaemon/ras-mc_event.db" {
+		t.Errorf("RasdaemonDB = %q", cfg.RasdaemonDB)
+	}
+
+	clash := base + "sources:\n  - type: rasdaemon\n    name: rasdaemon\n    path: /x.db\n"
+	if err := os.WriteFile(configPath, []byte(clash), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadAgentConfig(configPath); err == nil || !strings.Contains(err.Error(), "sources: [{type: rasdaemon") {
+		t.Errorf("rasdaemon_db beside a source named rasdaemon: %v", err)
+	}
+}
+
 func TestLoadCollectorConfig_DefaultMaxPayloadBytesWhenUnset(t *testing.T) {
 	dir := t.TempDir()
 	configPath := filepath.Join(dir, "collector.yaml")
@@ -475,3 +620,381 @@ alert_error_rate: `+val+`
 		})
 	}
 }
+
+func TestLoadCollectorConfig_ResultURL(t *testing.T) {
+	digest := `
+summary_interval: 24h
+smtp_host: smtp.example:587
+smtp_from: a@b
+smtp_to: c@d
+`
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, digest+"result_url: https://collector.example:9311/api/results/{id}\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.ResultURL != "https://collector.example:9311/api/results/{id}" {
+		t.Errorf("ResultURL = %q", cfg.ResultURL)
+	}
+	if _, err := LoadCollectorConfig(summaryBaseConfig(t, digest+"result_url: https://collector.example:9311/api/results/\n")); err == nil {
+		t.Error("expected error for result_url without {id}, got nil")
+	}
+}
+
+func TestLoadCollectorConfig_SyslogWindow(t *testing.T) {
+	// Listeners are off unless an address is set, but the window always
+	// gets a default so enabling one needs only the address.
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.SyslogUDPAddr != "" || cfg.SyslogTCPAddr != "" || cfg.SyslogTLSAddr != "" {
+		t.Errorf("syslog listeners enabled by default: %+v", cfg)
+	}
+	if cfg.SyslogWindow != 5*time.Minute {
+		t.Errorf("SyslogWindow = %v, want 5m default", cfg.SyslogWindow)
+	}
+
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, "syslog_udp_addr: \":514\"\nsyslog_window: 2m\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.SyslogUDPAddr != ":514" || cfg.SyslogWindow != 2*time.Minute {
+		t.Errorf("syslog = %q/%v, want :514/2m", cfg.SyslogUDPAddr, cfg.SyslogWindow)
+	}
+
+	if _, err := LoadCollectorConfig(summaryBaseConfig(t, "syslog_window: -1m\n")); err == nil {
+		t.Error("expected error for negative syslog_window")
+	}
+}
+
+func TestLoadCollectorConfig_SyslogLimits(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.SyslogMaxHosts != 1000 || len(cfg.SyslogAllowedNets) != 0 {
+		t.Errorf("defaults = %d hosts, %v allowed; want 1000, any", cfg.SyslogMaxHosts, cfg.SyslogAllowedNets)
+	}
+
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, "syslog_allowed_sources: [10.1.0.0/16, 192.0.2.7, \"2001:db8::/32\"]\nsyslog_max_hosts: 50\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	want := []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16"), netip.MustParsePrefix("192.0.2.7/32"), netip.MustParsePrefix("2001:db8::/32")}
+	if !reflect.DeepEqual(cfg.SyslogAllowedNets, want) || cfg.SyslogMaxHosts != 50 {
+		t.Errorf("limits = %v, %d", cfg.SyslogAllowedNets, cfg.SyslogMaxHosts)
+	}
+
+	for name, extra := range map[string]string{
+		"bad source":        "syslog_allowed_sources: [nas01]\n",
+		"negative hosts":    "syslog_max_hosts: -1\n",
+		"client CA, no TLS": "syslog_tls_client_ca: /etc/tasseograph/ca.pem\n",
+	} {
+		if _, err := LoadCollectorConfig(summaryBaseConfig(t, extra)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadCollectorConfig_Batch(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.BatchWindow != 0 || cfg.BatchMaxHosts != 10 || cfg.BatchMaxTokens != 8000 {
+		t.Errorf("batch defaults = %v/%d/%d, want 0/10/8000", cfg.BatchWindow, cfg.BatchMaxHosts, cfg.BatchMaxTokens)
+	}
+
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, "batch_window: 5s\nbatch_max_hosts: 4\nbatch_max_tokens: 2000\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.BatchWindow != 5*time.Second || cfg.BatchMaxHosts != 4 || cfg.BatchMaxTokens != 2000 {
+		t.Errorf("batch = %v/%d/%d, want 5s/4/2000", cfg.BatchWindow, cfg.BatchMaxHosts, cfg.BatchMaxTokens)
+	}
+
+	for _, bad := range []string{"batch_window: 30s\n", "batch_window: -1s\n", "batch_max_hosts: -1\n", "batch_max_tokens: -1\n"} {
+		if _, err := LoadCollectorConfig(summaryBaseConfig(t, bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCollectorConfig_TokenBudgets(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if ep := cfg.LLMEndpoints[0]; ep.ContextTokens != 32000 || ep.MaxOutputTokens != 1024 {
+		t.Errorf("budgets = %d/%d, want 32000/1024 defaults", ep.ContextTokens, ep.MaxOutputTokens)
+	}
+
+	// Extra lines continue the base config's single endpoint entry.
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, "    context_tokens: 8192\n    max_output_tokens: 2048\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if ep := cfg.LLMEndpoints[0]; ep.ContextTokens != 8192 || ep.MaxOutputTokens != 2048 {
+		t.Errorf("budgets = %d/%d, want 8192/2048", ep.ContextTokens, ep.MaxOutputTokens)
+	}
+
+	for _, bad := range []string{"    context_tokens: -1\n", "    context_tokens: 2048\n    max_output_tokens: 1024\n"} {
+		if _, err := LoadCollectorConfig(summaryBaseConfig(t, bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCollectorConfig_Breaker(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.BreakerThreshold != 5 || cfg.BreakerCooldown != 30*time.Second {
+		t.Errorf("breaker = %d/%v, want 5/30s defaults", cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, "breaker_threshold: 2\nbreaker_cooldown: 5m\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.BreakerThreshold != 2 || cfg.BreakerCooldown != 5*time.Minute {
+		t.Errorf("breaker = %d/%v, want 2/5m", cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+
+	for _, bad := range []string{"breaker_threshold: -1\n", "breaker_cooldown: -1s\n"} {
+		if _, err := LoadCollectorConfig(summaryBaseConfig(t, bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCollectorConfig_LLMFallback(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, "llm_fallback:\n  auth: false\n  parse: true\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.LLMFallback["auth"] || !cfg.LLMFallback["parse"] {
+		t.Errorf("llm_fallback = %v, want auth off and parse on", cfg.LLMFallback)
+	}
+
+	if _, err := LoadCollectorConfig(summaryBaseConfig(t, "llm_fallback:\n  teapot: true\n")); err == nil {
+		t.Error("expected error for unknown error class")
+	}
+}
+
+func TestLoadCollectorConfig_Consensus(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.ConsensusVoters != 0 || cfg.ConsensusStrategy != "majority" {
+		t.Errorf("consensus = %d/%q, want off with majority default", cfg.ConsensusVoters, cfg.ConsensusStrategy)
+	}
+
+	second := `  - url: "https://api.openai.com/v1"
+    model: "gpt-4o"
+    api_key_env: "OPENROUTER_API_KEY"
+`
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, second+"consensus_voters: 1\nconsensus_strategy: confidence\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.ConsensusVoters != 1 || cfg.ConsensusStrategy != "confidence" {
+		t.Errorf("consensus = %d/%q, want 1/confidence", cfg.ConsensusVoters, cfg.ConsensusStrategy)
+	}
+
+	for _, bad := range []string{
+		"consensus_voters: 1\n", // only one endpoint
+		"consensus_voters: -1\n",
+		second + "consensus_voters: 1\nconsensus_strategy: loudest\n",
+	} {
+		if _, err := LoadCollectorConfig(summaryBaseConfig(t, bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCollectorConfig_Feedback(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, "suppress_after: 3\nfeedback_examples: 5\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.SuppressAfter != 3 || cfg.FeedbackExamples != 5 {
+		t.Errorf("feedback = %d/%d, want 3/5", cfg.SuppressAfter, cfg.FeedbackExamples)
+	}
+
+	for _, bad := range []string{"suppress_after: -1\n", "feedback_examples: -1\n"} {
+		if _, err := LoadCollectorConfig(summaryBaseConfig(t, bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCollectorConfig_DBDriver(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.DBDriver != "sqlite" {
+		t.Errorf("DBDriver = %q, want sqlite by default", cfg.DBDriver)
+	}
+
+	if _, err := LoadCollectorConfig(summaryBaseConfig(t, "db_driver: postgres\n")); err == nil || !strings.Contains(err.Error(), "db_url") {
+		t.Errorf("postgres without db_url: err = %v", err)
+	}
+	t.Setenv("TASSEOGRAPH_DB_URL", "postgres://collector@db.internal/tasseograph")
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, "db_driver: postgres\ndb_url: postgres://ignored\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.DBURL != "postgres://collector@db.internal/tasseograph" {
+		t.Errorf("DBURL = %q, want the env override", cfg.DBURL)
+	}
+
+	if _, err := LoadCollectorConfig(summaryBaseConfig(t, "db_driver: mysql\n")); err == nil {
+		t.Error("expected error for an unknown db_driver")
+	}
+}
+
+func TestLoadCollectorConfig_EndpointProfiles(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, ""))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	ep := cfg.LLMEndpoints[0]
+	if ep.Profile != "hosted" || ep.Timeout != 60*time.Second || ep.MaxConcurrent != 0 || ep.ResponseFormat != "text" {
+		t.Errorf("hosted defaults = %+v", ep)
+	}
+
+	local := `  - url: "http://localhost:11434/v1"
+    model: "qwen2.5:7b-instruct"
+    profile: local
+`
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, local))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	ep = cfg.LLMEndpoints[1]
+	if ep.APIKey != "" || ep.Timeout != 5*time.Minute || ep.MaxConcurrent != 1 || ep.ResponseFormat != "json" || ep.ContextTokens != 8192 {
+		t.Errorf("local defaults = %+v", ep)
+	}
+
+	cfg, err = LoadCollectorConfig(summaryBaseConfig(t, local+"    timeout: 90s\n    max_concurrent: 4\n    response_format: text\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	ep = cfg.LLMEndpoints[1]
+	if ep.Timeout != 90*time.Second || ep.MaxConcurrent != 4 || ep.ResponseFormat != "text" {
+		t.Errorf("local overrides = %+v", ep)
+	}
+
+	for _, bad := range []string{
+		"    profile: edge\n",
+		"    response_format: yaml\n",
+		"    timeout: -1s\n",
+		"    max_concurrent: -1\n",
+	} {
+		if _, err := LoadCollectorConfig(summaryBaseConfig(t, bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCollectorConfig_Retention(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, `
+retention:
+  - {status: critical, days: 365}
+  - {status: warning, days: 90, action: delete}
+  - {status: ok, days: 7, action: drop_dmesg}
+  - {status: ok, days: 30}
+  - {status: llm_unavailable, days: 14}
+`))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	want := []RetentionRule{
+		{Status: "critical", Days: 365, Action: RetentionDelete},
+		{Status: "warning", Days: 90, Action: RetentionDelete},
+		{Status: "ok", Days: 7, Action: RetentionDropDmesg},
+		{Status: "ok", Days: 30, Action: RetentionDelete},
+		{Status: "llm_unavailable", Days: 14, Action: RetentionDelete},
+	}
+	if !reflect.DeepEqual(cfg.Retention, want) {
+		t.Errorf("Retention = %+v, want %+v", cfg.Retention, want)
+	}
+
+	for name, extra := range map[string]string{
+		"unknown status":          "retention: [{status: fine, days: 7}]",
+		"unknown action":          "retention: [{status: ok, days: 7, action: archive}]",
+		"no days":                 "retention: [{status: ok}]",
+		"duplicate":               "retention: [{status: ok, days: 7}, {status: ok, days: 9}]",
+		"drop after delete":       "retention: [{status: ok, days: 7}, {status: ok, days: 30, action: drop_dmesg}]",
+		"drop same age as delete": "retention: [{status: ok, days: 7}, {status: ok, days: 7, action: drop_dmesg}]",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadCollectorConfig(summaryBaseConfig(t, extra)); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoadCollectorConfig_Backup(t *testing.T) {
+	cfg, err := LoadCollectorConfig(summaryBaseConfig(t, "backup_interval: 6h\nbackup_dir: /var/backups/tasseograph\n"))
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig: %v", err)
+	}
+	if cfg.BackupInterval != 6*time.Hour || cfg.BackupKeep != 7 {
+		t.Errorf("BackupInterval = %v, BackupKeep = %d; want 6h, 7", cfg.BackupInterval, cfg.BackupKeep)
+	}
+	for name, extra := range map[string]string{
+		"no dir":        "backup_interval: 6h\n",
+		"negative keep": "backup_interval: 6h\nbackup_dir: /tmp\nbackup_keep: -1\n",
+		"postgres":      "backup_interval: 6h\nbackup_dir: /tmp\ndb_driver: postgres\ndb_url: postgres://localhost/tg\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadCollectorConfig(summaryBaseConfig(t, extra)); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoadCollectorConfig_OperatorAPIKey(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "collector.yaml")
+	content := []byte(`
+db_path: /var/lib/tasseograph/results.db
+tls_cert: /etc/tasseograph/tls/cert.pem
+tls_key: /etc/tasseograph/tls/key.pem
+operator_api_key: from-yaml
+llm_endpoints:
+  - url: "https://inference.internal/v1"
+    model: "m"
+`)
+	if err := os.WriteFile(configPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TASSEOGRAPH_API_KEY", "test-api-key")
+
+	cfg, err := LoadCollectorConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadCollectorConfig failed: %v", err)
+	}
+	if cfg.OperatorAPIKey != "from-yaml" {
+		t.Errorf("OperatorAPIKey = %q, want from-yaml", cfg.OperatorAPIKey)
+	}
+
+	t.Setenv("TASSEOGRAPH_OPERATOR_API_KEY", "from-env")
+	if cfg, err = LoadCollectorConfig(configPath); err != nil || cfg.OperatorAPIKey != "from-env" {
+		t.Errorf("env override: %v, %+v", err, cfg)
+	}
+
+	// Every agent holds the agents' key, so it can't double as the
+	// operator's.
+	t.Setenv("TASSEOGRAPH_OPERATOR_API_KEY", "test-api-key")
+	if _, err := LoadCollectorConfig(configPath); err == nil {
+		t.Error("expected error when operator_api_key equals the agents' key")
+	}
+}
@@ -0,0 +1,378 @@
+// internal/fakellm/fakellm.go
+package fakellm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// Reply is one scripted answer: either an analysis, or a failure to
+// inject instead of (or on top of) it.
+type Reply struct {
+	Status     string           `yaml:"status"` // default "ok"
+	Confidence float64          `yaml:"confidence"`
+	Issues     []protocol.Issue `yaml:"issues"`
+
+	Latency    time.Duration `yaml:"latency"`     // wait this long before answering
+	Error      int           `yaml:"error"`       // answer with this HTTP status instead, e.g. 429 or 503
+	RetryAfter int           `yaml:"retry_after"` // seconds, sent as Retry-After with Error
+	Fence      bool          `yaml:"fence"`       // wrap the JSON in a ```json fence
+	Malformed  bool          `yaml:"malformed"`   // cut the JSON short
+	Content    string        `yaml:"content"`     // send this text verbatim instead of an analysis
+}
+
+// Rule answers requests whose log lines match Match. Times, if set, limits
+// how many requests it answers before it's skipped, so e.g. "503 twice,
+// then fine" is two rules.
+type Rule struct {
+	Match string `yaml:"match"` // regexp; empty matches everything
+	Times int    `yaml:"times"`
+	Reply `yaml:",inline"`
+
+	re   *regexp.Regexp
+	used int
+}
+
+// Rules is a fake-llm script. Each request takes the next Script entry
+// until they run out, then the first matching rule, then Default.
+type Rules struct {
+	Script  []Reply `yaml:"script"`
+	Rules   []*Rule `yaml:"rules"`
+	Default Reply   `yaml:"default"`
+}
+
+// LoadRules reads rules from a YAML file.
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules Rules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	if err := rules.compile(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+func (r *Rules) compile() error {
+	for i, rule := range r.Rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		rule.re = re
+	}
+	return nil
+}
+
+// Server is an OpenAI- and Anthropic-compatible chat endpoint that answers
+// from Rules. It serves /chat/completions and /messages, with or without
+// a /v1 prefix.
+type Server struct {
+	mu     sync.Mutex
+	rules  *Rules
+	next   int // next Script entry
+	counts map[string]int
+}
+
+// New returns a server for rules. Nil rules answer everything with "ok".
+func New(rules *Rules) (*Server, error) {
+	if rules == nil {
+		rules = &Rules{}
+	}
+	if err := rules.compile(); err != nil {
+		return nil, err
+	}
+	return &Server{rules: rules, counts: map[string]int{}}, nil
+}
+
+// Requests returns how many requests each API has served, keyed "openai"
+// and "anthropic".
+func (s *Server) Requests() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]int, len(s.counts))
+	for k, v := range s.counts {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1")
+	if r.Method != http.MethodPost || (path != "/chat/completions" && path != "/messages") {
+		http.NotFound(w, r)
+		return
+	}
+	anthropic := path == "/messages"
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	model, user, err := parseRequest(body, anthropic)
+	if err != nil {
+		writeError(w, anthropic, http.StatusBadRequest, 0, err.Error())
+		return
+	}
+
+	api := "openai"
+	if anthropic {
+		api = "anthropic"
+	}
+	reply, hosts := s.answer(api, user)
+
+	if reply.Latency > 0 {
+		select {
+		case <-time.After(reply.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if reply.Error != 0 {
+		writeError(w, anthropic, reply.Error, reply.RetryAfter, "injected error")
+		return
+	}
+
+	content := reply.Content
+	if content == "" {
+		content = render(reply, hosts)
+	}
+	if reply.Malformed {
+		content = content[:len(content)/2]
+	}
+	if reply.Fence {
+		content = "```json\n" + content + "\n```"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if anthropic {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":          "msg_fake",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       model,
+			"content":     []map[string]string{{"type": "text", "text": content}},
+			"stop_reason": "end_turn",
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion",
+		"model":   model,
+		"choices": []map[string]interface{}{{"index": 0, "message": map[string]string{"role": "assistant", "content": content}, "finish_reason": "stop"}},
+	})
+}
+
+// hostAnswer is one host's analysis in a batched prompt.
+type hostAnswer struct {
+	name  string
+	reply Reply
+}
+
+// answer picks the reply for a request. A batched prompt gets a reply per
+// host section; the first host's latency, error and formatting apply to
+// the whole response.
+func (s *Server) answer(api, user string) (Reply, []hostAnswer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[api]++
+
+	sections := hostSections(user)
+	if sections == nil {
+		return s.pick(user), nil
+	}
+	var hosts []hostAnswer
+	var first Reply
+	for i, sec := range sections {
+		reply := s.pick(sec.lines)
+		if i == 0 {
+			first = reply
+		}
+		first.Latency = max(first.Latency, reply.Latency)
+		hosts = append(hosts, hostAnswer{sec.name, reply})
+	}
+	return first, hosts
+}
+
+// pick returns the reply for one host's lines. Callers hold mu.
+func (s *Server) pick(lines string) Reply {
+	if s.next < len(s.rules.Script) {
+		s.next++
+		return s.rules.Script[s.next-1]
+	}
+	for _, rule := range s.rules.Rules {
+		if rule.Times > 0 && rule.used >= rule.Times {
+			continue
+		}
+		if rule.re.MatchString(lines) {
+			rule.used++
+			return rule.Reply
+		}
+	}
+	return s.rules.Default
+}
+
+type section struct{ name, lines string }
+
+// hostSections splits a batched prompt's "=== host: NAME ===" sections, or
+// returns nil for a single host's lines.
+func hostSections(user string) []section {
+	var out []section
+	var cur *section
+	for _, line := range strings.Split(user, "\n") {
+		if name, ok := strings.CutPrefix(line, "=== host: "); ok {
+			out = append(out, section{name: strings.TrimSuffix(name, " ===")})
+			cur = &out[len(out)-1]
+			continue
+		}
+		if strings.HasPrefix(line, "=== end: ") {
+			cur = nil
+			continue
+		}
+		if cur != nil {
+			cur.lines += line + "\n"
+		}
+	}
+	return out
+}
+
+func analysisOf(reply Reply) protocol.AnalysisResult {
+	result := protocol.AnalysisResult{Status: reply.Status, Confidence: reply.Confidence, Issues: reply.Issues}
+	if result.Status == "" {
+		result.Status = "ok"
+	}
+	if result.Issues == nil {
+		result.Issues = []protocol.Issue{}
+	}
+	return result
+}
+
+func render(reply Reply, hosts []hostAnswer) string {
+	var v interface{} = analysisOf(reply)
+	if hosts != nil {
+		type hostResult struct {
+			Hostname string `json:"hostname"`
+			protocol.AnalysisResult
+		}
+		batch := struct {
+			Hosts []hostResult `json:"hosts"`
+		}{}
+		for _, h := range hosts {
+			batch.Hosts = append(batch.Hosts, hostResult{h.name, analysisOf(h.reply)})
+		}
+		v = batch
+	}
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
+
+// parseRequest pulls the model and the user's text out of either API's
+// request body.
+func parseRequest(body []byte, anthropic bool) (model, user string, err error) {
+	var req struct {
+		Model    string `json:"model"`
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", "", err
+	}
+	if len(req.Messages) == 0 {
+		return "", "", errors.New("messages is empty")
+	}
+	var sb strings.Builder
+	for _, m := range req.Messages {
+		if m.Role != "user" {
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(m.Content, &text); err == nil {
+			sb.WriteString(text)
+			continue
+		}
+		// Anthropic (and newer OpenAI) content blocks.
+		var blocks []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(m.Content, &blocks); err != nil {
+			return "", "", fmt.Errorf("unrecognised message content: %w", err)
+		}
+		for _, b := range blocks {
+			if b.Type == "text" {
+				sb.WriteString(b.Text)
+			}
+		}
+	}
+	return req.Model, sb.String(), nil
+}
+
+// writeError answers with code in the API's error shape.
+func writeError(w http.ResponseWriter, anthropic bool, code, retryAfter int, msg string) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if anthropic {
+		kind := "api_error"
+		switch {
+		case code == http.StatusTooManyRequests:
+			kind = "rate_limit_error"
+		case code == 529 || code == http.StatusServiceUnavailable:
+			kind = "overloaded_error"
+		case code < 500:
+			kind = "invalid_request_error"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": kind, "message": msg},
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"message": msg, "type": http.StatusText(code), "code": code},
+	})
+}
+
+// Run serves a fake LLM on addr until ctx is done.
+func Run(ctx context.Context, addr string, rules *Rules) error {
+	s, err := New(rules)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: addr, Handler: s}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("fake-llm listening on %s (OpenAI /v1/chat/completions, Anthropic /v1/messages)", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// internal/fakellm/fakellm_test.go
+package fakellm
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRules = `
+script:
+  - error: 503
+    retry_after: 2
+rules:
+  - match: "nvme"
+    times: 1
+    error: 429
+  - match: "EDAC|MCE"
+    status: critical
+    confidence: 0.9
+    issues:
+      - summary: "Uncorrected memory error"
+        evidence: "EDAC MC0: 1 UE"
+  - match: "fence"
+    fence: true
+    status: warning
+  - match: "garbage"
+    malformed: true
+  - match: "slow"
+    latency: 100ms
+default:
+  status: ok
+`
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte(testRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+	s, err := New(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// chat posts an OpenAI request with user as the user message and returns
+// the status code, the Retry-After header and the reply content.
+func chat(t *testing.T, url, user string) (int, string, string) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{
+		"model": "fake-model",
+		"messages": []map[string]string{
+			{"role": "system", "content": "you are a kernel expert"},
+			{"role": "user", "content": user},
+		},
+	})
+	resp, err := http.Post(url+"/v1/chat/completions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	content := ""
+	if len(out.Choices) > 0 {
+		content = out.Choices[0].Message.Content
+		if out.Model != "fake-model" {
+			t.Errorf("model = %q, want the requested model echoed", out.Model)
+		}
+	}
+	return resp.StatusCode, resp.Header.Get("Retry-After"), content
+}
+
+func TestServerRules(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	// The script comes first, whatever the input.
+	if code, retry, _ := chat(t, ts.URL, "EDAC MC0: 1 UE"); code != 503 || retry != "2" {
+		t.Errorf("script: code=%d Retry-After=%q, want 503 and 2", code, retry)
+	}
+
+	tests := []struct {
+		name, user string
+		code       int
+		content    string
+	}{
+		{"regex match", "EDAC MC0: 1 UE", 200, `{"status":"critical","confidence":0.9,"issues":[{"summary":"Uncorrected memory error","evidence":"EDAC MC0: 1 UE"}]}`},
+		{"times", "nvme0: timeout", 429, ""},
+		{"times used up", "nvme0: timeout", 200, `{"status":"ok","issues":[]}`},
+		{"fence", "fence me", 200, "```json\n{\"status\":\"warning\",\"issues\":[]}\n```"},
+		{"malformed", "garbage", 200, `{"status":"ok`},
+		{"default", "usb 1-1: new device", 200, `{"status":"ok","issues":[]}`},
+	}
+	for _, tt := range tests {
+		code, _, content := chat(t, ts.URL, tt.user)
+		if code != tt.code || content != tt.content {
+			t.Errorf("%s: code=%d content=%q, want %d %q", tt.name, code, content, tt.code, tt.content)
+		}
+	}
+
+	start := time.Now()
+	chat(t, ts.URL, "slow")
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("latency wasn't injected")
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	_, ts := newTestServer(t)
+	chat(t, ts.URL, "burn the script entry")
+
+	user := "=== host: web1 ===\nusb 1-1: new device\n=== end: web1 ===\n=== host: db1 ===\nMCE: CPU0 bank 4\n=== end: db1 ===\n"
+	_, _, content := chat(t, ts.URL, user)
+	var batch struct {
+		Hosts []struct {
+			Hostname string `json:"hostname"`
+			Status   string `json:"status"`
+		} `json:"hosts"`
+	}
+	if err := json.Unmarshal([]byte(content), &batch); err != nil {
+		t.Fatalf("batch reply %q: %v", content, err)
+	}
+	if len(batch.Hosts) != 2 || batch.Hosts[0].Hostname != "web1" || batch.Hosts[0].Status != "ok" ||
+		batch.Hosts[1].Hostname != "db1" || batch.Hosts[1].Status != "critical" {
+		t.Errorf("batch = %+v, want web1 ok and db1 critical", batch.Hosts)
+	}
+}
+
+func TestServerAnthropic(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	post := func() *http.Response {
+		body := `{"model":"claude-fake","max_tokens":1024,"system":"you are a kernel expert",` +
+			`"messages":[{"role":"user","content":[{"type":"text","text":"EDAC MC0: 1 UE"}]}]}`
+		resp, err := http.Post(ts.URL+"/v1/messages", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post()
+	var apiErr struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	resp.Body.Close()
+	if resp.StatusCode != 503 || apiErr.Type != "error" || apiErr.Error.Type != "overloaded_error" {
+		t.Errorf("scripted 503 = %d %+v, want an Anthropic overloaded_error", resp.StatusCode, apiErr)
+	}
+
+	resp = post()
+	defer resp.Body.Close()
+	var msg struct {
+		Type    string `json:"type"`
+		Model   string `json:"model"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	json.NewDecoder(resp.Body).Decode(&msg)
+	if msg.Type != "message" || msg.Model != "claude-fake" || len(msg.Content) != 1 || !strings.Contains(msg.Content[0].Text, `"critical"`) {
+		t.Errorf("message = %+v, want a critical analysis in an Anthropic message", msg)
+	}
+	if got := s.Requests()["anthropic"]; got != 2 {
+		t.Errorf("anthropic requests = %d, want 2", got)
+	}
+}
+
+func TestLoadRulesRejectsBadRegexp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	os.WriteFile(path, []byte("rules:\n  - match: \"(\"\n"), 0644)
+	if _, err := LoadRules(path); err == nil {
+		t.Error("expected error for an invalid regexp")
+	}
+}
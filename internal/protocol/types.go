@@ -1,32 +1,247 @@
 // internal/protocol/types.go
 package protocol
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 // DmesgDelta is sent from agent to collector
 type DmesgDelta struct {
-	Hostname  string    `json:"hostname"`
+	Hostname  string          `json:"hostname"`
+	Timestamp time.Time       `json:"timestamp"`
+	Source    string          `json:"source,omitempty"` // agent source the records came from, e.g. "kmsg" or "file:/var/log/kern.log"
+	Records   []Record        `json:"records,omitempty"`
+	Metrics   []Metric        `json:"metrics,omitempty"` // hardware counters sampled alongside the log
+	Smart     []SmartSnapshot `json:"smart,omitempty"`   // drive health, sent every smart_interval
+	// Lines is the pre-structured wire format: bare `dmesg -T` text. Current
+	// agents send Records; the collector still accepts Lines so a fleet can
+	// be upgraded host by host.
+	Lines []string `json:"lines,omitempty"`
+}
+
+// PromptLines returns the delta as text lines for the LLM and raw_dmesg
+// storage. Structured records win when present; otherwise the legacy Lines
+// pass through untouched.
+func (d DmesgDelta) PromptLines() []string {
+	if len(d.Records) == 0 {
+		return d.Lines
+	}
+	lines := make([]string, len(d.Records))
+	for i, r := range d.Records {
+		lines[i] = r.String()
+	}
+	return lines
+}
+
+// Record is one kernel log entry with its syslog priority preserved.
+// Level and Facility use the numeric syslog values (RFC 5424 section 6.2.1):
+// level 0 is emerg, 7 is debug; facility 0 is kern.
+type Record struct {
 	Timestamp time.Time `json:"timestamp"`
-	Lines     []string  `json:"lines"`
+	Level     int       `json:"level"`
+	Facility  int       `json:"facility"`
+	Subsystem string    `json:"subsystem,omitempty"` // SUBSYSTEM= tag from /dev/kmsg, e.g. "pci"
+	Device    string    `json:"device,omitempty"`    // DEVICE= tag from /dev/kmsg, e.g. "+pci:0000:00:1c.0"
+	Message   string    `json:"message"`
+}
+
+// String renders the record as one prompt line:
+//
+//	[2026-02-03T12:25:01Z] kern.err (pci +pci:0000:00:1c.0) AER: Corrected error
+//
+// The facility.level prefix is what lets the LLM tell a KERN_DEBUG line
+// from a KERN_EMERG one.
+func (r Record) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s.%s ", r.Timestamp.Format(time.RFC3339), FacilityName(r.Facility), LevelName(r.Level))
+	if r.Subsystem != "" || r.Device != "" {
+		sb.WriteString("(")
+		sb.WriteString(strings.TrimSpace(r.Subsystem + " " + r.Device))
+		sb.WriteString(") ")
+	}
+	sb.WriteString(r.Message)
+	return sb.String()
+}
+
+// Syslog severity levels, most severe first.
+const (
+	LevelEmerg = iota
+	LevelAlert
+	LevelCrit
+	LevelErr
+	LevelWarning
+	LevelNotice
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// LevelName returns the syslog keyword for a level ("err", "warning", ...).
+// Out-of-range values render as their number so nothing is silently dropped.
+func LevelName(level int) string {
+	if level < 0 || level >= len(levelNames) {
+		return fmt.Sprintf("level%d", level)
+	}
+	return levelNames[level]
+}
+
+// ParseLevel accepts a syslog level keyword as used by dmesg(1) and
+// syslog.conf ("warn" and "error" are accepted as aliases).
+func ParseLevel(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "warn":
+		return LevelWarning, nil
+	case "error":
+		return LevelErr, nil
+	}
+	for i, name := range levelNames {
+		if s == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "res0", "res1", "res2", "res3",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// FacilityName returns the syslog keyword for a facility ("kern", "daemon", ...).
+func FacilityName(facility int) string {
+	if facility < 0 || facility >= len(facilityNames) {
+		return fmt.Sprintf("facility%d", facility)
+	}
+	return facilityNames[facility]
+}
+
+// ParseFacility is the inverse of FacilityName.
+func ParseFacility(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range facilityNames {
+		if s == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown facility %q", s)
+}
+
+// Metric kinds. Counters only ever increase (until a reboot resets them),
+// so the collector diffs consecutive samples; gauges are stored as-is.
+const (
+	MetricCounter = "counter"
+	MetricGauge   = "gauge"
+)
+
+// Metric is one hardware health sample read from sysfs, e.g. an EDAC
+// corrected-error count for a DIMM or a PCIe AER total for a device.
+// Name plus Labels identify the series.
+type Metric struct {
+	Name   string            `json:"name"` // e.g. "edac_ce_count"
+	Kind   string            `json:"kind"` // MetricCounter or MetricGauge
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// SeriesKey renders Name{k=v,...} with labels sorted, so the same series
+// always produces the same key regardless of map iteration order.
+func (m Metric) SeriesKey() string {
+	if len(m.Labels) == 0 {
+		return m.Name
+	}
+	keys := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(m.Name)
+	sb.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, "%s=%q", k, m.Labels[k])
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// Drive protocols a SmartSnapshot can come from.
+const (
+	SmartNVMe = "nvme"
+	SmartATA  = "ata"
+)
+
+// SmartSnapshot is one drive's health as read from its SMART/health log.
+// NVMe drives fill the health-log fields; ATA drives fill Attributes. The
+// serial number identifies the drive across reboots and device renames.
+type SmartSnapshot struct {
+	Device   string `json:"device"` // e.g. "/dev/nvme0", "/dev/sda"
+	Protocol string `json:"protocol"`
+	Serial   string `json:"serial"`
+	Model    string `json:"model,omitempty"`
+
+	// NVMe SMART / Health Information log page (LID 02h).
+	CriticalWarning         int    `json:"critical_warning"` // bitmask, see NVMe base spec Figure 207
+	TemperatureCelsius      int    `json:"temperature_celsius,omitempty"`
+	AvailableSpare          int    `json:"available_spare,omitempty"`           // percent
+	AvailableSpareThreshold int    `json:"available_spare_threshold,omitempty"` // percent
+	PercentageUsed          int    `json:"percentage_used,omitempty"`           // may exceed 100
+	MediaErrors             uint64 `json:"media_errors,omitempty"`
+	PowerOnHours            uint64 `json:"power_on_hours,omitempty"`
+	UnsafeShutdowns         uint64 `json:"unsafe_shutdowns,omitempty"`
+
+	// ATA SMART attributes (READ DATA joined with READ THRESHOLDS).
+	Attributes []SmartAttribute `json:"attributes,omitempty"`
+}
+
+// SmartAttribute is one ATA SMART attribute. Value/Worst/Threshold are the
+// vendor-normalized 1..253 scores; the drive is failing that attribute when
+// Value <= Threshold and Threshold is non-zero.
+type SmartAttribute struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name,omitempty"`
+	Value     int    `json:"value"`
+	Worst     int    `json:"worst"`
+	Threshold int    `json:"threshold"`
+	Raw       uint64 `json:"raw"`
 }
 
 // Issue represents a single detected anomaly
 type Issue struct {
 	Summary  string `json:"summary"`
 	Evidence string `json:"evidence"`
+	Category string `json:"category,omitempty"` // memory, storage, network, thermal, driver or other
 }
 
 // AnalysisResult is the LLM response
 type AnalysisResult struct {
-	Status string  `json:"status"` // "ok", "warning", "critical"
-	Issues []Issue `json:"issues"`
+	Status     string  `json:"status"`               // "ok", "warning", "critical"
+	Confidence float64 `json:"confidence,omitempty"` // 0..1, the model's own estimate
+	Issues     []Issue `json:"issues"`
+}
+
+// Verdict is one model's answer in a consensus check.
+type Verdict struct {
+	Model      string  `json:"model"`
+	Status     string  `json:"status,omitempty"` // empty when the model failed to answer
+	Confidence float64 `json:"confidence,omitempty"`
+	Error      string  `json:"error,omitempty"` // error class when it failed, e.g. "rate_limited"
 }
 
-// StoredResult is what we persist to SQLite
+// StoredResult is what we persist to the collector database
 type StoredResult struct {
 	ID           int64     `json:"id"`
 	Timestamp    time.Time `json:"timestamp"`
 	Hostname     string    `json:"hostname"`
+	Source       string    `json:"source,omitempty"` // agent source tag from the delta; empty for pre-Source agents
 	Status       string    `json:"status"`
 	Issues       []Issue   `json:"issues"`
 	RawDmesg     string    `json:"raw_dmesg"`
@@ -34,7 +249,49 @@ type StoredResult struct {
 	// Provider is the upstream that served the request (e.g. "Google",
 	// "Amazon Bedrock"). Empty for endpoints that don't expose it. OpenRouter
 	// returns this so we can see when the fallback chain swaps providers.
-	Provider  string    `json:"provider,omitempty"`
-	Model     string    `json:"model,omitempty"` // resolved model id from the upstream response
+	Provider   string    `json:"provider,omitempty"`
+	Model      string    `json:"model,omitempty"`       // resolved model id from the upstream response
+	ErrorClass string    `json:"error_class,omitempty"` // why the LLM call failed on error/llm_unavailable rows, e.g. "auth"
+	Verdicts   []Verdict `json:"verdicts,omitempty"`    // each model's answer when a consensus check ran, primary first
+	Suppressed []Issue   `json:"suppressed,omitempty"`  // issues dropped by operator suppression rules
+	Silenced   bool      `json:"silenced,omitempty"`    // a silence matched; kept out of digest severity and alerts
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Label verdicts: an operator's judgement of a flagged result or issue.
+const (
+	LabelTruePositive  = "true_positive"
+	LabelFalsePositive = "false_positive"
+	LabelWrongSeverity = "wrong_severity" // real, but Severity is the right status
+)
+
+// Label records an operator's judgement of a stored result, or of one of
+// its issues.
+type Label struct {
+	ID        int64     `json:"id"`
+	ResultID  int64     `json:"result_id"`
+	Issue     *int      `json:"issue,omitempty"` // index into the result's issues; nil labels the whole result
+	Verdict   string    `json:"verdict"`
+	Severity  string    `json:"severity,omitempty"` // the right status, for wrong_severity
+	Note      string    `json:"note,omitempty"`
+	Author    string    `json:"author,omitempty"`
+	Hostname  string    `json:"hostname"` // of the labelled result
+	Issues    []Issue   `json:"issues"`   // the labelled issues, as they were when labelled
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Silence mutes results during planned work (burn-in, firmware upgrades,
+// DIMM swaps) between StartsAt and EndsAt. A result is silenced when its
+// host matches Hostname and every issue matches Category and Summary;
+// empty matchers match anything, but at least one must be set.
+type Silence struct {
+	ID        int64     `json:"id"`
+	Hostname  string    `json:"hostname,omitempty"` // glob, e.g. "db-*"
+	Category  string    `json:"category,omitempty"` // issue category, e.g. "memory"
+	Summary   string    `json:"summary,omitempty"`  // regexp matched against issue summaries
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Reason    string    `json:"reason"`
+	Author    string    `json:"author,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
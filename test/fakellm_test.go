@@ -0,0 +1,142 @@
+// test/fakellm_test.go
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/signalnine/tasseograph/internal/collector"
+	"github.com/signalnine/tasseograph/internal/config"
+	"github.com/signalnine/tasseograph/internal/fakellm"
+	"github.com/signalnine/tasseograph/internal/protocol"
+)
+
+// TestIntegrationFallbackPaths drives the collector's LLM fallback chain
+// against fake LLMs, one scenario per way an endpoint can fail.
+func TestIntegrationFallbackPaths(t *testing.T) {
+	edac := &fakellm.Rule{Match: "EDAC", Reply: fakellm.Reply{
+		Status: "critical",
+		Issues: []protocol.Issue{{Summary: "Uncorrected memory error", Evidence: "EDAC MC0: 1 UE"}},
+	}}
+	tests := []struct {
+		name           string
+		primary        fakellm.Rules
+		wantStatus     string
+		wantModel      string
+		wantErrorClass string
+	}{
+		{
+			name:       "primary down",
+			primary:    fakellm.Rules{Default: fakellm.Reply{Error: 503}},
+			wantStatus: "critical",
+			wantModel:  "secondary",
+		},
+		{
+			name:       "primary rate limited",
+			primary:    fakellm.Rules{Default: fakellm.Reply{Error: 429, RetryAfter: 120}},
+			wantStatus: "critical",
+			wantModel:  "secondary",
+		},
+		{
+			name:       "primary too slow",
+			primary:    fakellm.Rules{Default: fakellm.Reply{Latency: 2 * time.Second}},
+			wantStatus: "critical",
+			wantModel:  "secondary",
+		},
+		{
+			name:       "fenced reply",
+			primary:    fakellm.Rules{Rules: []*fakellm.Rule{{Match: "EDAC", Reply: fakellm.Reply{Status: "warning", Fence: true}}}},
+			wantStatus: "warning",
+			wantModel:  "primary",
+		},
+		{
+			name:           "malformed reply",
+			primary:        fakellm.Rules{Default: fakellm.Reply{Malformed: true}},
+			wantStatus:     "error",
+			wantErrorClass: "parse",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary, err := fakellm.New(&tt.primary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			primaryServer := httptest.NewServer(primary)
+			defer primaryServer.Close()
+			secondary, err := fakellm.New(&fakellm.Rules{Rules: []*fakellm.Rule{edac}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			secondaryServer := httptest.NewServer(secondary)
+			defer secondaryServer.Close()
+
+			dir := t.TempDir()
+			certFile, keyFile := generateTestCert(t, dir)
+			dbPath := filepath.Join(dir, "test.db")
+			cfg := &config.CollectorConfig{
+				ListenAddr:       "127.0.0.1:0",
+				DBPath:           dbPath,
+				MaxPayloadBytes:  1 << 20,
+				TLSCert:          certFile,
+				TLSKey:           keyFile,
+				APIKey:           "test-api-key",
+				BreakerThreshold: 5,
+				BreakerCooldown:  30 * time.Second,
+				LLMEndpoints: []config.LLMEndpoint{
+					{URL: primaryServer.URL, Model: "primary", Timeout: 500 * time.Millisecond},
+					{URL: secondaryServer.URL, Model: "secondary"},
+				},
+			}
+			srv, err := collector.NewServer(cfg)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			addr, err := srv.RunAndGetAddr(ctx)
+			if err != nil {
+				t.Fatalf("RunAndGetAddr: %v", err)
+			}
+
+			body, _ := json.Marshal(protocol.DmesgDelta{
+				Hostname:  "fallback-host",
+				Timestamp: time.Now(),
+				Lines:     []string{"[Mon Feb 3 12:00:00 2026] EDAC MC0: 1 UE memory error"},
+			})
+			req, _ := http.NewRequest("POST", "https://"+addr+"/ingest", bytes.NewReader(body))
+			req.Header.Set("Authorization", "Bearer test-api-key")
+			client := &http.Client{
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+				Timeout:   10 * time.Second,
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("POST /ingest: %v", err)
+			}
+			resp.Body.Close()
+
+			db, err := collector.NewDB(dbPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			rows, err := db.QueryByHostname("fallback-host", 10)
+			if err != nil || len(rows) != 1 {
+				t.Fatalf("rows = %d, err = %v, want 1", len(rows), err)
+			}
+			row := rows[0]
+			if row.Status != tt.wantStatus || row.Model != tt.wantModel || row.ErrorClass != tt.wantErrorClass {
+				t.Errorf("row = %s/%s/%q, want %s/%s/%q",
+					row.Status, row.Model, row.ErrorClass, tt.wantStatus, tt.wantModel, tt.wantErrorClass)
+			}
+		})
+	}
+}